@@ -1,41 +1,273 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"fmt"
+	"github.com/antoniobelotti/splid_backend_clone/internal/account"
+	"github.com/antoniobelotti/splid_backend_clone/internal/attachment"
+	"github.com/antoniobelotti/splid_backend_clone/internal/buildinfo"
+	"github.com/antoniobelotti/splid_backend_clone/internal/config"
+	"github.com/antoniobelotti/splid_backend_clone/internal/event"
 	"github.com/antoniobelotti/splid_backend_clone/internal/expense"
 	"github.com/antoniobelotti/splid_backend_clone/internal/group"
+	"github.com/antoniobelotti/splid_backend_clone/internal/grpc"
+	"github.com/antoniobelotti/splid_backend_clone/internal/health"
 	"github.com/antoniobelotti/splid_backend_clone/internal/http"
+	"github.com/antoniobelotti/splid_backend_clone/internal/http/authentication"
+	"github.com/antoniobelotti/splid_backend_clone/internal/logging"
+	"github.com/antoniobelotti/splid_backend_clone/internal/mailer"
+	"github.com/antoniobelotti/splid_backend_clone/internal/metrics"
 	"github.com/antoniobelotti/splid_backend_clone/internal/person"
 	"github.com/antoniobelotti/splid_backend_clone/internal/postgresdb"
+	"github.com/antoniobelotti/splid_backend_clone/internal/recurring"
+	"github.com/antoniobelotti/splid_backend_clone/internal/tracing"
 	"github.com/antoniobelotti/splid_backend_clone/internal/transfer"
+	"github.com/antoniobelotti/splid_backend_clone/migrations"
+	"log/slog"
 	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
 )
 
-func Run() error {
-	db, err := postgresdb.NewDatabase("")
+// newBlobStore returns the blob store selected by the configuration: local (default) or s3
+func newBlobStore(cfg config.Attachments) (attachment.BlobStore, error) {
+	if cfg.Storage == "s3" {
+		return attachment.NewS3BlobStore(attachment.S3Config{
+			Endpoint:  cfg.S3.Endpoint,
+			Region:    cfg.S3.Region,
+			Bucket:    cfg.S3.Bucket,
+			AccessKey: cfg.S3.AccessKey,
+			SecretKey: cfg.S3.SecretKey,
+		}), nil
+	}
+	return attachment.NewLocalBlobStore(cfg.LocalDir)
+}
+
+// newMailer returns the mailer selected by the configuration: file (default) writes the emails to a directory, smtp
+// sends them through a relay
+func newMailer(cfg config.Mailer) (mailer.Mailer, error) {
+	if cfg.Kind == "smtp" {
+		return mailer.NewSMTPMailer(mailer.SMTPConfig{
+			Addr:     cfg.SMTP.Addr,
+			Username: cfg.SMTP.Username,
+			Password: cfg.SMTP.Password,
+			From:     cfg.SMTP.From,
+		}), nil
+	}
+	return mailer.NewFileMailer(cfg.Dir)
+}
+
+// newKeyManager loads the jwt signing keys of the keys directory. Without one a throwaway key is generated: every
+// restart invalidates the access tokens, refresh tokens keep working.
+func newKeyManager(cfg config.Auth) (*authentication.KeyManager, error) {
+	if cfg.JwtKeysDir == "" {
+		slog.Warn("no jwt keys directory: signing access tokens with an ephemeral key")
+		return authentication.NewEphemeralKeyManager()
+	}
+	return authentication.LoadKeyManager(cfg.JwtKeysDir, cfg.JwtActiveKeyId)
+}
+
+// newAttemptTracker returns the login attempt tracker selected by the configuration: postgres (default), which is
+// shared by every instance and keeps an audit trail, or memory
+func newAttemptTracker(cfg config.Auth, db *postgresdb.PostgresDatabase) authentication.AttemptTracker {
+	if cfg.LoginAttemptTracker == "memory" {
+		return authentication.NewInMemoryAttemptTracker(authentication.DefaultLoginGuardConfig().Window)
+	}
+	return db
+}
+
+// newOidc configures the identity providers. The url to register with a provider is
+// <app base url>/api/v1/auth/oidc/<name>/callback.
+func newOidc(cfg config.Config, db *postgresdb.PostgresDatabase) (*authentication.Oidc, error) {
+	if len(cfg.Auth.OidcProviders) == 0 {
+		return nil, nil
+	}
+
+	var configs []authentication.OidcProviderConfig
+	for _, p := range cfg.Auth.OidcProviders {
+		configs = append(configs, authentication.OidcProviderConfig{
+			Name:         p.Name,
+			IssuerUrl:    p.IssuerUrl,
+			ClientId:     p.ClientId,
+			ClientSecret: p.ClientSecret,
+			Scopes:       p.Scopes,
+			RedirectUrl:  strings.TrimSuffix(cfg.AppBaseUrl, "/") + "/api/v1/auth/oidc/" + p.Name + "/callback",
+		})
+	}
+	return authentication.NewOidc(context.Background(), db, configs...)
+}
+
+// Run serves until SIGINT or SIGTERM, or until a server fails. Then it drains the requests in flight for at most
+// the shutdown timeout, stops the background workers and closes the database.
+func Run(cfg config.Config) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// the spans of the last requests are flushed after everything else is stopped
+	shutdownTracing, err := tracing.Setup(ctx, tracing.Config{
+		Exporter:       cfg.Tracing.Exporter,
+		ServiceVersion: buildinfo.Get().Commit,
+	})
 	if err != nil {
 		return err
 	}
-	fmt.Println("successfully connected to db")
+	defer func() {
+		flushCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(flushCtx); err != nil {
+			slog.Error("unable to flush the spans", "error", err)
+		}
+	}()
+
+	db, err := postgresdb.NewDatabase(cfg.Database.ConnectionString())
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := db.Close(); err != nil {
+			slog.Error("unable to close the database", "error", err)
+		}
+	}()
+	slog.Info("connected to the database")
+
+	serverMetrics := metrics.New()
+	serverMetrics.RegisterDB(db.DB.DB, "postgres")
 
-	ps := person.NewService(db)
+	m, err := newMailer(cfg.Mailer)
+	if err != nil {
+		return err
+	}
+	// validated by config.Load
+	policy, _ := person.ParseUnverifiedPolicy(strings.Join(cfg.UnverifiedAccountRestrictions, ","))
+	ps := person.NewService(db, m, cfg.AppBaseUrl).WithUnverifiedPolicy(policy)
 	es := expense.NewService(db)
 	ts := transfer.NewService(db)
-	gs := group.NewService(db, es, ts)
+	gs := group.NewService(db, es, ts).WithObserver(serverMetrics)
+	rs := recurring.NewService(db, es)
+
+	blobStore, err := newBlobStore(cfg.Attachments)
+	if err != nil {
+		return err
+	}
+	as := attachment.NewService(db, blobStore, es)
 
-	restServer := http.NewRESTServer(ps, gs, es, ts)
-	err = restServer.Run(":" + os.Getenv("HTTP_PORT"))
+	keys, err := newKeyManager(cfg.Auth)
+	if err != nil {
+		return err
+	}
+	guard := authentication.NewLoginGuard(newAttemptTracker(cfg.Auth, db), cfg.Auth.LoginGuardConfig())
+	auth := authentication.NewService(db, keys, guard)
+	oidc, err := newOidc(cfg, db)
 	if err != nil {
 		return err
 	}
+	auth = auth.WithOidc(oidc)
+
+	ac := account.NewService(db, blobStore)
 
-	return nil
+	dispatcher := event.NewDispatcher(db, event.DefaultPollInterval)
+	dispatcher.Subscribe(event.ExpenseDeleted, "attachment-cleanup", as.HandleExpenseDeleted)
+	hub := event.NewHub()
+	for _, t := range event.GroupEventTypes {
+		dispatcher.Subscribe(t, "grpc-hub", hub.Publish)
+	}
+	for _, t := range metrics.EventTypes {
+		dispatcher.Subscribe(t, "metrics", serverMetrics.HandleEvent)
+	}
+	scheduler := recurring.NewScheduler(rs, recurring.DefaultSchedulerInterval)
+
+	// the workers outlive the servers, so that what the last requests did is still dispatched
+	workersCtx, stopWorkers := context.WithCancel(context.Background())
+	var workers sync.WaitGroup
+	workers.Add(3)
+	go func() {
+		defer workers.Done()
+		dispatcher.Run(workersCtx)
+	}()
+	go func() {
+		defer workers.Done()
+		scheduler.Run(workersCtx)
+	}()
+	go func() {
+		defer workers.Done()
+		guard.RunPruning(workersCtx)
+	}()
+	defer func() {
+		stopWorkers()
+		workers.Wait()
+	}()
+
+	checker := health.NewChecker(health.DefaultCheckTimeout)
+	checker.Register("database", db.PingContext)
+	checker.Register("schema-version", db.CheckSchemaVersion(migrations.LatestVersion()))
+	checker.Register("event-dispatcher", dispatcher.CheckRunning)
+	checker.Register("recurring-scheduler", scheduler.CheckRunning)
+
+	httpServer := http.NewRESTServer(http.Dependencies{
+		Person:     ps,
+		Group:      gs,
+		Expense:    es,
+		Transfer:   ts,
+		Recurring:  rs,
+		Attachment: as,
+		Account:    ac,
+		Auth:       auth,
+		Checker:    checker,
+		Metrics:    serverMetrics,
+		Config:     cfg.HTTP.ServerConfig(),
+	}).NewServer(":" + strconv.Itoa(cfg.HTTP.Port))
+	grpcServer := grpc.NewGRPCServer(ps, gs, es, ts, auth, hub)
+
+	errs := make(chan error, 2)
+	go func() {
+		errs <- httpServer.Run()
+	}()
+	go func() {
+		errs <- grpcServer.Run(":" + strconv.Itoa(cfg.GRPC.Port))
+	}()
+
+	var runErr error
+	select {
+	case <-ctx.Done():
+		slog.Info("shutting down")
+	case runErr = <-errs:
+	}
+	// a second signal kills the process right away
+	stop()
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	// streams of group events would otherwise keep the gRPC server up until the timeout
+	hub.Close()
+	shutdownErrs := make(chan error, 2)
+	go func() {
+		shutdownErrs <- httpServer.Shutdown(shutdownCtx)
+	}()
+	go func() {
+		shutdownErrs <- grpcServer.Shutdown(shutdownCtx)
+	}()
+	return errors.Join(runErr, <-shutdownErrs, <-shutdownErrs)
 }
 
 func main() {
-	fmt.Println("main running")
-	err := Run()
+	cfg, err := config.Load(os.Args[1:], os.Environ())
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	}
 	if err != nil {
-		fmt.Println(err)
+		fmt.Fprintf(os.Stderr, "invalid configuration:\n%v\n", err)
+		os.Exit(2)
+	}
+	slog.SetDefault(logging.New(os.Stdout, cfg.Log.SlogLevel()))
+
+	if err = Run(cfg); err != nil {
+		slog.Error("server stopped", "error", err)
+		os.Exit(1)
 	}
 }
@@ -0,0 +1,182 @@
+//go:build integration
+
+package event_test
+
+import (
+	"context"
+	"errors"
+	"github.com/antoniobelotti/splid_backend_clone/integration_tests"
+	"github.com/antoniobelotti/splid_backend_clone/internal/event"
+	"github.com/antoniobelotti/splid_backend_clone/internal/expense"
+	"github.com/antoniobelotti/splid_backend_clone/internal/group"
+	"github.com/antoniobelotti/splid_backend_clone/internal/mailer"
+	"github.com/antoniobelotti/splid_backend_clone/internal/person"
+	"github.com/antoniobelotti/splid_backend_clone/internal/postgresdb"
+	"github.com/antoniobelotti/splid_backend_clone/internal/transfer"
+	"github.com/stretchr/testify/suite"
+	psqlcont "github.com/testcontainers/testcontainers-go/modules/postgres"
+	"sync"
+	"testing"
+	"time"
+)
+
+type EventTestSuite struct {
+	suite.Suite
+	psqlContainer  *psqlcont.PostgresContainer
+	db             *postgresdb.PostgresDatabase
+	personService  person.Service
+	groupService   group.Service
+	expenseService expense.Service
+}
+
+func (suite *EventTestSuite) SetupTest() {
+	db, cont := integration_tests.GetCleanContainerizedPsqlDb()
+	suite.psqlContainer = cont
+	suite.db = db
+	suite.personService = person.NewService(db, mailer.NewInMemoryMailer(), "")
+	suite.expenseService = expense.NewService(db)
+	suite.groupService = group.NewService(db, suite.expenseService, transfer.NewService(db))
+}
+
+func (suite *EventTestSuite) TearDownTest() {
+	_ = suite.psqlContainer.Terminate(context.Background())
+}
+
+func TestEventTestSuite(t *testing.T) {
+	suite.Run(t, new(EventTestSuite))
+}
+
+func (suite *EventTestSuite) TestCreateExpenseWritesOutboxEvent() {
+	c := context.Background()
+	p, err := suite.personService.CreatePerson(c, "person", "email@email.com", "testtest123")
+	suite.Require().NoError(err)
+	g, err := suite.groupService.CreateGroup(c, "testgroup", p.Id)
+	suite.Require().NoError(err)
+	e, err := suite.expenseService.CreateExpense(c, 42, p.Id, g.Id)
+	suite.Require().NoError(err)
+
+	events, err := suite.db.ClaimPendingEvents(c, 10, time.Minute)
+	suite.Require().NoError(err)
+	suite.Require().Len(events, 2)
+	suite.Assert().Equal(event.GroupCreated, events[0].Type)
+	suite.Assert().Equal(event.ExpenseCreated, events[1].Type)
+
+	var payload expense.Expense
+	suite.Require().NoError(events[1].Decode(&payload))
+	suite.Assert().Equal(e, payload)
+}
+
+func (suite *EventTestSuite) TestFailedWriteDoesNotEmitEvent() {
+	c := context.Background()
+	p, err := suite.personService.CreatePerson(c, "person", "email@email.com", "testtest123")
+	suite.Require().NoError(err)
+
+	// group does not exist: the foreign key makes the insert fail
+	_, err = suite.db.CreateExpense(c, expense.Expense{AmountInCents: 42, PersonId: p.Id, GroupId: 999}, "")
+	suite.Require().Error(err)
+
+	events, err := suite.db.ClaimPendingEvents(c, 10, time.Minute)
+	suite.Require().NoError(err)
+	suite.Assert().Empty(events)
+}
+
+func (suite *EventTestSuite) TestDispatcherRelaysAndRetries() {
+	c := context.Background()
+	p1, err := suite.personService.CreatePerson(c, "person 1", "email@email.com", "testtest123")
+	suite.Require().NoError(err)
+	p2, err := suite.personService.CreatePerson(c, "person 2", "email2@email.com", "testtest123")
+	suite.Require().NoError(err)
+	g, err := suite.groupService.CreateGroup(c, "testgroup", p1.Id)
+	suite.Require().NoError(err)
+	suite.Require().NoError(suite.groupService.AddPersonToGroup(c, g, p2.Id))
+
+	dispatcher := event.NewDispatcher(suite.db, 0)
+	var joined []event.MemberJoinedPayload
+	failOnce := true
+	dispatcher.Subscribe(event.MemberJoined, "test", func(_ context.Context, e event.Event) error {
+		if failOnce {
+			failOnce = false
+			return errors.New("temporary failure")
+		}
+		var payload event.MemberJoinedPayload
+		if err := e.Decode(&payload); err != nil {
+			return err
+		}
+		joined = append(joined, payload)
+		return nil
+	})
+
+	delivered, err := dispatcher.DispatchPending(c)
+	suite.Require().NoError(err)
+	suite.Assert().Equal(1, delivered, "only GroupCreated is delivered on the first pass")
+
+	delivered, err = dispatcher.DispatchPending(c)
+	suite.Require().NoError(err)
+	suite.Assert().Equal(1, delivered)
+	suite.Assert().Equal([]event.MemberJoinedPayload{{GroupId: g.Id, PersonId: p2.Id}}, joined)
+
+	events, err := suite.db.ClaimPendingEvents(c, 10, time.Minute)
+	suite.Require().NoError(err)
+	suite.Assert().Empty(events)
+}
+
+func (suite *EventTestSuite) TestConcurrentClaimsAreDisjoint() {
+	c := context.Background()
+	p, err := suite.personService.CreatePerson(c, "person", "email@email.com", "testtest123")
+	suite.Require().NoError(err)
+	for i := 0; i < 20; i++ {
+		_, err = suite.groupService.CreateGroup(c, "testgroup", p.Id)
+		suite.Require().NoError(err)
+	}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	claimed := map[int]int{}
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			events, err := suite.db.ClaimPendingEvents(c, 5, time.Minute)
+			suite.Assert().NoError(err)
+			mu.Lock()
+			defer mu.Unlock()
+			for _, e := range events {
+				claimed[e.Id]++
+			}
+		}()
+	}
+	wg.Wait()
+
+	suite.Assert().Len(claimed, 20)
+	for id, times := range claimed {
+		suite.Assert().Equal(1, times, "event %d claimed more than once", id)
+	}
+}
+
+func (suite *EventTestSuite) TestRetryCallsOnlyFailedHandlers() {
+	c := context.Background()
+	p, err := suite.personService.CreatePerson(c, "person", "email@email.com", "testtest123")
+	suite.Require().NoError(err)
+	_, err = suite.groupService.CreateGroup(c, "testgroup", p.Id)
+	suite.Require().NoError(err)
+
+	dispatcher := event.NewDispatcher(suite.db, 0)
+	calls := map[string]int{}
+	dispatcher.Subscribe(event.GroupCreated, "counter", func(context.Context, event.Event) error {
+		calls["counter"]++
+		return nil
+	})
+	dispatcher.Subscribe(event.GroupCreated, "flaky", func(context.Context, event.Event) error {
+		calls["flaky"]++
+		if calls["flaky"] == 1 {
+			return errors.New("temporary failure")
+		}
+		return nil
+	})
+
+	for i := 0; i < 2; i++ {
+		_, err = dispatcher.DispatchPending(c)
+		suite.Require().NoError(err)
+	}
+	suite.Assert().Equal(map[string]int{"counter": 1, "flaky": 2}, calls)
+}
@@ -7,6 +7,7 @@ import (
 	"github.com/antoniobelotti/splid_backend_clone/integration_tests"
 	"github.com/antoniobelotti/splid_backend_clone/internal/expense"
 	"github.com/antoniobelotti/splid_backend_clone/internal/group"
+	"github.com/antoniobelotti/splid_backend_clone/internal/mailer"
 	"github.com/antoniobelotti/splid_backend_clone/internal/person"
 	"github.com/antoniobelotti/splid_backend_clone/internal/transfer"
 	"github.com/stretchr/testify/suite"
@@ -26,7 +27,7 @@ func (suite *ExpenseTestSuite) SetupTest() {
 	db, cont := integration_tests.GetCleanContainerizedPsqlDb()
 	suite.psqlContainer = cont
 	suite.expenseService = expense.NewService(db)
-	suite.personService = person.NewService(db)
+	suite.personService = person.NewService(db, mailer.NewInMemoryMailer(), "")
 	suite.groupService = group.NewService(db, suite.expenseService, transfer.NewService(db))
 }
 
@@ -67,3 +68,158 @@ func (suite *ExpenseTestSuite) TestCreateExpenseFail() {
 	suite.Require().NotNil(err)
 	suite.Require().Empty(e)
 }
+
+func (suite *ExpenseTestSuite) TestCreateExpenseFailIfAmountIsNotPositive() {
+	p, err := suite.personService.CreatePerson(context.Background(), "person", "email@email.com", "testtest123")
+	suite.Require().NoError(err)
+
+	g, err := suite.groupService.CreateGroup(context.Background(), "testgroup", p.Id)
+	suite.Require().NoError(err)
+
+	for _, amount := range []int{0, -100} {
+		_, err = suite.expenseService.CreateExpense(context.Background(), amount, p.Id, g.Id)
+		suite.ErrorIs(err, expense.ErrInvalidAmount)
+	}
+}
+
+func (suite *ExpenseTestSuite) TestCreateExpenseWithIdempotencyKeyCreatesOnce() {
+	p, err := suite.personService.CreatePerson(context.Background(), "person", "email@email.com", "testtest123")
+	suite.Require().NoError(err)
+
+	g, err := suite.groupService.CreateGroup(context.Background(), "testgroup", p.Id)
+	suite.Require().NoError(err)
+
+	ctx := expense.WithIdempotencyKey(context.Background(), "rent-january")
+	first, err := suite.expenseService.CreateExpense(ctx, 80000, p.Id, g.Id)
+	suite.Require().NoError(err)
+	second, err := suite.expenseService.CreateExpense(ctx, 80000, p.Id, g.Id)
+	suite.Require().NoError(err)
+	suite.Assert().Equal(first.Id, second.Id)
+
+	expenses, err := suite.expenseService.GetExpenseByGroupId(context.Background(), g.Id)
+	suite.Require().NoError(err)
+	suite.Assert().Len(expenses, 1)
+}
+
+func (suite *ExpenseTestSuite) TestCreateItemizedExpenseRoundTrip() {
+	c := context.Background()
+	p1, err := suite.personService.CreatePerson(c, "person", "email@email.com", "testtest123")
+	suite.Require().NoError(err)
+	p2, err := suite.personService.CreatePerson(c, "person 2", "email2@email.com", "testtest123")
+	suite.Require().NoError(err)
+
+	g, err := suite.groupService.CreateGroup(c, "testgroup", p1.Id)
+	suite.Require().NoError(err)
+	suite.Require().NoError(suite.groupService.AddPersonToGroup(c, g, p2.Id))
+
+	itemization := &expense.Itemization{
+		Items: []expense.Item{
+			{Description: "pizza", UnitPriceInCents: 1200, Quantity: 1, ConsumerIds: []int{p1.Id}},
+			{Description: "beer", UnitPriceInCents: 450, Quantity: 2, ConsumerIds: []int{p1.Id, p2.Id}},
+		},
+		TaxInCents: 100,
+		TipInCents: 200,
+		TaxRule:    expense.Proportional,
+		TipRule:    expense.Equal,
+	}
+	e, err := suite.expenseService.CreateDetailedExpense(c, expense.Expense{
+		AmountInCents: 2400,
+		PersonId:      p1.Id,
+		GroupId:       g.Id,
+		Itemization:   itemization,
+	})
+	suite.Require().NoError(err)
+
+	expenses, err := suite.expenseService.GetExpenseByGroupId(c, g.Id)
+	suite.Require().NoError(err)
+	suite.Require().Len(expenses, 1)
+	suite.Assert().Equal(e, expenses[0])
+}
+
+func (suite *ExpenseTestSuite) TestCreateItemizedExpenseFailsIfItemsDoNotReconcile() {
+	c := context.Background()
+	p, err := suite.personService.CreatePerson(c, "person", "email@email.com", "testtest123")
+	suite.Require().NoError(err)
+	g, err := suite.groupService.CreateGroup(c, "testgroup", p.Id)
+	suite.Require().NoError(err)
+
+	_, err = suite.expenseService.CreateDetailedExpense(c, expense.Expense{
+		AmountInCents: 5000,
+		PersonId:      p.Id,
+		GroupId:       g.Id,
+		Itemization: &expense.Itemization{
+			Items:   []expense.Item{{Description: "pizza", UnitPriceInCents: 1200, Quantity: 1, ConsumerIds: []int{p.Id}}},
+			TaxRule: expense.Equal,
+			TipRule: expense.Equal,
+		},
+	})
+	suite.Require().ErrorIs(err, expense.ErrInvalidItemization)
+}
+
+func (suite *ExpenseTestSuite) TestCreateExpenseWithMultiplePayers() {
+	c := context.Background()
+	p1, err := suite.personService.CreatePerson(c, "person", "email@email.com", "testtest123")
+	suite.Require().NoError(err)
+	p2, err := suite.personService.CreatePerson(c, "person 2", "email2@email.com", "testtest123")
+	suite.Require().NoError(err)
+
+	g, err := suite.groupService.CreateGroup(c, "testgroup", p1.Id)
+	suite.Require().NoError(err)
+	suite.Require().NoError(suite.groupService.AddPersonToGroup(c, g, p2.Id))
+
+	e, err := suite.expenseService.CreateDetailedExpense(c, expense.Expense{
+		AmountInCents: 1000,
+		PersonId:      p1.Id,
+		GroupId:       g.Id,
+		Payers: []expense.Payer{
+			{PersonId: p1.Id, AmountInCents: 300},
+			{PersonId: p2.Id, AmountInCents: 700},
+		},
+	})
+	suite.Require().NoError(err)
+
+	expenses, err := suite.expenseService.GetExpenseByGroupId(c, g.Id)
+	suite.Require().NoError(err)
+	suite.Require().Len(expenses, 1)
+	suite.Assert().Equal(e, expenses[0])
+
+	_, err = suite.expenseService.CreateDetailedExpense(c, expense.Expense{
+		AmountInCents: 1000,
+		PersonId:      p1.Id,
+		GroupId:       g.Id,
+		Payers: []expense.Payer{
+			{PersonId: p1.Id, AmountInCents: 300},
+			{PersonId: p2.Id, AmountInCents: 600},
+		},
+	})
+	suite.Require().ErrorIs(err, expense.ErrInvalidPayers)
+}
+
+func (suite *ExpenseTestSuite) TestDeleteExpense() {
+	c := context.Background()
+	p1, err := suite.personService.CreatePerson(c, "person", "email@email.com", "testtest123")
+	suite.Require().NoError(err)
+	p2, err := suite.personService.CreatePerson(c, "person 2", "email2@email.com", "testtest123")
+	suite.Require().NoError(err)
+
+	g, err := suite.groupService.CreateGroup(c, "testgroup", p1.Id)
+	suite.Require().NoError(err)
+	suite.Require().NoError(suite.groupService.AddPersonToGroup(c, g, p2.Id))
+
+	e, err := suite.expenseService.CreateDetailedExpense(c, expense.Expense{
+		AmountInCents: 1000,
+		PersonId:      p1.Id,
+		GroupId:       g.Id,
+		Payers:        []expense.Payer{{PersonId: p1.Id, AmountInCents: 500}, {PersonId: p2.Id, AmountInCents: 500}},
+	})
+	suite.Require().NoError(err)
+
+	err = suite.expenseService.DeleteExpense(c, e.Id, p2.Id)
+	suite.Require().ErrorIs(err, expense.ErrNotExpenseOwner)
+
+	err = suite.expenseService.DeleteExpense(c, e.Id, p1.Id)
+	suite.Require().NoError(err)
+
+	_, err = suite.expenseService.GetExpenseById(c, e.Id)
+	suite.Require().ErrorIs(err, expense.ErrExpenseNotFound)
+}
@@ -8,6 +8,7 @@ import (
 	"github.com/antoniobelotti/splid_backend_clone/integration_tests"
 	"github.com/antoniobelotti/splid_backend_clone/internal/expense"
 	"github.com/antoniobelotti/splid_backend_clone/internal/group"
+	"github.com/antoniobelotti/splid_backend_clone/internal/mailer"
 	"github.com/antoniobelotti/splid_backend_clone/internal/person"
 	"github.com/antoniobelotti/splid_backend_clone/internal/transfer"
 	"github.com/stretchr/testify/suite"
@@ -27,7 +28,7 @@ type GroupTestSuite struct {
 func (suite *GroupTestSuite) SetupTest() {
 	db, cont := integration_tests.GetCleanContainerizedPsqlDb()
 	suite.psqlContainer = cont
-	suite.personService = person.NewService(db)
+	suite.personService = person.NewService(db, mailer.NewInMemoryMailer(), "")
 	suite.expenseService = expense.NewService(db)
 	suite.transferService = transfer.NewService(db)
 	suite.groupService = group.NewService(db, suite.expenseService, suite.transferService)
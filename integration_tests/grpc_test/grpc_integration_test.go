@@ -0,0 +1,222 @@
+//go:build integration
+
+package grpc_test
+
+import (
+	"context"
+	"github.com/antoniobelotti/splid_backend_clone/integration_tests"
+	"github.com/antoniobelotti/splid_backend_clone/internal/event"
+	"github.com/antoniobelotti/splid_backend_clone/internal/expense"
+	"github.com/antoniobelotti/splid_backend_clone/internal/group"
+	internal_grpc "github.com/antoniobelotti/splid_backend_clone/internal/grpc"
+	splidv1 "github.com/antoniobelotti/splid_backend_clone/internal/grpc/gen/splid/v1"
+	"github.com/antoniobelotti/splid_backend_clone/internal/http/authentication"
+	"github.com/antoniobelotti/splid_backend_clone/internal/mailer"
+	"github.com/antoniobelotti/splid_backend_clone/internal/person"
+	"github.com/antoniobelotti/splid_backend_clone/internal/postgresdb"
+	"github.com/antoniobelotti/splid_backend_clone/internal/transfer"
+	"github.com/stretchr/testify/suite"
+	psqlcont "github.com/testcontainers/testcontainers-go/modules/postgres"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"net"
+	"testing"
+	"time"
+)
+
+type GRPCTestSuite struct {
+	suite.Suite
+	psqlContainer *psqlcont.PostgresContainer
+	db            *postgresdb.PostgresDatabase
+	dispatcher    *event.Dispatcher
+	personService person.Service
+	authService   authentication.Service
+	server        internal_grpc.GRPCServer
+	conn          *grpc.ClientConn
+
+	persons   splidv1.PersonServiceClient
+	groups    splidv1.GroupServiceClient
+	expenses  splidv1.ExpenseServiceClient
+	transfers splidv1.TransferServiceClient
+}
+
+func TestGRPCTestSuite(t *testing.T) {
+	suite.Run(t, new(GRPCTestSuite))
+}
+
+func (suite *GRPCTestSuite) SetupTest() {
+	db, cont := integration_tests.GetCleanContainerizedPsqlDb()
+	suite.psqlContainer = cont
+	suite.db = db
+
+	keys, err := authentication.NewEphemeralKeyManager()
+	suite.Require().NoError(err)
+	suite.authService = authentication.NewService(db, keys, authentication.NewLoginGuard(db, authentication.DefaultLoginGuardConfig()))
+	suite.personService = person.NewService(db, mailer.NewInMemoryMailer(), "")
+	es := expense.NewService(db)
+	ts := transfer.NewService(db)
+	gs := group.NewService(db, es, ts)
+
+	hub := event.NewHub()
+	suite.dispatcher = event.NewDispatcher(db, event.DefaultPollInterval)
+	for _, t := range event.GroupEventTypes {
+		suite.dispatcher.Subscribe(t, "grpc-hub", hub.Publish)
+	}
+
+	suite.server = internal_grpc.NewGRPCServer(suite.personService, gs, es, ts, suite.authService, hub)
+	listener := bufconn.Listen(1024 * 1024)
+	go func() {
+		_ = suite.server.Serve(listener)
+	}()
+
+	suite.conn, err = grpc.DialContext(context.Background(), "bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	suite.Require().NoError(err)
+
+	suite.persons = splidv1.NewPersonServiceClient(suite.conn)
+	suite.groups = splidv1.NewGroupServiceClient(suite.conn)
+	suite.expenses = splidv1.NewExpenseServiceClient(suite.conn)
+	suite.transfers = splidv1.NewTransferServiceClient(suite.conn)
+}
+
+func (suite *GRPCTestSuite) TearDownTest() {
+	_ = suite.conn.Close()
+	suite.server.Stop()
+	_ = suite.psqlContainer.Terminate(context.Background())
+}
+
+// signup creates a person through the api and returns a context authenticated as them
+func (suite *GRPCTestSuite) signup(name string, email string) (*splidv1.Person, context.Context) {
+	resp, err := suite.persons.Signup(context.Background(), &splidv1.SignupRequest{Name: name, Email: email, Password: "password123"})
+	suite.Require().NoError(err)
+
+	tokens, err := suite.authService.Login(context.Background(), int(resp.Person.Id))
+	suite.Require().NoError(err)
+	return resp.Person, metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer "+tokens.AccessToken)
+}
+
+func (suite *GRPCTestSuite) TestSignupAndGetMe() {
+	p, ctx := suite.signup("person", "person@mail.com")
+
+	resp, err := suite.persons.GetMe(ctx, &splidv1.GetMeRequest{})
+	suite.Require().NoError(err)
+	suite.Assert().Equal(p.Id, resp.Person.Id)
+	suite.Assert().Equal("person@mail.com", resp.Person.Email)
+	suite.Assert().Nil(resp.Person.EmailVerifiedAt)
+
+	_, err = suite.persons.Signup(context.Background(), &splidv1.SignupRequest{Name: "other", Email: "person@mail.com", Password: "password123"})
+	suite.Assert().Equal(codes.AlreadyExists, status.Code(err))
+}
+
+func (suite *GRPCTestSuite) TestRejectsInvalidTokens() {
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer not-a-jwt")
+	_, err := suite.persons.GetMe(ctx, &splidv1.GetMeRequest{})
+	suite.Assert().Equal(codes.Unauthenticated, status.Code(err))
+
+	_, err = suite.groups.CreateGroup(context.Background(), &splidv1.CreateGroupRequest{Name: "group"})
+	suite.Assert().Equal(codes.Unauthenticated, status.Code(err))
+}
+
+func (suite *GRPCTestSuite) TestGroupExpensesAndBalance() {
+	p1, ctx1 := suite.signup("person 1", "p1@mail.com")
+	p2, ctx2 := suite.signup("person 2", "p2@mail.com")
+
+	created, err := suite.groups.CreateGroup(ctx1, &splidv1.CreateGroupRequest{Name: "group"})
+	suite.Require().NoError(err)
+	g := created.Group
+
+	_, err = suite.groups.JoinGroup(ctx2, &splidv1.JoinGroupRequest{GroupId: g.Id, InvitationCode: g.InvitationCode})
+	suite.Assert().Equal(codes.PermissionDenied, status.Code(err), "the email of person 2 is not verified")
+	integration_tests.VerifyEmail(suite.db, int(p2.Id))
+
+	_, err = suite.groups.JoinGroup(ctx2, &splidv1.JoinGroupRequest{GroupId: g.Id, InvitationCode: "wrong"})
+	suite.Assert().Equal(codes.PermissionDenied, status.Code(err))
+	_, err = suite.groups.JoinGroup(ctx2, &splidv1.JoinGroupRequest{GroupId: g.Id, InvitationCode: g.InvitationCode})
+	suite.Require().NoError(err)
+
+	_, err = suite.expenses.CreateExpense(ctx1, &splidv1.CreateExpenseRequest{GroupId: g.Id, AmountInCents: 1000})
+	suite.Require().NoError(err)
+	_, err = suite.transfers.CreateTransfer(ctx2, &splidv1.CreateTransferRequest{GroupId: g.Id, ReceiverId: p1.Id, AmountInCents: 200})
+	suite.Require().NoError(err)
+
+	balance, err := suite.groups.GetBalance(ctx1, &splidv1.GetBalanceRequest{GroupId: g.Id})
+	suite.Require().NoError(err)
+	suite.Assert().Equal(map[int64]int64{p1.Id: 700, p2.Id: -700}, balance.BalanceInCents)
+
+	ops, err := suite.groups.GetOperationsToEvenBalance(ctx2, &splidv1.GetOperationsToEvenBalanceRequest{GroupId: g.Id})
+	suite.Require().NoError(err)
+	suite.Require().Len(ops.Transfers, 1)
+	suite.Assert().Equal(p2.Id, ops.Transfers[0].SenderId)
+	suite.Assert().Equal(int64(700), ops.Transfers[0].AmountInCents)
+
+	_, err = suite.groups.GetBalance(ctx1, &splidv1.GetBalanceRequest{GroupId: 999})
+	suite.Assert().Equal(codes.NotFound, status.Code(err))
+}
+
+func (suite *GRPCTestSuite) TestPersonalAccessTokenScopes() {
+	p, ctx := suite.signup("person", "person@mail.com")
+	created, err := suite.groups.CreateGroup(ctx, &splidv1.CreateGroupRequest{Name: "group"})
+	suite.Require().NoError(err)
+
+	token, _, err := suite.authService.CreatePersonalAccessToken(context.Background(), int(p.Id), "script", []authentication.Scope{authentication.ScopeRead}, nil, nil)
+	suite.Require().NoError(err)
+	patCtx := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer "+token)
+
+	_, err = suite.groups.GetBalance(patCtx, &splidv1.GetBalanceRequest{GroupId: created.Group.Id})
+	suite.Assert().NoError(err)
+
+	_, err = suite.expenses.CreateExpense(patCtx, &splidv1.CreateExpenseRequest{GroupId: created.Group.Id, AmountInCents: 1000})
+	suite.Assert().Equal(codes.PermissionDenied, status.Code(err))
+
+	_, err = suite.groups.CreateGroup(patCtx, &splidv1.CreateGroupRequest{Name: "other group"})
+	suite.Assert().Equal(codes.PermissionDenied, status.Code(err), "account management needs a password session")
+}
+
+func (suite *GRPCTestSuite) TestWatchGroupEvents() {
+	p1, ctx1 := suite.signup("person 1", "p1@mail.com")
+	_, ctx2 := suite.signup("person 2", "p2@mail.com")
+	created, err := suite.groups.CreateGroup(ctx1, &splidv1.CreateGroupRequest{Name: "group"})
+	suite.Require().NoError(err)
+	g := created.Group
+
+	// events written so far are not streamed
+	_, err = suite.dispatcher.DispatchPending(context.Background())
+	suite.Require().NoError(err)
+
+	notMember, err := suite.groups.WatchGroupEvents(ctx2, &splidv1.WatchGroupEventsRequest{GroupId: g.Id})
+	suite.Require().NoError(err)
+	_, err = notMember.Recv()
+	suite.Assert().Equal(codes.PermissionDenied, status.Code(err))
+
+	watchCtx, cancel := context.WithTimeout(ctx1, 10*time.Second)
+	defer cancel()
+	stream, err := suite.groups.WatchGroupEvents(watchCtx, &splidv1.WatchGroupEventsRequest{GroupId: g.Id})
+	suite.Require().NoError(err)
+	// the headers arrive once the server has subscribed
+	_, err = stream.Header()
+	suite.Require().NoError(err)
+
+	e, err := suite.expenses.CreateExpense(ctx1, &splidv1.CreateExpenseRequest{GroupId: g.Id, AmountInCents: 1000})
+	suite.Require().NoError(err)
+	_, err = suite.expenses.DeleteExpense(ctx1, &splidv1.DeleteExpenseRequest{ExpenseId: e.Expense.Id})
+	suite.Require().NoError(err)
+	_, err = suite.dispatcher.DispatchPending(context.Background())
+	suite.Require().NoError(err)
+
+	resp, err := stream.Recv()
+	suite.Require().NoError(err)
+	suite.Assert().Equal(e.Expense.Id, resp.Event.GetExpenseCreated().Id)
+	suite.Assert().Equal(p1.Id, resp.Event.GetExpenseCreated().PersonId)
+
+	resp, err = stream.Recv()
+	suite.Require().NoError(err)
+	suite.Assert().Equal(e.Expense.Id, resp.Event.GetExpenseDeleted().Id)
+}
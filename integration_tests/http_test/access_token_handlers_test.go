@@ -0,0 +1,125 @@
+//go:build integration
+
+package http_test
+
+import (
+	"context"
+	"fmt"
+	"github.com/antoniobelotti/splid_backend_clone/integration_tests"
+	"github.com/antoniobelotti/splid_backend_clone/internal/expense"
+	"github.com/antoniobelotti/splid_backend_clone/internal/group"
+	internalHttp "github.com/antoniobelotti/splid_backend_clone/internal/http"
+	"github.com/antoniobelotti/splid_backend_clone/internal/http/authentication"
+	"github.com/antoniobelotti/splid_backend_clone/internal/mailer"
+	"github.com/antoniobelotti/splid_backend_clone/internal/person"
+	"github.com/antoniobelotti/splid_backend_clone/internal/transfer"
+	"github.com/stretchr/testify/suite"
+	psqlcont "github.com/testcontainers/testcontainers-go/modules/postgres"
+	"net/http"
+	"testing"
+)
+
+type AccessTokenHandlerTestSuite struct {
+	testSuiteHttp
+	psqlContainer *psqlcont.PostgresContainer
+	personService person.Service
+	groupService  group.Service
+}
+
+func TestAccessTokenHandlerTestSuite(t *testing.T) {
+	suite.Run(t, new(AccessTokenHandlerTestSuite))
+}
+
+func (suite *AccessTokenHandlerTestSuite) TearDownTest() {
+	_ = suite.psqlContainer.Terminate(context.Background())
+}
+
+func (suite *AccessTokenHandlerTestSuite) SetupTest() {
+	db, cont := integration_tests.GetCleanContainerizedPsqlDb()
+
+	suite.psqlContainer = cont
+	suite.personService = person.NewService(db, mailer.NewInMemoryMailer(), "")
+	expenseService := expense.NewService(db)
+	transferService := transfer.NewService(db)
+	suite.groupService = group.NewService(db, expenseService, transferService)
+
+	suite.server = newTestServer(suite.T(), db, internalHttp.Dependencies{Person: suite.personService, Group: suite.groupService, Expense: expenseService, Transfer: transferService})
+}
+
+func (suite *AccessTokenHandlerTestSuite) createAccessToken(sessionToken string, body internalHttp.CreateAccessTokenRequestBody) internalHttp.CreateAccessTokenResponseBody {
+	response := suite.POSTWithJwt("/api/v1/person/access-token", body, sessionToken)
+	suite.Require().Equal(http.StatusCreated, response.Code, response.Body.String())
+	return ExtractBody[internalHttp.CreateAccessTokenResponseBody](response)
+}
+
+func (suite *AccessTokenHandlerTestSuite) TestScopesAndGroupRestriction() {
+	p, sessionToken := suite.GetLoggedInPerson()
+	allowed, err := suite.groupService.CreateGroup(context.Background(), "allowed", p.Id)
+	suite.Require().NoError(err)
+	other, err := suite.groupService.CreateGroup(context.Background(), "other", p.Id)
+	suite.Require().NoError(err)
+
+	reader := suite.createAccessToken(sessionToken, internalHttp.CreateAccessTokenRequestBody{
+		Name:     "spreadsheet",
+		Scopes:   []string{string(authentication.ScopeRead)},
+		GroupIds: []int{allowed.Id},
+	})
+	suite.Contains(reader.Token, authentication.PersonalAccessTokenPrefix)
+
+	suite.Equal(http.StatusOK, suite.GETWithJwt(fmt.Sprintf("/api/v1/group/%d/balance", allowed.Id), reader.Token).Code)
+	suite.Equal(http.StatusForbidden, suite.GETWithJwt(fmt.Sprintf("/api/v1/group/%d/balance", other.Id), reader.Token).Code)
+	response := suite.POSTWithJwt("/api/v1/expense", internalHttp.CreateExpenseRequestBody{AmountInCents: 100, GroupId: allowed.Id}, reader.Token)
+	suite.Equal(http.StatusForbidden, response.Code, "read-only tokens cannot write")
+
+	writer := suite.createAccessToken(sessionToken, internalHttp.CreateAccessTokenRequestBody{
+		Name:     "bot",
+		Scopes:   []string{string(authentication.ScopeWriteExpenses)},
+		GroupIds: []int{allowed.Id},
+	})
+	response = suite.POSTWithJwt("/api/v1/expense", internalHttp.CreateExpenseRequestBody{AmountInCents: 100, GroupId: allowed.Id}, writer.Token)
+	suite.Equal(http.StatusCreated, response.Code)
+	response = suite.POSTWithJwt("/api/v1/expense", internalHttp.CreateExpenseRequestBody{AmountInCents: 100, GroupId: other.Id}, writer.Token)
+	suite.Equal(http.StatusForbidden, response.Code)
+
+	// account management needs a password login
+	suite.Equal(http.StatusForbidden, suite.GETWithJwt("/api/v1/person/access-token", writer.Token).Code)
+	suite.Equal(http.StatusForbidden, suite.PUTWithJwt("/api/v1/person/password", internalHttp.ChangePasswordRequestBody{}, reader.Token).Code)
+}
+
+func (suite *AccessTokenHandlerTestSuite) TestCreateValidatesRequest() {
+	_, sessionToken := suite.GetLoggedInPerson()
+	stranger, err := suite.personService.CreatePerson(context.Background(), "stranger", "stranger@mail.com", "password123")
+	suite.Require().NoError(err)
+	strangersGroup, err := suite.groupService.CreateGroup(context.Background(), "not mine", stranger.Id)
+	suite.Require().NoError(err)
+
+	for _, body := range []internalHttp.CreateAccessTokenRequestBody{
+		{Name: "bot", Scopes: []string{}},
+		{Name: "bot", Scopes: []string{"admin"}},
+		{Name: " ", Scopes: []string{"read"}},
+		{Name: "bot", Scopes: []string{"read"}, GroupIds: []int{strangersGroup.Id}},
+	} {
+		response := suite.POSTWithJwt("/api/v1/person/access-token", body, sessionToken)
+		suite.Equal(http.StatusBadRequest, response.Code, body)
+	}
+}
+
+func (suite *AccessTokenHandlerTestSuite) TestListAndRevoke() {
+	p, sessionToken := suite.GetLoggedInPerson()
+	created := suite.createAccessToken(sessionToken, internalHttp.CreateAccessTokenRequestBody{Name: "bot", Scopes: []string{"read"}})
+	suite.Equal(http.StatusOK, suite.GETWithJwt("/api/v1/person", created.Token).Code)
+
+	response := suite.GETWithJwt("/api/v1/person/access-token", sessionToken)
+	suite.Require().Equal(http.StatusOK, response.Code)
+	suite.NotContains(response.Body.String(), created.Token)
+	tokens := ExtractBody[[]authentication.PersonalAccessToken](response)
+	suite.Require().Len(tokens, 1)
+	suite.Equal("bot", tokens[0].Name)
+	suite.Equal(p.Id, tokens[0].PersonId)
+	suite.NotNil(tokens[0].LastUsedAt)
+
+	path := fmt.Sprintf("/api/v1/person/access-token/%d", created.Id)
+	suite.Equal(http.StatusNoContent, suite.send(http.MethodDelete, path, nil, sessionToken).Code)
+	suite.Equal(http.StatusUnauthorized, suite.GETWithJwt("/api/v1/person", created.Token).Code)
+	suite.Equal(http.StatusNotFound, suite.send(http.MethodDelete, "/api/v1/person/access-token/999", nil, sessionToken).Code)
+}
@@ -0,0 +1,153 @@
+//go:build integration
+
+package http_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"github.com/antoniobelotti/splid_backend_clone/integration_tests"
+	"github.com/antoniobelotti/splid_backend_clone/internal/account"
+	"github.com/antoniobelotti/splid_backend_clone/internal/attachment"
+	"github.com/antoniobelotti/splid_backend_clone/internal/expense"
+	"github.com/antoniobelotti/splid_backend_clone/internal/group"
+	internalHttp "github.com/antoniobelotti/splid_backend_clone/internal/http"
+	"github.com/antoniobelotti/splid_backend_clone/internal/mailer"
+	"github.com/antoniobelotti/splid_backend_clone/internal/person"
+	"github.com/antoniobelotti/splid_backend_clone/internal/postgresdb"
+	"github.com/antoniobelotti/splid_backend_clone/internal/transfer"
+	"github.com/stretchr/testify/suite"
+	psqlcont "github.com/testcontainers/testcontainers-go/modules/postgres"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type AccountHandlerTestSuite struct {
+	testSuiteHttp
+	psqlContainer   *psqlcont.PostgresContainer
+	db              *postgresdb.PostgresDatabase
+	personService   person.Service
+	groupService    group.Service
+	expenseService  expense.Service
+	transferService transfer.Service
+}
+
+func TestAccountHandlerTestSuite(t *testing.T) {
+	suite.Run(t, new(AccountHandlerTestSuite))
+}
+
+func (suite *AccountHandlerTestSuite) TearDownTest() {
+	_ = suite.psqlContainer.Terminate(context.Background())
+}
+
+func (suite *AccountHandlerTestSuite) SetupTest() {
+	db, cont := integration_tests.GetCleanContainerizedPsqlDb()
+	blobs, err := attachment.NewLocalBlobStore(suite.T().TempDir())
+	suite.Require().NoError(err)
+
+	suite.psqlContainer = cont
+	suite.db = db
+	suite.personService = person.NewService(db, mailer.NewInMemoryMailer(), "")
+	suite.expenseService = expense.NewService(db)
+	suite.transferService = transfer.NewService(db)
+	suite.groupService = group.NewService(db, suite.expenseService, suite.transferService)
+
+	suite.server = newTestServer(suite.T(), db, internalHttp.Dependencies{Person: suite.personService, Group: suite.groupService, Expense: suite.expenseService, Transfer: suite.transferService, Account: account.NewService(db, blobs)})
+}
+
+// setupSharedGroup creates a group with the logged-in person and a friend, one expense and one transfer between them
+func (suite *AccountHandlerTestSuite) setupSharedGroup() (person.Person, string, person.Person, group.Group) {
+	ctx := context.Background()
+	p, token := suite.GetLoggedInPerson()
+	friend, err := suite.personService.CreatePerson(ctx, "friend", "friend@mail.com", "password123")
+	suite.Require().NoError(err)
+
+	g, err := suite.groupService.CreateGroup(ctx, "holiday", friend.Id)
+	suite.Require().NoError(err)
+	suite.Require().NoError(suite.groupService.AddPersonToGroup(ctx, g, p.Id))
+
+	_, err = suite.expenseService.CreateExpense(ctx, 1000, p.Id, g.Id)
+	suite.Require().NoError(err)
+	_, err = suite.transferService.CreateTransfer(ctx, 200, g.Id, friend.Id, p.Id)
+	suite.Require().NoError(err)
+	return p, token, friend, g
+}
+
+func (suite *AccountHandlerTestSuite) TestExportJson() {
+	p, token, friend, g := suite.setupSharedGroup()
+
+	response := suite.GETWithJwt("/api/v1/person/export", token)
+	suite.Require().Equal(http.StatusOK, response.Code)
+	suite.Contains(response.Header().Get("Content-Disposition"), "attachment;")
+
+	export := ExtractBody[account.Export](response)
+	suite.Equal(p.Email, export.Profile.Email)
+	suite.Require().Len(export.Groups, 1)
+	suite.Equal(g.Id, export.Groups[0].Id)
+	suite.ElementsMatch([]int{p.Id, friend.Id}, export.Groups[0].ComponentIds)
+	suite.Require().Len(export.Expenses, 1)
+	suite.Equal(1000, export.Expenses[0].AmountInCents)
+	suite.Require().Len(export.Transfers, 1)
+	suite.Equal(friend.Id, export.Transfers[0].SenderId)
+}
+
+func (suite *AccountHandlerTestSuite) TestExportZip() {
+	_, token, _, _ := suite.setupSharedGroup()
+
+	response := suite.GETWithJwt("/api/v1/person/export?format=zip", token)
+	suite.Require().Equal(http.StatusOK, response.Code)
+	suite.Equal("application/zip", response.Header().Get("Content-Type"))
+
+	archive, err := zip.NewReader(bytes.NewReader(response.Body.Bytes()), int64(response.Body.Len()))
+	suite.Require().NoError(err)
+	var names []string
+	for _, f := range archive.File {
+		names = append(names, f.Name)
+	}
+	suite.ElementsMatch([]string{
+		"profile.json", "groups.json", "expenses.json", "transfers.json", "recurring-expenses.json", "attachments.json",
+	}, names)
+
+	suite.Equal(http.StatusBadRequest, suite.GETWithJwt("/api/v1/person/export?format=xml", token).Code)
+}
+
+func (suite *AccountHandlerTestSuite) deleteAccount(password string, token string) *httptest.ResponseRecorder {
+	return suite.send(http.MethodDelete, "/api/v1/person", internalHttp.DeleteAccountRequestBody{Password: password}, token)
+}
+
+func (suite *AccountHandlerTestSuite) TestDeleteAccountKeepsBalances() {
+	ctx := context.Background()
+	p, token, friend, g := suite.setupSharedGroup()
+	balanceBefore, err := suite.groupService.GetGroupBalance(ctx, g.Id)
+	suite.Require().NoError(err)
+
+	suite.Equal(http.StatusUnauthorized, suite.deleteAccount("wrong", token).Code)
+	suite.Equal(http.StatusUnauthorized, suite.POST("/api/v1/person/login", internalHttp.LoginRequestBody{Email: p.Email, Password: "wrong"}).Code)
+	suite.Require().Equal(http.StatusNoContent, suite.deleteAccount("password123", token).Code)
+
+	// the login attempts, keeping the email, are deleted
+	var attempts int
+	suite.Require().NoError(suite.db.GetContext(ctx, &attempts, `SELECT count(*) FROM login_attempt WHERE email=$1`, p.Email))
+	suite.Zero(attempts)
+
+	// the session is gone and the credentials do not work anymore
+	suite.Equal(http.StatusUnauthorized, suite.GETWithJwt("/api/v1/person", token).Code)
+	response := suite.POST("/api/v1/person/login", internalHttp.LoginRequestBody{Email: p.Email, Password: "password123"})
+	suite.NotEqual(http.StatusOK, response.Code)
+
+	deleted, err := suite.personService.GetPersonById(ctx, p.Id)
+	suite.Require().NoError(err)
+	suite.True(deleted.IsDeleted())
+	suite.Equal("Deleted user", deleted.Name)
+	suite.NotEqual(p.Email, deleted.Email)
+
+	balanceAfter, err := suite.groupService.GetGroupBalance(ctx, g.Id)
+	suite.Require().NoError(err)
+	suite.Equal(balanceBefore, balanceAfter)
+	suite.Contains(balanceAfter, friend.Id)
+
+	// the email can be used again
+	_, err = suite.personService.CreatePerson(ctx, "new", p.Email, "password123")
+	suite.NoError(err)
+}
@@ -0,0 +1,69 @@
+//go:build integration
+
+package http_test
+
+import (
+	"context"
+	"github.com/antoniobelotti/splid_backend_clone/integration_tests"
+	"github.com/antoniobelotti/splid_backend_clone/internal/expense"
+	"github.com/antoniobelotti/splid_backend_clone/internal/group"
+	internal_http "github.com/antoniobelotti/splid_backend_clone/internal/http"
+	"github.com/antoniobelotti/splid_backend_clone/internal/mailer"
+	"github.com/antoniobelotti/splid_backend_clone/internal/person"
+	"github.com/antoniobelotti/splid_backend_clone/internal/transfer"
+	"github.com/stretchr/testify/suite"
+	psqlcont "github.com/testcontainers/testcontainers-go/modules/postgres"
+	"net/http"
+	"testing"
+)
+
+type ExpenseHandlerTestSuite struct {
+	testSuiteHttp
+	psqlContainer *psqlcont.PostgresContainer
+	groupService  group.Service
+}
+
+func TestExpenseHandlerTestSuite(t *testing.T) {
+	suite.Run(t, new(ExpenseHandlerTestSuite))
+}
+
+func (suite *ExpenseHandlerTestSuite) TearDownTest() {
+	_ = suite.psqlContainer.Terminate(context.Background())
+}
+
+func (suite *ExpenseHandlerTestSuite) SetupTest() {
+	db, cont := integration_tests.GetCleanContainerizedPsqlDb()
+
+	suite.psqlContainer = cont
+	es := expense.NewService(db)
+	suite.groupService = group.NewService(db, es, transfer.NewService(db))
+
+	suite.server = newTestServer(suite.T(), db, internal_http.Dependencies{
+		Person:  person.NewService(db, mailer.NewInMemoryMailer(), ""),
+		Group:   suite.groupService,
+		Expense: es,
+	})
+}
+
+func (suite *ExpenseHandlerTestSuite) TestCreateExpenseChecksValidation() {
+	p, signedToken := suite.GetLoggedInPerson()
+	g, err := suite.groupService.CreateGroup(context.Background(), "testGroup", p.Id)
+	suite.Require().NoError(err)
+
+	table := []struct {
+		requestBody  internal_http.CreateExpenseRequestBody
+		invalidParam string
+	}{
+		{internal_http.CreateExpenseRequestBody{AmountInCents: 0, GroupId: g.Id}, "amount-in-cents"},
+		{internal_http.CreateExpenseRequestBody{AmountInCents: -100, GroupId: g.Id}, "amount-in-cents"},
+		{internal_http.CreateExpenseRequestBody{AmountInCents: 100}, "group-id"},
+	}
+	for _, tc := range table {
+		response := suite.POSTWithJwt("/api/v1/expense", tc.requestBody, signedToken)
+		suite.Equal(http.StatusBadRequest, response.Code)
+		suite.requireInvalidParam(response, tc.invalidParam)
+	}
+
+	response := suite.POSTWithJwt("/api/v1/expense", internal_http.CreateExpenseRequestBody{AmountInCents: 100, GroupId: g.Id}, signedToken)
+	suite.Equal(http.StatusCreated, response.Code)
+}
@@ -0,0 +1,162 @@
+//go:build integration
+
+package http_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/antoniobelotti/splid_backend_clone/integration_tests"
+	"github.com/antoniobelotti/splid_backend_clone/internal/expense"
+	"github.com/antoniobelotti/splid_backend_clone/internal/group"
+	internal_http "github.com/antoniobelotti/splid_backend_clone/internal/http"
+	"github.com/antoniobelotti/splid_backend_clone/internal/http/authentication"
+	"github.com/antoniobelotti/splid_backend_clone/internal/mailer"
+	"github.com/antoniobelotti/splid_backend_clone/internal/person"
+	"github.com/antoniobelotti/splid_backend_clone/internal/transfer"
+	"github.com/stretchr/testify/suite"
+	psqlcont "github.com/testcontainers/testcontainers-go/modules/postgres"
+	"net/http"
+	"testing"
+)
+
+type GraphQLHandlerTestSuite struct {
+	testSuiteHttp
+	psqlContainer   *psqlcont.PostgresContainer
+	personService   person.Service
+	groupService    group.Service
+	expenseService  expense.Service
+	transferService transfer.Service
+}
+
+func TestGraphQLHandlerTestSuite(t *testing.T) {
+	suite.Run(t, new(GraphQLHandlerTestSuite))
+}
+
+func (suite *GraphQLHandlerTestSuite) TearDownTest() {
+	_ = suite.psqlContainer.Terminate(context.Background())
+}
+
+func (suite *GraphQLHandlerTestSuite) SetupTest() {
+	db, cont := integration_tests.GetCleanContainerizedPsqlDb()
+
+	suite.psqlContainer = cont
+	suite.personService = person.NewService(db, mailer.NewInMemoryMailer(), "")
+	suite.expenseService = expense.NewService(db)
+	suite.transferService = transfer.NewService(db)
+	suite.groupService = group.NewService(db, suite.expenseService, suite.transferService)
+
+	suite.server = newTestServer(suite.T(), db, internal_http.Dependencies{Person: suite.personService, Group: suite.groupService, Expense: suite.expenseService, Transfer: suite.transferService})
+}
+
+type graphQLResponseBody struct {
+	Data   json.RawMessage `json:"data"`
+	Errors []struct {
+		Message    string         `json:"message"`
+		Extensions map[string]any `json:"extensions"`
+	} `json:"errors"`
+}
+
+func (suite *GraphQLHandlerTestSuite) query(query string, variables map[string]any, signedToken string) graphQLResponseBody {
+	response := suite.POSTWithJwt("/api/v1/graphql", internal_http.GraphQLRequestBody{Query: query, Variables: variables}, signedToken)
+	suite.Require().Equal(http.StatusOK, response.Code)
+	return ExtractBody[graphQLResponseBody](response)
+}
+
+func (suite *GraphQLHandlerTestSuite) TestQueryGroups() {
+	ctx := context.Background()
+	p, signedToken := suite.GetLoggedInPerson()
+	other, err := suite.personService.CreatePerson(ctx, "other", "other@mail.com", "password123")
+	suite.Require().NoError(err)
+
+	for i := 0; i < 2; i++ {
+		g, err := suite.groupService.CreateGroup(ctx, fmt.Sprintf("group %d", i), p.Id)
+		suite.Require().NoError(err)
+		_, err = suite.groupService.JoinGroup(ctx, g.Id, g.InvitationCode, other.Id)
+		suite.Require().NoError(err)
+		_, err = suite.expenseService.CreateExpense(ctx, 1000, p.Id, g.Id)
+		suite.Require().NoError(err)
+		_, err = suite.expenseService.CreateExpense(ctx, 500, other.Id, g.Id)
+		suite.Require().NoError(err)
+		_, err = suite.transferService.CreateTransfer(ctx, 100, g.Id, other.Id, p.Id)
+		suite.Require().NoError(err)
+	}
+
+	body := suite.query(`{
+		me { id email }
+		groups {
+			name
+			owner { id }
+			members { name email }
+			expenses { amountInCents recordedBy { id } }
+			transfers { amountInCents }
+			balance { person { id } amountInCents }
+			operationsToEvenBalance { amountInCents sender { id } receiver { id } }
+		}
+	}`, nil, signedToken)
+	suite.Require().Empty(body.Errors)
+
+	var data struct {
+		Me struct {
+			Id    string
+			Email string
+		}
+		Groups []struct {
+			Members []struct {
+				Name  string
+				Email *string
+			}
+			Expenses []struct {
+				AmountInCents int
+				RecordedBy    struct{ Id string }
+			}
+			Balance []struct {
+				Person        struct{ Id string }
+				AmountInCents int
+			}
+			OperationsToEvenBalance []struct {
+				AmountInCents int
+				Sender        struct{ Id string }
+				Receiver      struct{ Id string }
+			}
+		}
+	}
+	suite.Require().NoError(json.Unmarshal(body.Data, &data))
+
+	suite.Equal(fmt.Sprint(p.Id), data.Me.Id)
+	suite.Equal(p.Email, data.Me.Email)
+	suite.Require().Len(data.Groups, 2)
+	for _, g := range data.Groups {
+		suite.Len(g.Members, 2)
+		// most recent first
+		suite.Require().Len(g.Expenses, 2)
+		suite.Equal(500, g.Expenses[0].AmountInCents)
+		suite.Equal(fmt.Sprint(other.Id), g.Expenses[0].RecordedBy.Id)
+
+		// average 750: p paid 1000 and got 100, other paid 500 and sent 100
+		suite.Len(g.Balance, 2)
+		suite.Require().Len(g.OperationsToEvenBalance, 1)
+		suite.Equal(350, g.OperationsToEvenBalance[0].AmountInCents)
+		suite.Equal(fmt.Sprint(other.Id), g.OperationsToEvenBalance[0].Sender.Id)
+	}
+}
+
+func (suite *GraphQLHandlerTestSuite) TestQueryGroupOfOthers() {
+	owner, err := suite.personService.CreatePerson(context.Background(), "owner", "owner@mail.com", "password123")
+	suite.Require().NoError(err)
+	g, err := suite.groupService.CreateGroup(context.Background(), "not yours", owner.Id)
+	suite.Require().NoError(err)
+
+	_, signedToken := suite.GetLoggedInPerson()
+	body := suite.query(`query($id: ID!) { group(id: $id) { name } }`, map[string]any{"id": fmt.Sprint(g.Id)}, signedToken)
+
+	suite.Require().Len(body.Errors, 1)
+	suite.Equal("person_not_in_group", body.Errors[0].Extensions["code"])
+	suite.JSONEq(`{"group": null}`, string(body.Data))
+}
+
+func (suite *GraphQLHandlerTestSuite) TestQueryRequiresAuthentication() {
+	response := suite.POST("/api/v1/graphql", internal_http.GraphQLRequestBody{Query: "{ me { id } }"})
+	suite.Equal(http.StatusUnauthorized, response.Code)
+	suite.Equal(authentication.CodeMissingToken, ExtractBody[map[string]any](response)["code"])
+}
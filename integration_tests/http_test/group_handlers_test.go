@@ -9,7 +9,11 @@ import (
 	"github.com/antoniobelotti/splid_backend_clone/internal/expense"
 	"github.com/antoniobelotti/splid_backend_clone/internal/group"
 	internal_http "github.com/antoniobelotti/splid_backend_clone/internal/http"
+	"github.com/antoniobelotti/splid_backend_clone/internal/http/authentication"
+	"github.com/antoniobelotti/splid_backend_clone/internal/http/problem"
+	"github.com/antoniobelotti/splid_backend_clone/internal/mailer"
 	"github.com/antoniobelotti/splid_backend_clone/internal/person"
+	"github.com/antoniobelotti/splid_backend_clone/internal/postgresdb"
 	"github.com/antoniobelotti/splid_backend_clone/internal/transfer"
 	"github.com/stretchr/testify/suite"
 	psqlcont "github.com/testcontainers/testcontainers-go/modules/postgres"
@@ -20,8 +24,10 @@ import (
 type GroupHandlerTestSuite struct {
 	testSuiteHttp
 	psqlContainer *psqlcont.PostgresContainer
+	db            *postgresdb.PostgresDatabase
 	personService person.Service
 	groupService  group.Service
+	authService   authentication.Service
 }
 
 func TestGroupHandlerTestSuite(t *testing.T) {
@@ -36,10 +42,13 @@ func (suite *GroupHandlerTestSuite) SetupTest() {
 	db, cont := integration_tests.GetCleanContainerizedPsqlDb()
 
 	suite.psqlContainer = cont
-	suite.personService = person.NewService(db)
+	suite.db = db
+	suite.personService = person.NewService(db, mailer.NewInMemoryMailer(), "")
 	suite.groupService = group.NewService(db, expense.NewService(db), transfer.NewService(db))
 
-	suite.server = internal_http.NewRESTServer(suite.personService, suite.groupService, expense.Service{}, transfer.Service{})
+	suite.authService = newAuthService(suite.T(), db)
+
+	suite.server = newTestServer(suite.T(), db, internal_http.Dependencies{Person: suite.personService, Group: suite.groupService, Auth: suite.authService})
 }
 
 func (suite *GroupHandlerTestSuite) TestCreateGroupSuccess() {
@@ -68,6 +77,7 @@ func (suite *GroupHandlerTestSuite) TestJoinGroupSuccess() {
 	suite.Require().NoError(err)
 
 	p, signedToken := suite.GetLoggedInPerson()
+	integration_tests.VerifyEmail(suite.db, p.Id)
 
 	// perform request to join group g as user p
 	joinGroupResponse := suite.POSTWithJwt(
@@ -88,6 +98,7 @@ func (suite *GroupHandlerTestSuite) TestJoinGroupFailGivenWrongInvitationCode()
 	suite.Require().NoError(err)
 
 	p, signedToken := suite.GetLoggedInPerson()
+	integration_tests.VerifyEmail(suite.db, p.Id)
 
 	// perform request to join group g as user p
 	joinGroupResponse := suite.POSTWithJwt(
@@ -95,7 +106,8 @@ func (suite *GroupHandlerTestSuite) TestJoinGroupFailGivenWrongInvitationCode()
 		nil,
 		signedToken,
 	)
-	suite.Equal(http.StatusUnauthorized, joinGroupResponse.Code)
+	suite.Equal(http.StatusForbidden, joinGroupResponse.Code)
+	suite.Equal(group.ErrWrongInvitationCode.Code, ExtractBody[problem.Problem](joinGroupResponse).Code)
 
 	components, err := suite.groupService.GetGroupComponentsById(context.Background(), g.Id)
 	suite.Require().NotContains(components, p.Id)
@@ -107,7 +119,8 @@ func (suite *GroupHandlerTestSuite) TestJoinGroupFailIfGroupDoesNotExist() {
 	g, err := suite.groupService.CreateGroup(context.Background(), "testGroup", groupOwner.Id)
 	suite.Require().NoError(err)
 
-	_, signedToken := suite.GetLoggedInPerson()
+	p, signedToken := suite.GetLoggedInPerson()
+	integration_tests.VerifyEmail(suite.db, p.Id)
 
 	nonexistentGroupId := 999
 	// perform request to join group g as user p
@@ -116,5 +129,36 @@ func (suite *GroupHandlerTestSuite) TestJoinGroupFailIfGroupDoesNotExist() {
 		nil,
 		signedToken,
 	)
-	suite.Equal(http.StatusBadRequest, joinGroupResponse.Code)
+	suite.Equal(http.StatusNotFound, joinGroupResponse.Code)
+	suite.Equal(group.ErrGroupNotFound.Code, ExtractBody[problem.Problem](joinGroupResponse).Code)
+}
+
+func (suite *GroupHandlerTestSuite) TestJoinGroupFailIfEmailNotVerified() {
+	groupOwner, err := suite.personService.CreatePerson(context.Background(), "testPerson", "mail@email.com", "password123")
+	suite.Require().NoError(err)
+	g, err := suite.groupService.CreateGroup(context.Background(), "testGroup", groupOwner.Id)
+	suite.Require().NoError(err)
+
+	p, signedToken := suite.GetLoggedInPerson()
+
+	joinGroupResponse := suite.POSTWithJwt(
+		fmt.Sprintf("/api/v1/group/%d/join?invitationCode=%s", g.Id, g.InvitationCode),
+		nil,
+		signedToken,
+	)
+	suite.Equal(http.StatusForbidden, joinGroupResponse.Code)
+	suite.Equal(person.ErrEmailNotVerified.Code, ExtractBody[problem.Problem](joinGroupResponse).Code)
+
+	components, err := suite.groupService.GetGroupComponentsById(context.Background(), g.Id)
+	suite.Require().NotContains(components, p.Id)
+}
+
+func (suite *GroupHandlerTestSuite) TestUnverifiedPolicyIsEnforced() {
+	policy, err := person.ParseUnverifiedPolicy("create-group")
+	suite.Require().NoError(err)
+	suite.server = newTestServer(suite.T(), suite.db, internal_http.Dependencies{Person: suite.personService.WithUnverifiedPolicy(policy), Group: suite.groupService, Auth: suite.authService})
+
+	_, signedToken := suite.GetLoggedInPerson()
+	response := suite.POSTWithJwt("/api/v1/group", internal_http.CreateGroupRequestBody{Name: "group"}, signedToken)
+	suite.Equal(http.StatusForbidden, response.Code)
 }
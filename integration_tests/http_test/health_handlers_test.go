@@ -0,0 +1,68 @@
+//go:build integration
+
+package http_test
+
+import (
+	"context"
+	"github.com/antoniobelotti/splid_backend_clone/integration_tests"
+	"github.com/antoniobelotti/splid_backend_clone/internal/health"
+	internal_http "github.com/antoniobelotti/splid_backend_clone/internal/http"
+	"github.com/antoniobelotti/splid_backend_clone/internal/postgresdb"
+	"github.com/antoniobelotti/splid_backend_clone/migrations"
+	"github.com/stretchr/testify/suite"
+	psqlcont "github.com/testcontainers/testcontainers-go/modules/postgres"
+	"net/http"
+	"testing"
+)
+
+type HealthHandlerTestSuite struct {
+	testSuiteHttp
+	psqlContainer *psqlcont.PostgresContainer
+	db            *postgresdb.PostgresDatabase
+	checker       *health.Checker
+}
+
+func TestHealthHandlerTestSuite(t *testing.T) {
+	suite.Run(t, new(HealthHandlerTestSuite))
+}
+
+func (suite *HealthHandlerTestSuite) TearDownTest() {
+	_ = suite.psqlContainer.Terminate(context.Background())
+}
+
+func (suite *HealthHandlerTestSuite) SetupTest() {
+	db, cont := integration_tests.GetCleanContainerizedPsqlDb()
+	suite.psqlContainer = cont
+	suite.db = db
+
+	suite.checker = health.NewChecker(0)
+	suite.checker.Register("database", db.PingContext)
+	suite.checker.Register("schema-version", db.CheckSchemaVersion(migrations.LatestVersion()))
+
+	suite.server = newTestServer(suite.T(), db, internal_http.Dependencies{Checker: suite.checker})
+}
+
+func (suite *HealthHandlerTestSuite) TestReadyWhenMigrated() {
+	response := suite.GET("/readyz")
+	suite.Equal(http.StatusOK, response.Code)
+
+	report := ExtractBody[health.Report](response)
+	suite.Equal(health.StatusOk, report.Status)
+	suite.Len(report.Checks, 2)
+}
+
+func (suite *HealthHandlerTestSuite) TestNotReadyWithOutdatedSchema() {
+	suite.checker.Register("schema-version", suite.db.CheckSchemaVersion(migrations.LatestVersion()+1))
+
+	response := suite.GET("/readyz")
+	suite.Equal(http.StatusServiceUnavailable, response.Code)
+}
+
+func (suite *HealthHandlerTestSuite) TestNotReadyWithoutDatabase() {
+	suite.Require().NoError(suite.db.Close())
+
+	response := suite.GET("/readyz")
+	suite.Equal(http.StatusServiceUnavailable, response.Code)
+	// liveness does not depend on the database
+	suite.Equal(http.StatusOK, suite.GET("/healthz").Code)
+}
@@ -0,0 +1,131 @@
+//go:build integration
+
+package http_test
+
+import (
+	"context"
+	"github.com/antoniobelotti/splid_backend_clone/integration_tests"
+	internalHttp "github.com/antoniobelotti/splid_backend_clone/internal/http"
+	"github.com/antoniobelotti/splid_backend_clone/internal/http/authentication"
+	"github.com/antoniobelotti/splid_backend_clone/internal/mailer"
+	"github.com/antoniobelotti/splid_backend_clone/internal/person"
+	"github.com/stretchr/testify/suite"
+	psqlcont "github.com/testcontainers/testcontainers-go/modules/postgres"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+type OidcHandlerTestSuite struct {
+	testSuiteHttp
+	psqlContainer *psqlcont.PostgresContainer
+	provider      *integration_tests.MockOidcProvider
+	personService person.Service
+}
+
+func TestOidcHandlerTestSuite(t *testing.T) {
+	suite.Run(t, new(OidcHandlerTestSuite))
+}
+
+func (suite *OidcHandlerTestSuite) TearDownTest() {
+	suite.provider.Close()
+	_ = suite.psqlContainer.Terminate(context.Background())
+}
+
+func (suite *OidcHandlerTestSuite) SetupTest() {
+	db, cont := integration_tests.GetCleanContainerizedPsqlDb()
+
+	suite.psqlContainer = cont
+	suite.provider = integration_tests.NewMockOidcProvider()
+	suite.personService = person.NewService(db, mailer.NewInMemoryMailer(), "")
+
+	oidc, err := authentication.NewOidc(context.Background(), db, authentication.OidcProviderConfig{
+		Name:         "mock",
+		IssuerUrl:    suite.provider.URL,
+		ClientId:     suite.provider.ClientId,
+		ClientSecret: suite.provider.ClientSecret,
+		RedirectUrl:  "http://localhost:8080/api/v1/auth/oidc/mock/callback",
+	})
+	suite.Require().NoError(err)
+	auth := newAuthService(suite.T(), db).WithOidc(oidc)
+
+	suite.server = newTestServer(suite.T(), db, internalHttp.Dependencies{Person: suite.personService, Auth: auth})
+}
+
+// callbackUrl starts a login and follows the redirects of the mock provider, returning where it sends the browser back
+func (suite *OidcHandlerTestSuite) callbackUrl() string {
+	response := suite.GET("/api/v1/auth/oidc/mock/login")
+	suite.Require().Equal(http.StatusFound, response.Code)
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	providerResponse, err := client.Get(response.Header().Get("Location"))
+	suite.Require().NoError(err)
+	defer providerResponse.Body.Close()
+	suite.Require().Equal(http.StatusFound, providerResponse.StatusCode)
+
+	callback, err := url.Parse(providerResponse.Header.Get("Location"))
+	suite.Require().NoError(err)
+	return callback.RequestURI()
+}
+
+func (suite *OidcHandlerTestSuite) login(identity integration_tests.MockOidcIdentity) *httptest.ResponseRecorder {
+	suite.provider.SignInAs(identity)
+	return suite.GET(suite.callbackUrl())
+}
+
+func (suite *OidcHandlerTestSuite) TestListProviders() {
+	response := suite.GET("/api/v1/auth/oidc")
+	suite.Equal(http.StatusOK, response.Code)
+	suite.JSONEq(`{"providers": ["mock"]}`, response.Body.String())
+
+	suite.Equal(http.StatusNotFound, suite.GET("/api/v1/auth/oidc/unknown/login").Code)
+}
+
+func (suite *OidcHandlerTestSuite) TestFirstLoginCreatesVerifiedPerson() {
+	identity := integration_tests.MockOidcIdentity{Subject: "42", Email: "oidc@mail.com", EmailVerified: true, Name: "Oidc Person"}
+
+	response := suite.login(identity)
+	suite.Require().Equal(http.StatusOK, response.Code, response.Body.String())
+	tokens := ExtractBody[internalHttp.LoginResponseBody](response)
+
+	response = suite.GETWithJwt("/api/v1/person", tokens.SignedToken)
+	suite.Require().Equal(http.StatusOK, response.Code)
+	p := ExtractBody[person.Person](response)
+	suite.Equal("oidc@mail.com", p.Email)
+	suite.Equal("Oidc Person", p.Name)
+	suite.True(p.IsEmailVerified())
+
+	// the next login finds the same person, even if the email changed at the provider
+	identity.Email = "changed@mail.com"
+	response = suite.login(identity)
+	suite.Require().Equal(http.StatusOK, response.Code)
+	response = suite.GETWithJwt("/api/v1/person", ExtractBody[internalHttp.LoginResponseBody](response).SignedToken)
+	suite.Equal(p.Id, ExtractBody[person.Person](response).Id)
+}
+
+func (suite *OidcHandlerTestSuite) TestLinksExistingPersonByVerifiedEmail() {
+	p, err := suite.personService.CreatePerson(context.Background(), "p", "unverified@mail.com", "password123")
+	suite.Require().NoError(err)
+
+	response := suite.login(integration_tests.MockOidcIdentity{Subject: "1", Email: p.Email, EmailVerified: false})
+	suite.Equal(http.StatusForbidden, response.Code, "the provider must vouch for the email")
+
+	response = suite.login(integration_tests.MockOidcIdentity{Subject: "1", Email: p.Email, EmailVerified: true})
+	suite.Equal(http.StatusConflict, response.Code, "our account must have verified the email too")
+}
+
+func (suite *OidcHandlerTestSuite) TestCallbackCannotBeReplayed() {
+	suite.provider.SignInAs(integration_tests.MockOidcIdentity{Subject: "42", Email: "oidc@mail.com", EmailVerified: true})
+	callback := suite.callbackUrl()
+
+	suite.Equal(http.StatusOK, suite.GET(callback).Code)
+	suite.Equal(http.StatusBadRequest, suite.GET(callback).Code)
+
+	forged, err := url.Parse(suite.callbackUrl())
+	suite.Require().NoError(err)
+	query := forged.Query()
+	query.Set("state", "forged")
+	forged.RawQuery = query.Encode()
+	suite.Equal(http.StatusBadRequest, suite.GET(forged.String()).Code)
+}
@@ -4,23 +4,39 @@ package http_test
 
 import (
 	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
 	"github.com/antoniobelotti/splid_backend_clone/integration_tests"
 	"github.com/antoniobelotti/splid_backend_clone/internal/expense"
 	"github.com/antoniobelotti/splid_backend_clone/internal/group"
 	internalHttp "github.com/antoniobelotti/splid_backend_clone/internal/http"
+	"github.com/antoniobelotti/splid_backend_clone/internal/http/authentication"
+	"github.com/antoniobelotti/splid_backend_clone/internal/http/problem"
+	"github.com/antoniobelotti/splid_backend_clone/internal/mailer"
 	"github.com/antoniobelotti/splid_backend_clone/internal/person"
+	"github.com/antoniobelotti/splid_backend_clone/internal/postgresdb"
 	"github.com/antoniobelotti/splid_backend_clone/internal/transfer"
+	"github.com/golang-jwt/jwt/v5"
 	"github.com/stretchr/testify/suite"
 	psqlcont "github.com/testcontainers/testcontainers-go/modules/postgres"
 	"net/http"
+	"net/url"
+	"regexp"
+	"sync"
 	"testing"
+	"time"
 )
 
 type PersonHandlerTestSuite struct {
 	testSuiteHttp
 	psqlContainer *psqlcont.PostgresContainer
+	db            *postgresdb.PostgresDatabase
 	personService person.Service
 	groupService  group.Service
+	mailer        *mailer.InMemoryMailer
 }
 
 func TestPersonHandlerTestSuite(t *testing.T) {
@@ -35,17 +51,19 @@ func (suite *PersonHandlerTestSuite) SetupTest() {
 	db, cont := integration_tests.GetCleanContainerizedPsqlDb()
 
 	suite.psqlContainer = cont
-	suite.personService = person.NewService(db)
+	suite.db = db
+	suite.mailer = mailer.NewInMemoryMailer()
+	suite.personService = person.NewService(db, suite.mailer, "https://splid.example.com")
 	suite.groupService = group.NewService(db, expense.NewService(db), transfer.NewService(db))
 
-	suite.server = internalHttp.NewRESTServer(suite.personService, suite.groupService, expense.Service{}, transfer.Service{})
+	suite.server = newTestServer(suite.T(), db, internalHttp.Dependencies{Person: suite.personService, Group: suite.groupService})
 }
 
 func (suite *PersonHandlerTestSuite) TestCreatePersonChecksValidation() {
 	table := []struct {
 		requestBody    internalHttp.CreatePersonRequestBody
 		respHttpStatus int
-		respBody       string
+		invalidParam   string
 	}{
 		{
 			requestBody: internalHttp.CreatePersonRequestBody{
@@ -55,6 +73,7 @@ func (suite *PersonHandlerTestSuite) TestCreatePersonChecksValidation() {
 				ConfirmPassword: "password123",
 			},
 			respHttpStatus: http.StatusBadRequest,
+			invalidParam:   "name",
 		},
 		{
 			requestBody: internalHttp.CreatePersonRequestBody{
@@ -64,6 +83,7 @@ func (suite *PersonHandlerTestSuite) TestCreatePersonChecksValidation() {
 				ConfirmPassword: "password123",
 			},
 			respHttpStatus: http.StatusBadRequest,
+			invalidParam:   "email",
 		},
 		{
 			requestBody: internalHttp.CreatePersonRequestBody{
@@ -73,6 +93,7 @@ func (suite *PersonHandlerTestSuite) TestCreatePersonChecksValidation() {
 				ConfirmPassword: "password123",
 			},
 			respHttpStatus: http.StatusBadRequest,
+			invalidParam:   "email",
 		},
 		{
 			requestBody: internalHttp.CreatePersonRequestBody{
@@ -82,6 +103,7 @@ func (suite *PersonHandlerTestSuite) TestCreatePersonChecksValidation() {
 				ConfirmPassword: "pass",
 			},
 			respHttpStatus: http.StatusBadRequest,
+			invalidParam:   "password",
 		},
 		{
 			requestBody: internalHttp.CreatePersonRequestBody{
@@ -91,6 +113,7 @@ func (suite *PersonHandlerTestSuite) TestCreatePersonChecksValidation() {
 				ConfirmPassword: "password13",
 			},
 			respHttpStatus: http.StatusBadRequest,
+			invalidParam:   "confirm-password",
 		},
 		{
 			requestBody: internalHttp.CreatePersonRequestBody{
@@ -100,6 +123,7 @@ func (suite *PersonHandlerTestSuite) TestCreatePersonChecksValidation() {
 				ConfirmPassword: "",
 			},
 			respHttpStatus: http.StatusBadRequest,
+			invalidParam:   "password",
 		},
 		{
 			requestBody: internalHttp.CreatePersonRequestBody{
@@ -109,15 +133,39 @@ func (suite *PersonHandlerTestSuite) TestCreatePersonChecksValidation() {
 				ConfirmPassword: "password123",
 			},
 			respHttpStatus: http.StatusBadRequest,
+			invalidParam:   "email",
 		},
 	}
 
 	for _, tc := range table {
 		w := suite.POST("/api/v1/person/signup", tc.requestBody)
 		suite.Equal(tc.respHttpStatus, w.Code)
+		suite.Equal(problem.ContentType, w.Header().Get("Content-Type"))
+
+		p := ExtractBody[problem.Problem](w)
+		suite.Equal(problem.CodeValidationFailed, p.Code)
+		var invalidParams []string
+		for _, invalidParam := range p.InvalidParams {
+			invalidParams = append(invalidParams, invalidParam.Name)
+		}
+		suite.Contains(invalidParams, tc.invalidParam)
 	}
 }
 
+func (suite *PersonHandlerTestSuite) TestSignupWithEmailInUse() {
+	requestBody := internalHttp.CreatePersonRequestBody{
+		Name:            "name",
+		Email:           "cds@mail.com",
+		Password:        "password123",
+		ConfirmPassword: "password123",
+	}
+	suite.Equal(http.StatusCreated, suite.POST("/api/v1/person/signup", requestBody).Code)
+
+	response := suite.POST("/api/v1/person/signup", requestBody)
+	suite.Equal(http.StatusConflict, response.Code)
+	suite.Equal(person.ErrEmailAlreadyInUse.Code, ExtractBody[problem.Problem](response).Code)
+}
+
 func (suite *PersonHandlerTestSuite) TestPersonSignup() {
 	table := []struct {
 		requestBody    internalHttp.CreatePersonRequestBody
@@ -236,3 +284,345 @@ func (suite *PersonHandlerTestSuite) TestPersonLoginFail() {
 	response := suite.POST("/api/v1/person/login", rb)
 	suite.Equal(http.StatusUnauthorized, response.Code)
 }
+
+func (suite *PersonHandlerTestSuite) TestLoginDoesNotRevealUnknownEmails() {
+	_, err := suite.personService.CreatePerson(context.Background(), "p", "email@mail.com", "password123")
+	suite.Require().NoError(err)
+
+	wrongPassword := suite.POST("/api/v1/person/login", internalHttp.LoginRequestBody{Email: "email@mail.com", Password: "WrongPassword"})
+	unknownEmail := suite.POST("/api/v1/person/login", internalHttp.LoginRequestBody{Email: "unknown@mail.com", Password: "WrongPassword"})
+
+	suite.Equal(http.StatusUnauthorized, wrongPassword.Code)
+	suite.Equal(http.StatusUnauthorized, unknownEmail.Code)
+	suite.Equal(wrongPassword.Body.String(), unknownEmail.Body.String())
+}
+
+func (suite *PersonHandlerTestSuite) TestRepeatedLoginFailuresAreThrottled() {
+	_, err := suite.personService.CreatePerson(context.Background(), "p", "email@mail.com", "password123")
+	suite.Require().NoError(err)
+
+	config := authentication.DefaultLoginGuardConfig()
+	for i := 0; i < config.FreeAttempts; i++ {
+		response := suite.POST("/api/v1/person/login", internalHttp.LoginRequestBody{Email: "email@mail.com", Password: "WrongPassword"})
+		suite.Equal(http.StatusUnauthorized, response.Code)
+	}
+
+	// even the right password is refused until the delay has passed
+	response := suite.POST("/api/v1/person/login", internalHttp.LoginRequestBody{Email: "email@mail.com", Password: "password123"})
+	suite.Equal(http.StatusTooManyRequests, response.Code)
+	suite.NotEmpty(response.Header().Get("Retry-After"))
+
+	time.Sleep(config.BaseDelay)
+	response = suite.POST("/api/v1/person/login", internalHttp.LoginRequestBody{Email: "email@mail.com", Password: "password123"})
+	suite.Equal(http.StatusOK, response.Code)
+}
+
+func (suite *PersonHandlerTestSuite) TestConcurrentLoginFailuresAreThrottled() {
+	_, err := suite.personService.CreatePerson(context.Background(), "p", "email@mail.com", "password123")
+	suite.Require().NoError(err)
+
+	// a burst of guesses, all sent before any of them is answered
+	const guesses = 30
+	codes := make(chan int, guesses)
+	var wg sync.WaitGroup
+	for i := 0; i < guesses; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			codes <- suite.POST("/api/v1/person/login", internalHttp.LoginRequestBody{Email: "email@mail.com", Password: "WrongPassword"}).Code
+		}()
+	}
+	wg.Wait()
+	close(codes)
+
+	// the guesses refused with 429 never reached the password check
+	checked := 0
+	for code := range codes {
+		if code != http.StatusTooManyRequests {
+			suite.Equal(http.StatusUnauthorized, code)
+			checked++
+		}
+	}
+	suite.LessOrEqual(checked, authentication.DefaultLoginGuardConfig().AccountLockoutThreshold)
+}
+
+func (suite *PersonHandlerTestSuite) TestRefreshTokenRotationAndReuseDetection() {
+	_, err := suite.personService.CreatePerson(context.Background(), "person", "email@mail.com", "password123")
+	suite.Require().NoError(err)
+
+	response := suite.POST("/api/v1/person/login", internalHttp.LoginRequestBody{Email: "email@mail.com", Password: "password123"})
+	suite.Require().Equal(http.StatusOK, response.Code)
+	login := ExtractBody[internalHttp.LoginResponseBody](response)
+	suite.NotEmpty(login.RefreshToken)
+
+	response = suite.POST("/api/v1/person/token/refresh", internalHttp.RefreshTokenRequestBody{RefreshToken: login.RefreshToken})
+	suite.Require().Equal(http.StatusOK, response.Code)
+	refreshed := ExtractBody[internalHttp.LoginResponseBody](response)
+	suite.NotEqual(login.RefreshToken, refreshed.RefreshToken)
+
+	// presenting the old refresh token again revokes the whole session
+	response = suite.POST("/api/v1/person/token/refresh", internalHttp.RefreshTokenRequestBody{RefreshToken: login.RefreshToken})
+	suite.Equal(http.StatusUnauthorized, response.Code)
+
+	response = suite.GETWithJwt("/api/v1/person", refreshed.SignedToken)
+	suite.Equal(http.StatusUnauthorized, response.Code)
+	response = suite.POST("/api/v1/person/token/refresh", internalHttp.RefreshTokenRequestBody{RefreshToken: refreshed.RefreshToken})
+	suite.Equal(http.StatusUnauthorized, response.Code)
+}
+
+func (suite *PersonHandlerTestSuite) TestLogout() {
+	_, err := suite.personService.CreatePerson(context.Background(), "person", "email@mail.com", "password123")
+	suite.Require().NoError(err)
+
+	login := func() internalHttp.LoginResponseBody {
+		response := suite.POST("/api/v1/person/login", internalHttp.LoginRequestBody{Email: "email@mail.com", Password: "password123"})
+		suite.Require().Equal(http.StatusOK, response.Code)
+		return ExtractBody[internalHttp.LoginResponseBody](response)
+	}
+	phone, laptop, tablet := login(), login(), login()
+
+	response := suite.POSTWithJwt("/api/v1/person/logout", nil, phone.SignedToken)
+	suite.Equal(http.StatusNoContent, response.Code)
+	suite.Equal(http.StatusUnauthorized, suite.GETWithJwt("/api/v1/person", phone.SignedToken).Code)
+	suite.Equal(http.StatusOK, suite.GETWithJwt("/api/v1/person", laptop.SignedToken).Code)
+
+	response = suite.POSTWithJwt("/api/v1/person/logout-all", nil, laptop.SignedToken)
+	suite.Equal(http.StatusNoContent, response.Code)
+	suite.Equal(http.StatusUnauthorized, suite.GETWithJwt("/api/v1/person", laptop.SignedToken).Code)
+	suite.Equal(http.StatusUnauthorized, suite.GETWithJwt("/api/v1/person", tablet.SignedToken).Code)
+}
+
+func (suite *PersonHandlerTestSuite) TestJwksVerifiesIssuedTokens() {
+	_, err := suite.personService.CreatePerson(context.Background(), "person", "email@mail.com", "password123")
+	suite.Require().NoError(err)
+	response := suite.POST("/api/v1/person/login", internalHttp.LoginRequestBody{Email: "email@mail.com", Password: "password123"})
+	suite.Require().Equal(http.StatusOK, response.Code)
+	login := ExtractBody[internalHttp.LoginResponseBody](response)
+
+	response = suite.GET("/.well-known/jwks.json")
+	suite.Require().Equal(http.StatusOK, response.Code)
+	jwks := ExtractBody[authentication.JWKS](response)
+	suite.Require().Len(jwks.Keys, 1)
+	suite.Equal("OKP", jwks.Keys[0].KeyType)
+
+	token, _, err := jwt.NewParser().ParseUnverified(login.SignedToken, jwt.MapClaims{})
+	suite.Require().NoError(err)
+	suite.Equal(jwks.Keys[0].KeyId, token.Header["kid"])
+}
+
+// waitForMailToken waits until count emails containing a link to path have been sent to email, then returns the token
+// in the last one. Mails are sent in background.
+func (suite *PersonHandlerTestSuite) waitForMailToken(email string, path string, count int) string {
+	linkRegexp := regexp.MustCompile(`https://splid\.example\.com` + regexp.QuoteMeta(path) + `\?token=(\S+)`)
+	var matches [][]string
+	suite.Require().Eventually(func() bool {
+		matches = nil
+		for _, m := range suite.mailer.MessagesTo(email) {
+			if match := linkRegexp.FindStringSubmatch(m.Body); match != nil {
+				matches = append(matches, match)
+			}
+		}
+		return len(matches) == count
+	}, 5*time.Second, 10*time.Millisecond)
+	token, err := url.QueryUnescape(matches[len(matches)-1][1])
+	suite.Require().NoError(err)
+	return token
+}
+
+func (suite *PersonHandlerTestSuite) TestPasswordReset() {
+	_, err := suite.personService.CreatePerson(context.Background(), "person", "email@mail.com", "password123")
+	suite.Require().NoError(err)
+	response := suite.POST("/api/v1/person/login", internalHttp.LoginRequestBody{Email: "email@mail.com", Password: "password123"})
+	suite.Require().Equal(http.StatusOK, response.Code)
+	login := ExtractBody[internalHttp.LoginResponseBody](response)
+
+	response = suite.POST("/api/v1/person/password-reset/request", internalHttp.RequestPasswordResetRequestBody{Email: "email@mail.com"})
+	suite.Require().Equal(http.StatusAccepted, response.Code)
+	firstToken := suite.waitForMailToken("email@mail.com", "/reset-password", 1)
+
+	// a second request right away is accepted but mails nothing
+	response = suite.POST("/api/v1/person/password-reset/request", internalHttp.RequestPasswordResetRequestBody{Email: "email@mail.com"})
+	suite.Require().Equal(http.StatusAccepted, response.Code)
+	time.Sleep(100 * time.Millisecond)
+	suite.Equal(firstToken, suite.waitForMailToken("email@mail.com", "/reset-password", 1))
+
+	_, err = suite.db.ExecContext(context.Background(), `UPDATE person_token SET created_at = created_at - $1::interval`, person.PasswordResetEmailInterval.String())
+	suite.Require().NoError(err)
+	response = suite.POST("/api/v1/person/password-reset/request", internalHttp.RequestPasswordResetRequestBody{Email: "email@mail.com"})
+	suite.Require().Equal(http.StatusAccepted, response.Code)
+	token := suite.waitForMailToken("email@mail.com", "/reset-password", 2)
+
+	confirm := internalHttp.ConfirmPasswordResetRequestBody{Token: token, Password: "newPassword123", ConfirmPassword: "newPassword123"}
+	response = suite.POST("/api/v1/person/password-reset/confirm", confirm)
+	suite.Require().Equal(http.StatusNoContent, response.Code)
+
+	// tokens are single use, and resetting invalidates the other outstanding tokens
+	response = suite.POST("/api/v1/person/password-reset/confirm", confirm)
+	suite.Equal(http.StatusBadRequest, response.Code)
+	confirm.Token = firstToken
+	response = suite.POST("/api/v1/person/password-reset/confirm", confirm)
+	suite.Equal(http.StatusBadRequest, response.Code)
+
+	// existing sessions are revoked
+	suite.Equal(http.StatusUnauthorized, suite.GETWithJwt("/api/v1/person", login.SignedToken).Code)
+	response = suite.POST("/api/v1/person/token/refresh", internalHttp.RefreshTokenRequestBody{RefreshToken: login.RefreshToken})
+	suite.Equal(http.StatusUnauthorized, response.Code)
+
+	response = suite.POST("/api/v1/person/login", internalHttp.LoginRequestBody{Email: "email@mail.com", Password: "password123"})
+	suite.Equal(http.StatusUnauthorized, response.Code)
+	response = suite.POST("/api/v1/person/login", internalHttp.LoginRequestBody{Email: "email@mail.com", Password: "newPassword123"})
+	suite.Equal(http.StatusOK, response.Code)
+}
+
+func (suite *PersonHandlerTestSuite) TestPasswordResetDoesNotRevealUnknownEmails() {
+	response := suite.POST("/api/v1/person/password-reset/request", internalHttp.RequestPasswordResetRequestBody{Email: "nobody@mail.com"})
+	suite.Equal(http.StatusAccepted, response.Code)
+	suite.Empty(response.Body.String())
+	suite.Empty(suite.mailer.Messages())
+}
+
+func (suite *PersonHandlerTestSuite) TestEmailVerification() {
+	p, token := suite.GetLoggedInPerson()
+	suite.Nil(p.EmailVerifiedAt)
+	verificationToken := suite.waitForMailToken(p.Email, "/verify-email", 1)
+
+	// the signup mail has just been sent
+	response := suite.POSTWithJwt("/api/v1/person/email-verification/resend", nil, token)
+	suite.Equal(http.StatusTooManyRequests, response.Code)
+
+	response = suite.POST("/api/v1/person/email-verification/confirm", internalHttp.VerifyEmailRequestBody{Token: "wrong"})
+	suite.Equal(http.StatusBadRequest, response.Code)
+	response = suite.POST("/api/v1/person/email-verification/confirm", internalHttp.VerifyEmailRequestBody{Token: verificationToken})
+	suite.Equal(http.StatusNoContent, response.Code)
+
+	response = suite.GETWithJwt("/api/v1/person", token)
+	suite.Require().Equal(http.StatusOK, response.Code)
+	suite.NotNil(ExtractBody[person.Person](response).EmailVerifiedAt)
+
+	response = suite.POSTWithJwt("/api/v1/person/email-verification/resend", nil, token)
+	suite.Equal(http.StatusConflict, response.Code)
+}
+
+func (suite *PersonHandlerTestSuite) TestUpdateName() {
+	_, token := suite.GetLoggedInPerson()
+
+	response := suite.PATCHWithJwt("/api/v1/person", internalHttp.UpdatePersonRequestBody{Name: "  "}, token)
+	suite.Equal(http.StatusBadRequest, response.Code)
+
+	response = suite.PATCHWithJwt("/api/v1/person", internalHttp.UpdatePersonRequestBody{Name: "new name"}, token)
+	suite.Require().Equal(http.StatusOK, response.Code)
+	suite.Equal("new name", ExtractBody[person.Person](response).Name)
+	suite.Equal("new name", ExtractBody[person.Person](suite.GETWithJwt("/api/v1/person", token)).Name)
+}
+
+func (suite *PersonHandlerTestSuite) TestChangeEmail() {
+	_, err := suite.personService.CreatePerson(context.Background(), "other", "taken@mail.com", "password123")
+	suite.Require().NoError(err)
+	p, token := suite.GetLoggedInPerson()
+	oldVerificationToken := suite.waitForMailToken(p.Email, "/verify-email", 1)
+
+	response := suite.PUTWithJwt("/api/v1/person/email", internalHttp.ChangeEmailRequestBody{Email: "new@mail.com", Password: "wrong"}, token)
+	suite.Equal(http.StatusUnauthorized, response.Code)
+	response = suite.PUTWithJwt("/api/v1/person/email", internalHttp.ChangeEmailRequestBody{Email: "TAKEN@mail.com", Password: "password123"}, token)
+	suite.Equal(http.StatusConflict, response.Code)
+
+	response = suite.PUTWithJwt("/api/v1/person/email", internalHttp.ChangeEmailRequestBody{Email: "new@mail.com", Password: "password123"}, token)
+	suite.Require().Equal(http.StatusOK, response.Code)
+	got := ExtractBody[person.Person](response)
+	suite.Equal("new@mail.com", got.Email)
+	suite.Nil(got.EmailVerifiedAt)
+
+	// the link sent to the old address does not verify the new one
+	response = suite.POST("/api/v1/person/email-verification/confirm", internalHttp.VerifyEmailRequestBody{Token: oldVerificationToken})
+	suite.Equal(http.StatusBadRequest, response.Code)
+	newVerificationToken := suite.waitForMailToken("new@mail.com", "/verify-email", 1)
+	response = suite.POST("/api/v1/person/email-verification/confirm", internalHttp.VerifyEmailRequestBody{Token: newVerificationToken})
+	suite.Equal(http.StatusNoContent, response.Code)
+
+	suite.Eventually(func() bool {
+		for _, m := range suite.mailer.MessagesTo(p.Email) {
+			if m.Subject == "Your email has been changed" {
+				return true
+			}
+		}
+		return false
+	}, 5*time.Second, 10*time.Millisecond)
+
+	response = suite.POST("/api/v1/person/login", internalHttp.LoginRequestBody{Email: "new@mail.com", Password: "password123"})
+	suite.Equal(http.StatusOK, response.Code)
+}
+
+func (suite *PersonHandlerTestSuite) TestChangePassword() {
+	p, token := suite.GetLoggedInPerson()
+	response := suite.POST("/api/v1/person/login", internalHttp.LoginRequestBody{Email: p.Email, Password: "password123"})
+	suite.Require().Equal(http.StatusOK, response.Code)
+	otherDevice := ExtractBody[internalHttp.LoginResponseBody](response)
+
+	body := internalHttp.ChangePasswordRequestBody{CurrentPassword: "wrong", Password: "newPassword123", ConfirmPassword: "newPassword123"}
+	response = suite.PUTWithJwt("/api/v1/person/password", body, token)
+	suite.Equal(http.StatusUnauthorized, response.Code)
+
+	body.CurrentPassword = "password123"
+	response = suite.PUTWithJwt("/api/v1/person/password", body, token)
+	suite.Require().Equal(http.StatusNoContent, response.Code)
+
+	suite.Equal(http.StatusOK, suite.GETWithJwt("/api/v1/person", token).Code, "the current session is kept")
+	suite.Equal(http.StatusUnauthorized, suite.GETWithJwt("/api/v1/person", otherDevice.SignedToken).Code)
+
+	response = suite.POST("/api/v1/person/login", internalHttp.LoginRequestBody{Email: p.Email, Password: "newPassword123"})
+	suite.Equal(http.StatusOK, response.Code)
+}
+
+// totpNow plays the authenticator app, see RFC 6238
+func totpNow(secret string) string {
+	key, _ := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(secret)
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(time.Now().Unix()/30))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	return fmt.Sprintf("%06d", (binary.BigEndian.Uint32(sum[offset:offset+4])&0x7fffffff)%1_000_000)
+}
+
+func (suite *PersonHandlerTestSuite) TestTotpTwoStepLogin() {
+	p, token := suite.GetLoggedInPerson()
+
+	response := suite.POSTWithJwt("/api/v1/person/2fa/totp", nil, token)
+	suite.Require().Equal(http.StatusOK, response.Code)
+	enrollment := ExtractBody[person.TotpEnrollment](response)
+	suite.Contains(enrollment.ProvisioningUri, "otpauth://totp/")
+
+	response = suite.POSTWithJwt("/api/v1/person/2fa/totp/confirm", internalHttp.ConfirmTotpEnrollmentRequestBody{Code: "000000"}, token)
+	suite.Equal(http.StatusBadRequest, response.Code)
+	response = suite.POSTWithJwt("/api/v1/person/2fa/totp/confirm", internalHttp.ConfirmTotpEnrollmentRequestBody{Code: totpNow(enrollment.Secret)}, token)
+	suite.Require().Equal(http.StatusOK, response.Code)
+	recoveryCodes := ExtractBody[internalHttp.ConfirmTotpEnrollmentResponseBody](response).RecoveryCodes
+	suite.Len(recoveryCodes, person.RecoveryCodeCount)
+
+	// the password alone only gives a challenge token, which does not authenticate requests
+	response = suite.POST("/api/v1/person/login", internalHttp.LoginRequestBody{Email: p.Email, Password: "password123"})
+	suite.Require().Equal(http.StatusOK, response.Code)
+	challenge := ExtractBody[internalHttp.TwoFactorChallengeResponseBody](response)
+	suite.True(challenge.TwoFactorRequired)
+	suite.Equal(http.StatusUnauthorized, suite.GETWithJwt("/api/v1/person", challenge.ChallengeToken).Code)
+
+	response = suite.POST("/api/v1/person/login/2fa", internalHttp.LoginSecondFactorRequestBody{ChallengeToken: challenge.ChallengeToken, Code: "not-a-code"})
+	suite.Equal(http.StatusUnauthorized, response.Code)
+	response = suite.POST("/api/v1/person/login/2fa", internalHttp.LoginSecondFactorRequestBody{ChallengeToken: "forged", Code: recoveryCodes[0]})
+	suite.Equal(http.StatusUnauthorized, response.Code)
+
+	response = suite.POST("/api/v1/person/login/2fa", internalHttp.LoginSecondFactorRequestBody{ChallengeToken: challenge.ChallengeToken, Code: recoveryCodes[0]})
+	suite.Require().Equal(http.StatusOK, response.Code)
+	tokens := ExtractBody[internalHttp.LoginResponseBody](response)
+	suite.Equal(http.StatusOK, suite.GETWithJwt("/api/v1/person", tokens.SignedToken).Code)
+
+	response = suite.POST("/api/v1/person/login/2fa", internalHttp.LoginSecondFactorRequestBody{ChallengeToken: challenge.ChallengeToken, Code: recoveryCodes[0]})
+	suite.Equal(http.StatusUnauthorized, response.Code, "recovery codes work once")
+
+	response = suite.send(http.MethodDelete, "/api/v1/person/2fa/totp", internalHttp.DisableTotpRequestBody{Password: "password123"}, token)
+	suite.Require().Equal(http.StatusNoContent, response.Code)
+	response = suite.POST("/api/v1/person/login", internalHttp.LoginRequestBody{Email: p.Email, Password: "password123"})
+	suite.Require().Equal(http.StatusOK, response.Code)
+	suite.NotEmpty(ExtractBody[internalHttp.LoginResponseBody](response).SignedToken)
+}
@@ -0,0 +1,92 @@
+//go:build integration
+
+package http_test
+
+import (
+	"context"
+	"fmt"
+	"github.com/antoniobelotti/splid_backend_clone/integration_tests"
+	"github.com/antoniobelotti/splid_backend_clone/internal/expense"
+	"github.com/antoniobelotti/splid_backend_clone/internal/group"
+	internal_http "github.com/antoniobelotti/splid_backend_clone/internal/http"
+	"github.com/antoniobelotti/splid_backend_clone/internal/http/problem"
+	"github.com/antoniobelotti/splid_backend_clone/internal/mailer"
+	"github.com/antoniobelotti/splid_backend_clone/internal/person"
+	"github.com/antoniobelotti/splid_backend_clone/internal/recurring"
+	"github.com/antoniobelotti/splid_backend_clone/internal/transfer"
+	"github.com/stretchr/testify/suite"
+	psqlcont "github.com/testcontainers/testcontainers-go/modules/postgres"
+	"net/http"
+	"testing"
+	"time"
+)
+
+type RecurringExpenseHandlerTestSuite struct {
+	testSuiteHttp
+	psqlContainer    *psqlcont.PostgresContainer
+	personService    person.Service
+	groupService     group.Service
+	recurringService recurring.Service
+}
+
+func TestRecurringExpenseHandlerTestSuite(t *testing.T) {
+	suite.Run(t, new(RecurringExpenseHandlerTestSuite))
+}
+
+func (suite *RecurringExpenseHandlerTestSuite) TearDownTest() {
+	_ = suite.psqlContainer.Terminate(context.Background())
+}
+
+func (suite *RecurringExpenseHandlerTestSuite) SetupTest() {
+	db, cont := integration_tests.GetCleanContainerizedPsqlDb()
+
+	suite.psqlContainer = cont
+	suite.personService = person.NewService(db, mailer.NewInMemoryMailer(), "")
+	es := expense.NewService(db)
+	suite.groupService = group.NewService(db, es, transfer.NewService(db))
+	suite.recurringService = recurring.NewService(db, es)
+
+	suite.server = newTestServer(suite.T(), db, internal_http.Dependencies{
+		Person:    suite.personService,
+		Group:     suite.groupService,
+		Recurring: suite.recurringService,
+	})
+}
+
+// createTemplate creates a group, owned by someone else than the logged in person, with a recurring expense
+func (suite *RecurringExpenseHandlerTestSuite) createTemplate() group.Group {
+	ctx := context.Background()
+	owner, err := suite.personService.CreatePerson(ctx, "owner", "owner@email.com", "password123")
+	suite.Require().NoError(err)
+	g, err := suite.groupService.CreateGroup(ctx, "testGroup", owner.Id)
+	suite.Require().NoError(err)
+	_, err = suite.recurringService.CreateTemplate(ctx, recurring.Template{
+		AmountInCents: 1000,
+		PersonId:      owner.Id,
+		GroupId:       g.Id,
+		Frequency:     recurring.Monthly,
+		StartDate:     time.Now().AddDate(0, 1, 0),
+	})
+	suite.Require().NoError(err)
+	return g
+}
+
+func (suite *RecurringExpenseHandlerTestSuite) TestGetRecurringExpensesAsMember() {
+	g := suite.createTemplate()
+	p, signedToken := suite.GetLoggedInPerson()
+	_, err := suite.groupService.JoinGroup(context.Background(), g.Id, g.InvitationCode, p.Id)
+	suite.Require().NoError(err)
+
+	response := suite.GETWithJwt(fmt.Sprintf("/api/v1/group/%d/recurring-expense", g.Id), signedToken)
+	suite.Equal(http.StatusOK, response.Code)
+	suite.Len(ExtractBody[[]recurring.Template](response), 1)
+}
+
+func (suite *RecurringExpenseHandlerTestSuite) TestGetRecurringExpensesFailIfNotInGroup() {
+	g := suite.createTemplate()
+	_, signedToken := suite.GetLoggedInPerson()
+
+	response := suite.GETWithJwt(fmt.Sprintf("/api/v1/group/%d/recurring-expense", g.Id), signedToken)
+	suite.Equal(http.StatusForbidden, response.Code)
+	suite.Equal(recurring.ErrPersonNotInGroup.Code, ExtractBody[problem.Problem](response).Code)
+}
@@ -0,0 +1,119 @@
+//go:build integration
+
+package http_test
+
+import (
+	"context"
+	"fmt"
+	"github.com/antoniobelotti/splid_backend_clone/integration_tests"
+	"github.com/antoniobelotti/splid_backend_clone/internal/expense"
+	"github.com/antoniobelotti/splid_backend_clone/internal/group"
+	internal_http "github.com/antoniobelotti/splid_backend_clone/internal/http"
+	"github.com/antoniobelotti/splid_backend_clone/internal/mailer"
+	"github.com/antoniobelotti/splid_backend_clone/internal/person"
+	"github.com/antoniobelotti/splid_backend_clone/internal/tracing"
+	"github.com/antoniobelotti/splid_backend_clone/internal/transfer"
+	"github.com/stretchr/testify/suite"
+	psqlcont "github.com/testcontainers/testcontainers-go/modules/postgres"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type TracingTestSuite struct {
+	testSuiteHttp
+	psqlContainer *psqlcont.PostgresContainer
+	groupService  group.Service
+	spans         *tracetest.InMemoryExporter
+}
+
+func TestTracingTestSuite(t *testing.T) {
+	suite.Run(t, new(TracingTestSuite))
+}
+
+// SetupSuite - the tracers of the packages are bound to the first provider installed
+func (suite *TracingTestSuite) SetupSuite() {
+	suite.spans = tracetest.NewInMemoryExporter()
+	tracing.Install(sdktrace.NewTracerProvider(sdktrace.WithSyncer(suite.spans)))
+}
+
+func (suite *TracingTestSuite) TearDownTest() {
+	_ = suite.psqlContainer.Terminate(context.Background())
+}
+
+func (suite *TracingTestSuite) SetupTest() {
+	db, cont := integration_tests.GetCleanContainerizedPsqlDb()
+	suite.psqlContainer = cont
+
+	ps := person.NewService(db, mailer.NewInMemoryMailer(), "")
+	suite.groupService = group.NewService(db, expense.NewService(db), transfer.NewService(db))
+	suite.server = newTestServer(suite.T(), db, internal_http.Dependencies{Person: ps, Group: suite.groupService})
+}
+
+func (suite *TracingTestSuite) TestBalanceRequestIsTraced() {
+	p, token := suite.GetLoggedInPerson()
+	g, err := suite.groupService.CreateGroup(context.Background(), "traced", p.Id)
+	suite.Require().NoError(err)
+	suite.spans.Reset()
+
+	req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/api/v1/group/%d/balance", g.Id), nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	response := httptest.NewRecorder()
+	suite.server.ServeHTTP(response, req)
+	suite.Require().Equal(http.StatusOK, response.Code)
+
+	byName := make(map[string]tracetest.SpanStub)
+	children := make(map[trace.SpanID][]tracetest.SpanStub)
+	for _, span := range suite.spans.GetSpans() {
+		suite.Equal("4bf92f3577b34da6a3ce929d0e0e4736", span.SpanContext.TraceID().String(), span.Name)
+		byName[span.Name] = span
+		children[span.Parent.SpanID()] = append(children[span.Parent.SpanID()], span)
+	}
+
+	server, ok := byName["GET /api/v1/group/:groupId/balance"]
+	suite.Require().True(ok)
+	balance, ok := byName["group.GetGroupBalance"]
+	suite.Require().True(ok)
+	suite.Equal(server.SpanContext.SpanID(), balance.Parent.SpanID())
+
+	// the four reads of the balance, each with spans of its own for the queries, then the computation
+	var queries int
+	var walk func(id trace.SpanID)
+	walk = func(id trace.SpanID) {
+		for _, child := range children[id] {
+			if child.Name == "sql.conn.query" {
+				queries++
+			}
+			walk(child.SpanContext.SpanID())
+		}
+	}
+	walk(balance.SpanContext.SpanID())
+	suite.GreaterOrEqual(queries, 4)
+	suite.Contains(byName, "group.calculateGroupBalance")
+}
+
+func (suite *TracingTestSuite) TestFailuresAreRecordedOnTheSpans() {
+	p, _ := suite.GetLoggedInPerson()
+	suite.spans.Reset()
+
+	response := suite.POST("/api/v1/person/login", internal_http.LoginRequestBody{Email: p.Email, Password: "wrong"})
+	suite.Require().Equal(http.StatusUnauthorized, response.Code)
+
+	byName := make(map[string]tracetest.SpanStub)
+	for _, span := range suite.spans.GetSpans() {
+		byName[span.Name] = span
+	}
+	suite.Contains(byName, "authentication.ReserveLoginAttempt")
+	suite.Contains(byName, "authentication.CompleteLoginAttempt")
+	authenticate, ok := byName["person.Authenticate"]
+	suite.Require().True(ok)
+	suite.Equal(codes.Error, authenticate.Status.Code)
+	suite.Equal(person.ErrInvalidCredentials.Error(), authenticate.Status.Description)
+	suite.Require().Len(authenticate.Events, 1)
+	suite.Equal("exception", authenticate.Events[0].Name)
+}
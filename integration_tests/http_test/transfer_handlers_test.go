@@ -0,0 +1,75 @@
+//go:build integration
+
+package http_test
+
+import (
+	"context"
+	"github.com/antoniobelotti/splid_backend_clone/integration_tests"
+	"github.com/antoniobelotti/splid_backend_clone/internal/expense"
+	"github.com/antoniobelotti/splid_backend_clone/internal/group"
+	internal_http "github.com/antoniobelotti/splid_backend_clone/internal/http"
+	"github.com/antoniobelotti/splid_backend_clone/internal/mailer"
+	"github.com/antoniobelotti/splid_backend_clone/internal/person"
+	"github.com/antoniobelotti/splid_backend_clone/internal/transfer"
+	"github.com/stretchr/testify/suite"
+	psqlcont "github.com/testcontainers/testcontainers-go/modules/postgres"
+	"net/http"
+	"testing"
+)
+
+type TransferHandlerTestSuite struct {
+	testSuiteHttp
+	psqlContainer *psqlcont.PostgresContainer
+	personService person.Service
+	groupService  group.Service
+}
+
+func TestTransferHandlerTestSuite(t *testing.T) {
+	suite.Run(t, new(TransferHandlerTestSuite))
+}
+
+func (suite *TransferHandlerTestSuite) TearDownTest() {
+	_ = suite.psqlContainer.Terminate(context.Background())
+}
+
+func (suite *TransferHandlerTestSuite) SetupTest() {
+	db, cont := integration_tests.GetCleanContainerizedPsqlDb()
+
+	suite.psqlContainer = cont
+	ts := transfer.NewService(db)
+	suite.personService = person.NewService(db, mailer.NewInMemoryMailer(), "")
+	suite.groupService = group.NewService(db, expense.NewService(db), ts)
+
+	suite.server = newTestServer(suite.T(), db, internal_http.Dependencies{
+		Person:   suite.personService,
+		Group:    suite.groupService,
+		Transfer: ts,
+	})
+}
+
+func (suite *TransferHandlerTestSuite) TestCreateTransferChecksValidation() {
+	ctx := context.Background()
+	p, signedToken := suite.GetLoggedInPerson()
+	g, err := suite.groupService.CreateGroup(ctx, "testGroup", p.Id)
+	suite.Require().NoError(err)
+	receiver, err := suite.personService.CreatePerson(ctx, "receiver", "receiver@mail.com", "password123")
+	suite.Require().NoError(err)
+	suite.Require().NoError(suite.groupService.AddPersonToGroup(ctx, g, receiver.Id))
+
+	table := []struct {
+		requestBody  internal_http.CreateTransferRequestBody
+		invalidParam string
+	}{
+		{internal_http.CreateTransferRequestBody{AmountInCents: 0, GroupId: g.Id, ReceiverId: receiver.Id}, "amount-in-cents"},
+		{internal_http.CreateTransferRequestBody{AmountInCents: -100, GroupId: g.Id, ReceiverId: receiver.Id}, "amount-in-cents"},
+		{internal_http.CreateTransferRequestBody{AmountInCents: 100, ReceiverId: receiver.Id}, "group-id"},
+	}
+	for _, tc := range table {
+		response := suite.POSTWithJwt("/api/v1/transfer", tc.requestBody, signedToken)
+		suite.Equal(http.StatusBadRequest, response.Code)
+		suite.requireInvalidParam(response, tc.invalidParam)
+	}
+
+	response := suite.POSTWithJwt("/api/v1/transfer", internal_http.CreateTransferRequestBody{AmountInCents: 100, GroupId: g.Id, ReceiverId: receiver.Id}, signedToken)
+	suite.Equal(http.StatusCreated, response.Code)
+}
@@ -7,10 +7,14 @@ import (
 	"encoding/json"
 	"fmt"
 	internal_http "github.com/antoniobelotti/splid_backend_clone/internal/http"
+	"github.com/antoniobelotti/splid_backend_clone/internal/http/authentication"
+	"github.com/antoniobelotti/splid_backend_clone/internal/http/problem"
 	"github.com/antoniobelotti/splid_backend_clone/internal/person"
+	"github.com/antoniobelotti/splid_backend_clone/internal/postgresdb"
 	"github.com/stretchr/testify/suite"
 	"net/http"
 	"net/http/httptest"
+	"testing"
 	"time"
 )
 
@@ -28,8 +32,20 @@ func (suite *testSuiteHttp) POSTWithJwt(endpoint string, requestBody any, jwtTok
 }
 
 func (suite *testSuiteHttp) post(endpoint string, requestBody any, jwtToken string) *httptest.ResponseRecorder {
+	return suite.send(http.MethodPost, endpoint, requestBody, jwtToken)
+}
+
+func (suite *testSuiteHttp) PUTWithJwt(endpoint string, requestBody any, jwtToken string) *httptest.ResponseRecorder {
+	return suite.send(http.MethodPut, endpoint, requestBody, jwtToken)
+}
+
+func (suite *testSuiteHttp) PATCHWithJwt(endpoint string, requestBody any, jwtToken string) *httptest.ResponseRecorder {
+	return suite.send(http.MethodPatch, endpoint, requestBody, jwtToken)
+}
+
+func (suite *testSuiteHttp) send(method string, endpoint string, requestBody any, jwtToken string) *httptest.ResponseRecorder {
 	jsonBody, _ := json.Marshal(requestBody)
-	req := httptest.NewRequest(http.MethodPost, endpoint, bytes.NewBuffer(jsonBody))
+	req := httptest.NewRequest(method, endpoint, bytes.NewBuffer(jsonBody))
 	req.Header.Set("Content-Type", "application/json")
 	if jwtToken != "" {
 		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", jwtToken))
@@ -66,6 +82,18 @@ func ExtractBody[T any](rr *httptest.ResponseRecorder) T {
 	return body
 }
 
+// requireInvalidParam checks the response is a validation problem reporting the named field
+func (suite *testSuiteHttp) requireInvalidParam(response *httptest.ResponseRecorder, name string) {
+	suite.Require().Equal(problem.ContentType, response.Header().Get("Content-Type"))
+	p := ExtractBody[problem.Problem](response)
+	suite.Require().Equal(problem.CodeValidationFailed, p.Code)
+	var names []string
+	for _, invalidParam := range p.InvalidParams {
+		names = append(names, invalidParam.Name)
+	}
+	suite.Contains(names, name)
+}
+
 // GetLoggedInPerson performs an authentication flow and returns the Person struct plus valid jwt token
 func (suite *testSuiteHttp) GetLoggedInPerson() (person.Person, string) {
 
@@ -88,3 +116,21 @@ func (suite *testSuiteHttp) GetLoggedInPerson() (person.Person, string) {
 
 	return p, loginRespBody.SignedToken
 }
+
+// newAuthService returns an authentication service signing tokens with a throwaway key
+func newAuthService(t *testing.T, db *postgresdb.PostgresDatabase) authentication.Service {
+	keys, err := authentication.NewEphemeralKeyManager()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return authentication.NewService(db, keys, authentication.NewLoginGuard(db, authentication.DefaultLoginGuardConfig()))
+}
+
+// newTestServer returns the REST server of deps, the services left out being zero values. Tokens are signed with a
+// throwaway key unless deps.Auth is set.
+func newTestServer(t *testing.T, db *postgresdb.PostgresDatabase, deps internal_http.Dependencies) internal_http.RESTServer {
+	if deps.Auth == (authentication.Service{}) {
+		deps.Auth = newAuthService(t, db)
+	}
+	return internal_http.NewRESTServer(deps)
+}
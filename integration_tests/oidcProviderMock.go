@@ -0,0 +1,194 @@
+//go:build integration
+
+package integration_tests
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/golang-jwt/jwt/v5"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// MockOidcIdentity - who signs in at the mock provider
+type MockOidcIdentity struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+}
+
+type mockAuthorization struct {
+	identity      MockOidcIdentity
+	redirectUri   string
+	codeChallenge string
+	nonce         string
+}
+
+// MockOidcProvider - a minimal OpenID Connect provider: discovery, authorization code flow with PKCE, RS256 id tokens.
+// Its authorization endpoint does not ask anything: it signs in as Identity and redirects back straight away.
+type MockOidcProvider struct {
+	*httptest.Server
+	ClientId     string
+	ClientSecret string
+
+	mu       sync.Mutex
+	identity MockOidcIdentity
+	codes    map[string]mockAuthorization
+	key      *rsa.PrivateKey
+}
+
+func NewMockOidcProvider() *MockOidcProvider {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic(err)
+	}
+	m := &MockOidcProvider{
+		ClientId:     "splid",
+		ClientSecret: "secret",
+		codes:        map[string]mockAuthorization{},
+		key:          key,
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", m.handleDiscovery)
+	mux.HandleFunc("/authorize", m.handleAuthorize)
+	mux.HandleFunc("/token", m.handleToken)
+	mux.HandleFunc("/jwks", m.handleJwks)
+	m.Server = httptest.NewServer(mux)
+	return m
+}
+
+// SignInAs sets the identity of the next logins
+func (m *MockOidcProvider) SignInAs(identity MockOidcIdentity) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.identity = identity
+}
+
+func writeJson(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+func (m *MockOidcProvider) handleDiscovery(w http.ResponseWriter, _ *http.Request) {
+	writeJson(w, http.StatusOK, map[string]any{
+		"issuer":                                m.URL,
+		"authorization_endpoint":                m.URL + "/authorize",
+		"token_endpoint":                        m.URL + "/token",
+		"jwks_uri":                              m.URL + "/jwks",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"code_challenge_methods_supported":      []string{"S256"},
+	})
+}
+
+func (m *MockOidcProvider) handleAuthorize(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if q.Get("client_id") != m.ClientId || q.Get("response_type") != "code" || q.Get("code_challenge_method") != "S256" || q.Get("code_challenge") == "" {
+		http.Error(w, "invalid authorization request", http.StatusBadRequest)
+		return
+	}
+
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+	code := base64.RawURLEncoding.EncodeToString(b)
+	m.mu.Lock()
+	m.codes[code] = mockAuthorization{
+		identity:      m.identity,
+		redirectUri:   q.Get("redirect_uri"),
+		codeChallenge: q.Get("code_challenge"),
+		nonce:         q.Get("nonce"),
+	}
+	m.mu.Unlock()
+
+	redirect, err := url.Parse(q.Get("redirect_uri"))
+	if err != nil {
+		http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+	params := redirect.Query()
+	params.Set("code", code)
+	params.Set("state", q.Get("state"))
+	redirect.RawQuery = params.Encode()
+	http.Redirect(w, r, redirect.String(), http.StatusFound)
+}
+
+func (m *MockOidcProvider) handleToken(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeJson(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+	clientId, clientSecret, ok := r.BasicAuth()
+	if !ok {
+		clientId, clientSecret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	}
+	if clientId != m.ClientId || clientSecret != m.ClientSecret {
+		writeJson(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+
+	m.mu.Lock()
+	authorization, ok := m.codes[r.PostForm.Get("code")]
+	delete(m.codes, r.PostForm.Get("code"))
+	m.mu.Unlock()
+
+	challenge := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if !ok || r.PostForm.Get("grant_type") != "authorization_code" ||
+		r.PostForm.Get("redirect_uri") != authorization.redirectUri ||
+		base64.RawURLEncoding.EncodeToString(challenge[:]) != authorization.codeChallenge {
+		writeJson(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	now := time.Now()
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss":            m.URL,
+		"sub":            authorization.identity.Subject,
+		"aud":            m.ClientId,
+		"exp":            now.Add(time.Minute).Unix(),
+		"iat":            now.Unix(),
+		"nonce":          authorization.nonce,
+		"email":          authorization.identity.Email,
+		"email_verified": authorization.identity.EmailVerified,
+		"name":           authorization.identity.Name,
+	})
+	token.Header["kid"] = "mock"
+	idToken, err := token.SignedString(m.key)
+	if err != nil {
+		writeJson(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+
+	writeJson(w, http.StatusOK, map[string]any{
+		"access_token": "mock-access-token",
+		"token_type":   "Bearer",
+		"expires_in":   60,
+		"id_token":     idToken,
+	})
+}
+
+func (m *MockOidcProvider) handleJwks(w http.ResponseWriter, _ *http.Request) {
+	writeJson(w, http.StatusOK, map[string]any{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "mock",
+			"use": "sig",
+			"alg": "RS256",
+			"n":   base64.RawURLEncoding.EncodeToString(m.key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(m.key.E)).Bytes()),
+		}},
+	})
+}
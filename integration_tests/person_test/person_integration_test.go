@@ -7,9 +7,11 @@ import (
 	"errors"
 	"fmt"
 	"github.com/antoniobelotti/splid_backend_clone/integration_tests"
+	"github.com/antoniobelotti/splid_backend_clone/internal/mailer"
 	"github.com/antoniobelotti/splid_backend_clone/internal/person"
 	"github.com/stretchr/testify/suite"
 	psqlcont "github.com/testcontainers/testcontainers-go/modules/postgres"
+	"sync"
 	"testing"
 )
 
@@ -22,7 +24,7 @@ type PersonTestSuite struct {
 func (suite *PersonTestSuite) SetupTest() {
 	db, cont := integration_tests.GetCleanContainerizedPsqlDb()
 	suite.psqlContainer = cont
-	suite.personService = person.NewService(db)
+	suite.personService = person.NewService(db, mailer.NewInMemoryMailer(), "")
 }
 
 func (suite *PersonTestSuite) TearDownTest() {
@@ -50,3 +52,29 @@ func (suite *PersonTestSuite) TestCreatePersonReturnsCorrectId() {
 	suite.Require().NoError(err)
 	suite.Equal(2, p2.Id)
 }
+
+func (suite *PersonTestSuite) TestConcurrentFirstLoginsWithExternalIdentity() {
+	identity := person.ExternalIdentity{Provider: "google", Subject: "42", Email: "new@mail.com", EmailVerified: true}
+	const logins = 10
+
+	ids := make(chan int, logins)
+	var wg sync.WaitGroup
+	for i := 0; i < logins; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			p, err := suite.personService.LoginWithExternalIdentity(context.Background(), identity)
+			if suite.NoError(err) {
+				ids <- p.Id
+			}
+		}()
+	}
+	wg.Wait()
+	close(ids)
+
+	p, err := suite.personService.GetPersonByEmail(context.Background(), identity.Email)
+	suite.Require().NoError(err)
+	for id := range ids {
+		suite.Equal(p.Id, id, "every login resolves to the person the first one created")
+	}
+}
@@ -59,3 +59,11 @@ func GetCleanContainerizedPsqlDb() (*postgresdb.PostgresDatabase, *postgrestc.Po
 
 	return db, container
 }
+
+// VerifyEmail marks the email of the person as verified, as if they had followed the link of the verification email
+func VerifyEmail(db *postgresdb.PostgresDatabase, personId int) {
+	_, err := db.Exec(`UPDATE person SET email_verified_at=now() WHERE id=$1`, personId)
+	if err != nil {
+		panic(err.Error())
+	}
+}
@@ -0,0 +1,85 @@
+//go:build integration
+
+package recurring_test
+
+import (
+	"context"
+	"github.com/antoniobelotti/splid_backend_clone/integration_tests"
+	"github.com/antoniobelotti/splid_backend_clone/internal/expense"
+	"github.com/antoniobelotti/splid_backend_clone/internal/group"
+	"github.com/antoniobelotti/splid_backend_clone/internal/mailer"
+	"github.com/antoniobelotti/splid_backend_clone/internal/person"
+	"github.com/antoniobelotti/splid_backend_clone/internal/postgresdb"
+	"github.com/antoniobelotti/splid_backend_clone/internal/recurring"
+	"github.com/antoniobelotti/splid_backend_clone/internal/transfer"
+	"github.com/stretchr/testify/suite"
+	psqlcont "github.com/testcontainers/testcontainers-go/modules/postgres"
+	"testing"
+	"time"
+)
+
+type RecurringTestSuite struct {
+	suite.Suite
+	psqlContainer    *psqlcont.PostgresContainer
+	db               *postgresdb.PostgresDatabase
+	recurringService recurring.Service
+	groupService     group.Service
+	personService    person.Service
+}
+
+func (suite *RecurringTestSuite) SetupTest() {
+	db, cont := integration_tests.GetCleanContainerizedPsqlDb()
+	suite.psqlContainer = cont
+	suite.db = db
+	es := expense.NewService(db)
+	suite.recurringService = recurring.NewService(db, es)
+	suite.groupService = group.NewService(db, es, transfer.NewService(db))
+	suite.personService = person.NewService(db, mailer.NewInMemoryMailer(), "")
+}
+
+func (suite *RecurringTestSuite) TearDownTest() {
+	_ = suite.psqlContainer.Terminate(context.Background())
+}
+
+func TestRecurringTestSuite(t *testing.T) {
+	suite.Run(t, new(RecurringTestSuite))
+}
+
+// TestFailingTemplatesDoNotStarveTheOthers - more than a batch of failing templates are due before a valid one
+func (suite *RecurringTestSuite) TestFailingTemplatesDoNotStarveTheOthers() {
+	ctx := context.Background()
+	owner, err := suite.personService.CreatePerson(ctx, "owner", "owner@email.com", "testtest123")
+	suite.Require().NoError(err)
+	leaver, err := suite.personService.CreatePerson(ctx, "leaver", "leaver@email.com", "testtest123")
+	suite.Require().NoError(err)
+	g, err := suite.groupService.CreateGroup(ctx, "testgroup", owner.Id)
+	suite.Require().NoError(err)
+	suite.Require().NoError(suite.groupService.AddPersonToGroup(ctx, g, leaver.Id))
+
+	start := time.Date(2023, time.January, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 150; i++ {
+		_, err = suite.recurringService.CreateTemplate(ctx, recurring.Template{AmountInCents: 1000, PersonId: leaver.Id, GroupId: g.Id, Frequency: recurring.Monthly, StartDate: start})
+		suite.Require().NoError(err)
+	}
+	valid, err := suite.recurringService.CreateTemplate(ctx, recurring.Template{AmountInCents: 1000, PersonId: owner.Id, GroupId: g.Id, Frequency: recurring.Monthly, StartDate: start.AddDate(0, 0, 1)})
+	suite.Require().NoError(err)
+	_, err = suite.db.ExecContext(ctx, `DELETE FROM group_person WHERE person_id=$1`, leaver.Id)
+	suite.Require().NoError(err)
+
+	now := start.AddDate(0, 0, 1)
+	created, err := suite.recurringService.MaterializeDue(ctx, now)
+	suite.Require().NoError(err)
+	suite.Equal(1, created)
+	stored, err := suite.db.GetRecurringExpenseById(ctx, valid.Id)
+	suite.Require().NoError(err)
+	suite.Equal(1, stored.OccurrenceCount)
+
+	// the failing templates wait for their backoff
+	due, err := suite.db.GetDueRecurringExpenses(ctx, now, 200)
+	suite.Require().NoError(err)
+	suite.Empty(due)
+	due, err = suite.db.GetDueRecurringExpenses(ctx, now.Add(recurring.DefaultSchedulerInterval), 200)
+	suite.Require().NoError(err)
+	suite.Len(due, 150)
+	suite.Equal(1, due[0].FailureCount)
+}
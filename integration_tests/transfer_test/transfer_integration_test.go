@@ -7,6 +7,7 @@ import (
 	"github.com/antoniobelotti/splid_backend_clone/integration_tests"
 	"github.com/antoniobelotti/splid_backend_clone/internal/expense"
 	"github.com/antoniobelotti/splid_backend_clone/internal/group"
+	"github.com/antoniobelotti/splid_backend_clone/internal/mailer"
 	"github.com/antoniobelotti/splid_backend_clone/internal/person"
 	"github.com/antoniobelotti/splid_backend_clone/internal/transfer"
 	"github.com/stretchr/testify/suite"
@@ -27,7 +28,7 @@ func (suite *TransferTestSuite) SetupTest() {
 	suite.psqlContainer = cont
 	suite.transferService = transfer.NewService(db)
 	suite.groupService = group.NewService(db, expense.NewService(db), transfer.NewService(db))
-	suite.personService = person.NewService(db)
+	suite.personService = person.NewService(db, mailer.NewInMemoryMailer(), "")
 }
 
 func (suite *TransferTestSuite) TearDownTest() {
@@ -74,3 +75,20 @@ func (suite *TransferTestSuite) TestCreateTransferFail() {
 	suite.Require().NotNil(err)
 	suite.Require().Empty(e)
 }
+
+func (suite *TransferTestSuite) TestCreateTransferFailIfAmountIsNotPositive() {
+	sender, err := suite.personService.CreatePerson(context.Background(), "person", "email@email.com", "testtest123")
+	suite.Require().NoError(err)
+
+	receiver, err := suite.personService.CreatePerson(context.Background(), "person", "sknvnkvsjnvd@email.com", "testtest123")
+	suite.Require().NoError(err)
+
+	g, err := suite.groupService.CreateGroup(context.Background(), "testgroup", sender.Id)
+	suite.Require().NoError(err)
+	suite.Require().NoError(suite.groupService.AddPersonToGroup(context.Background(), g, receiver.Id))
+
+	for _, amount := range []int{0, -100} {
+		_, err = suite.transferService.CreateTransfer(context.Background(), amount, g.Id, sender.Id, receiver.Id)
+		suite.ErrorIs(err, transfer.ErrInvalidAmount)
+	}
+}
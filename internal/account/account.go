@@ -0,0 +1,172 @@
+package account
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/antoniobelotti/splid_backend_clone/internal/apperror"
+	"github.com/antoniobelotti/splid_backend_clone/internal/attachment"
+	"github.com/antoniobelotti/splid_backend_clone/internal/expense"
+	"github.com/antoniobelotti/splid_backend_clone/internal/group"
+	"github.com/antoniobelotti/splid_backend_clone/internal/person"
+	"github.com/antoniobelotti/splid_backend_clone/internal/recurring"
+	"github.com/antoniobelotti/splid_backend_clone/internal/tracing"
+	"github.com/antoniobelotti/splid_backend_clone/internal/transfer"
+	"go.opentelemetry.io/otel"
+	"golang.org/x/crypto/bcrypt"
+	"io"
+	"path"
+	"time"
+)
+
+var tracer = otel.Tracer("github.com/antoniobelotti/splid_backend_clone/internal/account")
+
+// Export - the personal data we hold about a person
+type Export struct {
+	ExportedAt time.Time     `json:"exported-at"`
+	Profile    person.Person `json:"profile"`
+	Groups     []group.Group `json:"groups"`
+	// Expenses the person recorded, paid or consumed items of
+	Expenses          []expense.Expense       `json:"expenses"`
+	Transfers         []transfer.Transfer     `json:"transfers"`
+	RecurringExpenses []recurring.Template    `json:"recurring-expenses"`
+	Attachments       []attachment.Attachment `json:"attachments"`
+}
+
+type Store interface {
+	GetPersonById(ctx context.Context, id int) (person.Person, error)
+	GetGroupsByPersonId(ctx context.Context, personId int) ([]group.Group, error)
+	GetExpensesByPersonId(ctx context.Context, personId int) ([]expense.Expense, error)
+	GetTransfersByPersonId(ctx context.Context, personId int) ([]transfer.Transfer, error)
+	GetRecurringExpensesByPersonId(ctx context.Context, personId int) ([]recurring.Template, error)
+	GetAttachmentsByUploaderId(ctx context.Context, personId int) ([]attachment.Attachment, error)
+	// AnonymizePerson replaces the personal data of the person with placeholders, deletes their sessions, tokens and
+	// recurring expenses, and keeps their expenses and transfers so that the balances of their groups do not change
+	AnonymizePerson(ctx context.Context, personId int) error
+}
+
+var (
+	ErrAccountDeleted = apperror.New(apperror.Gone, "account_deleted", "account deleted")
+	ErrUnexpected     = apperror.New(apperror.Internal, "unexpected_error", "unexpected error")
+)
+
+type Service struct {
+	store Store
+	blobs attachment.BlobStore
+}
+
+func NewService(store Store, blobs attachment.BlobStore) Service {
+	return Service{store: store, blobs: blobs}
+}
+
+// Export collects the personal data of the person
+func (s *Service) Export(ctx context.Context, personId int) (_ Export, err error) {
+	ctx, span := tracer.Start(ctx, "account.Export")
+	defer func() { tracing.End(span, err) }()
+
+	p, err := s.store.GetPersonById(ctx, personId)
+	if err != nil {
+		return Export{}, err
+	}
+	if p.IsDeleted() {
+		return Export{}, ErrAccountDeleted
+	}
+
+	export := Export{ExportedAt: time.Now().UTC(), Profile: p}
+	if export.Groups, err = s.store.GetGroupsByPersonId(ctx, personId); err != nil {
+		return Export{}, fmt.Errorf("%w %w", ErrUnexpected, err)
+	}
+	if export.Expenses, err = s.store.GetExpensesByPersonId(ctx, personId); err != nil {
+		return Export{}, fmt.Errorf("%w %w", ErrUnexpected, err)
+	}
+	if export.Transfers, err = s.store.GetTransfersByPersonId(ctx, personId); err != nil {
+		return Export{}, fmt.Errorf("%w %w", ErrUnexpected, err)
+	}
+	if export.RecurringExpenses, err = s.store.GetRecurringExpensesByPersonId(ctx, personId); err != nil {
+		return Export{}, fmt.Errorf("%w %w", ErrUnexpected, err)
+	}
+	if export.Attachments, err = s.store.GetAttachmentsByUploaderId(ctx, personId); err != nil {
+		return Export{}, fmt.Errorf("%w %w", ErrUnexpected, err)
+	}
+	return export, nil
+}
+
+// WriteZip writes the export as a zip archive: one json file per section plus the files the person uploaded
+func (s *Service) WriteZip(ctx context.Context, export Export, w io.Writer) (err error) {
+	ctx, span := tracer.Start(ctx, "account.WriteZip")
+	defer func() { tracing.End(span, err) }()
+
+	archive := zip.NewWriter(w)
+
+	sections := []struct {
+		name string
+		data any
+	}{
+		{"profile.json", export.Profile},
+		{"groups.json", export.Groups},
+		{"expenses.json", export.Expenses},
+		{"transfers.json", export.Transfers},
+		{"recurring-expenses.json", export.RecurringExpenses},
+		{"attachments.json", export.Attachments},
+	}
+	for _, section := range sections {
+		f, err := archive.CreateHeader(&zip.FileHeader{Name: section.name, Method: zip.Deflate, Modified: export.ExportedAt})
+		if err != nil {
+			return err
+		}
+		encoder := json.NewEncoder(f)
+		encoder.SetIndent("", "  ")
+		if err = encoder.Encode(section.data); err != nil {
+			return err
+		}
+	}
+
+	for _, a := range export.Attachments {
+		if err := s.writeAttachment(ctx, archive, a, export.ExportedAt); err != nil {
+			return err
+		}
+	}
+
+	return archive.Close()
+}
+
+func (s *Service) writeAttachment(ctx context.Context, archive *zip.Writer, a attachment.Attachment, modified time.Time) error {
+	content, err := s.blobs.Get(ctx, a.BlobKey)
+	if err != nil {
+		// the expense may have been deleted while its attachments are being cleaned up
+		if errors.Is(err, attachment.ErrBlobNotFound) {
+			return nil
+		}
+		return err
+	}
+	defer content.Close()
+
+	name := fmt.Sprintf("attachments/%d-%s", a.Id, path.Base("/"+a.FileName))
+	f, err := archive.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Store, Modified: modified})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, content)
+	return err
+}
+
+// DeleteAccount anonymizes the person, who has to confirm with their password. The person stays a member of their
+// groups, listed as an anonymized member, so that the balances of the other members do not change.
+func (s *Service) DeleteAccount(ctx context.Context, personId int, clearPassword string) (err error) {
+	ctx, span := tracer.Start(ctx, "account.DeleteAccount")
+	defer func() { tracing.End(span, err) }()
+
+	p, err := s.store.GetPersonById(ctx, personId)
+	if err != nil {
+		return err
+	}
+	if p.IsDeleted() {
+		return ErrAccountDeleted
+	}
+	if bcrypt.CompareHashAndPassword([]byte(p.Password), []byte(clearPassword)) != nil {
+		return person.ErrWrongPassword
+	}
+	return s.store.AnonymizePerson(ctx, personId)
+}
@@ -0,0 +1,122 @@
+//go:build unit
+
+package account
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/antoniobelotti/splid_backend_clone/internal/attachment"
+	"github.com/antoniobelotti/splid_backend_clone/internal/expense"
+	"github.com/antoniobelotti/splid_backend_clone/internal/group"
+	"github.com/antoniobelotti/splid_backend_clone/internal/person"
+	"github.com/antoniobelotti/splid_backend_clone/internal/recurring"
+	"github.com/antoniobelotti/splid_backend_clone/internal/transfer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+	"io"
+	"testing"
+	"time"
+)
+
+type fakeStore struct {
+	person      person.Person
+	attachments []attachment.Attachment
+	anonymized  bool
+}
+
+func (f *fakeStore) GetPersonById(_ context.Context, _ int) (person.Person, error) {
+	return f.person, nil
+}
+
+func (f *fakeStore) GetGroupsByPersonId(_ context.Context, _ int) ([]group.Group, error) {
+	return []group.Group{{Id: 1, Name: "holiday"}}, nil
+}
+
+func (f *fakeStore) GetExpensesByPersonId(_ context.Context, personId int) ([]expense.Expense, error) {
+	return []expense.Expense{{Id: 1, AmountInCents: 1000, PersonId: personId, GroupId: 1}}, nil
+}
+
+func (f *fakeStore) GetTransfersByPersonId(_ context.Context, _ int) ([]transfer.Transfer, error) {
+	return []transfer.Transfer{}, nil
+}
+
+func (f *fakeStore) GetRecurringExpensesByPersonId(_ context.Context, _ int) ([]recurring.Template, error) {
+	return []recurring.Template{}, nil
+}
+
+func (f *fakeStore) GetAttachmentsByUploaderId(_ context.Context, _ int) ([]attachment.Attachment, error) {
+	return f.attachments, nil
+}
+
+func (f *fakeStore) AnonymizePerson(_ context.Context, _ int) error {
+	f.anonymized = true
+	return nil
+}
+
+func newTestService(t *testing.T) (Service, *fakeStore, *attachment.LocalBlobStore) {
+	hashed, err := bcrypt.GenerateFromPassword([]byte("password123"), bcrypt.MinCost)
+	require.NoError(t, err)
+	blobs, err := attachment.NewLocalBlobStore(t.TempDir())
+	require.NoError(t, err)
+	store := &fakeStore{person: person.Person{Id: 1, Name: "p", Email: "p@mail.com", Password: string(hashed)}}
+	return NewService(store, blobs), store, blobs
+}
+
+func TestWriteZipIncludesUploadedFiles(t *testing.T) {
+	s, store, blobs := newTestService(t)
+	ctx := context.Background()
+	require.NoError(t, blobs.Put(ctx, "expenses/1/abc", []byte("receipt"), "image/png"))
+	store.attachments = []attachment.Attachment{
+		{Id: 3, ExpenseId: 1, UploaderId: 1, FileName: "../../receipt.png", BlobKey: "expenses/1/abc"},
+		{Id: 4, ExpenseId: 1, UploaderId: 1, FileName: "gone.png", BlobKey: "expenses/1/gone"},
+	}
+
+	export, err := s.Export(ctx, 1)
+	require.NoError(t, err)
+	var buf bytes.Buffer
+	require.NoError(t, s.WriteZip(ctx, export, &buf))
+
+	archive, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	require.NoError(t, err)
+	files := map[string][]byte{}
+	for _, f := range archive.File {
+		r, err := f.Open()
+		require.NoError(t, err)
+		files[f.Name], _ = io.ReadAll(r)
+		_ = r.Close()
+	}
+
+	assert.Equal(t, []byte("receipt"), files["attachments/3-receipt.png"])
+	assert.NotContains(t, files, "attachments/4-gone.png", "blobs already cleaned up are skipped")
+
+	var profile person.Person
+	require.NoError(t, json.Unmarshal(files["profile.json"], &profile))
+	assert.Equal(t, "p@mail.com", profile.Email)
+	var expenses []expense.Expense
+	require.NoError(t, json.Unmarshal(files["expenses.json"], &expenses))
+	assert.Len(t, expenses, 1)
+}
+
+func TestDeleteAccountRequiresPassword(t *testing.T) {
+	s, store, _ := newTestService(t)
+	ctx := context.Background()
+
+	assert.ErrorIs(t, s.DeleteAccount(ctx, 1, "wrong"), person.ErrWrongPassword)
+	assert.False(t, store.anonymized)
+
+	require.NoError(t, s.DeleteAccount(ctx, 1, "password123"))
+	assert.True(t, store.anonymized)
+}
+
+func TestDeletedAccountsCannotExportOrDeleteAgain(t *testing.T) {
+	s, store, _ := newTestService(t)
+	deletedAt := time.Now()
+	store.person.DeletedAt = &deletedAt
+
+	_, err := s.Export(context.Background(), 1)
+	assert.ErrorIs(t, err, ErrAccountDeleted)
+	assert.ErrorIs(t, s.DeleteAccount(context.Background(), 1, "password123"), ErrAccountDeleted)
+}
@@ -0,0 +1,42 @@
+package apperror
+
+// Kind - category of a domain error. It decides the status code the error is reported to clients with.
+type Kind int
+
+const (
+	// Internal errors are never explained to clients
+	Internal Kind = iota
+	Invalid
+	Unauthorized
+	Forbidden
+	NotFound
+	Conflict
+	Gone
+	TooLarge
+	UnsupportedMediaType
+	TooManyRequests
+)
+
+// Error - an error the domain packages expose to their callers. Domain packages declare them as package variables, so
+// they keep working with errors.Is when wrapped.
+type Error struct {
+	Kind Kind
+	// Code is stable and meant for programs, e.g. "group_not_found"
+	Code string
+	// Field is the request field the error is about, if any
+	Field   string
+	Message string
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+func New(kind Kind, code string, message string) *Error {
+	return &Error{Kind: kind, Code: code, Message: message}
+}
+
+// NewInvalidField - a validation error about a single field
+func NewInvalidField(field string, code string, message string) *Error {
+	return &Error{Kind: Invalid, Code: code, Field: field, Message: message}
+}
@@ -0,0 +1,240 @@
+package attachment
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/antoniobelotti/splid_backend_clone/internal/apperror"
+	"github.com/antoniobelotti/splid_backend_clone/internal/event"
+	"github.com/antoniobelotti/splid_backend_clone/internal/expense"
+	"github.com/antoniobelotti/splid_backend_clone/internal/tracing"
+	"go.opentelemetry.io/otel"
+	"io"
+	"net/http"
+	"path"
+	"time"
+)
+
+var tracer = otel.Tracer("github.com/antoniobelotti/splid_backend_clone/internal/attachment")
+
+// Attachment - a file (usually the photo of a receipt) attached to an expense
+type Attachment struct {
+	Id           int       `json:"id" db:"id"`
+	ExpenseId    int       `json:"expense-id" db:"expense_id"`
+	UploaderId   int       `json:"uploader-id" db:"uploader_id"`
+	FileName     string    `json:"file-name" db:"file_name"`
+	ContentType  string    `json:"content-type" db:"content_type"`
+	SizeInBytes  int64     `json:"size-in-bytes" db:"size_in_bytes"`
+	BlobKey      string    `json:"-" db:"blob_key"`
+	ThumbnailKey *string   `json:"-" db:"thumbnail_key"`
+	HasThumbnail bool      `json:"has-thumbnail" db:"-"`
+	CreatedAt    time.Time `json:"created-at" db:"created_at"`
+}
+
+type Store interface {
+	CreateAttachment(ctx context.Context, a Attachment) (int, error)
+	GetAttachmentById(ctx context.Context, attachmentId int) (Attachment, error)
+	GetAttachmentsByExpenseId(ctx context.Context, expenseId int) ([]Attachment, error)
+	DeleteAttachment(ctx context.Context, attachmentId int) error
+	IsPersonInGroup(ctx context.Context, groupId int, personId int) (bool, error)
+}
+
+const MaxAttachmentSizeInBytes = 10 << 20
+
+// allowedContentTypes - content types are sniffed from the uploaded bytes, the one declared by the client is ignored
+var allowedContentTypes = map[string]bool{
+	"image/jpeg":      true,
+	"image/png":       true,
+	"image/gif":       true,
+	"image/webp":      true,
+	"application/pdf": true,
+}
+
+var (
+	ErrAttachmentNotFound     = apperror.New(apperror.NotFound, "attachment_not_found", "attachment not found")
+	ErrAttachmentTooLarge     = apperror.New(apperror.TooLarge, "attachment_too_large", fmt.Sprintf("attachment exceeds the maximum size of %d bytes", MaxAttachmentSizeInBytes))
+	ErrUnsupportedContentType = apperror.New(apperror.UnsupportedMediaType, "unsupported_content_type", "unsupported content type")
+	ErrEmptyAttachment        = apperror.NewInvalidField("file", "empty_attachment", "attachment is empty")
+	ErrForbidden              = apperror.New(apperror.Forbidden, "not_group_member", "only members of the group can access the attachments of its expenses")
+	ErrUnexpected             = apperror.New(apperror.Internal, "unexpected_error", "unexpected error")
+)
+
+type Service struct {
+	store          Store
+	blobs          BlobStore
+	expenseService expense.Service
+}
+
+func NewService(store Store, blobs BlobStore, es expense.Service) Service {
+	return Service{store: store, blobs: blobs, expenseService: es}
+}
+
+// authorize checks the expense exists and personId belongs to its group
+func (s *Service) authorize(ctx context.Context, expenseId int, personId int) error {
+	e, err := s.expenseService.GetExpenseById(ctx, expenseId)
+	if err != nil {
+		return err
+	}
+	isMember, err := s.store.IsPersonInGroup(ctx, e.GroupId, personId)
+	if err != nil {
+		return fmt.Errorf("%w %w", ErrUnexpected, err)
+	}
+	if !isMember {
+		return ErrForbidden
+	}
+	return nil
+}
+
+func newBlobKey(expenseId int) (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("expenses/%d/%s", expenseId, hex.EncodeToString(b)), nil
+}
+
+// Upload stores content as a new attachment of the expense. Images also get a jpeg thumbnail.
+func (s *Service) Upload(ctx context.Context, personId int, expenseId int, fileName string, content io.Reader) (_ Attachment, err error) {
+	ctx, span := tracer.Start(ctx, "attachment.Upload")
+	defer func() { tracing.End(span, err) }()
+
+	if err := s.authorize(ctx, expenseId, personId); err != nil {
+		return Attachment{}, err
+	}
+
+	data, err := io.ReadAll(io.LimitReader(content, MaxAttachmentSizeInBytes+1))
+	if err != nil {
+		return Attachment{}, fmt.Errorf("%w %w", ErrUnexpected, err)
+	}
+	if len(data) > MaxAttachmentSizeInBytes {
+		return Attachment{}, ErrAttachmentTooLarge
+	}
+	if len(data) == 0 {
+		return Attachment{}, ErrEmptyAttachment
+	}
+
+	contentType := http.DetectContentType(data)
+	if !allowedContentTypes[contentType] {
+		return Attachment{}, fmt.Errorf("%w %s", ErrUnsupportedContentType, contentType)
+	}
+
+	blobKey, err := newBlobKey(expenseId)
+	if err != nil {
+		return Attachment{}, fmt.Errorf("%w %w", ErrUnexpected, err)
+	}
+
+	a := Attachment{
+		ExpenseId:   expenseId,
+		UploaderId:  personId,
+		FileName:    path.Base("/" + fileName),
+		ContentType: contentType,
+		SizeInBytes: int64(len(data)),
+		BlobKey:     blobKey,
+		CreatedAt:   time.Now().UTC(),
+	}
+
+	if err = s.blobs.Put(ctx, blobKey, data, contentType); err != nil {
+		return Attachment{}, fmt.Errorf("%w %w", ErrUnexpected, err)
+	}
+
+	// a missing thumbnail is not a reason to reject the upload: webp cannot be decoded, some images are too large
+	if thumbnail, err := makeThumbnail(data); err == nil {
+		thumbnailKey := blobKey + ".thumbnail.jpg"
+		if err = s.blobs.Put(ctx, thumbnailKey, thumbnail, "image/jpeg"); err == nil {
+			a.ThumbnailKey = &thumbnailKey
+			a.HasThumbnail = true
+		}
+	}
+
+	a.Id, err = s.store.CreateAttachment(ctx, a)
+	if err != nil {
+		s.deleteBlobs(ctx, a)
+		return Attachment{}, fmt.Errorf("%w %w", ErrUnexpected, err)
+	}
+	return a, nil
+}
+
+func (s *Service) GetAttachmentsByExpenseId(ctx context.Context, personId int, expenseId int) (_ []Attachment, err error) {
+	ctx, span := tracer.Start(ctx, "attachment.GetAttachmentsByExpenseId")
+	defer func() { tracing.End(span, err) }()
+
+	if err := s.authorize(ctx, expenseId, personId); err != nil {
+		return nil, err
+	}
+	return s.store.GetAttachmentsByExpenseId(ctx, expenseId)
+}
+
+// Download returns the attachment metadata and its content, or the content of its thumbnail. The caller must close
+// the returned reader.
+func (s *Service) Download(ctx context.Context, personId int, expenseId int, attachmentId int, thumbnail bool) (_ Attachment, _ io.ReadCloser, err error) {
+	ctx, span := tracer.Start(ctx, "attachment.Download")
+	defer func() { tracing.End(span, err) }()
+
+	if err := s.authorize(ctx, expenseId, personId); err != nil {
+		return Attachment{}, nil, err
+	}
+
+	a, err := s.store.GetAttachmentById(ctx, attachmentId)
+	if err != nil {
+		return Attachment{}, nil, err
+	}
+	if a.ExpenseId != expenseId {
+		return Attachment{}, nil, ErrAttachmentNotFound
+	}
+
+	key := a.BlobKey
+	if thumbnail {
+		if a.ThumbnailKey == nil {
+			return Attachment{}, nil, ErrAttachmentNotFound
+		}
+		key = *a.ThumbnailKey
+	}
+
+	content, err := s.blobs.Get(ctx, key)
+	if err != nil {
+		if errors.Is(err, ErrBlobNotFound) {
+			return Attachment{}, nil, fmt.Errorf("%w %w", ErrAttachmentNotFound, err)
+		}
+		return Attachment{}, nil, fmt.Errorf("%w %w", ErrUnexpected, err)
+	}
+	return a, content, nil
+}
+
+func (s *Service) deleteBlobs(ctx context.Context, a Attachment) {
+	_ = s.blobs.Delete(ctx, a.BlobKey)
+	if a.ThumbnailKey != nil {
+		_ = s.blobs.Delete(ctx, *a.ThumbnailKey)
+	}
+}
+
+// HandleExpenseDeleted removes the attachments of a deleted expense. Meant to be subscribed to event.ExpenseDeleted.
+func (s *Service) HandleExpenseDeleted(ctx context.Context, ev event.Event) (err error) {
+	ctx, span := tracer.Start(ctx, "attachment.HandleExpenseDeleted")
+	defer func() { tracing.End(span, err) }()
+
+	var e expense.Expense
+	if err := ev.Decode(&e); err != nil {
+		return err
+	}
+
+	attachments, err := s.store.GetAttachmentsByExpenseId(ctx, e.Id)
+	if err != nil {
+		return err
+	}
+	for _, a := range attachments {
+		if err = s.blobs.Delete(ctx, a.BlobKey); err != nil {
+			return err
+		}
+		if a.ThumbnailKey != nil {
+			if err = s.blobs.Delete(ctx, *a.ThumbnailKey); err != nil {
+				return err
+			}
+		}
+		if err = s.store.DeleteAttachment(ctx, a.Id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,187 @@
+//go:build unit
+
+package attachment
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/antoniobelotti/splid_backend_clone/internal/event"
+	"github.com/antoniobelotti/splid_backend_clone/internal/expense"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"testing"
+)
+
+// memoryStore implements both Store and expense.Store: expense 1 belongs to group 1, whose only member is person 1
+type memoryStore struct {
+	attachments map[int]Attachment
+}
+
+func (m *memoryStore) CreateAttachment(_ context.Context, a Attachment) (int, error) {
+	a.Id = len(m.attachments) + 1
+	m.attachments[a.Id] = a
+	return a.Id, nil
+}
+
+func (m *memoryStore) GetAttachmentById(_ context.Context, attachmentId int) (Attachment, error) {
+	a, ok := m.attachments[attachmentId]
+	if !ok {
+		return Attachment{}, ErrAttachmentNotFound
+	}
+	return a, nil
+}
+
+func (m *memoryStore) GetAttachmentsByExpenseId(_ context.Context, expenseId int) ([]Attachment, error) {
+	var attachments []Attachment
+	for _, a := range m.attachments {
+		if a.ExpenseId == expenseId {
+			attachments = append(attachments, a)
+		}
+	}
+	return attachments, nil
+}
+
+func (m *memoryStore) DeleteAttachment(_ context.Context, attachmentId int) error {
+	delete(m.attachments, attachmentId)
+	return nil
+}
+
+func (m *memoryStore) IsPersonInGroup(_ context.Context, groupId int, personId int) (bool, error) {
+	return groupId == 1 && personId == 1, nil
+}
+
+func (m *memoryStore) CreateExpense(_ context.Context, _ expense.Expense, _ string) (int, error) {
+	return 0, nil
+}
+
+func (m *memoryStore) GetExpenseByGroupId(_ context.Context, _ int) ([]expense.Expense, error) {
+	return nil, nil
+}
+
+func (m *memoryStore) GetExpensesByGroupIds(_ context.Context, _ []int) ([]expense.Expense, error) {
+	return nil, nil
+}
+
+func (m *memoryStore) GetExpenseById(_ context.Context, expenseId int) (expense.Expense, error) {
+	if expenseId != 1 {
+		return expense.Expense{}, expense.ErrExpenseNotFound
+	}
+	return expense.Expense{Id: 1, GroupId: 1, PersonId: 1, AmountInCents: 100}, nil
+}
+
+func (m *memoryStore) DeleteExpense(_ context.Context, _ expense.Expense) error {
+	return nil
+}
+
+func newTestService(t *testing.T) (Service, *memoryStore, *LocalBlobStore) {
+	store := &memoryStore{attachments: map[int]Attachment{}}
+	blobs, err := NewLocalBlobStore(t.TempDir())
+	require.NoError(t, err)
+	return NewService(store, blobs, expense.NewService(store)), store, blobs
+}
+
+func pngImage(t *testing.T, w, h int) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for x := 0; x < w; x++ {
+		img.Set(x, 0, color.RGBA{R: 255, A: 255})
+	}
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, img))
+	return buf.Bytes()
+}
+
+func TestUploadImageCreatesThumbnail(t *testing.T) {
+	s, _, _ := newTestService(t)
+	ctx := context.Background()
+
+	a, err := s.Upload(ctx, 1, 1, "../../receipt.png", bytes.NewReader(pngImage(t, 1024, 512)))
+	require.NoError(t, err)
+	assert.Equal(t, "image/png", a.ContentType)
+	assert.Equal(t, "receipt.png", a.FileName, "path components are stripped from the file name")
+	assert.True(t, a.HasThumbnail)
+
+	_, r, err := s.Download(ctx, 1, 1, a.Id, true)
+	require.NoError(t, err)
+	defer r.Close()
+	thumbnail, _, err := image.Decode(r)
+	require.NoError(t, err)
+	assert.Equal(t, image.Rect(0, 0, 256, 128), thumbnail.Bounds())
+}
+
+func TestUploadValidatesContent(t *testing.T) {
+	s, _, _ := newTestService(t)
+	ctx := context.Background()
+
+	_, err := s.Upload(ctx, 1, 1, "script.sh", bytes.NewReader([]byte("#!/bin/sh\nrm -rf /")))
+	assert.ErrorIs(t, err, ErrUnsupportedContentType)
+
+	_, err = s.Upload(ctx, 1, 1, "empty.png", bytes.NewReader(nil))
+	assert.ErrorIs(t, err, ErrEmptyAttachment)
+
+	tooLarge := append([]byte("%PDF-1.4\n"), make([]byte, MaxAttachmentSizeInBytes)...)
+	_, err = s.Upload(ctx, 1, 1, "huge.pdf", bytes.NewReader(tooLarge))
+	assert.ErrorIs(t, err, ErrAttachmentTooLarge)
+
+	pdf, err := s.Upload(ctx, 1, 1, "invoice.pdf", bytes.NewReader([]byte("%PDF-1.4\n...")))
+	require.NoError(t, err)
+	assert.Equal(t, "application/pdf", pdf.ContentType)
+	assert.False(t, pdf.HasThumbnail)
+}
+
+func TestAttachmentAccessRequiresGroupMembership(t *testing.T) {
+	s, _, _ := newTestService(t)
+	ctx := context.Background()
+
+	a, err := s.Upload(ctx, 1, 1, "receipt.png", bytes.NewReader(pngImage(t, 10, 10)))
+	require.NoError(t, err)
+
+	_, err = s.Upload(ctx, 2, 1, "receipt.png", bytes.NewReader(pngImage(t, 10, 10)))
+	assert.ErrorIs(t, err, ErrForbidden)
+
+	_, _, err = s.Download(ctx, 2, 1, a.Id, false)
+	assert.ErrorIs(t, err, ErrForbidden)
+
+	_, err = s.GetAttachmentsByExpenseId(ctx, 2, 1)
+	assert.ErrorIs(t, err, ErrForbidden)
+
+	_, _, err = s.Download(ctx, 1, 2, a.Id, false)
+	assert.ErrorIs(t, err, expense.ErrExpenseNotFound)
+}
+
+func TestHandleExpenseDeletedRemovesAttachments(t *testing.T) {
+	s, store, blobs := newTestService(t)
+	ctx := context.Background()
+
+	a, err := s.Upload(ctx, 1, 1, "receipt.png", bytes.NewReader(pngImage(t, 10, 10)))
+	require.NoError(t, err)
+
+	payload, _ := json.Marshal(expense.Expense{Id: 1, GroupId: 1, PersonId: 1})
+	require.NoError(t, s.HandleExpenseDeleted(ctx, event.Event{Type: event.ExpenseDeleted, Payload: payload}))
+
+	assert.Empty(t, store.attachments)
+	_, err = blobs.Get(ctx, a.BlobKey)
+	assert.ErrorIs(t, err, ErrBlobNotFound)
+	_, err = blobs.Get(ctx, *a.ThumbnailKey)
+	assert.ErrorIs(t, err, ErrBlobNotFound)
+}
+
+func TestLocalBlobStoreRejectsPathTraversal(t *testing.T) {
+	blobs, err := NewLocalBlobStore(t.TempDir())
+	require.NoError(t, err)
+
+	for _, key := range []string{"../outside", "/etc/passwd", "a//b", "a/./b", ""} {
+		assert.ErrorIs(t, blobs.Put(context.Background(), key, []byte("x"), ""), ErrInvalidKey, key)
+	}
+
+	require.NoError(t, blobs.Put(context.Background(), "a/b", []byte("x"), ""))
+	r, err := blobs.Get(context.Background(), "a/b")
+	require.NoError(t, err)
+	content, _ := io.ReadAll(r)
+	_ = r.Close()
+	assert.Equal(t, []byte("x"), content)
+}
@@ -0,0 +1,97 @@
+package attachment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// BlobStore - where the content of attachments is kept. Keys are slash separated paths.
+type BlobStore interface {
+	Put(ctx context.Context, key string, content []byte, contentType string) error
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete must not fail if the blob does not exist
+	Delete(ctx context.Context, key string) error
+}
+
+var (
+	ErrBlobNotFound = errors.New("blob not found")
+	ErrInvalidKey   = errors.New("invalid blob key")
+)
+
+// LocalBlobStore - stores blobs as files under a root directory
+type LocalBlobStore struct {
+	root string
+}
+
+func NewLocalBlobStore(root string) (*LocalBlobStore, error) {
+	if err := os.MkdirAll(root, 0o750); err != nil {
+		return nil, fmt.Errorf("unable to create blob store root %s: %w", root, err)
+	}
+	return &LocalBlobStore{root: root}, nil
+}
+
+func (l *LocalBlobStore) path(key string) (string, error) {
+	if key == "" || strings.HasPrefix(key, "/") {
+		return "", ErrInvalidKey
+	}
+	for _, segment := range strings.Split(key, "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return "", ErrInvalidKey
+		}
+	}
+	return filepath.Join(l.root, filepath.FromSlash(key)), nil
+}
+
+func (l *LocalBlobStore) Put(_ context.Context, key string, content []byte, _ string) error {
+	p, err := l.path(key)
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(p), 0o750); err != nil {
+		return err
+	}
+
+	// write to a temporary file first so that readers never see a partially written blob
+	tmp, err := os.CreateTemp(filepath.Dir(p), ".upload-*")
+	if err != nil {
+		return err
+	}
+	if _, err = tmp.Write(content); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), p)
+}
+
+func (l *LocalBlobStore) Get(_ context.Context, key string) (io.ReadCloser, error) {
+	p, err := l.path(key)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(p)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrBlobNotFound
+	}
+	return f, err
+}
+
+func (l *LocalBlobStore) Delete(_ context.Context, key string) error {
+	p, err := l.path(key)
+	if err != nil {
+		return err
+	}
+	if err = os.Remove(p); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
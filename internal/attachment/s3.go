@@ -0,0 +1,201 @@
+package attachment
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// S3Config - connection parameters of an S3-compatible object storage (AWS S3, MinIO, ...)
+type S3Config struct {
+	// Endpoint is the base url of the service, e.g. https://s3.eu-west-1.amazonaws.com or http://minio:9000
+	Endpoint  string
+	Region    string
+	Bucket    string
+	AccessKey string
+	SecretKey string
+}
+
+// S3BlobStore - stores blobs in an S3 bucket using path-style requests signed with AWS signature version 4
+type S3BlobStore struct {
+	config S3Config
+	client *http.Client
+	now    func() time.Time
+}
+
+func NewS3BlobStore(config S3Config) *S3BlobStore {
+	config.Endpoint = strings.TrimSuffix(config.Endpoint, "/")
+	return &S3BlobStore{
+		config: config,
+		client: &http.Client{Timeout: 30 * time.Second},
+		now:    time.Now,
+	}
+}
+
+func (s *S3BlobStore) objectUrl(key string) string {
+	segments := strings.Split(key, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return fmt.Sprintf("%s/%s/%s", s.config.Endpoint, url.PathEscape(s.config.Bucket), strings.Join(segments, "/"))
+}
+
+func (s *S3BlobStore) do(ctx context.Context, method string, key string, content []byte, contentType string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, s.objectUrl(key), bytes.NewReader(content))
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	signV4(req, content, s.config, s.now())
+	return s.client.Do(req)
+}
+
+func (s *S3BlobStore) Put(ctx context.Context, key string, content []byte, contentType string) error {
+	resp, err := s.do(ctx, http.MethodPut, key, content, contentType)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return s3Error(resp)
+	}
+	return nil
+}
+
+func (s *S3BlobStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	resp, err := s.do(ctx, http.MethodGet, key, nil, "")
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		_ = resp.Body.Close()
+		return nil, ErrBlobNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		return nil, s3Error(resp)
+	}
+	return resp.Body, nil
+}
+
+func (s *S3BlobStore) Delete(ctx context.Context, key string) error {
+	resp, err := s.do(ctx, http.MethodDelete, key, nil, "")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	// S3 answers 204 even if the object does not exist
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNotFound {
+		return s3Error(resp)
+	}
+	return nil
+}
+
+func s3Error(resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	return fmt.Errorf("s3 request %s %s failed with status %d: %s", resp.Request.Method, resp.Request.URL.Path, resp.StatusCode, body)
+}
+
+func sha256Hex(data []byte) string {
+	h := sha256.Sum256(data)
+	return hex.EncodeToString(h[:])
+}
+
+func hmacSha256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// signV4 adds the x-amz-date, x-amz-content-sha256 and Authorization headers to req.
+// See https://docs.aws.amazon.com/AmazonS3/latest/API/sig-v4-header-based-auth.html
+func signV4(req *http.Request, payload []byte, config S3Config, now time.Time) {
+	now = now.UTC()
+	amzDate := now.Format("20060102T150405Z")
+	day := now.Format("20060102")
+	payloadHash := sha256Hex(payload)
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	// sign host, content-type, range and every x-amz-* header
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		lower := strings.ToLower(name)
+		if lower == "content-type" || lower == "range" || strings.HasPrefix(lower, "x-amz-") {
+			headers[lower] = strings.TrimSpace(strings.Join(values, ","))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := fmt.Sprintf("%s/%s/s3/aws4_request", day, config.Region)
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		sha256Hex([]byte(canonicalRequest)),
+	}, "\n")
+
+	signingKey := hmacSha256([]byte("AWS4"+config.SecretKey), day)
+	signingKey = hmacSha256(signingKey, config.Region)
+	signingKey = hmacSha256(signingKey, "s3")
+	signingKey = hmacSha256(signingKey, "aws4_request")
+	signature := hex.EncodeToString(hmacSha256(signingKey, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		config.AccessKey, scope, signedHeaders, signature,
+	))
+}
+
+func canonicalQuery(values url.Values) string {
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var parts []string
+	for _, k := range keys {
+		vs := values[k]
+		sort.Strings(vs)
+		for _, v := range vs {
+			parts = append(parts, awsEscape(k)+"="+awsEscape(v))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+func awsEscape(s string) string {
+	return strings.ReplaceAll(url.QueryEscape(s), "+", "%20")
+}
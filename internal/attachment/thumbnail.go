@@ -0,0 +1,78 @@
+package attachment
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	_ "image/gif"
+	"image/jpeg"
+	_ "image/png"
+)
+
+const (
+	thumbnailMaxSide = 256
+	// images larger than this are not decoded, to protect against decompression bombs
+	thumbnailMaxSourcePixels = 50_000_000
+)
+
+var errImageTooLarge = errors.New("image too large to make a thumbnail")
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// makeThumbnail decodes an image and returns a jpeg scaled down to fit a thumbnailMaxSide square.
+// Each thumbnail pixel is the average of the source pixels it covers.
+func makeThumbnail(content []byte) ([]byte, error) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(content))
+	if err != nil {
+		return nil, err
+	}
+	if config.Width*config.Height > thumbnailMaxSourcePixels {
+		return nil, errImageTooLarge
+	}
+
+	src, _, err := image.Decode(bytes.NewReader(content))
+	if err != nil {
+		return nil, err
+	}
+
+	bounds := src.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	tw, th := w, h
+	if w > thumbnailMaxSide || h > thumbnailMaxSide {
+		if w >= h {
+			tw, th = thumbnailMaxSide, maxInt(1, h*thumbnailMaxSide/w)
+		} else {
+			tw, th = maxInt(1, w*thumbnailMaxSide/h), thumbnailMaxSide
+		}
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, tw, th))
+	for ty := 0; ty < th; ty++ {
+		y0, y1 := bounds.Min.Y+ty*h/th, bounds.Min.Y+(ty+1)*h/th
+		for tx := 0; tx < tw; tx++ {
+			x0, x1 := bounds.Min.X+tx*w/tw, bounds.Min.X+(tx+1)*w/tw
+
+			var r, g, b, a, n uint64
+			for y := y0; y < maxInt(y1, y0+1); y++ {
+				for x := x0; x < maxInt(x1, x0+1); x++ {
+					cr, cg, cb, ca := src.At(x, y).RGBA()
+					r, g, b, a = r+uint64(cr), g+uint64(cg), b+uint64(cb), a+uint64(ca)
+					n++
+				}
+			}
+			dst.Set(tx, ty, color.RGBA64{R: uint16(r / n), G: uint16(g / n), B: uint16(b / n), A: uint16(a / n)})
+		}
+	}
+
+	var out bytes.Buffer
+	if err = jpeg.Encode(&out, dst, &jpeg.Options{Quality: 80}); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
@@ -0,0 +1,53 @@
+package buildinfo
+
+import (
+	"github.com/antoniobelotti/splid_backend_clone/migrations"
+	"runtime"
+	"runtime/debug"
+)
+
+// Commit and BuildTime can be set when building, e.g.
+//
+//	go build -ldflags "-X github.com/antoniobelotti/splid_backend_clone/internal/buildinfo.Commit=$(git rev-parse HEAD)"
+//
+// Otherwise they are read from the VCS information go build stamps into binaries built inside the repository.
+var (
+	Commit    string
+	BuildTime string
+)
+
+// Info - what is running
+type Info struct {
+	Commit    string `json:"commit"`
+	BuildTime string `json:"build-time"`
+	// Modified - whether the binary was built with uncommitted changes
+	Modified bool `json:"modified,omitempty"`
+	// SchemaVersion - the migration version the database must be at
+	SchemaVersion uint   `json:"schema-version"`
+	GoVersion     string `json:"go-version"`
+}
+
+func Get() Info {
+	info := Info{
+		Commit:        Commit,
+		BuildTime:     BuildTime,
+		SchemaVersion: migrations.LatestVersion(),
+		GoVersion:     runtime.Version(),
+	}
+	if build, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range build.Settings {
+			switch {
+			case setting.Key == "vcs.revision" && info.Commit == "":
+				info.Commit = setting.Value
+			case setting.Key == "vcs.time" && info.BuildTime == "":
+				info.BuildTime = setting.Value
+			case setting.Key == "vcs.modified":
+				info.Modified = setting.Value == "true"
+			}
+		}
+	}
+	if info.Commit == "" {
+		info.Commit = "unknown"
+	}
+	return info
+}
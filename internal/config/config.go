@@ -0,0 +1,259 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"github.com/antoniobelotti/splid_backend_clone/internal/http"
+	"github.com/antoniobelotti/splid_backend_clone/internal/http/authentication"
+	"github.com/antoniobelotti/splid_backend_clone/internal/person"
+	"github.com/antoniobelotti/splid_backend_clone/internal/tracing"
+	"log/slog"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Config - every setting of the server. Each one is read, by increasing precedence, from its default, the
+// configuration file (the key tag), the environment (the env tag) and the command line (the flag tag). Secrets have no
+// flag: the command line of a process is visible to every user of the machine.
+type Config struct {
+	AppBaseUrl string `key:"app_base_url" env:"APP_BASE_URL" flag:"app-base-url" usage:"public url of the app, the links in the emails start with it"`
+	// ShutdownTimeout should be shorter than the grace period of the orchestrator
+	ShutdownTimeout time.Duration `key:"shutdown_timeout" env:"SHUTDOWN_TIMEOUT" flag:"shutdown-timeout" usage:"how long the requests in flight have to finish on shutdown"`
+	// UnverifiedAccountRestrictions - see person.ParseUnverifiedPolicy
+	UnverifiedAccountRestrictions []string `key:"unverified_account_restrictions" env:"UNVERIFIED_ACCOUNT_RESTRICTIONS" flag:"unverified-account-restrictions" usage:"comma separated actions accounts with an unverified email may not perform"`
+
+	HTTP        HTTP        `key:"http"`
+	GRPC        GRPC        `key:"grpc"`
+	Database    Database    `key:"database"`
+	Log         Log         `key:"log"`
+	Tracing     Tracing     `key:"tracing"`
+	Auth        Auth        `key:"auth"`
+	Attachments Attachments `key:"attachments"`
+	Mailer      Mailer      `key:"mailer"`
+}
+
+type HTTP struct {
+	Port              int           `key:"port" env:"HTTP_PORT" flag:"http-port" usage:"port of the REST server"`
+	ReadHeaderTimeout time.Duration `key:"read_header_timeout" env:"HTTP_READ_HEADER_TIMEOUT" flag:"http-read-header-timeout" usage:"time to read the headers of a request"`
+	ReadTimeout       time.Duration `key:"read_timeout" env:"HTTP_READ_TIMEOUT" flag:"http-read-timeout" usage:"time to read a whole request"`
+	WriteTimeout      time.Duration `key:"write_timeout" env:"HTTP_WRITE_TIMEOUT" flag:"http-write-timeout" usage:"time to write a response"`
+	IdleTimeout       time.Duration `key:"idle_timeout" env:"HTTP_IDLE_TIMEOUT" flag:"http-idle-timeout" usage:"how long idle keep-alive connections are kept open"`
+	MaxHeaderBytes    int           `key:"max_header_bytes" env:"HTTP_MAX_HEADER_BYTES" flag:"http-max-header-bytes" usage:"maximum size of the headers of a request"`
+	MaxBodyBytes      int64         `key:"max_body_bytes" env:"HTTP_MAX_BODY_BYTES" flag:"http-max-body-bytes" usage:"maximum size of a request body, attachments excluded"`
+}
+
+// ServerConfig - the limits of the REST server
+func (h HTTP) ServerConfig() http.ServerConfig {
+	return http.ServerConfig{
+		ReadHeaderTimeout: h.ReadHeaderTimeout,
+		ReadTimeout:       h.ReadTimeout,
+		WriteTimeout:      h.WriteTimeout,
+		IdleTimeout:       h.IdleTimeout,
+		MaxHeaderBytes:    h.MaxHeaderBytes,
+		MaxBodyBytes:      h.MaxBodyBytes,
+	}
+}
+
+type GRPC struct {
+	Port int `key:"port" env:"GRPC_PORT" flag:"grpc-port" usage:"port of the gRPC server"`
+}
+
+type Database struct {
+	Host     string `key:"host" env:"DB_HOST" flag:"db-host" usage:"host of the postgres database"`
+	Port     int    `key:"port" env:"DB_PORT" flag:"db-port" usage:"port of the postgres database"`
+	Name     string `key:"name" env:"DB_NAME" flag:"db-name" usage:"name of the postgres database"`
+	Username string `key:"username" env:"DB_USERNAME" flag:"db-username" usage:"user of the postgres database"`
+	Password string `key:"password" env:"DB_PASSWORD"`
+	SSLMode  string `key:"sslmode" env:"DB_SSLMODE" flag:"db-sslmode" usage:"disable, require, verify-ca or verify-full"`
+}
+
+// ConnectionString - for postgresdb.NewDatabase
+func (d Database) ConnectionString() string {
+	return fmt.Sprintf("host=%s port=%d dbname=%s user=%s password=%s sslmode=%s",
+		quote(d.Host), d.Port, quote(d.Name), quote(d.Username), quote(d.Password), quote(d.SSLMode))
+}
+
+// quote - values of a postgres connection string may contain spaces and quotes
+func quote(value string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(value) + "'"
+}
+
+type Log struct {
+	Level string `key:"level" env:"LOG_LEVEL" flag:"log-level" usage:"debug, info, warn or error"`
+}
+
+// SlogLevel - Level, valid once Validate has passed
+func (l Log) SlogLevel() slog.Level {
+	var level slog.Level
+	_ = level.UnmarshalText([]byte(l.Level))
+	return level
+}
+
+type Tracing struct {
+	// Exporter - the standard OTEL_* variables configure the rest, e.g. OTEL_EXPORTER_OTLP_ENDPOINT
+	Exporter string `key:"exporter" env:"OTEL_TRACES_EXPORTER" flag:"tracing-exporter" usage:"none or otlp"`
+}
+
+type Auth struct {
+	// JwtKeysDir - without it a throwaway key is generated: every restart invalidates the access tokens
+	JwtKeysDir          string `key:"jwt_keys_dir" env:"JWT_KEYS_DIR" flag:"jwt-keys-dir" usage:"directory of the PEM keys signing the access tokens"`
+	JwtActiveKeyId      string `key:"jwt_active_key_id" env:"JWT_ACTIVE_KEY_ID" flag:"jwt-active-key-id" usage:"id of the key signing the access tokens, the others only verify"`
+	LoginAttemptTracker string `key:"login_attempt_tracker" env:"LOGIN_ATTEMPT_TRACKER" flag:"login-attempt-tracker" usage:"postgres, shared by every instance, or memory"`
+	// LoginAttemptRetention - the login throttling only looks at the last authentication.LoginGuardConfig.Window
+	LoginAttemptRetention time.Duration `key:"login_attempt_retention" env:"LOGIN_ATTEMPT_RETENTION" flag:"login-attempt-retention" usage:"how long the login attempts are kept as an audit trail"`
+	// OidcProviders are read from the file, or from OIDC_PROVIDERS and the OIDC_<NAME>_* variables, see loadOidcFromEnv
+	OidcProviders []OidcProvider `key:"oidc_providers"`
+}
+
+// LoginGuardConfig - the default thresholds, with the configured retention
+func (a Auth) LoginGuardConfig() authentication.LoginGuardConfig {
+	guard := authentication.DefaultLoginGuardConfig()
+	guard.Retention = a.LoginAttemptRetention
+	return guard
+}
+
+type OidcProvider struct {
+	Name         string   `key:"name"`
+	IssuerUrl    string   `key:"issuer_url"`
+	ClientId     string   `key:"client_id"`
+	ClientSecret string   `key:"client_secret"`
+	Scopes       []string `key:"scopes"`
+}
+
+type Attachments struct {
+	Storage  string `key:"storage" env:"ATTACHMENT_STORAGE" flag:"attachment-storage" usage:"local or s3"`
+	LocalDir string `key:"local_dir" env:"ATTACHMENT_LOCAL_DIR" flag:"attachment-local-dir" usage:"directory of the attachments, with local storage"`
+	S3       S3     `key:"s3"`
+}
+
+type S3 struct {
+	Endpoint  string `key:"endpoint" env:"S3_ENDPOINT" flag:"s3-endpoint" usage:"endpoint of the S3 compatible storage"`
+	Region    string `key:"region" env:"S3_REGION" flag:"s3-region" usage:"region of the bucket"`
+	Bucket    string `key:"bucket" env:"S3_BUCKET" flag:"s3-bucket" usage:"bucket of the attachments"`
+	AccessKey string `key:"access_key" env:"S3_ACCESS_KEY"`
+	SecretKey string `key:"secret_key" env:"S3_SECRET_KEY"`
+}
+
+type Mailer struct {
+	Kind string `key:"kind" env:"MAILER" flag:"mailer" usage:"file, writing the emails to a directory, or smtp"`
+	Dir  string `key:"dir" env:"MAILER_DIR" flag:"mailer-dir" usage:"directory of the emails, with the file mailer"`
+	SMTP SMTP   `key:"smtp"`
+}
+
+type SMTP struct {
+	Addr     string `key:"addr" env:"SMTP_ADDR" flag:"smtp-addr" usage:"host:port of the SMTP relay"`
+	Username string `key:"username" env:"SMTP_USERNAME" flag:"smtp-username" usage:"user of the SMTP relay"`
+	Password string `key:"password" env:"SMTP_PASSWORD"`
+	From     string `key:"from" env:"SMTP_FROM" flag:"smtp-from" usage:"sender of the emails"`
+}
+
+// Default - what is not configured. The database has no default but its port and sslmode.
+func Default() Config {
+	server := http.DefaultServerConfig()
+	var restrictions []string
+	for action := range person.DefaultUnverifiedPolicy().Restricted {
+		restrictions = append(restrictions, string(action))
+	}
+	sort.Strings(restrictions)
+
+	return Config{
+		ShutdownTimeout:               20 * time.Second,
+		UnverifiedAccountRestrictions: restrictions,
+		HTTP: HTTP{
+			Port:              8080,
+			ReadHeaderTimeout: server.ReadHeaderTimeout,
+			ReadTimeout:       server.ReadTimeout,
+			WriteTimeout:      server.WriteTimeout,
+			IdleTimeout:       server.IdleTimeout,
+			MaxHeaderBytes:    server.MaxHeaderBytes,
+			MaxBodyBytes:      server.MaxBodyBytes,
+		},
+		GRPC:        GRPC{Port: 9090},
+		Database:    Database{Port: 5432, SSLMode: "require"},
+		Log:         Log{Level: "info"},
+		Tracing:     Tracing{Exporter: tracing.ExporterNone},
+		Auth:        Auth{LoginAttemptTracker: "postgres", LoginAttemptRetention: authentication.DefaultLoginGuardConfig().Retention},
+		Attachments: Attachments{Storage: "local", LocalDir: "attachments"},
+		Mailer:      Mailer{Kind: "file", Dir: "mails"},
+	}
+}
+
+// Validate reports every invalid setting at once, each named after its key, variable and flag
+func (c Config) Validate() error {
+	var errs []error
+	check := func(ok bool, field string, reason string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf("%s: %s", describe(field), fmt.Sprintf(reason, args...)))
+		}
+	}
+	oneOf := func(value string, field string, allowed ...string) {
+		for _, a := range allowed {
+			if value == a {
+				return
+			}
+		}
+		check(false, field, "is %q, must be one of %s", value, strings.Join(allowed, ", "))
+	}
+
+	if c.AppBaseUrl != "" {
+		u, err := url.Parse(c.AppBaseUrl)
+		check(err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "", "AppBaseUrl", "must be an absolute http(s) url")
+	}
+	check(c.AppBaseUrl != "" || len(c.Auth.OidcProviders) == 0, "AppBaseUrl", "is required by the identity providers, for their callback url")
+	check(c.ShutdownTimeout > 0, "ShutdownTimeout", "must be positive")
+	_, err := person.ParseUnverifiedPolicy(strings.Join(c.UnverifiedAccountRestrictions, ","))
+	check(err == nil, "UnverifiedAccountRestrictions", "%v", err)
+
+	check(validPort(c.HTTP.Port), "HTTP.Port", "must be between 1 and 65535")
+	check(c.HTTP.ReadHeaderTimeout > 0, "HTTP.ReadHeaderTimeout", "must be positive")
+	check(c.HTTP.ReadTimeout > 0, "HTTP.ReadTimeout", "must be positive")
+	check(c.HTTP.WriteTimeout > 0, "HTTP.WriteTimeout", "must be positive")
+	check(c.HTTP.IdleTimeout > 0, "HTTP.IdleTimeout", "must be positive")
+	check(c.HTTP.MaxHeaderBytes > 0, "HTTP.MaxHeaderBytes", "must be positive")
+	check(c.HTTP.MaxBodyBytes > 0, "HTTP.MaxBodyBytes", "must be positive")
+	check(validPort(c.GRPC.Port), "GRPC.Port", "must be between 1 and 65535")
+	check(c.GRPC.Port != c.HTTP.Port, "GRPC.Port", "must differ from the port of the REST server")
+
+	check(c.Database.Host != "", "Database.Host", "is required")
+	check(validPort(c.Database.Port), "Database.Port", "must be between 1 and 65535")
+	check(c.Database.Name != "", "Database.Name", "is required")
+	check(c.Database.Username != "", "Database.Username", "is required")
+	check(c.Database.Password != "", "Database.Password", "is required")
+	oneOf(c.Database.SSLMode, "Database.SSLMode", "disable", "require", "verify-ca", "verify-full")
+
+	var level slog.Level
+	check(level.UnmarshalText([]byte(c.Log.Level)) == nil, "Log.Level", "is %q, must be one of debug, info, warn, error", c.Log.Level)
+	oneOf(c.Tracing.Exporter, "Tracing.Exporter", tracing.ExporterNone, tracing.ExporterOtlp)
+
+	check(c.Auth.JwtKeysDir == "" || c.Auth.JwtActiveKeyId != "", "Auth.JwtActiveKeyId", "is required with a keys directory")
+	oneOf(c.Auth.LoginAttemptTracker, "Auth.LoginAttemptTracker", "postgres", "memory")
+	window := authentication.DefaultLoginGuardConfig().Window
+	check(c.Auth.LoginAttemptRetention >= window, "Auth.LoginAttemptRetention", "must be at least the throttling window, %s", window)
+	names := make(map[string]bool)
+	for i, p := range c.Auth.OidcProviders {
+		field := fmt.Sprintf("Auth.OidcProviders[%d]", i)
+		check(p.Name != "", field, "has no name")
+		check(!names[p.Name], field, "is the second provider named %q", p.Name)
+		names[p.Name] = true
+		check(p.IssuerUrl != "", field, "has no issuer url")
+		check(p.ClientId != "", field, "has no client id")
+	}
+
+	oneOf(c.Attachments.Storage, "Attachments.Storage", "local", "s3")
+	if c.Attachments.Storage == "s3" {
+		check(c.Attachments.S3.Bucket != "", "Attachments.S3.Bucket", "is required with s3 storage")
+	}
+	oneOf(c.Mailer.Kind, "Mailer.Kind", "file", "smtp")
+	if c.Mailer.Kind == "smtp" {
+		check(c.Mailer.SMTP.Addr != "", "Mailer.SMTP.Addr", "is required with the smtp mailer")
+		check(c.Mailer.SMTP.From != "", "Mailer.SMTP.From", "is required with the smtp mailer")
+	}
+
+	return errors.Join(errs...)
+}
+
+func validPort(port int) bool {
+	return port > 0 && port <= 65535
+}
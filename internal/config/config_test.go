@@ -0,0 +1,240 @@
+//go:build unit
+
+package config
+
+import (
+	"errors"
+	"flag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// database - the settings without a default
+var database = []string{"DB_HOST=db", "DB_NAME=splid", "DB_USERNAME=splid", "DB_PASSWORD=secret"}
+
+func writeFile(t *testing.T, name string, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func TestDefaults(t *testing.T) {
+	cfg, err := Load(nil, database)
+	require.NoError(t, err)
+
+	assert.Equal(t, 8080, cfg.HTTP.Port)
+	assert.Equal(t, 9090, cfg.GRPC.Port)
+	assert.Equal(t, 5432, cfg.Database.Port)
+	assert.Equal(t, "require", cfg.Database.SSLMode)
+	assert.Equal(t, 20*time.Second, cfg.ShutdownTimeout)
+	assert.Equal(t, []string{"join-group"}, cfg.UnverifiedAccountRestrictions)
+	assert.Equal(t, 30*24*time.Hour, cfg.Auth.LoginGuardConfig().Retention)
+	assert.Equal(t, "local", cfg.Attachments.Storage)
+	assert.Equal(t, "file", cfg.Mailer.Kind)
+}
+
+func TestPrecedence(t *testing.T) {
+	file := writeFile(t, "config.yaml", `
+http:
+  port: 8000
+  read_timeout: 10s
+grpc:
+  port: 9000
+log:
+  level: warn
+`)
+	environ := append([]string{"CONFIG_FILE=" + file, "HTTP_PORT=8001", "GRPC_PORT=9001"}, database...)
+
+	cfg, err := Load([]string{"-http-port", "8002"}, environ)
+	require.NoError(t, err)
+
+	assert.Equal(t, 8002, cfg.HTTP.Port, "flags win over the environment")
+	assert.Equal(t, 9001, cfg.GRPC.Port, "the environment wins over the file")
+	assert.Equal(t, 10*time.Second, cfg.HTTP.ReadTimeout, "the file wins over the defaults")
+	assert.Equal(t, "warn", cfg.Log.Level)
+	assert.Equal(t, Default().HTTP.WriteTimeout, cfg.HTTP.WriteTimeout)
+}
+
+func TestConfigFlagWinsOverConfigFileEnv(t *testing.T) {
+	fromFlag := writeFile(t, "flag.yaml", "http:\n  port: 8000\n")
+	fromEnv := writeFile(t, "env.yaml", "http:\n  port: 8001\n")
+
+	cfg, err := Load([]string{"-config", fromFlag}, append([]string{"CONFIG_FILE=" + fromEnv}, database...))
+	require.NoError(t, err)
+	assert.Equal(t, 8000, cfg.HTTP.Port)
+}
+
+func TestToml(t *testing.T) {
+	file := writeFile(t, "config.toml", `
+app_base_url = "https://splid.example.com"
+unverified_account_restrictions = ["create-group"]
+
+[database]
+host = "db"
+port = 5433
+name = "splid"
+username = "splid"
+password = "secret"
+sslmode = "disable"
+
+[mailer]
+kind = "smtp"
+smtp = { addr = "smtp.example.com:587", from = "noreply@example.com" }
+
+[[auth.oidc_providers]]
+name = "google"
+issuer_url = "https://accounts.google.com"
+client_id = "client"
+scopes = ["openid", "email"]
+`)
+
+	cfg, err := Load([]string{"-config", file}, nil)
+	require.NoError(t, err)
+
+	assert.Equal(t, "https://splid.example.com", cfg.AppBaseUrl)
+	assert.Equal(t, []string{"create-group"}, cfg.UnverifiedAccountRestrictions)
+	assert.Equal(t, 5433, cfg.Database.Port)
+	assert.Equal(t, "smtp.example.com:587", cfg.Mailer.SMTP.Addr)
+	assert.Equal(t, []OidcProvider{{
+		Name:      "google",
+		IssuerUrl: "https://accounts.google.com",
+		ClientId:  "client",
+		Scopes:    []string{"openid", "email"},
+	}}, cfg.Auth.OidcProviders)
+}
+
+func TestYamlListOfProviders(t *testing.T) {
+	file := writeFile(t, "config.yml", `
+app_base_url: https://splid.example.com
+auth:
+  oidc_providers:
+    - name: google
+      issuer_url: https://accounts.google.com
+      client_id: client
+`)
+
+	cfg, err := Load(nil, append([]string{"CONFIG_FILE=" + file, "OIDC_GOOGLE_CLIENT_SECRET=shh"}, database...))
+	require.NoError(t, err)
+	require.Len(t, cfg.Auth.OidcProviders, 1)
+	assert.Equal(t, "client", cfg.Auth.OidcProviders[0].ClientId)
+	assert.Equal(t, "shh", cfg.Auth.OidcProviders[0].ClientSecret, "the secret of a provider of the file can come from the environment")
+}
+
+func TestOidcFromEnv(t *testing.T) {
+	environ := append([]string{
+		"APP_BASE_URL=https://splid.example.com",
+		"OIDC_PROVIDERS=google, my-keycloak",
+		"OIDC_GOOGLE_ISSUER_URL=https://accounts.google.com",
+		"OIDC_GOOGLE_CLIENT_ID=google-client",
+		"OIDC_MY_KEYCLOAK_ISSUER_URL=https://keycloak.example.com/realms/splid",
+		"OIDC_MY_KEYCLOAK_CLIENT_ID=keycloak-client",
+		"OIDC_MY_KEYCLOAK_SCOPES=openid,profile",
+	}, database...)
+
+	cfg, err := Load(nil, environ)
+	require.NoError(t, err)
+	assert.Equal(t, []OidcProvider{
+		{Name: "google", IssuerUrl: "https://accounts.google.com", ClientId: "google-client"},
+		{Name: "my-keycloak", IssuerUrl: "https://keycloak.example.com/realms/splid", ClientId: "keycloak-client", Scopes: []string{"openid", "profile"}},
+	}, cfg.Auth.OidcProviders)
+}
+
+func TestEmptyVariables(t *testing.T) {
+	cfg, err := Load(nil, append([]string{"HTTP_PORT=", "UNVERIFIED_ACCOUNT_RESTRICTIONS="}, database...))
+	require.NoError(t, err)
+	assert.Equal(t, 8080, cfg.HTTP.Port, "an empty variable is unset")
+	assert.Empty(t, cfg.UnverifiedAccountRestrictions, "an empty list is a list")
+}
+
+func TestUnknownKey(t *testing.T) {
+	file := writeFile(t, "config.yaml", "http:\n  prot: 8000\n")
+
+	_, err := Load([]string{"-config", file}, database)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `unknown key "http.prot"`)
+}
+
+func TestUnknownFormat(t *testing.T) {
+	file := writeFile(t, "config.json", "{}")
+
+	_, err := Load([]string{"-config", file}, database)
+	assert.ErrorContains(t, err, "unknown format")
+}
+
+func TestInvalidValues(t *testing.T) {
+	_, err := Load([]string{"-http-read-timeout", "soon"}, append([]string{"GRPC_PORT=grpc"}, database...))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `grpc.port (GRPC_PORT, -grpc-port): "grpc" is not an integer`)
+	assert.Contains(t, err.Error(), `http.read_timeout (HTTP_READ_TIMEOUT, -http-read-timeout): "soon" is not a duration`)
+}
+
+func TestValidation(t *testing.T) {
+	environ := []string{
+		"DB_PASSWORD=secret",
+		"HTTP_PORT=70000",
+		"LOG_LEVEL=verbose",
+		"MAILER=smtp",
+		"ATTACHMENT_STORAGE=s3",
+		"UNVERIFIED_ACCOUNT_RESTRICTIONS=fly",
+		"OIDC_PROVIDERS=google",
+		"LOGIN_ATTEMPT_RETENTION=10m",
+	}
+
+	_, err := Load(nil, environ)
+	require.Error(t, err)
+	for _, message := range []string{
+		"database.host (DB_HOST, -db-host): is required",
+		"database.name (DB_NAME, -db-name): is required",
+		"http.port (HTTP_PORT, -http-port): must be between 1 and 65535",
+		`log.level (LOG_LEVEL, -log-level): is "verbose"`,
+		"mailer.smtp.addr (SMTP_ADDR, -smtp-addr): is required with the smtp mailer",
+		"attachments.s3.bucket (S3_BUCKET, -s3-bucket): is required with s3 storage",
+		`unverified_account_restrictions (UNVERIFIED_ACCOUNT_RESTRICTIONS, -unverified-account-restrictions): unknown action "fly"`,
+		"auth.oidc_providers[0]: has no issuer url",
+		"app_base_url (APP_BASE_URL, -app-base-url): is required by the identity providers",
+		"auth.login_attempt_retention (LOGIN_ATTEMPT_RETENTION, -login-attempt-retention): must be at least the throttling window",
+	} {
+		assert.Contains(t, err.Error(), message)
+	}
+}
+
+func TestPortsMustDiffer(t *testing.T) {
+	_, err := Load([]string{"-grpc-port", "8080"}, database)
+	assert.ErrorContains(t, err, "grpc.port (GRPC_PORT, -grpc-port): must differ")
+}
+
+func TestSecretsHaveNoFlag(t *testing.T) {
+	_, err := Load([]string{"-db-password", "secret"}, database)
+	assert.ErrorContains(t, err, "flag provided but not defined: -db-password")
+}
+
+func TestHelp(t *testing.T) {
+	_, err := Load([]string{"-h"}, nil)
+	assert.True(t, errors.Is(err, flag.ErrHelp))
+}
+
+func TestUnexpectedArguments(t *testing.T) {
+	_, err := Load([]string{"serve"}, database)
+	assert.ErrorContains(t, err, "unexpected arguments")
+}
+
+func TestConfigurationsAreIndependent(t *testing.T) {
+	first, err := Load([]string{"-http-port", "8001", "-grpc-port", "9001"}, database)
+	require.NoError(t, err)
+	second, err := Load([]string{"-http-port", "8002", "-grpc-port", "9002", "-db-name", "second"}, database)
+	require.NoError(t, err)
+
+	assert.Equal(t, 8001, first.HTTP.Port)
+	assert.Equal(t, 8002, second.HTTP.Port)
+	assert.Equal(t, "splid", first.Database.Name)
+	assert.Equal(t, "second", second.Database.Name)
+}
+
+func TestConnectionString(t *testing.T) {
+	db := Database{Host: "db", Port: 5432, Name: "splid", Username: "splid", Password: `it's a secret`, SSLMode: "disable"}
+	assert.Equal(t, `host='db' port=5432 dbname='splid' user='splid' password='it\'s a secret' sslmode='disable'`, db.ConnectionString())
+}
@@ -0,0 +1,338 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FileEnv - the variable naming the configuration file, when the -config flag does not
+const FileEnv = "CONFIG_FILE"
+
+// Load reads the configuration from, by increasing precedence, the defaults, the file named by the -config flag or
+// CONFIG_FILE (.yaml, .yml or .toml), environ and the flags in args, and validates it. Nothing is read from the process:
+// main passes os.Args[1:] and os.Environ(), a test whatever it needs. It returns flag.ErrHelp when args ask for the
+// usage, which is printed to stderr.
+func Load(args []string, environ []string) (Config, error) {
+	env := make(map[string]string, len(environ))
+	for _, kv := range environ {
+		if key, value, ok := strings.Cut(kv, "="); ok {
+			env[key] = value
+		}
+	}
+
+	// the flags are parsed first, to find the file, but applied last
+	var setFlags []func(cfg *Config) error
+	fs := flag.NewFlagSet("server", flag.ContinueOnError)
+	file := fs.String("config", "", "configuration file, .yaml, .yml or .toml (env "+FileEnv+")")
+	walk(reflect.ValueOf(Default()), "", func(_ reflect.Value, field reflect.StructField, path string) {
+		name := field.Tag.Get("flag")
+		if name == "" {
+			return
+		}
+		usage := field.Tag.Get("usage") + " (env " + field.Tag.Get("env") + ")"
+		fs.Func(name, usage, func(s string) error {
+			setFlags = append(setFlags, func(cfg *Config) error {
+				if err := setValue(lookup(reflect.ValueOf(cfg).Elem(), path), s); err != nil {
+					return fmt.Errorf("%s: %w", describe(path), err)
+				}
+				return nil
+			})
+			return nil
+		})
+	})
+	if err := fs.Parse(args); err != nil {
+		return Config{}, err
+	}
+	if fs.NArg() > 0 {
+		return Config{}, fmt.Errorf("unexpected arguments %q", fs.Args())
+	}
+
+	cfg := Default()
+	if *file == "" {
+		*file = env[FileEnv]
+	}
+	if *file != "" {
+		if err := loadFile(&cfg, *file); err != nil {
+			return Config{}, fmt.Errorf("configuration file %s: %w", *file, err)
+		}
+	}
+
+	var errs []error
+	walk(reflect.ValueOf(&cfg).Elem(), "", func(v reflect.Value, field reflect.StructField, path string) {
+		name := field.Tag.Get("env")
+		value, ok := env[name]
+		// an empty variable is unset, but for lists: it empties them
+		if name == "" || !ok || (value == "" && v.Kind() != reflect.Slice) {
+			return
+		}
+		if err := setValue(v, value); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", describe(path), err))
+		}
+	})
+	loadOidcFromEnv(&cfg.Auth, env)
+
+	for _, set := range setFlags {
+		errs = append(errs, set(&cfg))
+	}
+	if err := errors.Join(errs...); err != nil {
+		return Config{}, err
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return Config{}, err
+	}
+	return cfg, nil
+}
+
+// loadOidcFromEnv - OIDC_PROVIDERS, e.g. "google,keycloak", replaces the providers of the file. Provider NAME, listed
+// there or in the file, is then overridden by OIDC_NAME_ISSUER_URL, OIDC_NAME_CLIENT_ID, OIDC_NAME_CLIENT_SECRET and
+// OIDC_NAME_SCOPES.
+func loadOidcFromEnv(auth *Auth, env map[string]string) {
+	if names, ok := env["OIDC_PROVIDERS"]; ok {
+		fromFile := make(map[string]OidcProvider, len(auth.OidcProviders))
+		for _, p := range auth.OidcProviders {
+			fromFile[p.Name] = p
+		}
+		auth.OidcProviders = nil
+		for _, name := range splitList(names) {
+			p, ok := fromFile[name]
+			if !ok {
+				p = OidcProvider{Name: name}
+			}
+			auth.OidcProviders = append(auth.OidcProviders, p)
+		}
+	}
+
+	for i := range auth.OidcProviders {
+		p := &auth.OidcProviders[i]
+		prefix := "OIDC_" + strings.ToUpper(strings.ReplaceAll(p.Name, "-", "_")) + "_"
+		for suffix, field := range map[string]*string{"ISSUER_URL": &p.IssuerUrl, "CLIENT_ID": &p.ClientId, "CLIENT_SECRET": &p.ClientSecret} {
+			if value := env[prefix+suffix]; value != "" {
+				*field = value
+			}
+		}
+		if scopes := env[prefix+"SCOPES"]; scopes != "" {
+			p.Scopes = splitList(scopes)
+		}
+	}
+}
+
+// loadFile overwrites cfg with the settings of the file. Unknown keys are errors: a typo would otherwise be silently
+// ignored.
+func loadFile(cfg *Config, path string) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	settings := map[string]any{}
+	switch filepath.Ext(path) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(content, &settings)
+	case ".toml":
+		err = toml.Unmarshal(content, &settings)
+	default:
+		return errors.New("unknown format, the extension must be .yaml, .yml or .toml")
+	}
+	if err != nil {
+		return err
+	}
+	return setStruct(reflect.ValueOf(cfg).Elem(), settings, "")
+}
+
+// walk calls fn on every field of the struct v, descending in the nested structs, path being the dotted field names
+func walk(v reflect.Value, path string, fn func(v reflect.Value, field reflect.StructField, path string)) {
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		fieldPath := field.Name
+		if path != "" {
+			fieldPath = path + "." + field.Name
+		}
+		if field.Type.Kind() == reflect.Struct {
+			walk(v.Field(i), fieldPath, fn)
+			continue
+		}
+		fn(v.Field(i), field, fieldPath)
+	}
+}
+
+// lookup returns the field of the struct v at the dotted path
+func lookup(v reflect.Value, path string) reflect.Value {
+	for _, name := range strings.Split(path, ".") {
+		v = v.FieldByName(name)
+	}
+	return v
+}
+
+// describe names the setting at the dotted field path, e.g. "HTTP.Port", the way users know it: `http.port (HTTP_PORT,
+// -http-port)`. A trailing index, e.g. "Auth.OidcProviders[1]", is kept.
+func describe(path string) string {
+	path, index, _ := strings.Cut(path, "[")
+	if index != "" {
+		index = "[" + index
+	}
+
+	t := reflect.TypeOf(Config{})
+	var keys []string
+	var field reflect.StructField
+	for _, name := range strings.Split(path, ".") {
+		field, _ = t.FieldByName(name)
+		keys = append(keys, field.Tag.Get("key"))
+		t = field.Type
+	}
+
+	description := strings.Join(keys, ".") + index
+	var sources []string
+	if env := field.Tag.Get("env"); env != "" {
+		sources = append(sources, env)
+	}
+	if flag := field.Tag.Get("flag"); flag != "" {
+		sources = append(sources, "-"+flag)
+	}
+	if len(sources) > 0 {
+		description += " (" + strings.Join(sources, ", ") + ")"
+	}
+	return description
+}
+
+// setStruct overwrites the fields of the struct v with the settings, path being the key of v in the file
+func setStruct(v reflect.Value, settings map[string]any, path string) error {
+	// sorted, for the errors to be reported in a stable order
+	keys := make([]string, 0, len(settings))
+	for key := range settings {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var errs []error
+	for _, key := range keys {
+		raw := settings[key]
+		keyPath := key
+		if path != "" {
+			keyPath = path + "." + key
+		}
+
+		field, ok := fieldByKey(v, key)
+		if !ok {
+			errs = append(errs, fmt.Errorf("unknown key %q", keyPath))
+			continue
+		}
+		if err := setAny(field, raw, keyPath); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func fieldByKey(v reflect.Value, key string) (reflect.Value, bool) {
+	for i := 0; i < v.NumField(); i++ {
+		if v.Type().Field(i).Tag.Get("key") == key {
+			return v.Field(i), true
+		}
+	}
+	return reflect.Value{}, false
+}
+
+// setAny sets v to raw, a value decoded from the file
+func setAny(v reflect.Value, raw any, path string) error {
+	switch {
+	case v.Kind() == reflect.Struct:
+		settings, ok := raw.(map[string]any)
+		if !ok {
+			return fmt.Errorf("%s: expected a table, got %v", path, raw)
+		}
+		return setStruct(v, settings, path)
+
+	case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Struct:
+		var items []map[string]any
+		switch raw := raw.(type) {
+		case []map[string]any:
+			items = raw
+		case []any:
+			for _, item := range raw {
+				settings, ok := item.(map[string]any)
+				if !ok {
+					return fmt.Errorf("%s: expected a list of tables, got %v", path, raw)
+				}
+				items = append(items, settings)
+			}
+		default:
+			return fmt.Errorf("%s: expected a list of tables, got %v", path, raw)
+		}
+
+		slice := reflect.MakeSlice(v.Type(), len(items), len(items))
+		var errs []error
+		for i, settings := range items {
+			errs = append(errs, setStruct(slice.Index(i), settings, fmt.Sprintf("%s[%d]", path, i)))
+		}
+		v.Set(slice)
+		return errors.Join(errs...)
+
+	case v.Kind() == reflect.Slice:
+		list, ok := raw.([]any)
+		if !ok {
+			break
+		}
+		values := make([]string, 0, len(list))
+		for _, item := range list {
+			values = append(values, fmt.Sprint(item))
+		}
+		v.Set(reflect.ValueOf(values))
+		return nil
+	}
+
+	// scalars are parsed the way the variables and the flags are, so that "30s" and 8080 mean the same everywhere
+	if err := setValue(v, fmt.Sprint(raw)); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// setValue sets v to s, a value read from a variable or a flag: a string, a number, a duration like "30s" or a comma
+// separated list
+func setValue(v reflect.Value, s string) error {
+	switch {
+	case v.Type() == durationType:
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return fmt.Errorf("%q is not a duration, e.g. 30s", s)
+		}
+		v.SetInt(int64(d))
+	case v.Kind() == reflect.String:
+		v.SetString(s)
+	case v.Kind() == reflect.Int, v.Kind() == reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return fmt.Errorf("%q is not an integer", s)
+		}
+		v.SetInt(n)
+	case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.String:
+		v.Set(reflect.ValueOf(splitList(s)))
+	default:
+		return fmt.Errorf("unsupported setting of type %s", v.Type())
+	}
+	return nil
+}
+
+// splitList - "a, b,c" is [a b c], "" is empty
+func splitList(s string) []string {
+	values := []string{}
+	for _, value := range strings.Split(s, ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
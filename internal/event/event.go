@@ -0,0 +1,214 @@
+package event
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/antoniobelotti/splid_backend_clone/internal/apperror"
+	"github.com/antoniobelotti/splid_backend_clone/internal/health"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Type - identifies what happened. Consumers subscribe to one or more types.
+type Type string
+
+const (
+	GroupCreated    Type = "group.created"
+	MemberJoined    Type = "group.member-joined"
+	ExpenseCreated  Type = "expense.created"
+	ExpenseDeleted  Type = "expense.deleted"
+	TransferCreated Type = "transfer.created"
+	PersonDeleted   Type = "person.deleted"
+)
+
+// Event - a domain event read back from the outbox.
+// Payload is the json encoding of the entity the event refers to (e.g. an expense.Expense for ExpenseCreated)
+type Event struct {
+	Id        int             `json:"id" db:"id"`
+	Type      Type            `json:"type" db:"event_type"`
+	Payload   json.RawMessage `json:"payload" db:"payload"`
+	CreatedAt time.Time       `json:"created-at" db:"created_at"`
+	// Attempts - failed deliveries of the event so far
+	Attempts int `json:"-" db:"attempts"`
+}
+
+// Decode unmarshals the event payload into v
+func (e Event) Decode(v any) error {
+	return json.Unmarshal(e.Payload, v)
+}
+
+// MemberJoinedPayload - payload of MemberJoined events
+type MemberJoinedPayload struct {
+	GroupId  int `json:"group-id"`
+	PersonId int `json:"person-id"`
+}
+
+// PersonDeletedPayload - payload of PersonDeleted events
+type PersonDeletedPayload struct {
+	PersonId int `json:"person-id"`
+}
+
+// Store - events are written to the outbox by the stores of the other domains, in the same transaction as the
+// change they describe. The dispatcher only needs to read them back and record the delivery outcome.
+type Store interface {
+	// ClaimPendingEvents returns up to limit pending events, in insertion order, that no other dispatcher has claimed,
+	// and claims them for claimFor
+	ClaimPendingEvents(ctx context.Context, limit int, claimFor time.Duration) ([]Event, error)
+	// GetDeliveredHandlers returns the names of the handlers a failed event was already delivered to
+	GetDeliveredHandlers(ctx context.Context, eventId int) ([]string, error)
+	MarkEventDispatched(ctx context.Context, eventId int) error
+	// MarkEventFailed records a failed delivery, the handlers in deliveredTo having succeeded, and releases the claim
+	MarkEventFailed(ctx context.Context, eventId int, reason string, deliveredTo []string) error
+}
+
+// Handler - an in-process consumer. Delivery is at-least-once so handlers must be idempotent.
+type Handler func(ctx context.Context, e Event) error
+
+type namedHandler struct {
+	name    string
+	handler Handler
+}
+
+var (
+	ErrUnexpected = apperror.New(apperror.Internal, "unexpected_error", "unexpected error")
+)
+
+const (
+	DefaultPollInterval = time.Second
+	// minMaxSilence - a batch may take a while to deliver: the dispatcher is not considered stuck before this long
+	minMaxSilence = 30 * time.Second
+	// MaxDeliveryAttempts - after this many failed deliveries an event is no longer considered pending
+	MaxDeliveryAttempts = 10
+	defaultBatchSize    = 100
+	// claimDuration - how long the events of a batch are reserved to the dispatcher that claimed them: if it stops
+	// before delivering them, another one does after this long
+	claimDuration = 5 * time.Minute
+)
+
+// Dispatcher - polls the outbox and relays pending events to the registered handlers. Every instance of the server
+// runs one: each event is claimed, and delivered, by a single dispatcher. Handlers keeping state in memory, like the
+// Hub, therefore only see the events their instance claimed.
+type Dispatcher struct {
+	store        Store
+	pollInterval time.Duration
+	heartbeat    *health.Heartbeat
+
+	mu       sync.RWMutex
+	handlers map[Type][]namedHandler
+}
+
+func NewDispatcher(store Store, pollInterval time.Duration) *Dispatcher {
+	if pollInterval <= 0 {
+		pollInterval = DefaultPollInterval
+	}
+	maxSilence := 3 * pollInterval
+	if maxSilence < minMaxSilence {
+		maxSilence = minMaxSilence
+	}
+	return &Dispatcher{
+		store:        store,
+		pollInterval: pollInterval,
+		heartbeat:    health.NewHeartbeat(maxSilence),
+		handlers:     make(map[Type][]namedHandler),
+	}
+}
+
+// Subscribe registers h to be called for every event of type t. The name, unique among the handlers of t, is stored
+// with the failed deliveries so that a retry skips the handlers that succeeded: it must not change between releases.
+func (d *Dispatcher) Subscribe(t Type, name string, h Handler) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, s := range d.handlers[t] {
+		if s.name == name {
+			panic(fmt.Sprintf("event: %s already has a handler named %q", t, name))
+		}
+	}
+	d.handlers[t] = append(d.handlers[t], namedHandler{name: name, handler: h})
+}
+
+// Run relays events until ctx is cancelled
+func (d *Dispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := d.DispatchPending(ctx); err != nil {
+			slog.ErrorContext(ctx, "unable to dispatch the pending events", "error", err)
+		}
+		d.heartbeat.Beat()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// CheckRunning is a health.Check failing when Run is not running, or is stuck
+func (d *Dispatcher) CheckRunning(ctx context.Context) error {
+	return d.heartbeat.Check(ctx)
+}
+
+// DispatchPending claims and delivers one batch of pending events, in insertion order, and returns how many were
+// delivered. An event whose handlers fail is left in the outbox and retried on the next call, only by the handlers
+// that failed.
+func (d *Dispatcher) DispatchPending(ctx context.Context) (int, error) {
+	events, err := d.store.ClaimPendingEvents(ctx, defaultBatchSize, claimDuration)
+	if err != nil {
+		return 0, fmt.Errorf("%w %w", ErrUnexpected, err)
+	}
+
+	delivered := 0
+	for _, e := range events {
+		if ctx.Err() != nil {
+			return delivered, nil
+		}
+
+		deliveredTo, err := d.deliver(ctx, e)
+		if err != nil {
+			if err := d.store.MarkEventFailed(ctx, e.Id, err.Error(), deliveredTo); err != nil {
+				return delivered, fmt.Errorf("%w %w", ErrUnexpected, err)
+			}
+			continue
+		}
+
+		if err := d.store.MarkEventDispatched(ctx, e.Id); err != nil {
+			return delivered, fmt.Errorf("%w %w", ErrUnexpected, err)
+		}
+		delivered++
+	}
+	return delivered, nil
+}
+
+// deliver calls the handlers of e that did not succeed on a previous attempt, and returns all those that did
+func (d *Dispatcher) deliver(ctx context.Context, e Event) ([]string, error) {
+	d.mu.RLock()
+	handlers := d.handlers[e.Type]
+	d.mu.RUnlock()
+
+	var deliveredTo []string
+	if e.Attempts > 0 {
+		var err error
+		if deliveredTo, err = d.store.GetDeliveredHandlers(ctx, e.Id); err != nil {
+			return nil, fmt.Errorf("%w %w", ErrUnexpected, err)
+		}
+	}
+
+	var errs []error
+	for _, h := range handlers {
+		if slices.Contains(deliveredTo, h.name) {
+			continue
+		}
+		if err := h.handler(ctx, e); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", h.name, err))
+			continue
+		}
+		deliveredTo = append(deliveredTo, h.name)
+	}
+	return deliveredTo, errors.Join(errs...)
+}
@@ -0,0 +1,238 @@
+//go:build unit
+
+package event
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+type memoryStore struct {
+	events      []Event
+	dispatched  map[int]bool
+	claimed     map[int]bool
+	deliveredTo map[int][]string
+}
+
+func newMemoryStore(events ...Event) *memoryStore {
+	return &memoryStore{events: events, dispatched: map[int]bool{}, claimed: map[int]bool{}, deliveredTo: map[int][]string{}}
+}
+
+func (m *memoryStore) ClaimPendingEvents(_ context.Context, limit int, _ time.Duration) ([]Event, error) {
+	var pending []Event
+	for _, e := range m.events {
+		if !m.dispatched[e.Id] && !m.claimed[e.Id] && e.Attempts < MaxDeliveryAttempts && len(pending) < limit {
+			m.claimed[e.Id] = true
+			pending = append(pending, e)
+		}
+	}
+	return pending, nil
+}
+
+func (m *memoryStore) GetDeliveredHandlers(_ context.Context, eventId int) ([]string, error) {
+	return m.deliveredTo[eventId], nil
+}
+
+func (m *memoryStore) MarkEventDispatched(_ context.Context, eventId int) error {
+	m.dispatched[eventId] = true
+	delete(m.claimed, eventId)
+	return nil
+}
+
+func (m *memoryStore) MarkEventFailed(_ context.Context, eventId int, _ string, deliveredTo []string) error {
+	for i := range m.events {
+		if m.events[i].Id == eventId {
+			m.events[i].Attempts++
+		}
+	}
+	m.deliveredTo[eventId] = deliveredTo
+	delete(m.claimed, eventId)
+	return nil
+}
+
+func TestDispatchPendingDeliversToSubscribers(t *testing.T) {
+	store := newMemoryStore(
+		Event{Id: 1, Type: ExpenseCreated},
+		Event{Id: 2, Type: TransferCreated},
+		Event{Id: 3, Type: ExpenseCreated},
+	)
+	d := NewDispatcher(store, 0)
+
+	var received []int
+	d.Subscribe(ExpenseCreated, "test", func(_ context.Context, e Event) error {
+		received = append(received, e.Id)
+		return nil
+	})
+
+	delivered, err := d.DispatchPending(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 3, delivered, "events without subscribers are still marked as dispatched")
+	assert.Equal(t, []int{1, 3}, received)
+
+	// nothing left to deliver
+	delivered, err = d.DispatchPending(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 0, delivered)
+	assert.Equal(t, []int{1, 3}, received)
+}
+
+func TestDispatchPendingRetriesFailedEvents(t *testing.T) {
+	store := newMemoryStore(Event{Id: 1, Type: MemberJoined})
+	d := NewDispatcher(store, 0)
+
+	calls := 0
+	d.Subscribe(MemberJoined, "test", func(_ context.Context, _ Event) error {
+		calls++
+		if calls == 1 {
+			return errors.New("consumer temporarily unavailable")
+		}
+		return nil
+	})
+
+	delivered, err := d.DispatchPending(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 0, delivered)
+	assert.False(t, store.dispatched[1])
+
+	delivered, err = d.DispatchPending(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 1, delivered)
+	assert.True(t, store.dispatched[1])
+	assert.Equal(t, 2, calls)
+}
+
+func TestDispatchPendingGivesUpAfterMaxAttempts(t *testing.T) {
+	store := newMemoryStore(Event{Id: 1, Type: GroupCreated})
+	d := NewDispatcher(store, 0)
+
+	calls := 0
+	d.Subscribe(GroupCreated, "test", func(_ context.Context, _ Event) error {
+		calls++
+		return errors.New("always failing")
+	})
+
+	for i := 0; i < MaxDeliveryAttempts+5; i++ {
+		_, err := d.DispatchPending(context.Background())
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, MaxDeliveryAttempts, calls)
+}
+
+func TestDispatchPendingRetriesOnlyFailedHandlers(t *testing.T) {
+	store := newMemoryStore(Event{Id: 1, Type: ExpenseDeleted})
+	d := NewDispatcher(store, 0)
+
+	calls := map[string]int{}
+	d.Subscribe(ExpenseDeleted, "counter", func(_ context.Context, _ Event) error {
+		calls["counter"]++
+		return nil
+	})
+	d.Subscribe(ExpenseDeleted, "cleanup", func(_ context.Context, _ Event) error {
+		calls["cleanup"]++
+		if calls["cleanup"] == 1 {
+			return errors.New("blob store unavailable")
+		}
+		return nil
+	})
+
+	for i := 0; i < 2; i++ {
+		_, err := d.DispatchPending(context.Background())
+		assert.NoError(t, err)
+	}
+	assert.True(t, store.dispatched[1])
+	assert.Equal(t, map[string]int{"counter": 1, "cleanup": 2}, calls)
+}
+
+func TestDispatchPendingSkipsClaimedEvents(t *testing.T) {
+	store := newMemoryStore(Event{Id: 1, Type: GroupCreated}, Event{Id: 2, Type: GroupCreated})
+	store.claimed[1] = true
+	d := NewDispatcher(store, 0)
+
+	var received []int
+	d.Subscribe(GroupCreated, "test", func(_ context.Context, e Event) error {
+		received = append(received, e.Id)
+		return nil
+	})
+
+	delivered, err := d.DispatchPending(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 1, delivered)
+	assert.Equal(t, []int{2}, received, "another dispatcher is delivering event 1")
+}
+
+func TestSubscribeRejectsDuplicateNames(t *testing.T) {
+	d := NewDispatcher(newMemoryStore(), 0)
+	d.Subscribe(GroupCreated, "test", func(context.Context, Event) error { return nil })
+	d.Subscribe(ExpenseCreated, "test", func(context.Context, Event) error { return nil })
+
+	assert.Panics(t, func() {
+		d.Subscribe(GroupCreated, "test", func(context.Context, Event) error { return nil })
+	})
+}
+
+func TestEventGroupId(t *testing.T) {
+	groupId, ok := Event{Type: GroupCreated, Payload: []byte(`{"id": 4, "owner-id": 1}`)}.GroupId()
+	assert.True(t, ok)
+	assert.Equal(t, 4, groupId)
+
+	groupId, ok = Event{Type: ExpenseCreated, Payload: []byte(`{"id": 7, "group-id": 4}`)}.GroupId()
+	assert.True(t, ok)
+	assert.Equal(t, 4, groupId)
+
+	_, ok = Event{Type: PersonDeleted, Payload: []byte(`{"person-id": 1}`)}.GroupId()
+	assert.False(t, ok)
+}
+
+func TestHubRelaysMatchingEvents(t *testing.T) {
+	hub := NewHub()
+	events, cancel := hub.Subscribe(InGroup(4))
+
+	assert.NoError(t, hub.Publish(context.Background(), Event{Id: 1, Type: ExpenseCreated, Payload: []byte(`{"group-id": 5}`)}))
+	assert.NoError(t, hub.Publish(context.Background(), Event{Id: 2, Type: MemberJoined, Payload: []byte(`{"group-id": 4}`)}))
+
+	e := <-events
+	assert.Equal(t, 2, e.Id)
+	assert.Empty(t, events)
+
+	cancel()
+	_, open := <-events
+	assert.False(t, open)
+	cancel()
+}
+
+func TestHubDropsSubscribersFallingBehind(t *testing.T) {
+	hub := NewHub()
+	events, cancel := hub.Subscribe(func(Event) bool { return true })
+	defer cancel()
+
+	for i := 0; i <= subscriptionBufferSize; i++ {
+		assert.NoError(t, hub.Publish(context.Background(), Event{Id: i}))
+	}
+
+	received := 0
+	for range events {
+		received++
+	}
+	assert.Equal(t, subscriptionBufferSize, received, "the channel is closed once full")
+}
+
+func TestHubClose(t *testing.T) {
+	hub := NewHub()
+	events, cancel := hub.Subscribe(func(Event) bool { return true })
+	defer cancel()
+	assert.False(t, hub.IsClosed())
+
+	hub.Close()
+	_, open := <-events
+	assert.False(t, open)
+	assert.True(t, hub.IsClosed())
+	assert.NoError(t, hub.Publish(context.Background(), Event{Id: 1}))
+
+	late, cancelLate := hub.Subscribe(func(Event) bool { return true })
+	defer cancelLate()
+	_, open = <-late
+	assert.False(t, open)
+}
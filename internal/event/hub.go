@@ -0,0 +1,122 @@
+package event
+
+import (
+	"context"
+	"sync"
+)
+
+// GroupEventTypes - the types of the events that happen in a group, see Event.GroupId
+var GroupEventTypes = []Type{GroupCreated, MemberJoined, ExpenseCreated, ExpenseDeleted, TransferCreated}
+
+// GroupId returns the group the event happened in, if it happened in a group
+func (e Event) GroupId() (int, bool) {
+	var payload struct {
+		Id      int `json:"id"`
+		GroupId int `json:"group-id"`
+	}
+	switch e.Type {
+	case GroupCreated:
+		if err := e.Decode(&payload); err != nil {
+			return 0, false
+		}
+		return payload.Id, true
+	case MemberJoined, ExpenseCreated, ExpenseDeleted, TransferCreated:
+		if err := e.Decode(&payload); err != nil {
+			return 0, false
+		}
+		return payload.GroupId, true
+	default:
+		return 0, false
+	}
+}
+
+const subscriptionBufferSize = 64
+
+// Hub - relays the events delivered by the dispatcher to live subscribers, e.g. clients streaming what happens in a
+// group. Subscribers only see the events this instance dispatches after they subscribed.
+type Hub struct {
+	mu            sync.Mutex
+	subscriptions map[*subscription]struct{}
+	closed        bool
+}
+
+type subscription struct {
+	filter func(Event) bool
+	events chan Event
+}
+
+func NewHub() *Hub {
+	return &Hub{subscriptions: make(map[*subscription]struct{})}
+}
+
+// Publish is the Handler to subscribe to the dispatcher, for every type of event the subscribers may want
+func (h *Hub) Publish(_ context.Context, e Event) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for sub := range h.subscriptions {
+		if !sub.filter(e) {
+			continue
+		}
+		select {
+		case sub.events <- e:
+		default:
+			// a subscriber falling behind must not hold up the dispatcher: it is dropped and has to subscribe again
+			delete(h.subscriptions, sub)
+			close(sub.events)
+		}
+	}
+	return nil
+}
+
+// Subscribe returns the events matching filter. The channel is closed by cancel, when the subscriber falls too far
+// behind, or when the hub is closed.
+func (h *Hub) Subscribe(filter func(Event) bool) (<-chan Event, func()) {
+	sub := &subscription{filter: filter, events: make(chan Event, subscriptionBufferSize)}
+
+	h.mu.Lock()
+	if h.closed {
+		close(sub.events)
+	} else {
+		h.subscriptions[sub] = struct{}{}
+	}
+	h.mu.Unlock()
+
+	cancel := func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		if _, ok := h.subscriptions[sub]; ok {
+			delete(h.subscriptions, sub)
+			close(sub.events)
+		}
+	}
+	return sub.events, cancel
+}
+
+// Close ends every subscription, e.g. to let streaming clients go before shutting down. Later subscriptions are
+// closed right away.
+func (h *Hub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.closed = true
+	for sub := range h.subscriptions {
+		delete(h.subscriptions, sub)
+		close(sub.events)
+	}
+}
+
+// IsClosed - whether a closed subscription was ended by Close
+func (h *Hub) IsClosed() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.closed
+}
+
+// InGroup - a Subscribe filter for the events of a group
+func InGroup(groupId int) func(Event) bool {
+	return func(e Event) bool {
+		id, ok := e.GroupId()
+		return ok && id == groupId
+	}
+}
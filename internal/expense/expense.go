@@ -3,19 +3,70 @@ package expense
 import (
 	"context"
 	"fmt"
+	"github.com/antoniobelotti/splid_backend_clone/internal/apperror"
+	"github.com/antoniobelotti/splid_backend_clone/internal/tracing"
+	"go.opentelemetry.io/otel"
 )
 
+var tracer = otel.Tracer("github.com/antoniobelotti/splid_backend_clone/internal/expense")
+
 type Expense struct {
 	Id            int `json:"id" db:"id"`
 	AmountInCents int `json:"amount-in-cents" db:"amount_in_cents"`
 	PersonId      int `json:"person-id" db:"person_id"`
 	GroupId       int `json:"group-id" db:"group_id"`
+	// Itemization is nil for expenses split among the whole group
+	Itemization *Itemization `json:"itemization,omitempty" db:"-"`
+	// Payers is empty when PersonId paid the whole amount. Otherwise PersonId is just who recorded the expense.
+	Payers []Payer `json:"payers,omitempty" db:"-"`
+}
+
+// Payer - someone who paid part of an expense
+type Payer struct {
+	PersonId      int `json:"person-id" db:"person_id"`
+	AmountInCents int `json:"amount-in-cents" db:"amount_in_cents"`
+}
+
+// PaidBy returns how much each person paid for the expense
+func (e Expense) PaidBy() map[int]int {
+	if len(e.Payers) == 0 {
+		return map[int]int{e.PersonId: e.AmountInCents}
+	}
+	paid := make(map[int]int, len(e.Payers))
+	for _, p := range e.Payers {
+		paid[p.PersonId] += p.AmountInCents
+	}
+	return paid
+}
+
+func validatePayers(payers []Payer, amountInCents int) error {
+	seen := make(map[int]bool, len(payers))
+	total := 0
+	for _, p := range payers {
+		if p.AmountInCents <= 0 {
+			return fmt.Errorf("%w: person %d must pay a positive amount", ErrInvalidPayers, p.PersonId)
+		}
+		if seen[p.PersonId] {
+			return fmt.Errorf("%w: person %d listed more than once", ErrInvalidPayers, p.PersonId)
+		}
+		seen[p.PersonId] = true
+		total += p.AmountInCents
+	}
+	if total != amountInCents {
+		return fmt.Errorf("%w: payers paid %d but the expense amount is %d", ErrInvalidPayers, total, amountInCents)
+	}
+	return nil
 }
 
 type Store interface {
-	CreateExpense(ctx context.Context, AmountInCents int, PersonId int, GroupId int) (int, error)
+	// CreateExpense must return the id of the already existing expense when called again with the same non-empty idempotencyKey
+	CreateExpense(ctx context.Context, e Expense, idempotencyKey string) (int, error)
 	IsPersonInGroup(ctx context.Context, groupId int, personId int) (bool, error)
 	GetExpenseByGroupId(ctx context.Context, groupId int) ([]Expense, error)
+	// GetExpensesByGroupIds returns the expenses of all the groups, most recent first
+	GetExpensesByGroupIds(ctx context.Context, groupIds []int) ([]Expense, error)
+	GetExpenseById(ctx context.Context, expenseId int) (Expense, error)
+	DeleteExpense(ctx context.Context, e Expense) error
 }
 
 type Service struct {
@@ -26,21 +77,88 @@ func NewService(store Store) Service {
 	return Service{store: store}
 }
 
-func (s *Service) CreateExpense(ctx context.Context, AmountInCents int, PersonId int, GroupId int) (Expense, error) {
-	isPersonInGroup, err := s.store.IsPersonInGroup(ctx, GroupId, PersonId)
+type idempotencyKeyCtxKey struct{}
+
+// WithIdempotencyKey returns a context that makes CreateExpense create at most one expense for the given key.
+// Retrying a call with the same key returns the expense created by the first successful attempt.
+func WithIdempotencyKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, idempotencyKeyCtxKey{}, key)
+}
+
+func idempotencyKeyFromContext(ctx context.Context) string {
+	key, _ := ctx.Value(idempotencyKeyCtxKey{}).(string)
+	return key
+}
+
+var (
+	ErrPersonNotInGroup = apperror.New(apperror.Forbidden, "person_not_in_group", "person does not belong to the group")
+	ErrInvalidAmount    = apperror.NewInvalidField("amount-in-cents", "invalid_amount", "amount must be positive")
+	ErrInvalidPayers    = apperror.NewInvalidField("payers", "invalid_payers", "invalid payers")
+	ErrExpenseNotFound  = apperror.New(apperror.NotFound, "expense_not_found", "expense not found")
+	ErrNotExpenseOwner  = apperror.New(apperror.Forbidden, "not_expense_owner", "only the person who recorded the expense can delete it")
+	ErrUnexpected       = apperror.New(apperror.Internal, "unexpected_error", "unexpected error")
+)
+
+func (s *Service) CreateExpense(ctx context.Context, AmountInCents int, PersonId int, GroupId int) (_ Expense, err error) {
+	ctx, span := tracer.Start(ctx, "expense.CreateExpense")
+	defer func() { tracing.End(span, err) }()
+
+	return s.CreateDetailedExpense(ctx, Expense{
+		AmountInCents: AmountInCents,
+		PersonId:      PersonId,
+		GroupId:       GroupId,
+	})
+}
+
+// CreateDetailedExpense creates e after validating its amount, which must be positive, and its optional itemization
+// and payers
+func (s *Service) CreateDetailedExpense(ctx context.Context, e Expense) (_ Expense, err error) {
+	ctx, span := tracer.Start(ctx, "expense.CreateDetailedExpense")
+	defer func() { tracing.End(span, err) }()
+
+	if e.AmountInCents <= 0 {
+		return Expense{}, ErrInvalidAmount
+	}
+	isPersonInGroup, err := s.store.IsPersonInGroup(ctx, e.GroupId, e.PersonId)
 	if err != nil {
-		return Expense{}, fmt.Errorf("unexpected error: %w", err)
+		return Expense{}, fmt.Errorf("%w %w", ErrUnexpected, err)
 	}
 	if !isPersonInGroup {
-		return Expense{}, fmt.Errorf("person id %d does not belong to group %d and as such cannot add an expense: %w", PersonId, GroupId, err)
+		return Expense{}, fmt.Errorf("person id %d does not belong to group %d and as such cannot add an expense: %w", e.PersonId, e.GroupId, ErrPersonNotInGroup)
 	}
 
-	e := Expense{
-		AmountInCents: AmountInCents,
-		PersonId:      PersonId,
-		GroupId:       GroupId,
+	if e.Itemization != nil {
+		if err := e.Itemization.Validate(e.AmountInCents); err != nil {
+			return Expense{}, err
+		}
+		for _, consumerId := range e.Itemization.ConsumerIds() {
+			isConsumerInGroup, err := s.store.IsPersonInGroup(ctx, e.GroupId, consumerId)
+			if err != nil {
+				return Expense{}, fmt.Errorf("%w %w", ErrUnexpected, err)
+			}
+			if !isConsumerInGroup {
+				return Expense{}, fmt.Errorf("%w: consumer %d does not belong to group %d", ErrInvalidItemization, consumerId, e.GroupId)
+			}
+		}
 	}
-	id, err := s.store.CreateExpense(ctx, AmountInCents, PersonId, GroupId)
+
+	if len(e.Payers) > 0 {
+		if err := validatePayers(e.Payers, e.AmountInCents); err != nil {
+			return Expense{}, err
+		}
+		for _, p := range e.Payers {
+			isPayerInGroup, err := s.store.IsPersonInGroup(ctx, e.GroupId, p.PersonId)
+			if err != nil {
+				return Expense{}, fmt.Errorf("%w %w", ErrUnexpected, err)
+			}
+			if !isPayerInGroup {
+				return Expense{}, fmt.Errorf("%w: payer %d does not belong to group %d", ErrInvalidPayers, p.PersonId, e.GroupId)
+			}
+		}
+	}
+
+	e.Id = 0
+	id, err := s.store.CreateExpense(ctx, e, idempotencyKeyFromContext(ctx))
 	if err != nil {
 		return Expense{}, fmt.Errorf("unable to create Expense: %w", err)
 	}
@@ -49,6 +167,42 @@ func (s *Service) CreateExpense(ctx context.Context, AmountInCents int, PersonId
 	return e, nil
 }
 
-func (s *Service) GetExpenseByGroupId(ctx context.Context, groupId int) ([]Expense, error) {
+func (s *Service) GetExpenseByGroupId(ctx context.Context, groupId int) (_ []Expense, err error) {
+	ctx, span := tracer.Start(ctx, "expense.GetExpenseByGroupId")
+	defer func() { tracing.End(span, err) }()
+
 	return s.store.GetExpenseByGroupId(ctx, groupId)
 }
+
+func (s *Service) GetExpensesByGroupIds(ctx context.Context, groupIds []int) (_ []Expense, err error) {
+	ctx, span := tracer.Start(ctx, "expense.GetExpensesByGroupIds")
+	defer func() { tracing.End(span, err) }()
+
+	expenses, err := s.store.GetExpensesByGroupIds(ctx, groupIds)
+	if err != nil {
+		return nil, fmt.Errorf("%w %w", ErrUnexpected, err)
+	}
+	return expenses, nil
+}
+
+func (s *Service) GetExpenseById(ctx context.Context, expenseId int) (_ Expense, err error) {
+	ctx, span := tracer.Start(ctx, "expense.GetExpenseById")
+	defer func() { tracing.End(span, err) }()
+
+	return s.store.GetExpenseById(ctx, expenseId)
+}
+
+// DeleteExpense removes the expense from the group balance. Only the person who recorded it can delete it.
+func (s *Service) DeleteExpense(ctx context.Context, expenseId int, personId int) (err error) {
+	ctx, span := tracer.Start(ctx, "expense.DeleteExpense")
+	defer func() { tracing.End(span, err) }()
+
+	e, err := s.store.GetExpenseById(ctx, expenseId)
+	if err != nil {
+		return err
+	}
+	if e.PersonId != personId {
+		return ErrNotExpenseOwner
+	}
+	return s.store.DeleteExpense(ctx, e)
+}
@@ -0,0 +1,33 @@
+//go:build unit
+
+package expense
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestPaidBy(t *testing.T) {
+	single := Expense{AmountInCents: 1000, PersonId: 1}
+	assert.Equal(t, map[int]int{1: 1000}, single.PaidBy())
+
+	shared := Expense{AmountInCents: 1000, PersonId: 1, Payers: []Payer{
+		{PersonId: 2, AmountInCents: 600},
+		{PersonId: 3, AmountInCents: 400},
+	}}
+	assert.Equal(t, map[int]int{2: 600, 3: 400}, shared.PaidBy(), "the person recording the expense did not pay")
+}
+
+func TestValidatePayers(t *testing.T) {
+	assert.NoError(t, validatePayers([]Payer{{PersonId: 1, AmountInCents: 600}, {PersonId: 2, AmountInCents: 400}}, 1000))
+
+	table := [][]Payer{
+		{{PersonId: 1, AmountInCents: 600}, {PersonId: 2, AmountInCents: 300}},
+		{{PersonId: 1, AmountInCents: 500}, {PersonId: 1, AmountInCents: 500}},
+		{{PersonId: 1, AmountInCents: 1100}, {PersonId: 2, AmountInCents: -100}},
+		{{PersonId: 1, AmountInCents: 1000}, {PersonId: 2, AmountInCents: 0}},
+	}
+	for i, payers := range table {
+		assert.ErrorIs(t, validatePayers(payers, 1000), ErrInvalidPayers, "case %d", i)
+	}
+}
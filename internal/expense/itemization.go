@@ -0,0 +1,177 @@
+package expense
+
+import (
+	"fmt"
+	"github.com/antoniobelotti/splid_backend_clone/internal/apperror"
+	"sort"
+)
+
+// SplitRule - how tax and tip are distributed among the people who consumed something
+type SplitRule string
+
+const (
+	// Proportional - each person pays a share proportional to the subtotal of what they consumed
+	Proportional SplitRule = "proportional"
+	// Equal - every consumer pays the same share, regardless of what they consumed
+	Equal SplitRule = "equal"
+)
+
+// Item - a line of an itemized receipt. Its total is split equally among its consumers.
+type Item struct {
+	Description      string `json:"description"`
+	UnitPriceInCents int    `json:"unit-price-in-cents"`
+	Quantity         int    `json:"quantity"`
+	ConsumerIds      []int  `json:"consumer-ids"`
+}
+
+func (i Item) TotalInCents() int {
+	return i.UnitPriceInCents * i.Quantity
+}
+
+// Itemization - breakdown of an expense into line items plus tax and tip.
+// Items, tax and tip must add up to the amount of the expense.
+type Itemization struct {
+	Items      []Item    `json:"items"`
+	TaxInCents int       `json:"tax-in-cents"`
+	TipInCents int       `json:"tip-in-cents"`
+	TaxRule    SplitRule `json:"tax-rule"`
+	TipRule    SplitRule `json:"tip-rule"`
+}
+
+var (
+	ErrInvalidItemization = apperror.NewInvalidField("itemization", "invalid_itemization", "invalid itemization")
+)
+
+func (it Itemization) SubtotalInCents() int {
+	subtotal := 0
+	for _, i := range it.Items {
+		subtotal += i.TotalInCents()
+	}
+	return subtotal
+}
+
+func (it Itemization) TotalInCents() int {
+	return it.SubtotalInCents() + it.TaxInCents + it.TipInCents
+}
+
+// ConsumerIds returns everyone who consumed at least one item, sorted by id
+func (it Itemization) ConsumerIds() []int {
+	seen := make(map[int]bool)
+	var ids []int
+	for _, i := range it.Items {
+		for _, c := range i.ConsumerIds {
+			if !seen[c] {
+				seen[c] = true
+				ids = append(ids, c)
+			}
+		}
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+// Validate checks the itemization is well-formed and reconciles with the amount of the expense
+func (it Itemization) Validate(amountInCents int) error {
+	if len(it.Items) == 0 {
+		return fmt.Errorf("%w: at least one item is required", ErrInvalidItemization)
+	}
+	for idx, i := range it.Items {
+		if i.Quantity < 1 {
+			return fmt.Errorf("%w: item %d: quantity must be positive", ErrInvalidItemization, idx)
+		}
+		if i.UnitPriceInCents < 0 {
+			return fmt.Errorf("%w: item %d: price cannot be negative", ErrInvalidItemization, idx)
+		}
+		if len(i.ConsumerIds) == 0 {
+			return fmt.Errorf("%w: item %d: at least one consumer is required", ErrInvalidItemization, idx)
+		}
+		seen := make(map[int]bool, len(i.ConsumerIds))
+		for _, c := range i.ConsumerIds {
+			if seen[c] {
+				return fmt.Errorf("%w: item %d: consumer %d listed more than once", ErrInvalidItemization, idx, c)
+			}
+			seen[c] = true
+		}
+	}
+	if it.TaxInCents < 0 || it.TipInCents < 0 {
+		return fmt.Errorf("%w: tax and tip cannot be negative", ErrInvalidItemization)
+	}
+	for _, rule := range []SplitRule{it.TaxRule, it.TipRule} {
+		if rule != Proportional && rule != Equal {
+			return fmt.Errorf("%w: unknown split rule %q", ErrInvalidItemization, rule)
+		}
+	}
+	if it.TotalInCents() != amountInCents {
+		return fmt.Errorf("%w: items, tax and tip add up to %d but the expense amount is %d", ErrInvalidItemization, it.TotalInCents(), amountInCents)
+	}
+	return nil
+}
+
+// Shares returns how much each consumer owes. The shares always add up to TotalInCents: cents that cannot be split
+// evenly go to the people with the largest remainders, ties broken by lowest person id.
+func (it Itemization) Shares() map[int]int {
+	subtotals := make(map[int]int)
+	for _, i := range it.Items {
+		weights := make(map[int]int, len(i.ConsumerIds))
+		for _, c := range i.ConsumerIds {
+			weights[c] = 1
+		}
+		for p, share := range distribute(i.TotalInCents(), weights) {
+			subtotals[p] += share
+		}
+	}
+
+	shares := make(map[int]int, len(subtotals))
+	for p, subtotal := range subtotals {
+		shares[p] = subtotal
+	}
+	for _, extra := range []struct {
+		amount int
+		rule   SplitRule
+	}{{it.TaxInCents, it.TaxRule}, {it.TipInCents, it.TipRule}} {
+		weights := subtotals
+		if extra.rule == Equal || it.SubtotalInCents() == 0 {
+			weights = make(map[int]int, len(subtotals))
+			for p := range subtotals {
+				weights[p] = 1
+			}
+		}
+		for p, share := range distribute(extra.amount, weights) {
+			shares[p] += share
+		}
+	}
+	return shares
+}
+
+// distribute splits amount proportionally to weights using the largest remainder method
+func distribute(amount int, weights map[int]int) map[int]int {
+	totalWeight := 0
+	ids := make([]int, 0, len(weights))
+	for id, w := range weights {
+		totalWeight += w
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	result := make(map[int]int, len(weights))
+	if totalWeight == 0 {
+		return result
+	}
+
+	remainders := make(map[int]int, len(weights))
+	assigned := 0
+	for _, id := range ids {
+		result[id] = amount * weights[id] / totalWeight
+		remainders[id] = amount * weights[id] % totalWeight
+		assigned += result[id]
+	}
+
+	sort.SliceStable(ids, func(i, j int) bool {
+		return remainders[ids[i]] > remainders[ids[j]]
+	})
+	for i := 0; assigned < amount; i++ {
+		result[ids[i%len(ids)]]++
+		assigned++
+	}
+	return result
+}
@@ -0,0 +1,75 @@
+//go:build unit
+
+package expense
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestItemizationShares(t *testing.T) {
+	// restaurant bill:
+	// p1 had a 12€ pizza, p2 two 4.5€ beers, p1 p2 and p3 shared a 10€ starter
+	// subtotals: p1 = 12 + 3.34 = 15.34, p2 = 9 + 3.33 = 12.33, p3 = 3.33
+	it := Itemization{
+		Items: []Item{
+			{Description: "pizza", UnitPriceInCents: 1200, Quantity: 1, ConsumerIds: []int{1}},
+			{Description: "beer", UnitPriceInCents: 450, Quantity: 2, ConsumerIds: []int{2}},
+			{Description: "starter", UnitPriceInCents: 1000, Quantity: 1, ConsumerIds: []int{1, 2, 3}},
+		},
+		TaxInCents: 310,
+		TipInCents: 300,
+		TaxRule:    Proportional,
+		TipRule:    Equal,
+	}
+
+	shares := it.Shares()
+
+	// tax proportional to 1534/3100, 1233/3100, 333/3100 of 310 = 153.4, 123.3, 33.3: the leftover cent goes to p1
+	// tip 100 each
+	assert.Equal(t, map[int]int{
+		1: 1534 + 154 + 100,
+		2: 1233 + 123 + 100,
+		3: 333 + 33 + 100,
+	}, shares)
+
+	total := 0
+	for _, s := range shares {
+		total += s
+	}
+	assert.Equal(t, it.TotalInCents(), total, "shares must add up to the total")
+}
+
+func TestItemizationSharesWithZeroSubtotal(t *testing.T) {
+	it := Itemization{
+		Items:      []Item{{Description: "free water", UnitPriceInCents: 0, Quantity: 1, ConsumerIds: []int{1, 2}}},
+		TipInCents: 101,
+		TaxRule:    Proportional,
+		TipRule:    Proportional,
+	}
+
+	assert.Equal(t, map[int]int{1: 51, 2: 50}, it.Shares())
+}
+
+func TestItemizationValidate(t *testing.T) {
+	valid := Itemization{
+		Items:      []Item{{Description: "pizza", UnitPriceInCents: 1200, Quantity: 2, ConsumerIds: []int{1, 2}}},
+		TaxInCents: 100,
+		TaxRule:    Proportional,
+		TipRule:    Equal,
+	}
+	assert.NoError(t, valid.Validate(2500))
+	assert.ErrorIs(t, valid.Validate(2400), ErrInvalidItemization, "items, tax and tip must reconcile with the amount")
+
+	table := []Itemization{
+		{TaxRule: Equal, TipRule: Equal},
+		{Items: []Item{{UnitPriceInCents: 100, Quantity: 0, ConsumerIds: []int{1}}}, TaxRule: Equal, TipRule: Equal},
+		{Items: []Item{{UnitPriceInCents: 100, Quantity: 1}}, TaxRule: Equal, TipRule: Equal},
+		{Items: []Item{{UnitPriceInCents: 100, Quantity: 1, ConsumerIds: []int{1, 1}}}, TaxRule: Equal, TipRule: Equal},
+		{Items: []Item{{UnitPriceInCents: 100, Quantity: 1, ConsumerIds: []int{1}}}, TaxRule: "random", TipRule: Equal},
+		{Items: []Item{{UnitPriceInCents: 200, Quantity: 1, ConsumerIds: []int{1}}}, TipInCents: -100, TaxRule: Equal, TipRule: Equal},
+	}
+	for i, it := range table {
+		assert.ErrorIs(t, it.Validate(it.TotalInCents()), ErrInvalidItemization, "case %d", i)
+	}
+}
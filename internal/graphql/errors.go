@@ -0,0 +1,43 @@
+package graphql
+
+import (
+	"context"
+	"errors"
+	"github.com/antoniobelotti/splid_backend_clone/internal/apperror"
+	"log/slog"
+)
+
+// resolverError - reported in the errors of the response with its stable code in the extensions, the same code of
+// the problems reported by the REST server
+type resolverError struct {
+	code    string
+	message string
+}
+
+func (e resolverError) Error() string {
+	return e.message
+}
+
+func (e resolverError) Extensions() map[string]interface{} {
+	return map[string]interface{}{"code": e.code}
+}
+
+var (
+	errInternal         = resolverError{code: "internal_error", message: "internal server error"}
+	errPersonNotInGroup = resolverError{code: "person_not_in_group", message: "person does not belong to the group"}
+)
+
+// toError maps the domain errors to resolver errors. Any other error is an internal error, whose details are logged
+// and not disclosed.
+func toError(ctx context.Context, err error) error {
+	var appErr *apperror.Error
+	if !errors.As(err, &appErr) || appErr.Kind == apperror.Internal {
+		slog.ErrorContext(ctx, "graphql resolver failed", "error", err)
+		return errInternal
+	}
+	message := appErr.Message
+	if appErr.Kind == apperror.Invalid {
+		message = err.Error()
+	}
+	return resolverError{code: appErr.Code, message: message}
+}
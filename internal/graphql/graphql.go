@@ -0,0 +1,56 @@
+package graphql
+
+import (
+	"context"
+	_ "embed"
+	"github.com/antoniobelotti/splid_backend_clone/internal/expense"
+	"github.com/antoniobelotti/splid_backend_clone/internal/group"
+	"github.com/antoniobelotti/splid_backend_clone/internal/http/authentication"
+	"github.com/antoniobelotti/splid_backend_clone/internal/person"
+	"github.com/antoniobelotti/splid_backend_clone/internal/transfer"
+	"github.com/graph-gophers/graphql-go"
+	"time"
+)
+
+//go:embed schema.graphql
+var schemaString string
+
+const (
+	// maxDepth keeps a single query from walking group -> members -> ... indefinitely
+	maxDepth = 10
+	// maxParallelism - how many fields are resolved concurrently. It is the largest batch a loader can get.
+	maxParallelism = 100
+)
+
+// Schema - the read-only GraphQL API over persons, groups, expenses, transfers and balances
+type Schema struct {
+	schema *graphql.Schema
+	fetch  fetchers
+	wait   time.Duration
+}
+
+func NewSchema(ps person.Service, gs group.Service, es expense.Service, ts transfer.Service) Schema {
+	return newSchema(loaderWait, fetchers{
+		persons:             ps.GetPersonsByIds,
+		groups:              gs.GetGroupsByIds,
+		groupsByPersonId:    gs.GetGroupsByPersonId,
+		expensesByGroupIds:  es.GetExpensesByGroupIds,
+		transfersByGroupIds: ts.GetTransfersByGroupIds,
+	})
+}
+
+func newSchema(wait time.Duration, f fetchers) Schema {
+	return Schema{
+		schema: graphql.MustParseSchema(schemaString, &rootResolver{groupsByPersonId: f.groupsByPersonId},
+			graphql.MaxDepth(maxDepth), graphql.MaxParallelism(maxParallelism)),
+		fetch: f,
+		wait:  wait,
+	}
+}
+
+// Exec runs the query on behalf of the person of the credential. Every call gets its own loaders, so nothing is
+// cached across requests.
+func (s Schema) Exec(ctx context.Context, credential authentication.Credential, query string, operationName string, variables map[string]any) *graphql.Response {
+	ctx = context.WithValue(ctx, viewerCtxKey{}, viewer{credential: credential, loaders: newLoaders(s.fetch, s.wait)})
+	return s.schema.Exec(ctx, query, operationName, variables)
+}
@@ -0,0 +1,267 @@
+//go:build unit
+
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/antoniobelotti/splid_backend_clone/internal/expense"
+	"github.com/antoniobelotti/splid_backend_clone/internal/group"
+	"github.com/antoniobelotti/splid_backend_clone/internal/http/authentication"
+	"github.com/antoniobelotti/splid_backend_clone/internal/person"
+	"github.com/antoniobelotti/splid_backend_clone/internal/transfer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memoryData counts the calls of each fetcher, to check the loaders batch them
+type memoryData struct {
+	persons   []person.Person
+	groups    []group.Group
+	expenses  []expense.Expense
+	transfers []transfer.Transfer
+
+	mu    sync.Mutex
+	calls map[string]int
+}
+
+func (m *memoryData) called(name string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.calls[name]++
+}
+
+func (m *memoryData) callsOf(name string) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.calls[name]
+}
+
+func (m *memoryData) fetchers() fetchers {
+	contains := func(ids []int, id int) bool {
+		for _, i := range ids {
+			if i == id {
+				return true
+			}
+		}
+		return false
+	}
+	return fetchers{
+		persons: func(_ context.Context, ids []int) ([]person.Person, error) {
+			m.called("persons")
+			var found []person.Person
+			for _, p := range m.persons {
+				if contains(ids, p.Id) {
+					found = append(found, p)
+				}
+			}
+			return found, nil
+		},
+		groups: func(_ context.Context, ids []int) ([]group.Group, error) {
+			m.called("groups")
+			var found []group.Group
+			for _, g := range m.groups {
+				if contains(ids, g.Id) {
+					found = append(found, g)
+				}
+			}
+			return found, nil
+		},
+		groupsByPersonId: func(_ context.Context, personId int) ([]group.Group, error) {
+			m.called("groupsByPersonId")
+			var found []group.Group
+			for _, g := range m.groups {
+				if contains(g.ComponentIds, personId) {
+					found = append(found, g)
+				}
+			}
+			return found, nil
+		},
+		expensesByGroupIds: func(_ context.Context, groupIds []int) ([]expense.Expense, error) {
+			m.called("expenses")
+			var found []expense.Expense
+			for _, e := range m.expenses {
+				if contains(groupIds, e.GroupId) {
+					found = append(found, e)
+				}
+			}
+			return found, nil
+		},
+		transfersByGroupIds: func(_ context.Context, groupIds []int) ([]transfer.Transfer, error) {
+			m.called("transfers")
+			var found []transfer.Transfer
+			for _, t := range m.transfers {
+				if contains(groupIds, t.GroupId) {
+					found = append(found, t)
+				}
+			}
+			return found, nil
+		},
+	}
+}
+
+// newMemoryData - persons 1, 2 and 3 are in groups 10 and 11, person 4 is alone in group 12
+func newMemoryData() *memoryData {
+	return &memoryData{
+		persons: []person.Person{
+			{Id: 1, Name: "alice", Email: "alice@example.com"},
+			{Id: 2, Name: "bob", Email: "bob@example.com"},
+			{Id: 3, Name: "carol", Email: "carol@example.com"},
+			{Id: 4, Name: "dave", Email: "dave@example.com"},
+		},
+		groups: []group.Group{
+			{Id: 10, Name: "trip", OwnerId: 1, ComponentIds: []int{1, 2, 3}, InvitationCode: "000010"},
+			{Id: 11, Name: "flat", OwnerId: 2, ComponentIds: []int{1, 2, 3}, InvitationCode: "000011"},
+			{Id: 12, Name: "solo", OwnerId: 4, ComponentIds: []int{4}, InvitationCode: "000012"},
+		},
+		expenses: []expense.Expense{
+			{Id: 4, AmountInCents: 900, PersonId: 3, GroupId: 10},
+			{Id: 3, AmountInCents: 900, PersonId: 3, GroupId: 11},
+			{Id: 2, AmountInCents: 600, PersonId: 2, GroupId: 10, Payers: []expense.Payer{{PersonId: 1, AmountInCents: 200}, {PersonId: 2, AmountInCents: 400}}},
+			{Id: 1, AmountInCents: 300, PersonId: 1, GroupId: 10},
+		},
+		transfers: []transfer.Transfer{
+			{Id: 1, AmountInCents: 100, GroupId: 10, SenderId: 3, ReceiverId: 1},
+		},
+		calls: map[string]int{},
+	}
+}
+
+type response struct {
+	Data   json.RawMessage
+	Errors []struct {
+		Message    string
+		Extensions map[string]any
+	}
+}
+
+func exec(t *testing.T, data *memoryData, credential authentication.Credential, query string, variables map[string]any) response {
+	t.Helper()
+	schema := newSchema(50*time.Millisecond, data.fetchers())
+	resp := schema.Exec(context.Background(), credential, query, "", variables)
+
+	raw, err := json.Marshal(resp)
+	require.NoError(t, err)
+	var r response
+	require.NoError(t, json.Unmarshal(raw, &r))
+	return r
+}
+
+func TestGroupsAreLoadedInBatches(t *testing.T) {
+	data := newMemoryData()
+	r := exec(t, data, authentication.Credential{PersonId: 1}, `{
+		groups {
+			name
+			owner { name }
+			members { name }
+			expenses { recordedBy { name } payers { person { name } amountInCents } }
+			transfers { sender { name } receiver { name } }
+			balance { person { name } amountInCents }
+		}
+	}`, nil)
+	require.Empty(t, r.Errors)
+
+	var result struct {
+		Groups []struct {
+			Name     string
+			Members  []struct{ Name string }
+			Expenses []struct {
+				Payers []struct{ AmountInCents int }
+			}
+			Balance []struct {
+				Person        struct{ Name string }
+				AmountInCents int
+			}
+		}
+	}
+	require.NoError(t, json.Unmarshal(r.Data, &result))
+	require.Len(t, result.Groups, 2)
+	assert.Len(t, result.Groups[0].Members, 3)
+	assert.Len(t, result.Groups[0].Expenses, 3)
+	assert.Len(t, result.Groups[0].Expenses[1].Payers, 2)
+
+	// a single query for all the expenses and one for all the transfers, even if balance needs them too
+	assert.Equal(t, 1, data.callsOf("expenses"))
+	assert.Equal(t, 1, data.callsOf("transfers"))
+	// persons are asked for at two levels of the query: at most a query per level
+	assert.LessOrEqual(t, data.callsOf("persons"), 2)
+}
+
+func TestGroupBalance(t *testing.T) {
+	r := exec(t, newMemoryData(), authentication.Credential{PersonId: 1}, `query($id: ID!) {
+		group(id: $id) {
+			balance { person { id } amountInCents }
+			operationsToEvenBalance { id amountInCents sender { id } receiver { id } }
+		}
+	}`, map[string]any{"id": "10"})
+	require.Empty(t, r.Errors)
+
+	// average 600: alice paid 500 and got 100, bob paid 400, carol paid 900 and sent 100
+	assert.JSONEq(t, `{"group": {
+		"balance": [
+			{"person": {"id": "1"}, "amountInCents": 0},
+			{"person": {"id": "2"}, "amountInCents": -200},
+			{"person": {"id": "3"}, "amountInCents": 200}
+		],
+		"operationsToEvenBalance": [
+			{"id": null, "amountInCents": 200, "sender": {"id": "2"}, "receiver": {"id": "3"}}
+		]
+	}}`, string(r.Data))
+}
+
+func TestGroupIsOnlyDisclosedToMembers(t *testing.T) {
+	r := exec(t, newMemoryData(), authentication.Credential{PersonId: 1}, `{ group(id: "12") { name } }`, nil)
+
+	require.Len(t, r.Errors, 1)
+	assert.Equal(t, "person_not_in_group", r.Errors[0].Extensions["code"])
+	assert.JSONEq(t, `{"group": null}`, string(r.Data))
+
+	r = exec(t, newMemoryData(), authentication.Credential{PersonId: 1}, `{ group(id: "99") { name } }`, nil)
+	require.Len(t, r.Errors, 1)
+	assert.Equal(t, "group_not_found", r.Errors[0].Extensions["code"])
+}
+
+func TestGroupRestrictedAccessToken(t *testing.T) {
+	credential := authentication.Credential{
+		PersonId:            1,
+		PersonalAccessToken: &authentication.PersonalAccessToken{GroupIds: []int{11}},
+	}
+
+	r := exec(t, newMemoryData(), credential, `{ groups { id } }`, nil)
+	require.Empty(t, r.Errors)
+	assert.JSONEq(t, `{"groups": [{"id": "11"}]}`, string(r.Data))
+
+	r = exec(t, newMemoryData(), credential, `{ group(id: "10") { id } }`, nil)
+	require.Len(t, r.Errors, 1)
+	assert.Equal(t, authentication.CodeTokenNotValidForGroup, r.Errors[0].Extensions["code"])
+}
+
+func TestEmailIsOnlyDisclosedToThePersonItself(t *testing.T) {
+	r := exec(t, newMemoryData(), authentication.Credential{PersonId: 1}, `{
+		me { email }
+		group(id: "10") { members { id email } }
+	}`, nil)
+	require.Empty(t, r.Errors)
+
+	assert.JSONEq(t, `{
+		"me": {"email": "alice@example.com"},
+		"group": {"members": [
+			{"id": "1", "email": "alice@example.com"},
+			{"id": "2", "email": null},
+			{"id": "3", "email": null}
+		]}
+	}`, string(r.Data))
+}
+
+func TestListLength(t *testing.T) {
+	r := exec(t, newMemoryData(), authentication.Credential{PersonId: 1}, `{ group(id: "10") { expenses(last: 1) { id } } }`, nil)
+	require.Empty(t, r.Errors)
+	assert.JSONEq(t, `{"group": {"expenses": [{"id": "4"}]}}`, string(r.Data))
+
+	r = exec(t, newMemoryData(), authentication.Credential{PersonId: 1}, `{ group(id: "10") { expenses(last: -1) { id } } }`, nil)
+	require.Len(t, r.Errors, 1)
+	assert.Equal(t, "validation_failed", r.Errors[0].Extensions["code"])
+}
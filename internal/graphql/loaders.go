@@ -0,0 +1,96 @@
+package graphql
+
+import (
+	"context"
+	"github.com/antoniobelotti/splid_backend_clone/internal/expense"
+	"github.com/antoniobelotti/splid_backend_clone/internal/group"
+	"github.com/antoniobelotti/splid_backend_clone/internal/person"
+	"github.com/antoniobelotti/splid_backend_clone/internal/transfer"
+	"github.com/graph-gophers/dataloader/v7"
+	"time"
+)
+
+// loaderWait - how long a loader waits for more keys before running its batch. The resolvers of sibling fields run
+// concurrently, so they all get to ask for their keys in the meantime.
+const loaderWait = 2 * time.Millisecond
+
+// fetchers - the batch reads behind the loaders
+type fetchers struct {
+	persons             func(ctx context.Context, ids []int) ([]person.Person, error)
+	groups              func(ctx context.Context, ids []int) ([]group.Group, error)
+	groupsByPersonId    func(ctx context.Context, personId int) ([]group.Group, error)
+	expensesByGroupIds  func(ctx context.Context, groupIds []int) ([]expense.Expense, error)
+	transfersByGroupIds func(ctx context.Context, groupIds []int) ([]transfer.Transfer, error)
+}
+
+// loaders - batch and cache the reads of a single request, so that a query costs a query per level of the
+// schema instead of one per object (N+1)
+type loaders struct {
+	persons            *dataloader.Loader[int, person.Person]
+	groups             *dataloader.Loader[int, group.Group]
+	expensesByGroupId  *dataloader.Loader[int, []expense.Expense]
+	transfersByGroupId *dataloader.Loader[int, []transfer.Transfer]
+}
+
+func newLoaders(f fetchers, wait time.Duration) *loaders {
+	return &loaders{
+		persons: dataloader.NewBatchedLoader(byId(f.persons, func(p person.Person) int { return p.Id }, person.ErrPersonNotFound),
+			dataloader.WithWait[int, person.Person](wait)),
+		groups: dataloader.NewBatchedLoader(byId(f.groups, func(g group.Group) int { return g.Id }, group.ErrGroupNotFound),
+			dataloader.WithWait[int, group.Group](wait)),
+		expensesByGroupId: dataloader.NewBatchedLoader(byGroupId(f.expensesByGroupIds, func(e expense.Expense) int { return e.GroupId }),
+			dataloader.WithWait[int, []expense.Expense](wait)),
+		transfersByGroupId: dataloader.NewBatchedLoader(byGroupId(f.transfersByGroupIds, func(t transfer.Transfer) int { return t.GroupId }),
+			dataloader.WithWait[int, []transfer.Transfer](wait)),
+	}
+}
+
+// byId adapts fetch to a batch function. Keys with no value get notFound.
+func byId[V any](fetch func(ctx context.Context, ids []int) ([]V, error), id func(V) int, notFound error) dataloader.BatchFunc[int, V] {
+	return func(ctx context.Context, keys []int) []*dataloader.Result[V] {
+		values, err := fetch(ctx, keys)
+		results := make([]*dataloader.Result[V], len(keys))
+		if err != nil {
+			for i := range results {
+				results[i] = &dataloader.Result[V]{Error: err}
+			}
+			return results
+		}
+
+		byId := make(map[int]V, len(values))
+		for _, v := range values {
+			byId[id(v)] = v
+		}
+		for i, key := range keys {
+			if v, ok := byId[key]; ok {
+				results[i] = &dataloader.Result[V]{Data: v}
+			} else {
+				results[i] = &dataloader.Result[V]{Error: notFound}
+			}
+		}
+		return results
+	}
+}
+
+// byGroupId adapts fetch to a batch function returning all the values of each group, in the order fetch returns them
+func byGroupId[V any](fetch func(ctx context.Context, groupIds []int) ([]V, error), groupId func(V) int) dataloader.BatchFunc[int, []V] {
+	return func(ctx context.Context, keys []int) []*dataloader.Result[[]V] {
+		values, err := fetch(ctx, keys)
+		results := make([]*dataloader.Result[[]V], len(keys))
+		if err != nil {
+			for i := range results {
+				results[i] = &dataloader.Result[[]V]{Error: err}
+			}
+			return results
+		}
+
+		byGroup := make(map[int][]V, len(keys))
+		for _, v := range values {
+			byGroup[groupId(v)] = append(byGroup[groupId(v)], v)
+		}
+		for i, key := range keys {
+			results[i] = &dataloader.Result[[]V]{Data: byGroup[key]}
+		}
+		return results
+	}
+}
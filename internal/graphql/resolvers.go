@@ -0,0 +1,321 @@
+package graphql
+
+import (
+	"context"
+	"github.com/antoniobelotti/splid_backend_clone/internal/expense"
+	"github.com/antoniobelotti/splid_backend_clone/internal/group"
+	"github.com/antoniobelotti/splid_backend_clone/internal/http/authentication"
+	"github.com/antoniobelotti/splid_backend_clone/internal/person"
+	"github.com/antoniobelotti/splid_backend_clone/internal/transfer"
+	"github.com/graph-gophers/graphql-go"
+	"sort"
+	"strconv"
+)
+
+const maxListLength = 100
+
+type viewerCtxKey struct{}
+
+// viewer - who is running the request, and the loaders of the request
+type viewer struct {
+	credential authentication.Credential
+	loaders    *loaders
+}
+
+func viewerFrom(ctx context.Context) viewer {
+	v, _ := ctx.Value(viewerCtxKey{}).(viewer)
+	return v
+}
+
+func toId(id int) graphql.ID {
+	return graphql.ID(strconv.Itoa(id))
+}
+
+func isMember(g group.Group, personId int) bool {
+	for _, id := range g.ComponentIds {
+		if id == personId {
+			return true
+		}
+	}
+	return false
+}
+
+type rootResolver struct {
+	groupsByPersonId func(ctx context.Context, personId int) ([]group.Group, error)
+}
+
+func (r *rootResolver) Me(ctx context.Context) (*personResolver, error) {
+	return loadPerson(ctx, viewerFrom(ctx).credential.PersonId)
+}
+
+func (r *rootResolver) Group(ctx context.Context, args struct{ ID graphql.ID }) (*groupResolver, error) {
+	groupId, err := strconv.Atoi(string(args.ID))
+	if err != nil {
+		return nil, resolverError{code: "validation_failed", message: "id must be an integer"}
+	}
+
+	v := viewerFrom(ctx)
+	if !v.credential.CanAccessGroup(groupId) {
+		return nil, resolverError{code: authentication.CodeTokenNotValidForGroup, message: "token not valid for this group"}
+	}
+	g, err := v.loaders.groups.Load(ctx, groupId)()
+	if err != nil {
+		return nil, toError(ctx, err)
+	}
+	if !isMember(g, v.credential.PersonId) {
+		return nil, errPersonNotInGroup
+	}
+	return &groupResolver{group: g}, nil
+}
+
+func (r *rootResolver) Groups(ctx context.Context) ([]*groupResolver, error) {
+	v := viewerFrom(ctx)
+	groups, err := r.groupsByPersonId(ctx, v.credential.PersonId)
+	if err != nil {
+		return nil, toError(ctx, err)
+	}
+
+	resolvers := make([]*groupResolver, 0, len(groups))
+	for _, g := range groups {
+		// groups outside the restriction of a personal access token are left out, as if the person was not a member
+		if !v.credential.CanAccessGroup(g.Id) {
+			continue
+		}
+		v.loaders.groups.Prime(ctx, g.Id, g)
+		resolvers = append(resolvers, &groupResolver{group: g})
+	}
+	return resolvers, nil
+}
+
+type personResolver struct {
+	person person.Person
+}
+
+func loadPerson(ctx context.Context, personId int) (*personResolver, error) {
+	p, err := viewerFrom(ctx).loaders.persons.Load(ctx, personId)()
+	if err != nil {
+		return nil, toError(ctx, err)
+	}
+	return &personResolver{person: p}, nil
+}
+
+func loadPersons(ctx context.Context, personIds []int) ([]*personResolver, error) {
+	persons, errs := viewerFrom(ctx).loaders.persons.LoadMany(ctx, personIds)()
+	for _, err := range errs {
+		if err != nil {
+			return nil, toError(ctx, err)
+		}
+	}
+	resolvers := make([]*personResolver, len(persons))
+	for i, p := range persons {
+		resolvers[i] = &personResolver{person: p}
+	}
+	return resolvers, nil
+}
+
+func (r *personResolver) ID() graphql.ID {
+	return toId(r.person.Id)
+}
+
+func (r *personResolver) Name() string {
+	return r.person.Name
+}
+
+func (r *personResolver) Email(ctx context.Context) *string {
+	if viewerFrom(ctx).credential.PersonId != r.person.Id {
+		return nil
+	}
+	return &r.person.Email
+}
+
+type groupResolver struct {
+	group group.Group
+}
+
+func (r *groupResolver) ID() graphql.ID {
+	return toId(r.group.Id)
+}
+
+func (r *groupResolver) Name() string {
+	return r.group.Name
+}
+
+func (r *groupResolver) InvitationCode() string {
+	return r.group.InvitationCode
+}
+
+func (r *groupResolver) Owner(ctx context.Context) (*personResolver, error) {
+	return loadPerson(ctx, r.group.OwnerId)
+}
+
+func (r *groupResolver) Members(ctx context.Context) ([]*personResolver, error) {
+	return loadPersons(ctx, r.group.ComponentIds)
+}
+
+// listArgs - the schema defaults last to 20
+type listArgs struct {
+	Last int32
+}
+
+// length - how many of the most recent items to return
+func (a listArgs) length() (int, error) {
+	if a.Last < 0 {
+		return 0, resolverError{code: "validation_failed", message: "last must not be negative"}
+	}
+	if a.Last > maxListLength {
+		return maxListLength, nil
+	}
+	return int(a.Last), nil
+}
+
+func (r *groupResolver) Expenses(ctx context.Context, args listArgs) ([]*expenseResolver, error) {
+	n, err := args.length()
+	if err != nil {
+		return nil, err
+	}
+	expenses, err := viewerFrom(ctx).loaders.expensesByGroupId.Load(ctx, r.group.Id)()
+	if err != nil {
+		return nil, toError(ctx, err)
+	}
+	if len(expenses) > n {
+		expenses = expenses[:n]
+	}
+
+	resolvers := make([]*expenseResolver, len(expenses))
+	for i, e := range expenses {
+		resolvers[i] = &expenseResolver{expense: e}
+	}
+	return resolvers, nil
+}
+
+func (r *groupResolver) Transfers(ctx context.Context, args listArgs) ([]*transferResolver, error) {
+	n, err := args.length()
+	if err != nil {
+		return nil, err
+	}
+	transfers, err := viewerFrom(ctx).loaders.transfersByGroupId.Load(ctx, r.group.Id)()
+	if err != nil {
+		return nil, toError(ctx, err)
+	}
+	if len(transfers) > n {
+		transfers = transfers[:n]
+	}
+	return toTransferResolvers(transfers), nil
+}
+
+// balance - computed from every expense and transfer of the group, batched with those of the other groups
+func (r *groupResolver) balance(ctx context.Context) (map[int]int, error) {
+	l := viewerFrom(ctx).loaders
+	// both loads are started before waiting on either, so that both join the current batch
+	expensesThunk := l.expensesByGroupId.Load(ctx, r.group.Id)
+	transfersThunk := l.transfersByGroupId.Load(ctx, r.group.Id)
+
+	expenses, err := expensesThunk()
+	if err != nil {
+		return nil, toError(ctx, err)
+	}
+	transfers, err := transfersThunk()
+	if err != nil {
+		return nil, toError(ctx, err)
+	}
+	return group.Balance(r.group, expenses, transfers), nil
+}
+
+func (r *groupResolver) Balance(ctx context.Context) ([]*personAmountResolver, error) {
+	balance, err := r.balance(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return toPersonAmountResolvers(balance), nil
+}
+
+func (r *groupResolver) OperationsToEvenBalance(ctx context.Context) ([]*transferResolver, error) {
+	balance, err := r.balance(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return toTransferResolvers(group.OpsToEvenBalance(balance)), nil
+}
+
+type expenseResolver struct {
+	expense expense.Expense
+}
+
+func (r *expenseResolver) ID() graphql.ID {
+	return toId(r.expense.Id)
+}
+
+func (r *expenseResolver) AmountInCents() int32 {
+	return int32(r.expense.AmountInCents)
+}
+
+func (r *expenseResolver) RecordedBy(ctx context.Context) (*personResolver, error) {
+	return loadPerson(ctx, r.expense.PersonId)
+}
+
+func (r *expenseResolver) Payers() []*personAmountResolver {
+	return toPersonAmountResolvers(r.expense.PaidBy())
+}
+
+func (r *expenseResolver) Itemized() bool {
+	return r.expense.Itemization != nil
+}
+
+// personAmountResolver resolves both Payer and Balance
+type personAmountResolver struct {
+	personId      int
+	amountInCents int
+}
+
+// toPersonAmountResolvers - sorted by person id, for a stable output
+func toPersonAmountResolvers(amountByPersonId map[int]int) []*personAmountResolver {
+	resolvers := make([]*personAmountResolver, 0, len(amountByPersonId))
+	for personId, amount := range amountByPersonId {
+		resolvers = append(resolvers, &personAmountResolver{personId: personId, amountInCents: amount})
+	}
+	sort.Slice(resolvers, func(i, j int) bool {
+		return resolvers[i].personId < resolvers[j].personId
+	})
+	return resolvers
+}
+
+func (r *personAmountResolver) Person(ctx context.Context) (*personResolver, error) {
+	return loadPerson(ctx, r.personId)
+}
+
+func (r *personAmountResolver) AmountInCents() int32 {
+	return int32(r.amountInCents)
+}
+
+type transferResolver struct {
+	transfer transfer.Transfer
+}
+
+func toTransferResolvers(transfers []transfer.Transfer) []*transferResolver {
+	resolvers := make([]*transferResolver, len(transfers))
+	for i, t := range transfers {
+		resolvers[i] = &transferResolver{transfer: t}
+	}
+	return resolvers
+}
+
+func (r *transferResolver) ID() *graphql.ID {
+	// the suggested transfers to even out the balance have no id
+	if r.transfer.Id == 0 {
+		return nil
+	}
+	id := toId(r.transfer.Id)
+	return &id
+}
+
+func (r *transferResolver) AmountInCents() int32 {
+	return int32(r.transfer.AmountInCents)
+}
+
+func (r *transferResolver) Sender(ctx context.Context) (*personResolver, error) {
+	return loadPerson(ctx, r.transfer.SenderId)
+}
+
+func (r *transferResolver) Receiver(ctx context.Context) (*personResolver, error) {
+	return loadPerson(ctx, r.transfer.ReceiverId)
+}
@@ -2,15 +2,22 @@ package group
 
 import (
 	"context"
-	"errors"
 	"fmt"
+	"github.com/antoniobelotti/splid_backend_clone/internal/apperror"
 	"github.com/antoniobelotti/splid_backend_clone/internal/expense"
+	"github.com/antoniobelotti/splid_backend_clone/internal/tracing"
 	"github.com/antoniobelotti/splid_backend_clone/internal/transfer"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"hash/fnv"
 	"sort"
 	"strconv"
+	"time"
 )
 
+var tracer = otel.Tracer("github.com/antoniobelotti/splid_backend_clone/internal/group")
+
 type Group struct {
 	Id             int    `json:"id" db:"id"`
 	Name           string `json:"name" db:"name"`
@@ -24,21 +31,46 @@ type Store interface {
 	GetGroupById(ctx context.Context, groupId int) (Group, error)
 	AddPersonToGroup(ctx context.Context, g Group, personId int) error
 	GetGroupComponentsById(ctx context.Context, groupId int) ([]int, error)
+	// GetGroupsByIds returns the groups found, with their components, in no particular order
+	GetGroupsByIds(ctx context.Context, groupIds []int) ([]Group, error)
+	// GetGroupsByPersonId returns the groups the person is a component of, with their components
+	GetGroupsByPersonId(ctx context.Context, personId int) ([]Group, error)
 }
 
 type Service struct {
 	store           Store
 	expenseService  expense.Service
 	transferService transfer.Service
+	observer        Observer
 }
 
 func NewService(store Store, es expense.Service, ts transfer.Service) Service {
-	return Service{store: store, expenseService: es, transferService: ts}
+	return Service{store: store, expenseService: es, transferService: ts, observer: nopObserver{}}
+}
+
+// Observer - told about the computations of the service, e.g. to export them as metrics. Calls must not block.
+type Observer interface {
+	// BalanceComputed - how long computing the balance of a group took, reads included
+	BalanceComputed(d time.Duration)
+	// SettlementPlanned - how many transfers even out the balance of a group
+	SettlementPlanned(transfers int)
+}
+
+type nopObserver struct{}
+
+func (nopObserver) BalanceComputed(time.Duration) {}
+func (nopObserver) SettlementPlanned(int)         {}
+
+// WithObserver returns a copy of the service reporting to o
+func (s Service) WithObserver(o Observer) Service {
+	s.observer = o
+	return s
 }
 
 var (
-	ErrGroupNotFound = errors.New("group not found")
-	ErrUnexpected    = errors.New("unexpected error")
+	ErrGroupNotFound       = apperror.New(apperror.NotFound, "group_not_found", "group not found")
+	ErrWrongInvitationCode = apperror.New(apperror.Forbidden, "wrong_invitation_code", "wrong invitation code")
+	ErrUnexpected          = apperror.New(apperror.Internal, "unexpected_error", "unexpected error")
 )
 
 func getHopefullyUniqueInvitationCode(groupName string, ownerId int) (string, error) {
@@ -54,7 +86,10 @@ func getHopefullyUniqueInvitationCode(groupName string, ownerId int) (string, er
 	return asStr[:6], nil
 }
 
-func (s *Service) CreateGroup(ctx context.Context, name string, ownerId int) (Group, error) {
+func (s *Service) CreateGroup(ctx context.Context, name string, ownerId int) (_ Group, err error) {
+	ctx, span := tracer.Start(ctx, "group.CreateGroup")
+	defer func() { tracing.End(span, err) }()
+
 	invitationCode, err := getHopefullyUniqueInvitationCode(name, ownerId)
 	if err != nil {
 		return Group{}, ErrUnexpected
@@ -74,34 +109,98 @@ func (s *Service) CreateGroup(ctx context.Context, name string, ownerId int) (Gr
 	return g, nil
 }
 
-func (s *Service) GetGroupById(ctx context.Context, groupId int) (Group, error) {
+func (s *Service) GetGroupById(ctx context.Context, groupId int) (_ Group, err error) {
+	ctx, span := tracer.Start(ctx, "group.GetGroupById")
+	defer func() { tracing.End(span, err) }()
+
 	return s.store.GetGroupById(ctx, groupId)
 }
 
-func (s *Service) AddPersonToGroup(ctx context.Context, g Group, personId int) error {
+func (s *Service) AddPersonToGroup(ctx context.Context, g Group, personId int) (err error) {
+	ctx, span := tracer.Start(ctx, "group.AddPersonToGroup")
+	defer func() { tracing.End(span, err) }()
+
 	return s.store.AddPersonToGroup(ctx, g, personId)
 }
 
-func (s *Service) GetGroupComponentsById(ctx context.Context, groupId int) ([]int, error) {
+// JoinGroup adds the person to the group if the invitation code is the one of the group
+func (s *Service) JoinGroup(ctx context.Context, groupId int, invitationCode string, personId int) (_ Group, err error) {
+	ctx, span := tracer.Start(ctx, "group.JoinGroup")
+	defer func() { tracing.End(span, err) }()
+
+	g, err := s.store.GetGroupById(ctx, groupId)
+	if err != nil {
+		return Group{}, err
+	}
+	if g.InvitationCode != invitationCode {
+		return Group{}, ErrWrongInvitationCode
+	}
+	if err = s.store.AddPersonToGroup(ctx, g, personId); err != nil {
+		return Group{}, err
+	}
+	return g, nil
+}
+
+func (s *Service) GetGroupComponentsById(ctx context.Context, groupId int) (_ []int, err error) {
+	ctx, span := tracer.Start(ctx, "group.GetGroupComponentsById")
+	defer func() { tracing.End(span, err) }()
+
 	return s.store.GetGroupComponentsById(ctx, groupId)
 }
 
+func (s *Service) GetGroupsByIds(ctx context.Context, groupIds []int) (_ []Group, err error) {
+	ctx, span := tracer.Start(ctx, "group.GetGroupsByIds")
+	defer func() { tracing.End(span, err) }()
+
+	groups, err := s.store.GetGroupsByIds(ctx, groupIds)
+	if err != nil {
+		return nil, fmt.Errorf("%w %w", ErrUnexpected, err)
+	}
+	return groups, nil
+}
+
+func (s *Service) GetGroupsByPersonId(ctx context.Context, personId int) (_ []Group, err error) {
+	ctx, span := tracer.Start(ctx, "group.GetGroupsByPersonId")
+	defer func() { tracing.End(span, err) }()
+
+	groups, err := s.store.GetGroupsByPersonId(ctx, personId)
+	if err != nil {
+		return nil, fmt.Errorf("%w %w", ErrUnexpected, err)
+	}
+	return groups, nil
+}
+
 func calculateGroupBalance(componentIds []int, expenses []expense.Expense, transfers []transfer.Transfer) map[int]int {
 	// TODO: should probably accept a context and cancel operation if timeout exceeded
 
 	// 	b_person1 = ((sum expenses person1) - avg all expenses) - (sum transfers from person1 -> any) + (sum transfers any -> person1)
+	// itemized expenses are not part of the average: each consumer owes the share derived from the items instead
 	balance := make(map[int]int, len(componentIds))
 	expensesSumByPerson := make(map[int]int)
+	itemizedSharesByPerson := make(map[int]int)
 
 	expensesSum := 0
+	splitExpenses := 0
 	for _, e := range expenses {
+		for personId, paid := range e.PaidBy() {
+			expensesSumByPerson[personId] += paid
+		}
+		if e.Itemization != nil {
+			for personId, share := range e.Itemization.Shares() {
+				itemizedSharesByPerson[personId] += share
+			}
+			continue
+		}
 		expensesSum += e.AmountInCents
-		expensesSumByPerson[e.PersonId] += e.AmountInCents
+		splitExpenses++
+	}
+	expensesAverage := 0
+	if splitExpenses > 0 {
+		expensesAverage = expensesSum / splitExpenses
 	}
-	expensesAverage := expensesSum / len(expenses)
 
 	for _, personId := range componentIds {
-		balance[personId] = expensesSumByPerson[personId] - expensesAverage
+		balance[personId] = expensesSumByPerson[personId] - expensesAverage - itemizedSharesByPerson[personId]
 	}
 
 	// now apply transfers
@@ -115,26 +214,40 @@ func calculateGroupBalance(componentIds []int, expenses []expense.Expense, trans
 	return balance
 }
 
-func (s *Service) GetGroupBalance(ctx context.Context, groupId int) (map[int]int, error) {
+func (s *Service) GetGroupBalance(ctx context.Context, groupId int) (_ map[int]int, err error) {
+	ctx, span := tracer.Start(ctx, "group.GetGroupBalance", trace.WithAttributes(attribute.Int("group.id", groupId)))
+	defer func() { tracing.End(span, err) }()
+
+	start := time.Now()
+	if _, err := s.store.GetGroupById(ctx, groupId); err != nil {
+		return nil, err
+	}
+
 	componentIds, err := s.GetGroupComponentsById(ctx, groupId)
 	if err != nil {
-		//TODO
-		return nil, err
+		return nil, fmt.Errorf("%w %w", ErrUnexpected, err)
 	}
 
 	expenses, err := s.expenseService.GetExpenseByGroupId(ctx, groupId)
 	if err != nil {
-		//TODO
-		return nil, err
+		return nil, fmt.Errorf("%w %w", ErrUnexpected, err)
 	}
 
 	transfers, err := s.transferService.GetTransfersByGroupId(ctx, groupId)
 	if err != nil {
-		//TODO
-		return nil, err
+		return nil, fmt.Errorf("%w %w", ErrUnexpected, err)
 	}
 
-	return calculateGroupBalance(componentIds, expenses, transfers), nil
+	// a span of its own, to tell the computation apart from the queries
+	_, computeSpan := tracer.Start(ctx, "group.calculateGroupBalance", trace.WithAttributes(
+		attribute.Int("components", len(componentIds)),
+		attribute.Int("expenses", len(expenses)),
+		attribute.Int("transfers", len(transfers)),
+	))
+	balance := calculateGroupBalance(componentIds, expenses, transfers)
+	computeSpan.End()
+	s.observer.BalanceComputed(time.Since(start))
+	return balance, nil
 }
 
 func calculateOpsToEvenBalance(currentBalance map[int]int) []transfer.Transfer {
@@ -192,11 +305,28 @@ func calculateOpsToEvenBalance(currentBalance map[int]int) []transfer.Transfer {
 	return transfers
 }
 
-func (s *Service) GetOpsEvenBalance(ctx context.Context, groupId int) ([]transfer.Transfer, error) {
+// Balance - like GetGroupBalance, for callers that already loaded all the expenses and transfers of the group
+func Balance(g Group, expenses []expense.Expense, transfers []transfer.Transfer) map[int]int {
+	return calculateGroupBalance(g.ComponentIds, expenses, transfers)
+}
+
+// OpsToEvenBalance - like GetOpsEvenBalance, for a balance returned by Balance
+func OpsToEvenBalance(balance map[int]int) []transfer.Transfer {
+	return calculateOpsToEvenBalance(balance)
+}
+
+func (s *Service) GetOpsEvenBalance(ctx context.Context, groupId int) (_ []transfer.Transfer, err error) {
+	ctx, span := tracer.Start(ctx, "group.GetOpsEvenBalance", trace.WithAttributes(attribute.Int("group.id", groupId)))
+	defer func() { tracing.End(span, err) }()
+
 	currentBalance, err := s.GetGroupBalance(ctx, groupId)
 	if err != nil {
-		//todo
-		return []transfer.Transfer{}, nil
+		return nil, err
 	}
-	return calculateOpsToEvenBalance(currentBalance), nil
+	_, planSpan := tracer.Start(ctx, "group.calculateOpsToEvenBalance")
+	ops := calculateOpsToEvenBalance(currentBalance)
+	planSpan.SetAttributes(attribute.Int("transfers", len(ops)))
+	planSpan.End()
+	s.observer.SettlementPlanned(len(ops))
+	return ops, nil
 }
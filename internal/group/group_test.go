@@ -104,3 +104,57 @@ func TestCalculateOpsToEvenBalance(t *testing.T) {
 	ops := calculateOpsToEvenBalance(currentBalance)
 	assert.Equal(t, expectedOps, ops)
 }
+
+func TestCalculateGroupBalanceWithItemizedExpense(t *testing.T) {
+	componentIds := []int{1, 2, 3}
+
+	// p3 pays a 30€ dinner: p1 had 20€, p2 10€, p3 nothing
+	expenses := []expense.Expense{
+		{
+			AmountInCents: 3000,
+			PersonId:      3,
+			Itemization: &expense.Itemization{
+				Items: []expense.Item{
+					{UnitPriceInCents: 2000, Quantity: 1, ConsumerIds: []int{1}},
+					{UnitPriceInCents: 1000, Quantity: 1, ConsumerIds: []int{2}},
+				},
+				TaxRule: expense.Proportional,
+				TipRule: expense.Proportional,
+			},
+		},
+	}
+
+	expectedBalance := map[int]int{
+		1: -2000,
+		2: -1000,
+		3: 3000,
+	}
+	assert.Equal(t, expectedBalance, calculateGroupBalance(componentIds, expenses, nil))
+}
+
+func TestCalculateGroupBalanceWithMultiplePayers(t *testing.T) {
+	componentIds := []int{1, 2}
+
+	// a 10€ expense recorded by p1, paid 4€ by p1 and 6€ by p2, and a 2€ expense paid by p1
+	expenses := []expense.Expense{
+		{
+			AmountInCents: 1000,
+			PersonId:      1,
+			Payers: []expense.Payer{
+				{PersonId: 1, AmountInCents: 400},
+				{PersonId: 2, AmountInCents: 600},
+			},
+		},
+		{
+			AmountInCents: 200,
+			PersonId:      1,
+		},
+	}
+
+	// avg is (10+2)/2 = 6
+	expectedBalance := map[int]int{
+		1: 600 - 600,
+		2: 600 - 600,
+	}
+	assert.Equal(t, expectedBalance, calculateGroupBalance(componentIds, expenses, nil))
+}
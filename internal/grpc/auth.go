@@ -0,0 +1,165 @@
+package grpc
+
+import (
+	"context"
+	"fmt"
+	splidv1 "github.com/antoniobelotti/splid_backend_clone/internal/grpc/gen/splid/v1"
+	"github.com/antoniobelotti/splid_backend_clone/internal/http/authentication"
+	"github.com/antoniobelotti/splid_backend_clone/internal/logging"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"log/slog"
+	"strings"
+)
+
+// methodAuth - how a method authenticates, like the routes of the REST server: public methods need no token, the
+// others accept personal access tokens only if they declare the scopes they require
+type methodAuth struct {
+	public bool
+	scopes []authentication.Scope
+}
+
+var (
+	readAuth          = methodAuth{scopes: []authentication.Scope{authentication.ScopeRead}}
+	writeExpensesAuth = methodAuth{scopes: []authentication.Scope{authentication.ScopeWriteExpenses}}
+)
+
+// methodAuths - every method of the server. Methods missing here are rejected.
+var methodAuths = map[string]methodAuth{
+	splidv1.PersonService_Signup_FullMethodName: {public: true},
+	splidv1.PersonService_GetMe_FullMethodName:  readAuth,
+
+	splidv1.GroupService_CreateGroup_FullMethodName:                {},
+	splidv1.GroupService_JoinGroup_FullMethodName:                  {},
+	splidv1.GroupService_GetBalance_FullMethodName:                 readAuth,
+	splidv1.GroupService_GetOperationsToEvenBalance_FullMethodName: readAuth,
+	splidv1.GroupService_WatchGroupEvents_FullMethodName:           readAuth,
+
+	splidv1.ExpenseService_CreateExpense_FullMethodName: writeExpensesAuth,
+	splidv1.ExpenseService_DeleteExpense_FullMethodName: writeExpensesAuth,
+
+	splidv1.TransferService_CreateTransfer_FullMethodName: writeExpensesAuth,
+}
+
+type credentialKey struct{}
+
+// credentialFrom returns the credential of the authenticated caller
+func credentialFrom(ctx context.Context) authentication.Credential {
+	credential, _ := ctx.Value(credentialKey{}).(authentication.Credential)
+	return credential
+}
+
+// authenticate checks the bearer token in the authorization metadata, as AuthenticateMiddleware does for the REST
+// server, and returns ctx with the credential of the caller
+func authenticate(ctx context.Context, auth authentication.Service, method string) (context.Context, error) {
+	required, ok := methodAuths[method]
+	if !ok {
+		return nil, newStatus(codes.PermissionDenied, "method_not_allowed", "method not allowed")
+	}
+	if required.public {
+		return ctx, nil
+	}
+
+	values := metadata.ValueFromIncomingContext(ctx, "authorization")
+	if len(values) == 0 {
+		return nil, newStatus(codes.Unauthenticated, authentication.CodeMissingToken, "no authorization metadata provided")
+	}
+	scheme, token, found := strings.Cut(values[0], " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") || token == "" {
+		return nil, newStatus(codes.Unauthenticated, authentication.CodeMalformedToken, "invalid token format")
+	}
+
+	credential, err := auth.Authenticate(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	if credential.PersonalAccessToken != nil {
+		if len(required.scopes) == 0 {
+			return nil, newStatus(codes.PermissionDenied, authentication.CodeAccessTokenNotAllowed, "personal access tokens cannot be used here")
+		}
+		for _, scope := range required.scopes {
+			if !credential.HasScope(scope) {
+				return nil, newStatus(codes.PermissionDenied, authentication.CodeInsufficientScope, fmt.Sprintf("insufficient scope: %s required", scope))
+			}
+		}
+	}
+	return context.WithValue(ctx, credentialKey{}, credential), nil
+}
+
+// requireGroupAccess rejects personal access tokens restricted to other groups
+func requireGroupAccess(ctx context.Context, groupId int) error {
+	if !credentialFrom(ctx).CanAccessGroup(groupId) {
+		return newStatus(codes.PermissionDenied, authentication.CodeTokenNotValidForGroup, "token not valid for this group")
+	}
+	return nil
+}
+
+// unaryInterceptor assigns the request id, authenticates the caller and maps the errors of the handlers to status
+// errors
+func unaryInterceptor(auth authentication.Service) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		ctx, header := withRequestId(ctx)
+		_ = grpc.SetHeader(ctx, header)
+
+		authenticated, err := authenticate(ctx, auth, info.FullMethod)
+		if err != nil {
+			return nil, statusOf(ctx, info.FullMethod, err)
+		}
+		resp, err := handler(authenticated, req)
+		if err != nil {
+			return nil, statusOf(ctx, info.FullMethod, err)
+		}
+		return resp, nil
+	}
+}
+
+// streamInterceptor - see unaryInterceptor
+func streamInterceptor(auth authentication.Service) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, header := withRequestId(ss.Context())
+		_ = ss.SetHeader(header)
+
+		authenticated, err := authenticate(ctx, auth, info.FullMethod)
+		if err != nil {
+			return statusOf(ctx, info.FullMethod, err)
+		}
+		if err = handler(srv, &authenticatedStream{ServerStream: ss, ctx: authenticated}); err != nil {
+			return statusOf(ctx, info.FullMethod, err)
+		}
+		return nil
+	}
+}
+
+// requestIdMetadata - the request id is read from it when the client sends one, and always sent back in the header
+const requestIdMetadata = "x-request-id"
+
+func withRequestId(ctx context.Context) (context.Context, metadata.MD) {
+	var id string
+	if values := metadata.ValueFromIncomingContext(ctx, requestIdMetadata); len(values) > 0 {
+		id = values[0]
+	}
+	if !logging.IsValidRequestId(id) {
+		id = logging.NewRequestId()
+	}
+	return logging.WithRequestId(ctx, id), metadata.Pairs(requestIdMetadata, id)
+}
+
+type authenticatedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *authenticatedStream) Context() context.Context {
+	return s.ctx
+}
+
+// statusOf - see toStatus. Internal errors are logged, since the client is not told what went wrong.
+func statusOf(ctx context.Context, method string, err error) error {
+	st := toStatus(err)
+	if status.Code(st) == codes.Internal {
+		slog.ErrorContext(ctx, "grpc call failed", "method", method, "error", err)
+	}
+	return st
+}
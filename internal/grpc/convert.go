@@ -0,0 +1,172 @@
+package grpc
+
+import (
+	"fmt"
+	"github.com/antoniobelotti/splid_backend_clone/internal/event"
+	"github.com/antoniobelotti/splid_backend_clone/internal/expense"
+	"github.com/antoniobelotti/splid_backend_clone/internal/group"
+	splidv1 "github.com/antoniobelotti/splid_backend_clone/internal/grpc/gen/splid/v1"
+	"github.com/antoniobelotti/splid_backend_clone/internal/person"
+	"github.com/antoniobelotti/splid_backend_clone/internal/transfer"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func toPerson(p person.Person) *splidv1.Person {
+	pb := &splidv1.Person{Id: int64(p.Id), Name: p.Name, Email: p.Email}
+	if p.EmailVerifiedAt != nil {
+		pb.EmailVerifiedAt = timestamppb.New(*p.EmailVerifiedAt)
+	}
+	return pb
+}
+
+func toGroup(g group.Group) *splidv1.Group {
+	return &splidv1.Group{
+		Id:             int64(g.Id),
+		Name:           g.Name,
+		OwnerId:        int64(g.OwnerId),
+		MemberIds:      toInt64s(g.ComponentIds),
+		InvitationCode: g.InvitationCode,
+	}
+}
+
+func toTransfer(t transfer.Transfer) *splidv1.Transfer {
+	return &splidv1.Transfer{
+		Id:            int64(t.Id),
+		AmountInCents: int64(t.AmountInCents),
+		GroupId:       int64(t.GroupId),
+		SenderId:      int64(t.SenderId),
+		ReceiverId:    int64(t.ReceiverId),
+	}
+}
+
+func toExpense(e expense.Expense) *splidv1.Expense {
+	return &splidv1.Expense{
+		Id:            int64(e.Id),
+		AmountInCents: int64(e.AmountInCents),
+		PersonId:      int64(e.PersonId),
+		GroupId:       int64(e.GroupId),
+		Itemization:   toItemization(e.Itemization),
+		Payers:        toPayers(e.Payers),
+	}
+}
+
+func toPayers(payers []expense.Payer) []*splidv1.Payer {
+	var pb []*splidv1.Payer
+	for _, p := range payers {
+		pb = append(pb, &splidv1.Payer{PersonId: int64(p.PersonId), AmountInCents: int64(p.AmountInCents)})
+	}
+	return pb
+}
+
+func fromPayers(pb []*splidv1.Payer) []expense.Payer {
+	var payers []expense.Payer
+	for _, p := range pb {
+		payers = append(payers, expense.Payer{PersonId: int(p.PersonId), AmountInCents: int(p.AmountInCents)})
+	}
+	return payers
+}
+
+var splitRules = map[expense.SplitRule]splidv1.SplitRule{
+	expense.Proportional: splidv1.SplitRule_SPLIT_RULE_PROPORTIONAL,
+	expense.Equal:        splidv1.SplitRule_SPLIT_RULE_EQUAL,
+}
+
+func toItemization(it *expense.Itemization) *splidv1.Itemization {
+	if it == nil {
+		return nil
+	}
+	pb := &splidv1.Itemization{
+		TaxInCents: int64(it.TaxInCents),
+		TipInCents: int64(it.TipInCents),
+		TaxRule:    splitRules[it.TaxRule],
+		TipRule:    splitRules[it.TipRule],
+	}
+	for _, item := range it.Items {
+		pb.Items = append(pb.Items, &splidv1.Item{
+			Description:      item.Description,
+			UnitPriceInCents: int64(item.UnitPriceInCents),
+			Quantity:         int64(item.Quantity),
+			ConsumerIds:      toInt64s(item.ConsumerIds),
+		})
+	}
+	return pb
+}
+
+// fromItemization - unspecified split rules are left empty, for the expense service to reject
+func fromItemization(pb *splidv1.Itemization) *expense.Itemization {
+	if pb == nil {
+		return nil
+	}
+	it := &expense.Itemization{TaxInCents: int(pb.TaxInCents), TipInCents: int(pb.TipInCents)}
+	for rule, pbRule := range splitRules {
+		if pb.TaxRule == pbRule {
+			it.TaxRule = rule
+		}
+		if pb.TipRule == pbRule {
+			it.TipRule = rule
+		}
+	}
+	for _, item := range pb.Items {
+		it.Items = append(it.Items, expense.Item{
+			Description:      item.Description,
+			UnitPriceInCents: int(item.UnitPriceInCents),
+			Quantity:         int(item.Quantity),
+			ConsumerIds:      toInts(item.ConsumerIds),
+		})
+	}
+	return it
+}
+
+// toGroupEvent - e must be one of event.GroupEventTypes
+func toGroupEvent(e event.Event) (*splidv1.GroupEvent, error) {
+	pb := &splidv1.GroupEvent{Id: int64(e.Id), CreatedAt: timestamppb.New(e.CreatedAt)}
+
+	var err error
+	switch e.Type {
+	case event.GroupCreated:
+		var g group.Group
+		err = e.Decode(&g)
+		pb.Payload = &splidv1.GroupEvent_GroupCreated{GroupCreated: toGroup(g)}
+	case event.MemberJoined:
+		var payload event.MemberJoinedPayload
+		err = e.Decode(&payload)
+		pb.Payload = &splidv1.GroupEvent_MemberJoined{MemberJoined: &splidv1.MemberJoined{
+			GroupId:  int64(payload.GroupId),
+			PersonId: int64(payload.PersonId),
+		}}
+	case event.ExpenseCreated, event.ExpenseDeleted:
+		var exp expense.Expense
+		err = e.Decode(&exp)
+		if e.Type == event.ExpenseCreated {
+			pb.Payload = &splidv1.GroupEvent_ExpenseCreated{ExpenseCreated: toExpense(exp)}
+		} else {
+			pb.Payload = &splidv1.GroupEvent_ExpenseDeleted{ExpenseDeleted: toExpense(exp)}
+		}
+	case event.TransferCreated:
+		var t transfer.Transfer
+		err = e.Decode(&t)
+		pb.Payload = &splidv1.GroupEvent_TransferCreated{TransferCreated: toTransfer(t)}
+	default:
+		return nil, fmt.Errorf("%s is not a group event", e.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode event %d: %w", e.Id, err)
+	}
+	return pb, nil
+}
+
+func toInt64s(ints []int) []int64 {
+	var int64s []int64
+	for _, i := range ints {
+		int64s = append(int64s, int64(i))
+	}
+	return int64s
+}
+
+func toInts(int64s []int64) []int {
+	var ints []int
+	for _, i := range int64s {
+		ints = append(ints, int(i))
+	}
+	return ints
+}
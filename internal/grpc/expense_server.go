@@ -0,0 +1,48 @@
+package grpc
+
+import (
+	"context"
+	"github.com/antoniobelotti/splid_backend_clone/internal/expense"
+	splidv1 "github.com/antoniobelotti/splid_backend_clone/internal/grpc/gen/splid/v1"
+)
+
+type expenseServer struct {
+	splidv1.UnimplementedExpenseServiceServer
+	service expense.Service
+}
+
+func (s *expenseServer) CreateExpense(ctx context.Context, req *splidv1.CreateExpenseRequest) (*splidv1.CreateExpenseResponse, error) {
+	if err := requireGroupAccess(ctx, int(req.GroupId)); err != nil {
+		return nil, err
+	}
+
+	e, err := s.service.CreateDetailedExpense(ctx, expense.Expense{
+		AmountInCents: int(req.AmountInCents),
+		PersonId:      credentialFrom(ctx).PersonId,
+		GroupId:       int(req.GroupId),
+		Itemization:   fromItemization(req.Itemization),
+		Payers:        fromPayers(req.Payers),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &splidv1.CreateExpenseResponse{Expense: toExpense(e)}, nil
+}
+
+func (s *expenseServer) DeleteExpense(ctx context.Context, req *splidv1.DeleteExpenseRequest) (*splidv1.DeleteExpenseResponse, error) {
+	credential := credentialFrom(ctx)
+	if credential.IsGroupRestricted() {
+		e, err := s.service.GetExpenseById(ctx, int(req.ExpenseId))
+		if err != nil {
+			return nil, err
+		}
+		if err = requireGroupAccess(ctx, e.GroupId); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := s.service.DeleteExpense(ctx, int(req.ExpenseId), credential.PersonId); err != nil {
+		return nil, err
+	}
+	return &splidv1.DeleteExpenseResponse{}, nil
+}
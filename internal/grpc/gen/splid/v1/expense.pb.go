@@ -0,0 +1,830 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.31.0
+// 	protoc        (unknown)
+// source: splid/v1/expense.proto
+
+package splidv1
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type SplitRule int32
+
+const (
+	SplitRule_SPLIT_RULE_UNSPECIFIED  SplitRule = 0
+	SplitRule_SPLIT_RULE_PROPORTIONAL SplitRule = 1
+	SplitRule_SPLIT_RULE_EQUAL        SplitRule = 2
+)
+
+// Enum value maps for SplitRule.
+var (
+	SplitRule_name = map[int32]string{
+		0: "SPLIT_RULE_UNSPECIFIED",
+		1: "SPLIT_RULE_PROPORTIONAL",
+		2: "SPLIT_RULE_EQUAL",
+	}
+	SplitRule_value = map[string]int32{
+		"SPLIT_RULE_UNSPECIFIED":  0,
+		"SPLIT_RULE_PROPORTIONAL": 1,
+		"SPLIT_RULE_EQUAL":        2,
+	}
+)
+
+func (x SplitRule) Enum() *SplitRule {
+	p := new(SplitRule)
+	*p = x
+	return p
+}
+
+func (x SplitRule) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (SplitRule) Descriptor() protoreflect.EnumDescriptor {
+	return file_splid_v1_expense_proto_enumTypes[0].Descriptor()
+}
+
+func (SplitRule) Type() protoreflect.EnumType {
+	return &file_splid_v1_expense_proto_enumTypes[0]
+}
+
+func (x SplitRule) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use SplitRule.Descriptor instead.
+func (SplitRule) EnumDescriptor() ([]byte, []int) {
+	return file_splid_v1_expense_proto_rawDescGZIP(), []int{0}
+}
+
+type Expense struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Id            int64 `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	AmountInCents int64 `protobuf:"varint,2,opt,name=amount_in_cents,json=amountInCents,proto3" json:"amount_in_cents,omitempty"`
+	// who recorded the expense, and paid it all when there are no payers
+	PersonId int64 `protobuf:"varint,3,opt,name=person_id,json=personId,proto3" json:"person_id,omitempty"`
+	GroupId  int64 `protobuf:"varint,4,opt,name=group_id,json=groupId,proto3" json:"group_id,omitempty"`
+	// unset for expenses split among the whole group
+	Itemization *Itemization `protobuf:"bytes,5,opt,name=itemization,proto3" json:"itemization,omitempty"`
+	Payers      []*Payer     `protobuf:"bytes,6,rep,name=payers,proto3" json:"payers,omitempty"`
+}
+
+func (x *Expense) Reset() {
+	*x = Expense{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_splid_v1_expense_proto_msgTypes[0]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *Expense) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Expense) ProtoMessage() {}
+
+func (x *Expense) ProtoReflect() protoreflect.Message {
+	mi := &file_splid_v1_expense_proto_msgTypes[0]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Expense.ProtoReflect.Descriptor instead.
+func (*Expense) Descriptor() ([]byte, []int) {
+	return file_splid_v1_expense_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *Expense) GetId() int64 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+func (x *Expense) GetAmountInCents() int64 {
+	if x != nil {
+		return x.AmountInCents
+	}
+	return 0
+}
+
+func (x *Expense) GetPersonId() int64 {
+	if x != nil {
+		return x.PersonId
+	}
+	return 0
+}
+
+func (x *Expense) GetGroupId() int64 {
+	if x != nil {
+		return x.GroupId
+	}
+	return 0
+}
+
+func (x *Expense) GetItemization() *Itemization {
+	if x != nil {
+		return x.Itemization
+	}
+	return nil
+}
+
+func (x *Expense) GetPayers() []*Payer {
+	if x != nil {
+		return x.Payers
+	}
+	return nil
+}
+
+type Payer struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	PersonId      int64 `protobuf:"varint,1,opt,name=person_id,json=personId,proto3" json:"person_id,omitempty"`
+	AmountInCents int64 `protobuf:"varint,2,opt,name=amount_in_cents,json=amountInCents,proto3" json:"amount_in_cents,omitempty"`
+}
+
+func (x *Payer) Reset() {
+	*x = Payer{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_splid_v1_expense_proto_msgTypes[1]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *Payer) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Payer) ProtoMessage() {}
+
+func (x *Payer) ProtoReflect() protoreflect.Message {
+	mi := &file_splid_v1_expense_proto_msgTypes[1]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Payer.ProtoReflect.Descriptor instead.
+func (*Payer) Descriptor() ([]byte, []int) {
+	return file_splid_v1_expense_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *Payer) GetPersonId() int64 {
+	if x != nil {
+		return x.PersonId
+	}
+	return 0
+}
+
+func (x *Payer) GetAmountInCents() int64 {
+	if x != nil {
+		return x.AmountInCents
+	}
+	return 0
+}
+
+type Itemization struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Items      []*Item   `protobuf:"bytes,1,rep,name=items,proto3" json:"items,omitempty"`
+	TaxInCents int64     `protobuf:"varint,2,opt,name=tax_in_cents,json=taxInCents,proto3" json:"tax_in_cents,omitempty"`
+	TipInCents int64     `protobuf:"varint,3,opt,name=tip_in_cents,json=tipInCents,proto3" json:"tip_in_cents,omitempty"`
+	TaxRule    SplitRule `protobuf:"varint,4,opt,name=tax_rule,json=taxRule,proto3,enum=splid.v1.SplitRule" json:"tax_rule,omitempty"`
+	TipRule    SplitRule `protobuf:"varint,5,opt,name=tip_rule,json=tipRule,proto3,enum=splid.v1.SplitRule" json:"tip_rule,omitempty"`
+}
+
+func (x *Itemization) Reset() {
+	*x = Itemization{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_splid_v1_expense_proto_msgTypes[2]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *Itemization) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Itemization) ProtoMessage() {}
+
+func (x *Itemization) ProtoReflect() protoreflect.Message {
+	mi := &file_splid_v1_expense_proto_msgTypes[2]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Itemization.ProtoReflect.Descriptor instead.
+func (*Itemization) Descriptor() ([]byte, []int) {
+	return file_splid_v1_expense_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *Itemization) GetItems() []*Item {
+	if x != nil {
+		return x.Items
+	}
+	return nil
+}
+
+func (x *Itemization) GetTaxInCents() int64 {
+	if x != nil {
+		return x.TaxInCents
+	}
+	return 0
+}
+
+func (x *Itemization) GetTipInCents() int64 {
+	if x != nil {
+		return x.TipInCents
+	}
+	return 0
+}
+
+func (x *Itemization) GetTaxRule() SplitRule {
+	if x != nil {
+		return x.TaxRule
+	}
+	return SplitRule_SPLIT_RULE_UNSPECIFIED
+}
+
+func (x *Itemization) GetTipRule() SplitRule {
+	if x != nil {
+		return x.TipRule
+	}
+	return SplitRule_SPLIT_RULE_UNSPECIFIED
+}
+
+type Item struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Description      string  `protobuf:"bytes,1,opt,name=description,proto3" json:"description,omitempty"`
+	UnitPriceInCents int64   `protobuf:"varint,2,opt,name=unit_price_in_cents,json=unitPriceInCents,proto3" json:"unit_price_in_cents,omitempty"`
+	Quantity         int64   `protobuf:"varint,3,opt,name=quantity,proto3" json:"quantity,omitempty"`
+	ConsumerIds      []int64 `protobuf:"varint,4,rep,packed,name=consumer_ids,json=consumerIds,proto3" json:"consumer_ids,omitempty"`
+}
+
+func (x *Item) Reset() {
+	*x = Item{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_splid_v1_expense_proto_msgTypes[3]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *Item) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Item) ProtoMessage() {}
+
+func (x *Item) ProtoReflect() protoreflect.Message {
+	mi := &file_splid_v1_expense_proto_msgTypes[3]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Item.ProtoReflect.Descriptor instead.
+func (*Item) Descriptor() ([]byte, []int) {
+	return file_splid_v1_expense_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *Item) GetDescription() string {
+	if x != nil {
+		return x.Description
+	}
+	return ""
+}
+
+func (x *Item) GetUnitPriceInCents() int64 {
+	if x != nil {
+		return x.UnitPriceInCents
+	}
+	return 0
+}
+
+func (x *Item) GetQuantity() int64 {
+	if x != nil {
+		return x.Quantity
+	}
+	return 0
+}
+
+func (x *Item) GetConsumerIds() []int64 {
+	if x != nil {
+		return x.ConsumerIds
+	}
+	return nil
+}
+
+type CreateExpenseRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	GroupId       int64        `protobuf:"varint,1,opt,name=group_id,json=groupId,proto3" json:"group_id,omitempty"`
+	AmountInCents int64        `protobuf:"varint,2,opt,name=amount_in_cents,json=amountInCents,proto3" json:"amount_in_cents,omitempty"`
+	Itemization   *Itemization `protobuf:"bytes,3,opt,name=itemization,proto3" json:"itemization,omitempty"`
+	Payers        []*Payer     `protobuf:"bytes,4,rep,name=payers,proto3" json:"payers,omitempty"`
+}
+
+func (x *CreateExpenseRequest) Reset() {
+	*x = CreateExpenseRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_splid_v1_expense_proto_msgTypes[4]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *CreateExpenseRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CreateExpenseRequest) ProtoMessage() {}
+
+func (x *CreateExpenseRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_splid_v1_expense_proto_msgTypes[4]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CreateExpenseRequest.ProtoReflect.Descriptor instead.
+func (*CreateExpenseRequest) Descriptor() ([]byte, []int) {
+	return file_splid_v1_expense_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *CreateExpenseRequest) GetGroupId() int64 {
+	if x != nil {
+		return x.GroupId
+	}
+	return 0
+}
+
+func (x *CreateExpenseRequest) GetAmountInCents() int64 {
+	if x != nil {
+		return x.AmountInCents
+	}
+	return 0
+}
+
+func (x *CreateExpenseRequest) GetItemization() *Itemization {
+	if x != nil {
+		return x.Itemization
+	}
+	return nil
+}
+
+func (x *CreateExpenseRequest) GetPayers() []*Payer {
+	if x != nil {
+		return x.Payers
+	}
+	return nil
+}
+
+type CreateExpenseResponse struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Expense *Expense `protobuf:"bytes,1,opt,name=expense,proto3" json:"expense,omitempty"`
+}
+
+func (x *CreateExpenseResponse) Reset() {
+	*x = CreateExpenseResponse{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_splid_v1_expense_proto_msgTypes[5]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *CreateExpenseResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CreateExpenseResponse) ProtoMessage() {}
+
+func (x *CreateExpenseResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_splid_v1_expense_proto_msgTypes[5]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CreateExpenseResponse.ProtoReflect.Descriptor instead.
+func (*CreateExpenseResponse) Descriptor() ([]byte, []int) {
+	return file_splid_v1_expense_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *CreateExpenseResponse) GetExpense() *Expense {
+	if x != nil {
+		return x.Expense
+	}
+	return nil
+}
+
+type DeleteExpenseRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	ExpenseId int64 `protobuf:"varint,1,opt,name=expense_id,json=expenseId,proto3" json:"expense_id,omitempty"`
+}
+
+func (x *DeleteExpenseRequest) Reset() {
+	*x = DeleteExpenseRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_splid_v1_expense_proto_msgTypes[6]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *DeleteExpenseRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeleteExpenseRequest) ProtoMessage() {}
+
+func (x *DeleteExpenseRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_splid_v1_expense_proto_msgTypes[6]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeleteExpenseRequest.ProtoReflect.Descriptor instead.
+func (*DeleteExpenseRequest) Descriptor() ([]byte, []int) {
+	return file_splid_v1_expense_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *DeleteExpenseRequest) GetExpenseId() int64 {
+	if x != nil {
+		return x.ExpenseId
+	}
+	return 0
+}
+
+type DeleteExpenseResponse struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+}
+
+func (x *DeleteExpenseResponse) Reset() {
+	*x = DeleteExpenseResponse{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_splid_v1_expense_proto_msgTypes[7]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *DeleteExpenseResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeleteExpenseResponse) ProtoMessage() {}
+
+func (x *DeleteExpenseResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_splid_v1_expense_proto_msgTypes[7]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeleteExpenseResponse.ProtoReflect.Descriptor instead.
+func (*DeleteExpenseResponse) Descriptor() ([]byte, []int) {
+	return file_splid_v1_expense_proto_rawDescGZIP(), []int{7}
+}
+
+var File_splid_v1_expense_proto protoreflect.FileDescriptor
+
+var file_splid_v1_expense_proto_rawDesc = []byte{
+	0x0a, 0x16, 0x73, 0x70, 0x6c, 0x69, 0x64, 0x2f, 0x76, 0x31, 0x2f, 0x65, 0x78, 0x70, 0x65, 0x6e,
+	0x73, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x12, 0x08, 0x73, 0x70, 0x6c, 0x69, 0x64, 0x2e,
+	0x76, 0x31, 0x22, 0xdb, 0x01, 0x0a, 0x07, 0x45, 0x78, 0x70, 0x65, 0x6e, 0x73, 0x65, 0x12, 0x0e,
+	0x0a, 0x02, 0x69, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x03, 0x52, 0x02, 0x69, 0x64, 0x12, 0x26,
+	0x0a, 0x0f, 0x61, 0x6d, 0x6f, 0x75, 0x6e, 0x74, 0x5f, 0x69, 0x6e, 0x5f, 0x63, 0x65, 0x6e, 0x74,
+	0x73, 0x18, 0x02, 0x20, 0x01, 0x28, 0x03, 0x52, 0x0d, 0x61, 0x6d, 0x6f, 0x75, 0x6e, 0x74, 0x49,
+	0x6e, 0x43, 0x65, 0x6e, 0x74, 0x73, 0x12, 0x1b, 0x0a, 0x09, 0x70, 0x65, 0x72, 0x73, 0x6f, 0x6e,
+	0x5f, 0x69, 0x64, 0x18, 0x03, 0x20, 0x01, 0x28, 0x03, 0x52, 0x08, 0x70, 0x65, 0x72, 0x73, 0x6f,
+	0x6e, 0x49, 0x64, 0x12, 0x19, 0x0a, 0x08, 0x67, 0x72, 0x6f, 0x75, 0x70, 0x5f, 0x69, 0x64, 0x18,
+	0x04, 0x20, 0x01, 0x28, 0x03, 0x52, 0x07, 0x67, 0x72, 0x6f, 0x75, 0x70, 0x49, 0x64, 0x12, 0x37,
+	0x0a, 0x0b, 0x69, 0x74, 0x65, 0x6d, 0x69, 0x7a, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x18, 0x05, 0x20,
+	0x01, 0x28, 0x0b, 0x32, 0x15, 0x2e, 0x73, 0x70, 0x6c, 0x69, 0x64, 0x2e, 0x76, 0x31, 0x2e, 0x49,
+	0x74, 0x65, 0x6d, 0x69, 0x7a, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x52, 0x0b, 0x69, 0x74, 0x65, 0x6d,
+	0x69, 0x7a, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x12, 0x27, 0x0a, 0x06, 0x70, 0x61, 0x79, 0x65, 0x72,
+	0x73, 0x18, 0x06, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x0f, 0x2e, 0x73, 0x70, 0x6c, 0x69, 0x64, 0x2e,
+	0x76, 0x31, 0x2e, 0x50, 0x61, 0x79, 0x65, 0x72, 0x52, 0x06, 0x70, 0x61, 0x79, 0x65, 0x72, 0x73,
+	0x22, 0x4c, 0x0a, 0x05, 0x50, 0x61, 0x79, 0x65, 0x72, 0x12, 0x1b, 0x0a, 0x09, 0x70, 0x65, 0x72,
+	0x73, 0x6f, 0x6e, 0x5f, 0x69, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x03, 0x52, 0x08, 0x70, 0x65,
+	0x72, 0x73, 0x6f, 0x6e, 0x49, 0x64, 0x12, 0x26, 0x0a, 0x0f, 0x61, 0x6d, 0x6f, 0x75, 0x6e, 0x74,
+	0x5f, 0x69, 0x6e, 0x5f, 0x63, 0x65, 0x6e, 0x74, 0x73, 0x18, 0x02, 0x20, 0x01, 0x28, 0x03, 0x52,
+	0x0d, 0x61, 0x6d, 0x6f, 0x75, 0x6e, 0x74, 0x49, 0x6e, 0x43, 0x65, 0x6e, 0x74, 0x73, 0x22, 0xd7,
+	0x01, 0x0a, 0x0b, 0x49, 0x74, 0x65, 0x6d, 0x69, 0x7a, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x12, 0x24,
+	0x0a, 0x05, 0x69, 0x74, 0x65, 0x6d, 0x73, 0x18, 0x01, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x0e, 0x2e,
+	0x73, 0x70, 0x6c, 0x69, 0x64, 0x2e, 0x76, 0x31, 0x2e, 0x49, 0x74, 0x65, 0x6d, 0x52, 0x05, 0x69,
+	0x74, 0x65, 0x6d, 0x73, 0x12, 0x20, 0x0a, 0x0c, 0x74, 0x61, 0x78, 0x5f, 0x69, 0x6e, 0x5f, 0x63,
+	0x65, 0x6e, 0x74, 0x73, 0x18, 0x02, 0x20, 0x01, 0x28, 0x03, 0x52, 0x0a, 0x74, 0x61, 0x78, 0x49,
+	0x6e, 0x43, 0x65, 0x6e, 0x74, 0x73, 0x12, 0x20, 0x0a, 0x0c, 0x74, 0x69, 0x70, 0x5f, 0x69, 0x6e,
+	0x5f, 0x63, 0x65, 0x6e, 0x74, 0x73, 0x18, 0x03, 0x20, 0x01, 0x28, 0x03, 0x52, 0x0a, 0x74, 0x69,
+	0x70, 0x49, 0x6e, 0x43, 0x65, 0x6e, 0x74, 0x73, 0x12, 0x2e, 0x0a, 0x08, 0x74, 0x61, 0x78, 0x5f,
+	0x72, 0x75, 0x6c, 0x65, 0x18, 0x04, 0x20, 0x01, 0x28, 0x0e, 0x32, 0x13, 0x2e, 0x73, 0x70, 0x6c,
+	0x69, 0x64, 0x2e, 0x76, 0x31, 0x2e, 0x53, 0x70, 0x6c, 0x69, 0x74, 0x52, 0x75, 0x6c, 0x65, 0x52,
+	0x07, 0x74, 0x61, 0x78, 0x52, 0x75, 0x6c, 0x65, 0x12, 0x2e, 0x0a, 0x08, 0x74, 0x69, 0x70, 0x5f,
+	0x72, 0x75, 0x6c, 0x65, 0x18, 0x05, 0x20, 0x01, 0x28, 0x0e, 0x32, 0x13, 0x2e, 0x73, 0x70, 0x6c,
+	0x69, 0x64, 0x2e, 0x76, 0x31, 0x2e, 0x53, 0x70, 0x6c, 0x69, 0x74, 0x52, 0x75, 0x6c, 0x65, 0x52,
+	0x07, 0x74, 0x69, 0x70, 0x52, 0x75, 0x6c, 0x65, 0x22, 0x96, 0x01, 0x0a, 0x04, 0x49, 0x74, 0x65,
+	0x6d, 0x12, 0x20, 0x0a, 0x0b, 0x64, 0x65, 0x73, 0x63, 0x72, 0x69, 0x70, 0x74, 0x69, 0x6f, 0x6e,
+	0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0b, 0x64, 0x65, 0x73, 0x63, 0x72, 0x69, 0x70, 0x74,
+	0x69, 0x6f, 0x6e, 0x12, 0x2d, 0x0a, 0x13, 0x75, 0x6e, 0x69, 0x74, 0x5f, 0x70, 0x72, 0x69, 0x63,
+	0x65, 0x5f, 0x69, 0x6e, 0x5f, 0x63, 0x65, 0x6e, 0x74, 0x73, 0x18, 0x02, 0x20, 0x01, 0x28, 0x03,
+	0x52, 0x10, 0x75, 0x6e, 0x69, 0x74, 0x50, 0x72, 0x69, 0x63, 0x65, 0x49, 0x6e, 0x43, 0x65, 0x6e,
+	0x74, 0x73, 0x12, 0x1a, 0x0a, 0x08, 0x71, 0x75, 0x61, 0x6e, 0x74, 0x69, 0x74, 0x79, 0x18, 0x03,
+	0x20, 0x01, 0x28, 0x03, 0x52, 0x08, 0x71, 0x75, 0x61, 0x6e, 0x74, 0x69, 0x74, 0x79, 0x12, 0x21,
+	0x0a, 0x0c, 0x63, 0x6f, 0x6e, 0x73, 0x75, 0x6d, 0x65, 0x72, 0x5f, 0x69, 0x64, 0x73, 0x18, 0x04,
+	0x20, 0x03, 0x28, 0x03, 0x52, 0x0b, 0x63, 0x6f, 0x6e, 0x73, 0x75, 0x6d, 0x65, 0x72, 0x49, 0x64,
+	0x73, 0x22, 0xbb, 0x01, 0x0a, 0x14, 0x43, 0x72, 0x65, 0x61, 0x74, 0x65, 0x45, 0x78, 0x70, 0x65,
+	0x6e, 0x73, 0x65, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x19, 0x0a, 0x08, 0x67, 0x72,
+	0x6f, 0x75, 0x70, 0x5f, 0x69, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x03, 0x52, 0x07, 0x67, 0x72,
+	0x6f, 0x75, 0x70, 0x49, 0x64, 0x12, 0x26, 0x0a, 0x0f, 0x61, 0x6d, 0x6f, 0x75, 0x6e, 0x74, 0x5f,
+	0x69, 0x6e, 0x5f, 0x63, 0x65, 0x6e, 0x74, 0x73, 0x18, 0x02, 0x20, 0x01, 0x28, 0x03, 0x52, 0x0d,
+	0x61, 0x6d, 0x6f, 0x75, 0x6e, 0x74, 0x49, 0x6e, 0x43, 0x65, 0x6e, 0x74, 0x73, 0x12, 0x37, 0x0a,
+	0x0b, 0x69, 0x74, 0x65, 0x6d, 0x69, 0x7a, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x18, 0x03, 0x20, 0x01,
+	0x28, 0x0b, 0x32, 0x15, 0x2e, 0x73, 0x70, 0x6c, 0x69, 0x64, 0x2e, 0x76, 0x31, 0x2e, 0x49, 0x74,
+	0x65, 0x6d, 0x69, 0x7a, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x52, 0x0b, 0x69, 0x74, 0x65, 0x6d, 0x69,
+	0x7a, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x12, 0x27, 0x0a, 0x06, 0x70, 0x61, 0x79, 0x65, 0x72, 0x73,
+	0x18, 0x04, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x0f, 0x2e, 0x73, 0x70, 0x6c, 0x69, 0x64, 0x2e, 0x76,
+	0x31, 0x2e, 0x50, 0x61, 0x79, 0x65, 0x72, 0x52, 0x06, 0x70, 0x61, 0x79, 0x65, 0x72, 0x73, 0x22,
+	0x44, 0x0a, 0x15, 0x43, 0x72, 0x65, 0x61, 0x74, 0x65, 0x45, 0x78, 0x70, 0x65, 0x6e, 0x73, 0x65,
+	0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x2b, 0x0a, 0x07, 0x65, 0x78, 0x70, 0x65,
+	0x6e, 0x73, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x11, 0x2e, 0x73, 0x70, 0x6c, 0x69,
+	0x64, 0x2e, 0x76, 0x31, 0x2e, 0x45, 0x78, 0x70, 0x65, 0x6e, 0x73, 0x65, 0x52, 0x07, 0x65, 0x78,
+	0x70, 0x65, 0x6e, 0x73, 0x65, 0x22, 0x35, 0x0a, 0x14, 0x44, 0x65, 0x6c, 0x65, 0x74, 0x65, 0x45,
+	0x78, 0x70, 0x65, 0x6e, 0x73, 0x65, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x1d, 0x0a,
+	0x0a, 0x65, 0x78, 0x70, 0x65, 0x6e, 0x73, 0x65, 0x5f, 0x69, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28,
+	0x03, 0x52, 0x09, 0x65, 0x78, 0x70, 0x65, 0x6e, 0x73, 0x65, 0x49, 0x64, 0x22, 0x17, 0x0a, 0x15,
+	0x44, 0x65, 0x6c, 0x65, 0x74, 0x65, 0x45, 0x78, 0x70, 0x65, 0x6e, 0x73, 0x65, 0x52, 0x65, 0x73,
+	0x70, 0x6f, 0x6e, 0x73, 0x65, 0x2a, 0x5a, 0x0a, 0x09, 0x53, 0x70, 0x6c, 0x69, 0x74, 0x52, 0x75,
+	0x6c, 0x65, 0x12, 0x1a, 0x0a, 0x16, 0x53, 0x50, 0x4c, 0x49, 0x54, 0x5f, 0x52, 0x55, 0x4c, 0x45,
+	0x5f, 0x55, 0x4e, 0x53, 0x50, 0x45, 0x43, 0x49, 0x46, 0x49, 0x45, 0x44, 0x10, 0x00, 0x12, 0x1b,
+	0x0a, 0x17, 0x53, 0x50, 0x4c, 0x49, 0x54, 0x5f, 0x52, 0x55, 0x4c, 0x45, 0x5f, 0x50, 0x52, 0x4f,
+	0x50, 0x4f, 0x52, 0x54, 0x49, 0x4f, 0x4e, 0x41, 0x4c, 0x10, 0x01, 0x12, 0x14, 0x0a, 0x10, 0x53,
+	0x50, 0x4c, 0x49, 0x54, 0x5f, 0x52, 0x55, 0x4c, 0x45, 0x5f, 0x45, 0x51, 0x55, 0x41, 0x4c, 0x10,
+	0x02, 0x32, 0xb4, 0x01, 0x0a, 0x0e, 0x45, 0x78, 0x70, 0x65, 0x6e, 0x73, 0x65, 0x53, 0x65, 0x72,
+	0x76, 0x69, 0x63, 0x65, 0x12, 0x50, 0x0a, 0x0d, 0x43, 0x72, 0x65, 0x61, 0x74, 0x65, 0x45, 0x78,
+	0x70, 0x65, 0x6e, 0x73, 0x65, 0x12, 0x1e, 0x2e, 0x73, 0x70, 0x6c, 0x69, 0x64, 0x2e, 0x76, 0x31,
+	0x2e, 0x43, 0x72, 0x65, 0x61, 0x74, 0x65, 0x45, 0x78, 0x70, 0x65, 0x6e, 0x73, 0x65, 0x52, 0x65,
+	0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x1f, 0x2e, 0x73, 0x70, 0x6c, 0x69, 0x64, 0x2e, 0x76, 0x31,
+	0x2e, 0x43, 0x72, 0x65, 0x61, 0x74, 0x65, 0x45, 0x78, 0x70, 0x65, 0x6e, 0x73, 0x65, 0x52, 0x65,
+	0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x50, 0x0a, 0x0d, 0x44, 0x65, 0x6c, 0x65, 0x74, 0x65,
+	0x45, 0x78, 0x70, 0x65, 0x6e, 0x73, 0x65, 0x12, 0x1e, 0x2e, 0x73, 0x70, 0x6c, 0x69, 0x64, 0x2e,
+	0x76, 0x31, 0x2e, 0x44, 0x65, 0x6c, 0x65, 0x74, 0x65, 0x45, 0x78, 0x70, 0x65, 0x6e, 0x73, 0x65,
+	0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x1f, 0x2e, 0x73, 0x70, 0x6c, 0x69, 0x64, 0x2e,
+	0x76, 0x31, 0x2e, 0x44, 0x65, 0x6c, 0x65, 0x74, 0x65, 0x45, 0x78, 0x70, 0x65, 0x6e, 0x73, 0x65,
+	0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x42, 0x52, 0x5a, 0x50, 0x67, 0x69, 0x74, 0x68,
+	0x75, 0x62, 0x2e, 0x63, 0x6f, 0x6d, 0x2f, 0x61, 0x6e, 0x74, 0x6f, 0x6e, 0x69, 0x6f, 0x62, 0x65,
+	0x6c, 0x6f, 0x74, 0x74, 0x69, 0x2f, 0x73, 0x70, 0x6c, 0x69, 0x64, 0x5f, 0x62, 0x61, 0x63, 0x6b,
+	0x65, 0x6e, 0x64, 0x5f, 0x63, 0x6c, 0x6f, 0x6e, 0x65, 0x2f, 0x69, 0x6e, 0x74, 0x65, 0x72, 0x6e,
+	0x61, 0x6c, 0x2f, 0x67, 0x72, 0x70, 0x63, 0x2f, 0x67, 0x65, 0x6e, 0x2f, 0x73, 0x70, 0x6c, 0x69,
+	0x64, 0x2f, 0x76, 0x31, 0x3b, 0x73, 0x70, 0x6c, 0x69, 0x64, 0x76, 0x31, 0x62, 0x06, 0x70, 0x72,
+	0x6f, 0x74, 0x6f, 0x33,
+}
+
+var (
+	file_splid_v1_expense_proto_rawDescOnce sync.Once
+	file_splid_v1_expense_proto_rawDescData = file_splid_v1_expense_proto_rawDesc
+)
+
+func file_splid_v1_expense_proto_rawDescGZIP() []byte {
+	file_splid_v1_expense_proto_rawDescOnce.Do(func() {
+		file_splid_v1_expense_proto_rawDescData = protoimpl.X.CompressGZIP(file_splid_v1_expense_proto_rawDescData)
+	})
+	return file_splid_v1_expense_proto_rawDescData
+}
+
+var file_splid_v1_expense_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
+var file_splid_v1_expense_proto_msgTypes = make([]protoimpl.MessageInfo, 8)
+var file_splid_v1_expense_proto_goTypes = []interface{}{
+	(SplitRule)(0),                // 0: splid.v1.SplitRule
+	(*Expense)(nil),               // 1: splid.v1.Expense
+	(*Payer)(nil),                 // 2: splid.v1.Payer
+	(*Itemization)(nil),           // 3: splid.v1.Itemization
+	(*Item)(nil),                  // 4: splid.v1.Item
+	(*CreateExpenseRequest)(nil),  // 5: splid.v1.CreateExpenseRequest
+	(*CreateExpenseResponse)(nil), // 6: splid.v1.CreateExpenseResponse
+	(*DeleteExpenseRequest)(nil),  // 7: splid.v1.DeleteExpenseRequest
+	(*DeleteExpenseResponse)(nil), // 8: splid.v1.DeleteExpenseResponse
+}
+var file_splid_v1_expense_proto_depIdxs = []int32{
+	3,  // 0: splid.v1.Expense.itemization:type_name -> splid.v1.Itemization
+	2,  // 1: splid.v1.Expense.payers:type_name -> splid.v1.Payer
+	4,  // 2: splid.v1.Itemization.items:type_name -> splid.v1.Item
+	0,  // 3: splid.v1.Itemization.tax_rule:type_name -> splid.v1.SplitRule
+	0,  // 4: splid.v1.Itemization.tip_rule:type_name -> splid.v1.SplitRule
+	3,  // 5: splid.v1.CreateExpenseRequest.itemization:type_name -> splid.v1.Itemization
+	2,  // 6: splid.v1.CreateExpenseRequest.payers:type_name -> splid.v1.Payer
+	1,  // 7: splid.v1.CreateExpenseResponse.expense:type_name -> splid.v1.Expense
+	5,  // 8: splid.v1.ExpenseService.CreateExpense:input_type -> splid.v1.CreateExpenseRequest
+	7,  // 9: splid.v1.ExpenseService.DeleteExpense:input_type -> splid.v1.DeleteExpenseRequest
+	6,  // 10: splid.v1.ExpenseService.CreateExpense:output_type -> splid.v1.CreateExpenseResponse
+	8,  // 11: splid.v1.ExpenseService.DeleteExpense:output_type -> splid.v1.DeleteExpenseResponse
+	10, // [10:12] is the sub-list for method output_type
+	8,  // [8:10] is the sub-list for method input_type
+	8,  // [8:8] is the sub-list for extension type_name
+	8,  // [8:8] is the sub-list for extension extendee
+	0,  // [0:8] is the sub-list for field type_name
+}
+
+func init() { file_splid_v1_expense_proto_init() }
+func file_splid_v1_expense_proto_init() {
+	if File_splid_v1_expense_proto != nil {
+		return
+	}
+	if !protoimpl.UnsafeEnabled {
+		file_splid_v1_expense_proto_msgTypes[0].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*Expense); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_splid_v1_expense_proto_msgTypes[1].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*Payer); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_splid_v1_expense_proto_msgTypes[2].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*Itemization); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_splid_v1_expense_proto_msgTypes[3].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*Item); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_splid_v1_expense_proto_msgTypes[4].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*CreateExpenseRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_splid_v1_expense_proto_msgTypes[5].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*CreateExpenseResponse); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_splid_v1_expense_proto_msgTypes[6].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*DeleteExpenseRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_splid_v1_expense_proto_msgTypes[7].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*DeleteExpenseResponse); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: file_splid_v1_expense_proto_rawDesc,
+			NumEnums:      1,
+			NumMessages:   8,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_splid_v1_expense_proto_goTypes,
+		DependencyIndexes: file_splid_v1_expense_proto_depIdxs,
+		EnumInfos:         file_splid_v1_expense_proto_enumTypes,
+		MessageInfos:      file_splid_v1_expense_proto_msgTypes,
+	}.Build()
+	File_splid_v1_expense_proto = out.File
+	file_splid_v1_expense_proto_rawDesc = nil
+	file_splid_v1_expense_proto_goTypes = nil
+	file_splid_v1_expense_proto_depIdxs = nil
+}
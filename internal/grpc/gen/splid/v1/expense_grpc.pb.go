@@ -0,0 +1,148 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.3.0
+// - protoc             (unknown)
+// source: splid/v1/expense.proto
+
+package splidv1
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+const (
+	ExpenseService_CreateExpense_FullMethodName = "/splid.v1.ExpenseService/CreateExpense"
+	ExpenseService_DeleteExpense_FullMethodName = "/splid.v1.ExpenseService/DeleteExpense"
+)
+
+// ExpenseServiceClient is the client API for ExpenseService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type ExpenseServiceClient interface {
+	CreateExpense(ctx context.Context, in *CreateExpenseRequest, opts ...grpc.CallOption) (*CreateExpenseResponse, error)
+	// DeleteExpense is only allowed to whoever recorded the expense
+	DeleteExpense(ctx context.Context, in *DeleteExpenseRequest, opts ...grpc.CallOption) (*DeleteExpenseResponse, error)
+}
+
+type expenseServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewExpenseServiceClient(cc grpc.ClientConnInterface) ExpenseServiceClient {
+	return &expenseServiceClient{cc}
+}
+
+func (c *expenseServiceClient) CreateExpense(ctx context.Context, in *CreateExpenseRequest, opts ...grpc.CallOption) (*CreateExpenseResponse, error) {
+	out := new(CreateExpenseResponse)
+	err := c.cc.Invoke(ctx, ExpenseService_CreateExpense_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *expenseServiceClient) DeleteExpense(ctx context.Context, in *DeleteExpenseRequest, opts ...grpc.CallOption) (*DeleteExpenseResponse, error) {
+	out := new(DeleteExpenseResponse)
+	err := c.cc.Invoke(ctx, ExpenseService_DeleteExpense_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// ExpenseServiceServer is the server API for ExpenseService service.
+// All implementations must embed UnimplementedExpenseServiceServer
+// for forward compatibility
+type ExpenseServiceServer interface {
+	CreateExpense(context.Context, *CreateExpenseRequest) (*CreateExpenseResponse, error)
+	// DeleteExpense is only allowed to whoever recorded the expense
+	DeleteExpense(context.Context, *DeleteExpenseRequest) (*DeleteExpenseResponse, error)
+	mustEmbedUnimplementedExpenseServiceServer()
+}
+
+// UnimplementedExpenseServiceServer must be embedded to have forward compatible implementations.
+type UnimplementedExpenseServiceServer struct {
+}
+
+func (UnimplementedExpenseServiceServer) CreateExpense(context.Context, *CreateExpenseRequest) (*CreateExpenseResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateExpense not implemented")
+}
+func (UnimplementedExpenseServiceServer) DeleteExpense(context.Context, *DeleteExpenseRequest) (*DeleteExpenseResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteExpense not implemented")
+}
+func (UnimplementedExpenseServiceServer) mustEmbedUnimplementedExpenseServiceServer() {}
+
+// UnsafeExpenseServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to ExpenseServiceServer will
+// result in compilation errors.
+type UnsafeExpenseServiceServer interface {
+	mustEmbedUnimplementedExpenseServiceServer()
+}
+
+func RegisterExpenseServiceServer(s grpc.ServiceRegistrar, srv ExpenseServiceServer) {
+	s.RegisterService(&ExpenseService_ServiceDesc, srv)
+}
+
+func _ExpenseService_CreateExpense_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateExpenseRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ExpenseServiceServer).CreateExpense(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ExpenseService_CreateExpense_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ExpenseServiceServer).CreateExpense(ctx, req.(*CreateExpenseRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ExpenseService_DeleteExpense_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteExpenseRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ExpenseServiceServer).DeleteExpense(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ExpenseService_DeleteExpense_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ExpenseServiceServer).DeleteExpense(ctx, req.(*DeleteExpenseRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// ExpenseService_ServiceDesc is the grpc.ServiceDesc for ExpenseService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var ExpenseService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "splid.v1.ExpenseService",
+	HandlerType: (*ExpenseServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "CreateExpense",
+			Handler:    _ExpenseService_CreateExpense_Handler,
+		},
+		{
+			MethodName: "DeleteExpense",
+			Handler:    _ExpenseService_DeleteExpense_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "splid/v1/expense.proto",
+}
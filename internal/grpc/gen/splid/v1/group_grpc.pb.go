@@ -0,0 +1,291 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.3.0
+// - protoc             (unknown)
+// source: splid/v1/group.proto
+
+package splidv1
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+const (
+	GroupService_CreateGroup_FullMethodName                = "/splid.v1.GroupService/CreateGroup"
+	GroupService_JoinGroup_FullMethodName                  = "/splid.v1.GroupService/JoinGroup"
+	GroupService_GetBalance_FullMethodName                 = "/splid.v1.GroupService/GetBalance"
+	GroupService_GetOperationsToEvenBalance_FullMethodName = "/splid.v1.GroupService/GetOperationsToEvenBalance"
+	GroupService_WatchGroupEvents_FullMethodName           = "/splid.v1.GroupService/WatchGroupEvents"
+)
+
+// GroupServiceClient is the client API for GroupService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type GroupServiceClient interface {
+	CreateGroup(ctx context.Context, in *CreateGroupRequest, opts ...grpc.CallOption) (*CreateGroupResponse, error)
+	JoinGroup(ctx context.Context, in *JoinGroupRequest, opts ...grpc.CallOption) (*JoinGroupResponse, error)
+	GetBalance(ctx context.Context, in *GetBalanceRequest, opts ...grpc.CallOption) (*GetBalanceResponse, error)
+	GetOperationsToEvenBalance(ctx context.Context, in *GetOperationsToEvenBalanceRequest, opts ...grpc.CallOption) (*GetOperationsToEvenBalanceResponse, error)
+	// WatchGroupEvents streams what happens in a group from now on, until the client cancels. Only members can watch a
+	// group. The response headers are sent once the server is listening for events. Delivery is at-least-once: use the
+	// event id to discard duplicates.
+	WatchGroupEvents(ctx context.Context, in *WatchGroupEventsRequest, opts ...grpc.CallOption) (GroupService_WatchGroupEventsClient, error)
+}
+
+type groupServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewGroupServiceClient(cc grpc.ClientConnInterface) GroupServiceClient {
+	return &groupServiceClient{cc}
+}
+
+func (c *groupServiceClient) CreateGroup(ctx context.Context, in *CreateGroupRequest, opts ...grpc.CallOption) (*CreateGroupResponse, error) {
+	out := new(CreateGroupResponse)
+	err := c.cc.Invoke(ctx, GroupService_CreateGroup_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *groupServiceClient) JoinGroup(ctx context.Context, in *JoinGroupRequest, opts ...grpc.CallOption) (*JoinGroupResponse, error) {
+	out := new(JoinGroupResponse)
+	err := c.cc.Invoke(ctx, GroupService_JoinGroup_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *groupServiceClient) GetBalance(ctx context.Context, in *GetBalanceRequest, opts ...grpc.CallOption) (*GetBalanceResponse, error) {
+	out := new(GetBalanceResponse)
+	err := c.cc.Invoke(ctx, GroupService_GetBalance_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *groupServiceClient) GetOperationsToEvenBalance(ctx context.Context, in *GetOperationsToEvenBalanceRequest, opts ...grpc.CallOption) (*GetOperationsToEvenBalanceResponse, error) {
+	out := new(GetOperationsToEvenBalanceResponse)
+	err := c.cc.Invoke(ctx, GroupService_GetOperationsToEvenBalance_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *groupServiceClient) WatchGroupEvents(ctx context.Context, in *WatchGroupEventsRequest, opts ...grpc.CallOption) (GroupService_WatchGroupEventsClient, error) {
+	stream, err := c.cc.NewStream(ctx, &GroupService_ServiceDesc.Streams[0], GroupService_WatchGroupEvents_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &groupServiceWatchGroupEventsClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type GroupService_WatchGroupEventsClient interface {
+	Recv() (*WatchGroupEventsResponse, error)
+	grpc.ClientStream
+}
+
+type groupServiceWatchGroupEventsClient struct {
+	grpc.ClientStream
+}
+
+func (x *groupServiceWatchGroupEventsClient) Recv() (*WatchGroupEventsResponse, error) {
+	m := new(WatchGroupEventsResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// GroupServiceServer is the server API for GroupService service.
+// All implementations must embed UnimplementedGroupServiceServer
+// for forward compatibility
+type GroupServiceServer interface {
+	CreateGroup(context.Context, *CreateGroupRequest) (*CreateGroupResponse, error)
+	JoinGroup(context.Context, *JoinGroupRequest) (*JoinGroupResponse, error)
+	GetBalance(context.Context, *GetBalanceRequest) (*GetBalanceResponse, error)
+	GetOperationsToEvenBalance(context.Context, *GetOperationsToEvenBalanceRequest) (*GetOperationsToEvenBalanceResponse, error)
+	// WatchGroupEvents streams what happens in a group from now on, until the client cancels. Only members can watch a
+	// group. The response headers are sent once the server is listening for events. Delivery is at-least-once: use the
+	// event id to discard duplicates.
+	WatchGroupEvents(*WatchGroupEventsRequest, GroupService_WatchGroupEventsServer) error
+	mustEmbedUnimplementedGroupServiceServer()
+}
+
+// UnimplementedGroupServiceServer must be embedded to have forward compatible implementations.
+type UnimplementedGroupServiceServer struct {
+}
+
+func (UnimplementedGroupServiceServer) CreateGroup(context.Context, *CreateGroupRequest) (*CreateGroupResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateGroup not implemented")
+}
+func (UnimplementedGroupServiceServer) JoinGroup(context.Context, *JoinGroupRequest) (*JoinGroupResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method JoinGroup not implemented")
+}
+func (UnimplementedGroupServiceServer) GetBalance(context.Context, *GetBalanceRequest) (*GetBalanceResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetBalance not implemented")
+}
+func (UnimplementedGroupServiceServer) GetOperationsToEvenBalance(context.Context, *GetOperationsToEvenBalanceRequest) (*GetOperationsToEvenBalanceResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetOperationsToEvenBalance not implemented")
+}
+func (UnimplementedGroupServiceServer) WatchGroupEvents(*WatchGroupEventsRequest, GroupService_WatchGroupEventsServer) error {
+	return status.Errorf(codes.Unimplemented, "method WatchGroupEvents not implemented")
+}
+func (UnimplementedGroupServiceServer) mustEmbedUnimplementedGroupServiceServer() {}
+
+// UnsafeGroupServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to GroupServiceServer will
+// result in compilation errors.
+type UnsafeGroupServiceServer interface {
+	mustEmbedUnimplementedGroupServiceServer()
+}
+
+func RegisterGroupServiceServer(s grpc.ServiceRegistrar, srv GroupServiceServer) {
+	s.RegisterService(&GroupService_ServiceDesc, srv)
+}
+
+func _GroupService_CreateGroup_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateGroupRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GroupServiceServer).CreateGroup(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: GroupService_CreateGroup_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GroupServiceServer).CreateGroup(ctx, req.(*CreateGroupRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _GroupService_JoinGroup_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(JoinGroupRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GroupServiceServer).JoinGroup(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: GroupService_JoinGroup_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GroupServiceServer).JoinGroup(ctx, req.(*JoinGroupRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _GroupService_GetBalance_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetBalanceRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GroupServiceServer).GetBalance(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: GroupService_GetBalance_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GroupServiceServer).GetBalance(ctx, req.(*GetBalanceRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _GroupService_GetOperationsToEvenBalance_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetOperationsToEvenBalanceRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GroupServiceServer).GetOperationsToEvenBalance(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: GroupService_GetOperationsToEvenBalance_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GroupServiceServer).GetOperationsToEvenBalance(ctx, req.(*GetOperationsToEvenBalanceRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _GroupService_WatchGroupEvents_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchGroupEventsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(GroupServiceServer).WatchGroupEvents(m, &groupServiceWatchGroupEventsServer{stream})
+}
+
+type GroupService_WatchGroupEventsServer interface {
+	Send(*WatchGroupEventsResponse) error
+	grpc.ServerStream
+}
+
+type groupServiceWatchGroupEventsServer struct {
+	grpc.ServerStream
+}
+
+func (x *groupServiceWatchGroupEventsServer) Send(m *WatchGroupEventsResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+// GroupService_ServiceDesc is the grpc.ServiceDesc for GroupService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var GroupService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "splid.v1.GroupService",
+	HandlerType: (*GroupServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "CreateGroup",
+			Handler:    _GroupService_CreateGroup_Handler,
+		},
+		{
+			MethodName: "JoinGroup",
+			Handler:    _GroupService_JoinGroup_Handler,
+		},
+		{
+			MethodName: "GetBalance",
+			Handler:    _GroupService_GetBalance_Handler,
+		},
+		{
+			MethodName: "GetOperationsToEvenBalance",
+			Handler:    _GroupService_GetOperationsToEvenBalance_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "WatchGroupEvents",
+			Handler:       _GroupService_WatchGroupEvents_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "splid/v1/group.proto",
+}
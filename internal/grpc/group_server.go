@@ -0,0 +1,137 @@
+package grpc
+
+import (
+	"context"
+	"github.com/antoniobelotti/splid_backend_clone/internal/event"
+	"github.com/antoniobelotti/splid_backend_clone/internal/group"
+	splidv1 "github.com/antoniobelotti/splid_backend_clone/internal/grpc/gen/splid/v1"
+	"github.com/antoniobelotti/splid_backend_clone/internal/person"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+type groupServer struct {
+	splidv1.UnimplementedGroupServiceServer
+	service       group.Service
+	personService person.Service
+	hub           *event.Hub
+}
+
+func (s *groupServer) CreateGroup(ctx context.Context, req *splidv1.CreateGroupRequest) (*splidv1.CreateGroupResponse, error) {
+	if req.Name == "" {
+		return nil, invalidArgument("name", "is required")
+	}
+	if err := requireAllowed(ctx, s.personService, person.ActionCreateGroup); err != nil {
+		return nil, err
+	}
+
+	g, err := s.service.CreateGroup(ctx, req.Name, credentialFrom(ctx).PersonId)
+	if err != nil {
+		return nil, err
+	}
+	return &splidv1.CreateGroupResponse{Group: toGroup(g)}, nil
+}
+
+func (s *groupServer) JoinGroup(ctx context.Context, req *splidv1.JoinGroupRequest) (*splidv1.JoinGroupResponse, error) {
+	if err := requireAllowed(ctx, s.personService, person.ActionJoinGroup); err != nil {
+		return nil, err
+	}
+
+	g, err := s.service.JoinGroup(ctx, int(req.GroupId), req.InvitationCode, credentialFrom(ctx).PersonId)
+	if err != nil {
+		return nil, err
+	}
+	return &splidv1.JoinGroupResponse{Group: toGroup(g)}, nil
+}
+
+func (s *groupServer) GetBalance(ctx context.Context, req *splidv1.GetBalanceRequest) (*splidv1.GetBalanceResponse, error) {
+	if err := requireGroupAccess(ctx, int(req.GroupId)); err != nil {
+		return nil, err
+	}
+
+	balance, err := s.service.GetGroupBalance(ctx, int(req.GroupId))
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &splidv1.GetBalanceResponse{BalanceInCents: make(map[int64]int64, len(balance))}
+	for personId, amount := range balance {
+		resp.BalanceInCents[int64(personId)] = int64(amount)
+	}
+	return resp, nil
+}
+
+func (s *groupServer) GetOperationsToEvenBalance(ctx context.Context, req *splidv1.GetOperationsToEvenBalanceRequest) (*splidv1.GetOperationsToEvenBalanceResponse, error) {
+	if err := requireGroupAccess(ctx, int(req.GroupId)); err != nil {
+		return nil, err
+	}
+
+	ops, err := s.service.GetOpsEvenBalance(ctx, int(req.GroupId))
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &splidv1.GetOperationsToEvenBalanceResponse{}
+	for _, t := range ops {
+		resp.Transfers = append(resp.Transfers, toTransfer(t))
+	}
+	return resp, nil
+}
+
+// WatchGroupEvents relays the events of the group published to the hub, until the client goes away. The headers are
+// sent as soon as the subscription starts. A client falling too far behind is disconnected with ResourceExhausted, and
+// every client with Unavailable when the server shuts down.
+func (s *groupServer) WatchGroupEvents(req *splidv1.WatchGroupEventsRequest, stream splidv1.GroupService_WatchGroupEventsServer) error {
+	ctx := stream.Context()
+	groupId := int(req.GroupId)
+	if err := requireGroupAccess(ctx, groupId); err != nil {
+		return err
+	}
+	if err := s.requireMember(ctx, groupId); err != nil {
+		return err
+	}
+
+	events, cancel := s.hub.Subscribe(event.InGroup(groupId))
+	defer cancel()
+	// the headers tell the client that nothing happening from now on will be missed
+	if err := stream.SendHeader(metadata.MD{}); err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return status.FromContextError(ctx.Err()).Err()
+		case e, ok := <-events:
+			if !ok && s.hub.IsClosed() {
+				return newStatus(codes.Unavailable, "server_shutting_down", "the server is shutting down, watch again")
+			}
+			if !ok {
+				return newStatus(codes.ResourceExhausted, "watcher_too_slow", "events were not received fast enough, watch again")
+			}
+			pb, err := toGroupEvent(e)
+			if err != nil {
+				return err
+			}
+			if err = stream.Send(&splidv1.WatchGroupEventsResponse{Event: pb}); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// requireMember - unlike the balance, the events of a group are only disclosed to its members
+func (s *groupServer) requireMember(ctx context.Context, groupId int) error {
+	members, err := s.service.GetGroupComponentsById(ctx, groupId)
+	if err != nil {
+		return err
+	}
+	personId := credentialFrom(ctx).PersonId
+	for _, id := range members {
+		if id == personId {
+			return nil
+		}
+	}
+	return newStatus(codes.PermissionDenied, "person_not_in_group", "person does not belong to the group")
+}
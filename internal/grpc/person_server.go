@@ -0,0 +1,53 @@
+package grpc
+
+import (
+	"context"
+	"fmt"
+	splidv1 "github.com/antoniobelotti/splid_backend_clone/internal/grpc/gen/splid/v1"
+	"github.com/antoniobelotti/splid_backend_clone/internal/person"
+	"google.golang.org/grpc/codes"
+	"net/mail"
+)
+
+type personServer struct {
+	splidv1.UnimplementedPersonServiceServer
+	service person.Service
+}
+
+func (s *personServer) Signup(ctx context.Context, req *splidv1.SignupRequest) (*splidv1.SignupResponse, error) {
+	if req.Name == "" {
+		return nil, invalidArgument("name", "is required")
+	}
+	if _, err := mail.ParseAddress(req.Email); err != nil {
+		return nil, invalidArgument("email", "must be a valid email")
+	}
+	if len(req.Password) < 8 {
+		return nil, invalidArgument("password", "must be at least 8 characters long")
+	}
+
+	p, err := s.service.CreatePerson(ctx, req.Name, req.Email, req.Password)
+	if err != nil {
+		return nil, err
+	}
+	return &splidv1.SignupResponse{Person: toPerson(p)}, nil
+}
+
+func (s *personServer) GetMe(ctx context.Context, _ *splidv1.GetMeRequest) (*splidv1.GetMeResponse, error) {
+	p, err := s.service.GetPersonById(ctx, credentialFrom(ctx).PersonId)
+	if err != nil {
+		return nil, err
+	}
+	return &splidv1.GetMeResponse{Person: toPerson(p)}, nil
+}
+
+// requireAllowed rejects the caller if the unverified accounts policy forbids them the action
+func requireAllowed(ctx context.Context, ps person.Service, action person.Action) error {
+	allowed, err := ps.IsAllowed(ctx, credentialFrom(ctx).PersonId, action)
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		return newStatus(codes.PermissionDenied, person.ErrEmailNotVerified.Code, fmt.Sprintf("%s: verify your email to %s", person.ErrEmailNotVerified, action))
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package grpc
+
+import (
+	"context"
+	"github.com/antoniobelotti/splid_backend_clone/internal/event"
+	"github.com/antoniobelotti/splid_backend_clone/internal/expense"
+	"github.com/antoniobelotti/splid_backend_clone/internal/group"
+	splidv1 "github.com/antoniobelotti/splid_backend_clone/internal/grpc/gen/splid/v1"
+	"github.com/antoniobelotti/splid_backend_clone/internal/http/authentication"
+	"github.com/antoniobelotti/splid_backend_clone/internal/person"
+	"github.com/antoniobelotti/splid_backend_clone/internal/transfer"
+	"google.golang.org/grpc"
+	"net"
+)
+
+// GRPCServer - the gRPC API, backed by the same services as the REST server and accepting the same tokens, sent as
+// "authorization: Bearer <token>" metadata
+type GRPCServer struct {
+	*grpc.Server
+}
+
+// NewGRPCServer - hub must be subscribed to the event.GroupEventTypes for WatchGroupEvents to see anything
+func NewGRPCServer(ps person.Service, gs group.Service, es expense.Service, ts transfer.Service, auth authentication.Service, hub *event.Hub) GRPCServer {
+	server := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(unaryInterceptor(auth)),
+		grpc.ChainStreamInterceptor(streamInterceptor(auth)),
+	)
+
+	splidv1.RegisterPersonServiceServer(server, &personServer{service: ps})
+	splidv1.RegisterGroupServiceServer(server, &groupServer{service: gs, personService: ps, hub: hub})
+	splidv1.RegisterExpenseServiceServer(server, &expenseServer{service: es})
+	splidv1.RegisterTransferServiceServer(server, &transferServer{service: ts})
+
+	return GRPCServer{server}
+}
+
+// Run listens on addr and serves until the server is stopped
+func (s GRPCServer) Run(addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(listener)
+}
+
+// Shutdown stops accepting calls and waits for the running ones until ctx is done, then cancels those left. Streams
+// only end on their own if the hub is closed first.
+func (s GRPCServer) Shutdown(ctx context.Context) error {
+	stopped := make(chan struct{})
+	go func() {
+		s.GracefulStop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+		return nil
+	case <-ctx.Done():
+		s.Stop()
+		<-stopped
+		return ctx.Err()
+	}
+}
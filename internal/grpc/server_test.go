@@ -0,0 +1,115 @@
+//go:build unit
+
+package grpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/antoniobelotti/splid_backend_clone/internal/apperror"
+	"github.com/antoniobelotti/splid_backend_clone/internal/event"
+	"github.com/antoniobelotti/splid_backend_clone/internal/expense"
+	"github.com/antoniobelotti/splid_backend_clone/internal/group"
+	splidv1 "github.com/antoniobelotti/splid_backend_clone/internal/grpc/gen/splid/v1"
+	"github.com/antoniobelotti/splid_backend_clone/internal/http/authentication"
+	"github.com/antoniobelotti/splid_backend_clone/internal/person"
+	"github.com/antoniobelotti/splid_backend_clone/internal/transfer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"net"
+	"testing"
+)
+
+func newTestServer() GRPCServer {
+	return NewGRPCServer(person.Service{}, group.Service{}, expense.Service{}, transfer.Service{}, authentication.Service{}, event.NewHub())
+}
+
+// TestMethodAuthsCoverEveryMethod fails when a method is added or removed without updating methodAuths
+func TestMethodAuthsCoverEveryMethod(t *testing.T) {
+	methods := map[string]bool{}
+	for service, info := range newTestServer().GetServiceInfo() {
+		for _, method := range info.Methods {
+			name := fmt.Sprintf("/%s/%s", service, method.Name)
+			methods[name] = true
+			assert.Contains(t, methodAuths, name)
+		}
+	}
+	for name := range methodAuths {
+		assert.Contains(t, methods, name)
+	}
+}
+
+func reasonOf(t *testing.T, err error) string {
+	for _, detail := range status.Convert(err).Details() {
+		if info, ok := detail.(*errdetails.ErrorInfo); ok {
+			assert.Equal(t, ErrorDomain, info.Domain)
+			return info.Reason
+		}
+	}
+	t.Fatalf("no ErrorInfo in %v", err)
+	return ""
+}
+
+func TestToStatus(t *testing.T) {
+	notFound := apperror.New(apperror.NotFound, "thing_not_found", "thing not found")
+	err := toStatus(fmt.Errorf("%w %w", notFound, errors.New("sql: no rows in result set")))
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	assert.Equal(t, "thing not found", status.Convert(err).Message())
+	assert.Equal(t, "thing_not_found", reasonOf(t, err))
+
+	invalid := apperror.NewInvalidField("amount", "invalid_amount", "invalid amount")
+	err = toStatus(fmt.Errorf("%w: must be positive", invalid))
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	assert.Equal(t, "invalid amount: must be positive", status.Convert(err).Message())
+
+	err = toStatus(errors.New("connection refused"))
+	assert.Equal(t, codes.Internal, status.Code(err))
+	assert.Equal(t, "internal server error", status.Convert(err).Message())
+
+	st := status.Error(codes.Canceled, "canceled")
+	assert.Equal(t, st, toStatus(st))
+}
+
+func dial(t *testing.T, server GRPCServer) *grpc.ClientConn {
+	listener := bufconn.Listen(1024 * 1024)
+	go func() {
+		_ = server.Serve(listener)
+	}()
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.DialContext(context.Background(), "bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+	return conn
+}
+
+func TestRequestsAreCheckedBeforeReachingTheServices(t *testing.T) {
+	client := splidv1.NewPersonServiceClient(dial(t, newTestServer()))
+
+	_, err := client.Signup(context.Background(), &splidv1.SignupRequest{Name: "name", Email: "not an email", Password: "password123"})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+	assert.Equal(t, "validation_failed", reasonOf(t, err))
+	var violations []*errdetails.BadRequest_FieldViolation
+	for _, detail := range status.Convert(err).Details() {
+		if badRequest, ok := detail.(*errdetails.BadRequest); ok {
+			violations = badRequest.FieldViolations
+		}
+	}
+	require.Len(t, violations, 1)
+	assert.Equal(t, "email", violations[0].Field)
+
+	_, err = client.GetMe(context.Background(), &splidv1.GetMeRequest{})
+	require.Equal(t, codes.Unauthenticated, status.Code(err))
+	assert.Equal(t, authentication.CodeMissingToken, reasonOf(t, err))
+}
@@ -0,0 +1,73 @@
+package grpc
+
+import (
+	"errors"
+	"github.com/antoniobelotti/splid_backend_clone/internal/apperror"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ErrorDomain - of the ErrorInfo detail of every error status, whose reason is the same stable code of the problems
+// reported by the REST server
+const ErrorDomain = "splid"
+
+var codeByKind = map[apperror.Kind]codes.Code{
+	apperror.Invalid:              codes.InvalidArgument,
+	apperror.Unauthorized:         codes.Unauthenticated,
+	apperror.Forbidden:            codes.PermissionDenied,
+	apperror.NotFound:             codes.NotFound,
+	apperror.Conflict:             codes.AlreadyExists,
+	apperror.Gone:                 codes.FailedPrecondition,
+	apperror.TooLarge:             codes.InvalidArgument,
+	apperror.UnsupportedMediaType: codes.InvalidArgument,
+	apperror.TooManyRequests:      codes.ResourceExhausted,
+}
+
+// newStatus - a status error carrying its stable reason
+func newStatus(code codes.Code, reason string, message string, details ...*errdetails.BadRequest_FieldViolation) error {
+	st := status.New(code, message)
+	withDetails, err := st.WithDetails(&errdetails.ErrorInfo{Reason: reason, Domain: ErrorDomain})
+	if err != nil {
+		return st.Err()
+	}
+	if len(details) > 0 {
+		if d, err := withDetails.WithDetails(&errdetails.BadRequest{FieldViolations: details}); err == nil {
+			withDetails = d
+		}
+	}
+	return withDetails.Err()
+}
+
+// invalidArgument - a validation error about a single field of the request
+func invalidArgument(field string, description string) error {
+	return newStatus(codes.InvalidArgument, "validation_failed", field+" "+description,
+		&errdetails.BadRequest_FieldViolation{Field: field, Description: description})
+}
+
+// toStatus maps the domain errors to status errors, like problem.FromError does for the REST server. Any other error
+// is an internal error, whose details are not disclosed. Status errors are returned as they are.
+func toStatus(err error) error {
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+
+	var appErr *apperror.Error
+	if !errors.As(err, &appErr) {
+		return newStatus(codes.Internal, "internal_error", "internal server error")
+	}
+	code, ok := codeByKind[appErr.Kind]
+	if !ok {
+		return newStatus(codes.Internal, "internal_error", "internal server error")
+	}
+
+	message := appErr.Message
+	if appErr.Kind == apperror.Invalid {
+		// validation errors are wrapped with what exactly is wrong, other errors may be wrapped with database errors
+		message = err.Error()
+	}
+	if appErr.Field != "" {
+		return newStatus(code, appErr.Code, message, &errdetails.BadRequest_FieldViolation{Field: appErr.Field, Description: message})
+	}
+	return newStatus(code, appErr.Code, message)
+}
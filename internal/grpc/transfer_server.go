@@ -0,0 +1,24 @@
+package grpc
+
+import (
+	"context"
+	splidv1 "github.com/antoniobelotti/splid_backend_clone/internal/grpc/gen/splid/v1"
+	"github.com/antoniobelotti/splid_backend_clone/internal/transfer"
+)
+
+type transferServer struct {
+	splidv1.UnimplementedTransferServiceServer
+	service transfer.Service
+}
+
+func (s *transferServer) CreateTransfer(ctx context.Context, req *splidv1.CreateTransferRequest) (*splidv1.CreateTransferResponse, error) {
+	if err := requireGroupAccess(ctx, int(req.GroupId)); err != nil {
+		return nil, err
+	}
+
+	t, err := s.service.CreateTransfer(ctx, int(req.AmountInCents), int(req.GroupId), credentialFrom(ctx).PersonId, int(req.ReceiverId))
+	if err != nil {
+		return nil, err
+	}
+	return &splidv1.CreateTransferResponse{Transfer: toTransfer(t)}, nil
+}
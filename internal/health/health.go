@@ -0,0 +1,148 @@
+package health
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Check - returns why a subsystem is not ready, nil when it is
+type Check func(ctx context.Context) error
+
+// DefaultCheckTimeout - a check still running after this long fails
+const DefaultCheckTimeout = 2 * time.Second
+
+const (
+	StatusOk          = "ok"
+	StatusUnavailable = "unavailable"
+)
+
+// Checker - the readiness checks of the subsystems, each registered by name
+type Checker struct {
+	timeout time.Duration
+
+	mu     sync.RWMutex
+	checks map[string]Check
+}
+
+func NewChecker(timeout time.Duration) *Checker {
+	if timeout <= 0 {
+		timeout = DefaultCheckTimeout
+	}
+	return &Checker{timeout: timeout, checks: make(map[string]Check)}
+}
+
+// Register adds the check, replacing the one already registered with the same name
+func (c *Checker) Register(name string, check Check) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.checks[name] = check
+}
+
+// CheckResult - the outcome of a single check
+type CheckResult struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Report - ready only if every check passed
+type Report struct {
+	Status string        `json:"status"`
+	Checks []CheckResult `json:"checks"`
+}
+
+func (r Report) IsReady() bool {
+	return r.Status == StatusOk
+}
+
+// Run runs every check concurrently and reports the results sorted by name
+func (c *Checker) Run(ctx context.Context) Report {
+	c.mu.RLock()
+	checks := make(map[string]Check, len(c.checks))
+	for name, check := range c.checks {
+		checks[name] = check
+	}
+	c.mu.RUnlock()
+
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	results := make(chan CheckResult, len(checks))
+	for name, check := range checks {
+		go func(name string, check Check) {
+			results <- CheckResult{Name: name, Status: StatusOk}.withError(run(ctx, check))
+		}(name, check)
+	}
+
+	report := Report{Status: StatusOk, Checks: make([]CheckResult, 0, len(checks))}
+	for range checks {
+		result := <-results
+		if result.Status != StatusOk {
+			report.Status = StatusUnavailable
+		}
+		report.Checks = append(report.Checks, result)
+	}
+	sort.Slice(report.Checks, func(i, j int) bool {
+		return report.Checks[i].Name < report.Checks[j].Name
+	})
+	return report
+}
+
+// run returns when ctx is done even if check does not
+func run(ctx context.Context, check Check) error {
+	done := make(chan error, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				done <- fmt.Errorf("panic: %v", r)
+			}
+		}()
+		done <- check(ctx)
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (r CheckResult) withError(err error) CheckResult {
+	if err != nil {
+		r.Status = StatusUnavailable
+		r.Error = err.Error()
+	}
+	return r
+}
+
+// Heartbeat - a background worker beats once per iteration. Its Check fails until the first beat, and whenever the
+// worker stays silent for longer than maxSilence.
+type Heartbeat struct {
+	maxSilence time.Duration
+	// last is a unix time in nanoseconds, 0 before the first beat
+	last atomic.Int64
+}
+
+func NewHeartbeat(maxSilence time.Duration) *Heartbeat {
+	return &Heartbeat{maxSilence: maxSilence}
+}
+
+func (h *Heartbeat) Beat() {
+	h.last.Store(time.Now().UnixNano())
+}
+
+func (h *Heartbeat) Check(_ context.Context) error {
+	last := h.last.Load()
+	if last == 0 {
+		return fmt.Errorf("not started")
+	}
+	if silence := time.Since(time.Unix(0, last)); silence > h.maxSilence {
+		return fmt.Errorf("last run %s ago", silence.Round(time.Second))
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+//go:build unit
+
+package health
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestCheckerRun(t *testing.T) {
+	checker := NewChecker(50 * time.Millisecond)
+	checker.Register("ok", func(context.Context) error { return nil })
+	checker.Register("failing", func(context.Context) error { return errors.New("broken") })
+	checker.Register("slow", func(ctx context.Context) error {
+		// ignores ctx on purpose
+		time.Sleep(time.Second)
+		return nil
+	})
+	checker.Register("panicking", func(context.Context) error { panic("boom") })
+
+	report := checker.Run(context.Background())
+	assert.False(t, report.IsReady())
+	assert.Equal(t, []CheckResult{
+		{Name: "failing", Status: StatusUnavailable, Error: "broken"},
+		{Name: "ok", Status: StatusOk},
+		{Name: "panicking", Status: StatusUnavailable, Error: "panic: boom"},
+		{Name: "slow", Status: StatusUnavailable, Error: context.DeadlineExceeded.Error()},
+	}, report.Checks)
+}
+
+func TestCheckerReady(t *testing.T) {
+	checker := NewChecker(0)
+	assert.True(t, checker.Run(context.Background()).IsReady(), "no checks, nothing wrong")
+
+	checker.Register("database", func(context.Context) error { return errors.New("down") })
+	assert.False(t, checker.Run(context.Background()).IsReady())
+	checker.Register("database", func(context.Context) error { return nil })
+	assert.True(t, checker.Run(context.Background()).IsReady(), "registering again replaces the check")
+}
+
+func TestHeartbeat(t *testing.T) {
+	heartbeat := NewHeartbeat(20 * time.Millisecond)
+	assert.EqualError(t, heartbeat.Check(context.Background()), "not started")
+
+	heartbeat.Beat()
+	assert.NoError(t, heartbeat.Check(context.Background()))
+
+	time.Sleep(40 * time.Millisecond)
+	assert.Error(t, heartbeat.Check(context.Background()))
+}
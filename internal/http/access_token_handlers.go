@@ -0,0 +1,108 @@
+package http
+
+import (
+	"errors"
+	"github.com/antoniobelotti/splid_backend_clone/internal/group"
+	"github.com/antoniobelotti/splid_backend_clone/internal/http/authentication"
+	"github.com/antoniobelotti/splid_backend_clone/internal/http/problem"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+type AccessTokenHandlers struct {
+	authService  authentication.Service
+	groupService group.Service
+}
+
+func NewAccessTokenHandlers(authService authentication.Service, groupService group.Service) AccessTokenHandlers {
+	return AccessTokenHandlers{
+		authService:  authService,
+		groupService: groupService,
+	}
+}
+
+type CreateAccessTokenRequestBody struct {
+	Name   string   `json:"name" binding:"required"`
+	Scopes []string `json:"scopes" binding:"required"`
+	// GroupIds restricts the token to some of the groups of the person
+	GroupIds  []int      `json:"group-ids"`
+	ExpiresAt *time.Time `json:"expires-at"`
+}
+
+type CreateAccessTokenResponseBody struct {
+	// Token is shown only once
+	Token string `json:"token"`
+	authentication.PersonalAccessToken
+}
+
+func (h *AccessTokenHandlers) handleCreateAccessToken(ctx *gin.Context) {
+	requestBody := CreateAccessTokenRequestBody{}
+
+	if err := ctx.ShouldBindJSON(&requestBody); err != nil {
+		problem.AbortWithBindingError(ctx, err)
+		return
+	}
+
+	scopes, err := authentication.ParseScopes(requestBody.Scopes)
+	if err != nil {
+		problem.AbortWithError(ctx, err)
+		return
+	}
+
+	personId := ctx.GetInt("PersonId")
+	for _, groupId := range requestBody.GroupIds {
+		members, err := h.groupService.GetGroupComponentsById(ctx, groupId)
+		if err != nil && !errors.Is(err, group.ErrGroupNotFound) {
+			problem.AbortWithError(ctx, err)
+			return
+		}
+		if !containsInt(members, personId) {
+			problem.Abort(ctx, problem.Invalid("group-ids", "must only contain groups you are a member of, not "+strconv.Itoa(groupId)))
+			return
+		}
+	}
+
+	token, pat, err := h.authService.CreatePersonalAccessToken(ctx, personId, requestBody.Name, scopes, requestBody.GroupIds, requestBody.ExpiresAt)
+	if err != nil {
+		problem.AbortWithError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, CreateAccessTokenResponseBody{Token: token, PersonalAccessToken: pat})
+}
+
+func (h *AccessTokenHandlers) handleGetAccessTokens(ctx *gin.Context) {
+	tokens, err := h.authService.GetPersonalAccessTokens(ctx, ctx.GetInt("PersonId"))
+	if err != nil {
+		problem.AbortWithError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, tokens)
+}
+
+func (h *AccessTokenHandlers) handleRevokeAccessToken(ctx *gin.Context) {
+	tokenId, err := strconv.Atoi(ctx.Param("tokenId"))
+	if err != nil {
+		problem.Abort(ctx, problem.Invalid("tokenId", "must be an integer"))
+		return
+	}
+
+	if err = h.authService.RevokePersonalAccessToken(ctx, ctx.GetInt("PersonId"), tokenId); err != nil {
+		problem.AbortWithError(ctx, err)
+		return
+	}
+
+	ctx.Status(http.StatusNoContent)
+}
+
+func containsInt(values []int, v int) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,46 @@
+package http
+
+import (
+	"github.com/antoniobelotti/splid_backend_clone/internal/expense"
+	"github.com/antoniobelotti/splid_backend_clone/internal/http/authentication"
+	"github.com/antoniobelotti/splid_backend_clone/internal/http/problem"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strconv"
+)
+
+// requireGroupAccess aborts the request if it is made with a personal access token restricted to other groups.
+// Routes with a :groupId parameter are already checked by the authentication middleware: this is for group ids found
+// in request bodies. Returns false if the request has been aborted.
+func requireGroupAccess(ctx *gin.Context, groupId int) bool {
+	if !authentication.GetCredential(ctx).CanAccessGroup(groupId) {
+		problem.AbortWithStatus(ctx, http.StatusForbidden, authentication.CodeTokenNotValidForGroup, "token not valid for this group")
+		return false
+	}
+	return true
+}
+
+// requireExpenseGroupAccess applies the group restriction of personal access tokens to routes with an :expenseId
+// parameter. Must run after the authentication middleware.
+func requireExpenseGroupAccess(es expense.Service) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if !authentication.GetCredential(ctx).IsGroupRestricted() {
+			ctx.Next()
+			return
+		}
+
+		expenseId, err := strconv.Atoi(ctx.Param("expenseId"))
+		if err != nil {
+			problem.Abort(ctx, problem.Invalid("expenseId", "must be an integer"))
+			return
+		}
+		e, err := es.GetExpenseById(ctx, expenseId)
+		if err != nil {
+			problem.AbortWithError(ctx, err)
+			return
+		}
+		if requireGroupAccess(ctx, e.GroupId) {
+			ctx.Next()
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package http
+
+import (
+	"fmt"
+	"github.com/antoniobelotti/splid_backend_clone/internal/account"
+	"github.com/antoniobelotti/splid_backend_clone/internal/http/problem"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+type AccountHandlers struct {
+	service account.Service
+}
+
+func NewAccountHandlers(service account.Service) AccountHandlers {
+	return AccountHandlers{
+		service: service,
+	}
+}
+
+// handleExportData returns the personal data of the logged-in person as a json document, or as a zip archive
+// including the uploaded files with ?format=zip
+func (h *AccountHandlers) handleExportData(ctx *gin.Context) {
+	format := ctx.DefaultQuery("format", "json")
+	if format != "json" && format != "zip" {
+		problem.Abort(ctx, problem.Invalid("format", "must be one of json, zip"))
+		return
+	}
+
+	export, err := h.service.Export(ctx, ctx.GetInt("PersonId"))
+	if err != nil {
+		problem.AbortWithError(ctx, err)
+		return
+	}
+
+	fileName := fmt.Sprintf("splid-export-%d-%s.%s", export.Profile.Id, export.ExportedAt.Format("20060102"), format)
+	ctx.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, fileName))
+	if format == "json" {
+		ctx.JSON(http.StatusOK, export)
+		return
+	}
+
+	ctx.Header("Content-Type", "application/zip")
+	ctx.Status(http.StatusOK)
+	if err = h.service.WriteZip(ctx, export, ctx.Writer); err != nil {
+		// the status has already been sent: a truncated archive is the only signal left
+		_ = ctx.Error(err)
+	}
+}
+
+type DeleteAccountRequestBody struct {
+	Password string `json:"password" binding:"required"`
+}
+
+func (h *AccountHandlers) handleDeleteAccount(ctx *gin.Context) {
+	requestBody := DeleteAccountRequestBody{}
+
+	if err := ctx.ShouldBindJSON(&requestBody); err != nil {
+		problem.AbortWithBindingError(ctx, err)
+		return
+	}
+
+	if err := h.service.DeleteAccount(ctx, ctx.GetInt("PersonId"), requestBody.Password); err != nil {
+		problem.AbortWithError(ctx, err)
+		return
+	}
+
+	ctx.Status(http.StatusNoContent)
+}
@@ -0,0 +1,130 @@
+package http
+
+import (
+	"errors"
+	"fmt"
+	"github.com/antoniobelotti/splid_backend_clone/internal/attachment"
+	"github.com/antoniobelotti/splid_backend_clone/internal/expense"
+	"github.com/antoniobelotti/splid_backend_clone/internal/http/problem"
+	"github.com/gin-gonic/gin"
+	"io"
+	"net/http"
+	"strconv"
+)
+
+type AttachmentHandlers struct {
+	service attachment.Service
+}
+
+func NewAttachmentHandlers(as attachment.Service) AttachmentHandlers {
+	return AttachmentHandlers{service: as}
+}
+
+// abortWithAttachmentError does not reveal whether the expense exists to who cannot see its attachments
+func abortWithAttachmentError(ctx *gin.Context, err error) {
+	if errors.Is(err, expense.ErrExpenseNotFound) {
+		err = attachment.ErrAttachmentNotFound
+	}
+	problem.AbortWithError(ctx, err)
+}
+
+// attachmentUploadPath - the route of handleUploadAttachment, exempt from ServerConfig.MaxBodyBytes because it sets a
+// limit of its own
+const attachmentUploadPath = "/api/v1/expense/:expenseId/attachment"
+
+// handleUploadAttachment expects a multipart form with the file in the "file" field
+func (h *AttachmentHandlers) handleUploadAttachment(ctx *gin.Context) {
+	expenseId, err := strconv.Atoi(ctx.Param("expenseId"))
+	if err != nil {
+		problem.Abort(ctx, problem.Invalid("expenseId", "must be an integer"))
+		return
+	}
+
+	// leave some room for the multipart envelope
+	ctx.Request.Body = http.MaxBytesReader(ctx.Writer, ctx.Request.Body, attachment.MaxAttachmentSizeInBytes+1<<20)
+	fileHeader, err := ctx.FormFile("file")
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			abortWithAttachmentError(ctx, attachment.ErrAttachmentTooLarge)
+			return
+		}
+		problem.Abort(ctx, problem.Invalid("file", "is required"))
+		return
+	}
+	if fileHeader.Size > attachment.MaxAttachmentSizeInBytes {
+		abortWithAttachmentError(ctx, attachment.ErrAttachmentTooLarge)
+		return
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		problem.Abort(ctx, problem.Invalid("file", "is not readable"))
+		return
+	}
+	defer file.Close()
+
+	a, err := h.service.Upload(ctx, ctx.GetInt("PersonId"), expenseId, fileHeader.Filename, file)
+	if err != nil {
+		abortWithAttachmentError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, a)
+}
+
+func (h *AttachmentHandlers) handleGetAttachments(ctx *gin.Context) {
+	expenseId, err := strconv.Atoi(ctx.Param("expenseId"))
+	if err != nil {
+		problem.Abort(ctx, problem.Invalid("expenseId", "must be an integer"))
+		return
+	}
+
+	attachments, err := h.service.GetAttachmentsByExpenseId(ctx, ctx.GetInt("PersonId"), expenseId)
+	if err != nil {
+		abortWithAttachmentError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, attachments)
+}
+
+func (h *AttachmentHandlers) handleDownloadAttachment(ctx *gin.Context) {
+	h.download(ctx, false)
+}
+
+func (h *AttachmentHandlers) handleDownloadThumbnail(ctx *gin.Context) {
+	h.download(ctx, true)
+}
+
+func (h *AttachmentHandlers) download(ctx *gin.Context, thumbnail bool) {
+	expenseId, err := strconv.Atoi(ctx.Param("expenseId"))
+	if err != nil {
+		problem.Abort(ctx, problem.Invalid("expenseId", "must be an integer"))
+		return
+	}
+	attachmentId, err := strconv.Atoi(ctx.Param("attachmentId"))
+	if err != nil {
+		problem.Abort(ctx, problem.Invalid("attachmentId", "must be an integer"))
+		return
+	}
+
+	a, content, err := h.service.Download(ctx, ctx.GetInt("PersonId"), expenseId, attachmentId, thumbnail)
+	if err != nil {
+		abortWithAttachmentError(ctx, err)
+		return
+	}
+	defer content.Close()
+
+	contentType := a.ContentType
+	if thumbnail {
+		contentType = "image/jpeg"
+	} else {
+		ctx.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", a.FileName))
+		ctx.Header("Content-Length", strconv.FormatInt(a.SizeInBytes, 10))
+	}
+	ctx.Header("Content-Type", contentType)
+	ctx.Header("X-Content-Type-Options", "nosniff")
+	ctx.Status(http.StatusOK)
+	_, _ = io.Copy(ctx.Writer, content)
+}
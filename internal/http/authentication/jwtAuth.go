@@ -1,58 +1,105 @@
 package authentication
 
 import (
-	"errors"
+	"github.com/antoniobelotti/splid_backend_clone/internal/apperror"
 	"github.com/golang-jwt/jwt/v5"
-	"os"
 	"time"
 )
 
 type CustomJwtClaims struct {
-	PersonId int `json:"person-id"`
+	PersonId  int    `json:"person-id"`
+	SessionId string `json:"sid"`
 	jwt.RegisteredClaims
 }
 
-func GetJwtToken(personId int) (string, error) {
-	expirationTime := time.Now().Add(1440 * time.Minute)
+// AccessTokenTTL - access tokens are short-lived: clients are expected to obtain new ones with their refresh token
+const AccessTokenTTL = 15 * time.Minute
+
+// GetJwtToken returns an access token signed with the active key
+func (km *KeyManager) GetJwtToken(personId int, sessionId string) (string, error) {
+	expirationTime := time.Now().Add(AccessTokenTTL)
 	claims := CustomJwtClaims{
-		PersonId: personId,
+		PersonId:  personId,
+		SessionId: sessionId,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(expirationTime),
 			NotBefore: jwt.NewNumericDate(time.Now()),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 		},
 	}
-	strKey := os.Getenv("JWT_SIGNING_KEY")
-	if strKey == "" {
-		return "", errors.New("JWT_SIGNING_KEY not set")
-	}
-
-	signingKey := []byte(strKey)
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(signingKey)
+	return km.sign(claims)
 }
 
 var (
-	ErrSigningKeyNotSet = errors.New("jwt sign key not set")
-	ErrInvalidToken     = errors.New("invalid token")
-	ErrInternalError    = errors.New("unable to verify token")
+	ErrInvalidToken  = apperror.New(apperror.Unauthorized, "invalid_token", "invalid token")
+	ErrInternalError = apperror.New(apperror.Internal, "token_verification_failed", "unable to verify token")
 )
 
-func GetPersonIdFromValidJwtToken(jwtTokenString string) (int, error) {
-	jwtToken, _ := jwt.ParseWithClaims(jwtTokenString, &CustomJwtClaims{}, func(token *jwt.Token) (interface{}, error) {
-		keyStr := os.Getenv("JWT_SIGNING_KEY")
-		if keyStr == "" {
-			return nil, ErrSigningKeyNotSet
-		}
-		return []byte(keyStr), nil
-	})
+// ParseJwtToken verifies the token signature and validity period and returns its claims
+func (km *KeyManager) ParseJwtToken(jwtTokenString string) (CustomJwtClaims, error) {
+	jwtToken, err := jwt.ParseWithClaims(
+		jwtTokenString,
+		&CustomJwtClaims{},
+		km.keyFunc,
+		jwt.WithValidMethods([]string{AlgorithmRS256, AlgorithmEdDSA}),
+	)
+	if jwtToken == nil {
+		// malformed token
+		return CustomJwtClaims{}, ErrInvalidToken
+	}
 
 	if claims, ok := jwtToken.Claims.(*CustomJwtClaims); ok {
-		if !jwtToken.Valid {
-			return 0, ErrInvalidToken
+		// challenge tokens have no session: they must not be accepted as access tokens
+		if err != nil || !jwtToken.Valid || claims.SessionId == "" {
+			return CustomJwtClaims{}, ErrInvalidToken
 		}
 
-		return claims.PersonId, nil
+		return *claims, nil
+	}
+	return CustomJwtClaims{}, ErrInternalError
+}
+
+// ChallengeTokenTTL - time left to enter the second factor once the password has been accepted
+const ChallengeTokenTTL = 5 * time.Minute
+
+const challengePurpose = "2fa-challenge"
+
+// ChallengeClaims - proof that the password of the person was correct. It is traded for an access token together with
+// the second factor.
+type ChallengeClaims struct {
+	PersonId int    `json:"person-id"`
+	Purpose  string `json:"purpose"`
+	jwt.RegisteredClaims
+}
+
+// GetChallengeToken returns a short-lived token that can only complete a two-step login
+func (km *KeyManager) GetChallengeToken(personId int) (string, time.Time, error) {
+	now := time.Now()
+	expirationTime := now.Add(ChallengeTokenTTL)
+	claims := ChallengeClaims{
+		PersonId: personId,
+		Purpose:  challengePurpose,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(expirationTime),
+			NotBefore: jwt.NewNumericDate(now),
+			IssuedAt:  jwt.NewNumericDate(now),
+		},
+	}
+	token, err := km.sign(claims)
+	return token, expirationTime, err
+}
+
+// ParseChallengeToken verifies a token returned by GetChallengeToken and returns the person it was issued to
+func (km *KeyManager) ParseChallengeToken(challengeTokenString string) (int, error) {
+	claims := ChallengeClaims{}
+	jwtToken, err := jwt.ParseWithClaims(
+		challengeTokenString,
+		&claims,
+		km.keyFunc,
+		jwt.WithValidMethods([]string{AlgorithmRS256, AlgorithmEdDSA}),
+	)
+	if err != nil || jwtToken == nil || !jwtToken.Valid || claims.Purpose != challengePurpose {
+		return 0, ErrInvalidToken
 	}
-	return 0, ErrInternalError
+	return claims.PersonId, nil
 }
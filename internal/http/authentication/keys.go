@@ -0,0 +1,294 @@
+package authentication
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt/v5"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	AlgorithmRS256 = "RS256"
+	AlgorithmEdDSA = "EdDSA"
+
+	minRsaKeyBits = 2048
+)
+
+var (
+	ErrNoSigningKey        = errors.New("no active signing key")
+	ErrUnsupportedKey      = errors.New("unsupported signing key: only RSA (at least 2048 bits) and Ed25519 keys are supported")
+	ErrDuplicateKeyId      = errors.New("duplicate signing key id")
+	ErrActiveKeyIdNotFound = errors.New("active signing key id not found")
+)
+
+// SigningKey - a private key identified by the kid header of the tokens it signs
+type SigningKey struct {
+	Id         string
+	Algorithm  string
+	PrivateKey crypto.Signer
+	// RetiredAt is set when the key stops signing. It keeps verifying tokens until every token it signed has expired.
+	RetiredAt *time.Time
+}
+
+// NewSigningKey infers the algorithm from the type of the private key
+func NewSigningKey(id string, privateKey crypto.Signer) (SigningKey, error) {
+	switch k := privateKey.(type) {
+	case *rsa.PrivateKey:
+		if k.N.BitLen() < minRsaKeyBits {
+			return SigningKey{}, ErrUnsupportedKey
+		}
+		return SigningKey{Id: id, Algorithm: AlgorithmRS256, PrivateKey: k}, nil
+	case ed25519.PrivateKey:
+		return SigningKey{Id: id, Algorithm: AlgorithmEdDSA, PrivateKey: k}, nil
+	default:
+		return SigningKey{}, ErrUnsupportedKey
+	}
+}
+
+// GenerateSigningKey returns a new Ed25519 key. Its id is derived from the public key.
+func GenerateSigningKey() (SigningKey, error) {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return SigningKey{}, err
+	}
+	h := sha256.Sum256(public)
+	return NewSigningKey(base64.RawURLEncoding.EncodeToString(h[:12]), private)
+}
+
+func (k SigningKey) method() jwt.SigningMethod {
+	if k.Algorithm == AlgorithmRS256 {
+		return jwt.SigningMethodRS256
+	}
+	return jwt.SigningMethodEdDSA
+}
+
+// KeyManager - holds the key used to sign new tokens and the keys that can still verify old ones.
+//
+// Rotation is graceful: the new key becomes the signing key, the previous one is retired and keeps verifying until
+// AccessTokenTTL has passed, so nobody is logged out.
+type KeyManager struct {
+	mu sync.RWMutex
+	// keys[len(keys)-1] is the active key
+	keys []SigningKey
+	now  func() time.Time
+}
+
+// NewKeyManager signs with active. verificationOnly keys are accepted when verifying, until they are pruned.
+func NewKeyManager(active SigningKey, verificationOnly ...SigningKey) (*KeyManager, error) {
+	km := &KeyManager{now: time.Now}
+	seen := map[string]bool{}
+	for _, k := range append(verificationOnly, active) {
+		if seen[k.Id] {
+			return nil, fmt.Errorf("%w %s", ErrDuplicateKeyId, k.Id)
+		}
+		seen[k.Id] = true
+		km.keys = append(km.keys, k)
+	}
+	return km, nil
+}
+
+// NewEphemeralKeyManager signs with a freshly generated key. Tokens do not survive a restart: meant for tests and dev.
+func NewEphemeralKeyManager() (*KeyManager, error) {
+	key, err := GenerateSigningKey()
+	if err != nil {
+		return nil, err
+	}
+	return NewKeyManager(key)
+}
+
+// LoadKeyManager reads every PKCS#8 PEM private key (*.pem) in dir. The key id is the file name without extension.
+// activeKeyId selects the signing key, the others only verify: to rotate, add the new key file, make it the active
+// one and delete the old file once AccessTokenTTL has passed.
+func LoadKeyManager(dir string, activeKeyId string) (*KeyManager, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+
+	var active *SigningKey
+	var others []SigningKey
+	for _, p := range paths {
+		key, err := loadSigningKey(p)
+		if err != nil {
+			return nil, fmt.Errorf("unable to load signing key %s: %w", p, err)
+		}
+		if key.Id == activeKeyId {
+			active = &key
+		} else {
+			others = append(others, key)
+		}
+	}
+	if active == nil {
+		return nil, fmt.Errorf("%w %q in %s", ErrActiveKeyIdNotFound, activeKeyId, dir)
+	}
+	return NewKeyManager(*active, others...)
+}
+
+func loadSigningKey(path string) (SigningKey, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return SigningKey{}, err
+	}
+	block, _ := pem.Decode(content)
+	if block == nil {
+		return SigningKey{}, errors.New("no PEM block found")
+	}
+	privateKey, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return SigningKey{}, err
+	}
+	signer, ok := privateKey.(crypto.Signer)
+	if !ok {
+		return SigningKey{}, ErrUnsupportedKey
+	}
+	return NewSigningKey(strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)), signer)
+}
+
+// Rotate makes key the signing key. The previous signing key is retired.
+func (km *KeyManager) Rotate(key SigningKey) error {
+	km.mu.Lock()
+	defer km.mu.Unlock()
+
+	km.prune()
+	for _, k := range km.keys {
+		if k.Id == key.Id {
+			return fmt.Errorf("%w %s", ErrDuplicateKeyId, key.Id)
+		}
+	}
+	if len(km.keys) > 0 {
+		now := km.now()
+		km.keys[len(km.keys)-1].RetiredAt = &now
+	}
+	km.keys = append(km.keys, key)
+	return nil
+}
+
+// prune drops the keys that stopped verifying, so that they do not pile up across rotations. Callers must hold the
+// write lock.
+func (km *KeyManager) prune() {
+	now := km.now()
+	kept := km.keys[:0]
+	for i, k := range km.keys {
+		if km.verifies(i, now) {
+			kept = append(kept, k)
+		}
+	}
+	km.keys = kept
+}
+
+// verifies tells whether keys[i] is accepted at now: retired keys are, until every token they signed has expired.
+// Callers must hold the lock.
+func (km *KeyManager) verifies(i int, now time.Time) bool {
+	k := km.keys[i]
+	return i == len(km.keys)-1 || k.RetiredAt == nil || !now.After(k.RetiredAt.Add(AccessTokenTTL))
+}
+
+func (km *KeyManager) activeKey() (SigningKey, error) {
+	km.mu.RLock()
+	defer km.mu.RUnlock()
+	if len(km.keys) == 0 {
+		return SigningKey{}, ErrNoSigningKey
+	}
+	return km.keys[len(km.keys)-1], nil
+}
+
+// verificationKeys returns the keys accepted when verifying a token. Expired keys are skipped here and only dropped by
+// Rotate: this runs on every authenticated request and must not take the write lock.
+func (km *KeyManager) verificationKeys() []SigningKey {
+	km.mu.RLock()
+	defer km.mu.RUnlock()
+	now := km.now()
+	keys := make([]SigningKey, 0, len(km.keys))
+	for i, k := range km.keys {
+		if km.verifies(i, now) {
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
+
+// verificationKey returns the key accepted when verifying a token with the kid header
+func (km *KeyManager) verificationKey(kid string) (SigningKey, bool) {
+	km.mu.RLock()
+	defer km.mu.RUnlock()
+	now := km.now()
+	for i, k := range km.keys {
+		if k.Id == kid && km.verifies(i, now) {
+			return k, true
+		}
+	}
+	return SigningKey{}, false
+}
+
+func (km *KeyManager) sign(claims jwt.Claims) (string, error) {
+	key, err := km.activeKey()
+	if err != nil {
+		return "", err
+	}
+	token := jwt.NewWithClaims(key.method(), claims)
+	token.Header["kid"] = key.Id
+	return token.SignedString(key.PrivateKey)
+}
+
+// keyFunc picks the verification key from the kid header and checks the token algorithm matches the key
+func (km *KeyManager) keyFunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	k, ok := km.verificationKey(kid)
+	if !ok || token.Method.Alg() != k.Algorithm {
+		return nil, ErrInvalidToken
+	}
+	return k.PrivateKey.Public(), nil
+}
+
+// JWK - public key in the JSON Web Key format, see RFC 7517 and RFC 8037
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyId     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	// RSA
+	Modulus  string `json:"n,omitempty"`
+	Exponent string `json:"e,omitempty"`
+	// Ed25519
+	Curve string `json:"crv,omitempty"`
+	X     string `json:"x,omitempty"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS returns the public keys that currently verify tokens, retired ones included
+func (km *KeyManager) JWKS() JWKS {
+	jwks := JWKS{Keys: []JWK{}}
+	for _, k := range km.verificationKeys() {
+		jwk := JWK{KeyId: k.Id, Use: "sig", Algorithm: k.Algorithm}
+		switch public := k.PrivateKey.Public().(type) {
+		case *rsa.PublicKey:
+			jwk.KeyType = "RSA"
+			jwk.Modulus = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+			jwk.Exponent = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.KeyType = "OKP"
+			jwk.Curve = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(public)
+		}
+		jwks.Keys = append(jwks.Keys, jwk)
+	}
+	return jwks
+}
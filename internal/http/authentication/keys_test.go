@@ -0,0 +1,183 @@
+//go:build unit
+
+package authentication
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newRsaSigningKey(t *testing.T, id string) SigningKey {
+	private, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	key, err := NewSigningKey(id, private)
+	require.NoError(t, err)
+	return key
+}
+
+func TestSignAndVerifyWithEveryAlgorithm(t *testing.T) {
+	edKey, err := GenerateSigningKey()
+	require.NoError(t, err)
+
+	for _, key := range []SigningKey{edKey, newRsaSigningKey(t, "rsa")} {
+		km, err := NewKeyManager(key)
+		require.NoError(t, err)
+
+		token, err := km.GetJwtToken(7, "session")
+		require.NoError(t, err)
+
+		parsed, _, err := jwt.NewParser().ParseUnverified(token, jwt.MapClaims{})
+		require.NoError(t, err)
+		assert.Equal(t, key.Id, parsed.Header["kid"])
+		assert.Equal(t, key.Algorithm, parsed.Header["alg"])
+
+		claims, err := km.ParseJwtToken(token)
+		require.NoError(t, err)
+		assert.Equal(t, 7, claims.PersonId)
+		assert.Equal(t, "session", claims.SessionId)
+	}
+}
+
+func TestNewSigningKeyRejectsWeakRsaKeys(t *testing.T) {
+	private, err := rsa.GenerateKey(rand.Reader, 1024)
+	require.NoError(t, err)
+	_, err = NewSigningKey("weak", private)
+	assert.ErrorIs(t, err, ErrUnsupportedKey)
+}
+
+func TestRotationKeepsOldTokensValidUntilExpiry(t *testing.T) {
+	old, err := GenerateSigningKey()
+	require.NoError(t, err)
+	km, err := NewKeyManager(old)
+	require.NoError(t, err)
+	now := time.Now()
+	km.now = func() time.Time { return now }
+
+	oldToken, err := km.GetJwtToken(1, "s1")
+	require.NoError(t, err)
+
+	require.NoError(t, km.Rotate(newRsaSigningKey(t, "new")))
+	newToken, err := km.GetJwtToken(1, "s2")
+	require.NoError(t, err)
+	parsed, _, err := jwt.NewParser().ParseUnverified(newToken, jwt.MapClaims{})
+	require.NoError(t, err)
+	assert.Equal(t, "new", parsed.Header["kid"])
+
+	_, err = km.ParseJwtToken(oldToken)
+	assert.NoError(t, err, "tokens signed by the retired key are still valid")
+	assert.Len(t, km.JWKS().Keys, 2)
+
+	now = now.Add(AccessTokenTTL + time.Second)
+	assert.Len(t, km.JWKS().Keys, 1, "the retired key is dropped once its tokens have expired")
+	_, err = km.ParseJwtToken(oldToken)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+	_, err = km.ParseJwtToken(newToken)
+	assert.NoError(t, err)
+
+	require.NoError(t, km.Rotate(newRsaSigningKey(t, "newer")))
+	assert.Len(t, km.keys, 2, "rotating prunes the expired keys")
+}
+
+func TestParseRejectsUnknownKeyAndAlgorithmMismatch(t *testing.T) {
+	km, err := NewEphemeralKeyManager()
+	require.NoError(t, err)
+	other, err := NewEphemeralKeyManager()
+	require.NoError(t, err)
+
+	token, err := other.GetJwtToken(1, "s")
+	require.NoError(t, err)
+	_, err = km.ParseJwtToken(token)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+
+	// an HS256 token using the public key as secret must not be accepted
+	key, err := km.activeKey()
+	require.NoError(t, err)
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, CustomJwtClaims{PersonId: 1})
+	forged.Header["kid"] = key.Id
+	forgedString, err := forged.SignedString([]byte(key.PrivateKey.Public().(ed25519.PublicKey)))
+	require.NoError(t, err)
+	_, err = km.ParseJwtToken(forgedString)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+}
+
+func TestJwksPublishesPublicKeys(t *testing.T) {
+	rsaKey := newRsaSigningKey(t, "rsa")
+	edKey, err := GenerateSigningKey()
+	require.NoError(t, err)
+	km, err := NewKeyManager(edKey, rsaKey)
+	require.NoError(t, err)
+
+	jwks := km.JWKS()
+	require.Len(t, jwks.Keys, 2)
+
+	rsaJwk := jwks.Keys[0]
+	assert.Equal(t, JWK{KeyType: "RSA", KeyId: "rsa", Use: "sig", Algorithm: AlgorithmRS256, Modulus: rsaJwk.Modulus, Exponent: "AQAB"}, rsaJwk)
+	n, err := base64.RawURLEncoding.DecodeString(rsaJwk.Modulus)
+	require.NoError(t, err)
+	assert.Equal(t, rsaKey.PrivateKey.(*rsa.PrivateKey).N, new(big.Int).SetBytes(n))
+
+	edJwk := jwks.Keys[1]
+	assert.Equal(t, "OKP", edJwk.KeyType)
+	assert.Equal(t, "Ed25519", edJwk.Curve)
+	x, err := base64.RawURLEncoding.DecodeString(edJwk.X)
+	require.NoError(t, err)
+	assert.Equal(t, []byte(edKey.PrivateKey.Public().(ed25519.PublicKey)), x)
+}
+
+func TestLoadKeyManager(t *testing.T) {
+	dir := t.TempDir()
+	writeKey := func(name string, key any) {
+		der, err := x509.MarshalPKCS8PrivateKey(key)
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600))
+	}
+	_, edPrivate, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	rsaPrivate, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	writeKey("2024-01.pem", rsaPrivate)
+	writeKey("2024-02.pem", edPrivate)
+
+	km, err := LoadKeyManager(dir, "2024-02")
+	require.NoError(t, err)
+	key, err := km.activeKey()
+	require.NoError(t, err)
+	assert.Equal(t, "2024-02", key.Id)
+	assert.Equal(t, AlgorithmEdDSA, key.Algorithm)
+	assert.Len(t, km.JWKS().Keys, 2)
+
+	_, err = LoadKeyManager(dir, "2023-12")
+	assert.ErrorIs(t, err, ErrActiveKeyIdNotFound)
+}
+
+func TestChallengeAndAccessTokensAreNotInterchangeable(t *testing.T) {
+	km, err := NewEphemeralKeyManager()
+	require.NoError(t, err)
+
+	challenge, expiresAt, err := km.GetChallengeToken(7)
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now().Add(ChallengeTokenTTL), expiresAt, time.Second)
+
+	personId, err := km.ParseChallengeToken(challenge)
+	require.NoError(t, err)
+	assert.Equal(t, 7, personId)
+	_, err = km.ParseJwtToken(challenge)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+
+	access, err := km.GetJwtToken(7, "session")
+	require.NoError(t, err)
+	_, err = km.ParseChallengeToken(access)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+}
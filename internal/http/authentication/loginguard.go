@@ -0,0 +1,272 @@
+package authentication
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LoginAttempt - one login request, successful or not. Attempts are kept as an audit trail.
+type LoginAttempt struct {
+	Email     string    `db:"email"`
+	Ip        string    `db:"ip"`
+	UserAgent string    `db:"user_agent"`
+	Succeeded bool      `db:"succeeded"`
+	CreatedAt time.Time `db:"created_at"`
+}
+
+// AttemptStats - failed attempts in the observation window
+type AttemptStats struct {
+	Failures      int
+	LastFailureAt time.Time
+}
+
+// AttemptTracker - stores login attempts
+type AttemptTracker interface {
+	// ReserveLoginAttempt passes decide the failures since the given time for a.Email, not counting the ones before its
+	// last successful login, and for a.Ip, pending attempts counting as failures. Unless decide returns a wait, a is
+	// stored as pending and its id returned. Reservations for the same email or ip are serialized: each one counts the
+	// ones before it.
+	ReserveLoginAttempt(ctx context.Context, a LoginAttempt, since time.Time, decide func(byEmail AttemptStats, byIp AttemptStats) time.Duration) (id int, retryAfter time.Duration, err error)
+	// CompleteLoginAttempt records the outcome of a pending attempt
+	CompleteLoginAttempt(ctx context.Context, id int, succeeded bool) error
+	// ReleaseLoginAttempt forgets a pending attempt that was neither a success nor a failure
+	ReleaseLoginAttempt(ctx context.Context, id int) error
+	// DeleteLoginAttemptsBefore deletes the attempts created before the given time
+	DeleteLoginAttemptsBefore(ctx context.Context, before time.Time) error
+}
+
+// LoginGuardConfig - thresholds are counted within Window
+type LoginGuardConfig struct {
+	Window time.Duration
+	// Retention - how long the attempts are kept as an audit trail, at least Window
+	Retention time.Duration
+	// FreeAttempts failures are allowed without delay, then each failure doubles the delay starting from BaseDelay
+	FreeAttempts int
+	BaseDelay    time.Duration
+	MaxDelay     time.Duration
+	// after AccountLockoutThreshold failures for an email, or IpLockoutThreshold failures from an ip, login is refused
+	// until LockoutDuration has passed since the last failure
+	AccountLockoutThreshold int
+	IpLockoutThreshold      int
+	LockoutDuration         time.Duration
+}
+
+func DefaultLoginGuardConfig() LoginGuardConfig {
+	return LoginGuardConfig{
+		Window:                  time.Hour,
+		Retention:               30 * 24 * time.Hour,
+		FreeAttempts:            3,
+		BaseDelay:               time.Second,
+		MaxDelay:                time.Minute,
+		AccountLockoutThreshold: 10,
+		IpLockoutThreshold:      100,
+		LockoutDuration:         15 * time.Minute,
+	}
+}
+
+// LoginGuard - slows down and then locks out password guessing, per account and per ip
+type LoginGuard struct {
+	tracker AttemptTracker
+	config  LoginGuardConfig
+	now     func() time.Time
+}
+
+func NewLoginGuard(tracker AttemptTracker, config LoginGuardConfig) *LoginGuard {
+	return &LoginGuard{tracker: tracker, config: config, now: time.Now}
+}
+
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// delay - how long after the last failure the next attempt is accepted
+func (g *LoginGuard) delay(stats AttemptStats, lockoutThreshold int) time.Duration {
+	if stats.Failures >= lockoutThreshold {
+		return g.config.LockoutDuration
+	}
+	if stats.Failures < g.config.FreeAttempts {
+		return 0
+	}
+	d := g.config.BaseDelay
+	for i := g.config.FreeAttempts; i < stats.Failures && d < g.config.MaxDelay; i++ {
+		d *= 2
+	}
+	if d > g.config.MaxDelay {
+		d = g.config.MaxDelay
+	}
+	return d
+}
+
+// Reserve returns how long the client has to wait before a login attempt for a.Email from a.Ip is accepted: if it is
+// not zero the password must not even be checked. Otherwise the attempt is stored as pending and counts as a failure
+// until Complete records its outcome, so that concurrent guesses cannot all pass before the first failure is recorded.
+// Unknown emails are throttled the same way as registered ones.
+func (g *LoginGuard) Reserve(ctx context.Context, a LoginAttempt) (id int, retryAfter time.Duration, err error) {
+	now := g.now()
+	a.Email = normalizeEmail(a.Email)
+	a.CreatedAt = now.UTC()
+
+	id, retryAfter, err = g.tracker.ReserveLoginAttempt(ctx, a, now.Add(-g.config.Window), func(byEmail AttemptStats, byIp AttemptStats) time.Duration {
+		var retryAfter time.Duration
+		for _, wait := range []time.Duration{
+			byEmail.LastFailureAt.Add(g.delay(byEmail, g.config.AccountLockoutThreshold)).Sub(now),
+			byIp.LastFailureAt.Add(g.delay(byIp, g.config.IpLockoutThreshold)).Sub(now),
+		} {
+			if wait > retryAfter {
+				retryAfter = wait
+			}
+		}
+		return retryAfter
+	})
+	if err != nil {
+		return 0, 0, fmt.Errorf("%w %w", ErrUnexpected, err)
+	}
+	return id, retryAfter, nil
+}
+
+// Complete records the outcome of the attempt reserved with id. It is recorded even if ctx is canceled: a pending
+// attempt would count as a failure.
+func (g *LoginGuard) Complete(ctx context.Context, id int, succeeded bool) error {
+	if err := g.tracker.CompleteLoginAttempt(context.WithoutCancel(ctx), id, succeeded); err != nil {
+		return fmt.Errorf("%w %w", ErrUnexpected, err)
+	}
+	return nil
+}
+
+// Release forgets the attempt reserved with id, when it could not be completed or was not a whole login, e.g. the
+// password of an account with 2FA
+func (g *LoginGuard) Release(ctx context.Context, id int) error {
+	if err := g.tracker.ReleaseLoginAttempt(context.WithoutCancel(ctx), id); err != nil {
+		return fmt.Errorf("%w %w", ErrUnexpected, err)
+	}
+	return nil
+}
+
+// pruneInterval - how often RunPruning deletes the attempts past the retention
+const pruneInterval = time.Hour
+
+// Prune deletes the attempts older than the retention: the audit trail keeps personal data, the email, the ip and the
+// user agent, no longer than needed
+func (g *LoginGuard) Prune(ctx context.Context) error {
+	if err := g.tracker.DeleteLoginAttemptsBefore(ctx, g.now().Add(-g.config.Retention)); err != nil {
+		return fmt.Errorf("%w %w", ErrUnexpected, err)
+	}
+	return nil
+}
+
+// RunPruning prunes the attempts every pruneInterval until ctx is cancelled
+func (g *LoginGuard) RunPruning(ctx context.Context) {
+	ticker := time.NewTicker(pruneInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := g.Prune(ctx); err != nil && ctx.Err() == nil {
+			slog.ErrorContext(ctx, "unable to prune the login attempts", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// InMemoryAttemptTracker - keeps the attempts of the last maxAge in memory. Only suitable for a single instance.
+type InMemoryAttemptTracker struct {
+	mu       sync.Mutex
+	attempts []trackedAttempt
+	lastId   int
+	maxAge   time.Duration
+}
+
+type trackedAttempt struct {
+	LoginAttempt
+	id      int
+	pending bool
+}
+
+func NewInMemoryAttemptTracker(maxAge time.Duration) *InMemoryAttemptTracker {
+	return &InMemoryAttemptTracker{maxAge: maxAge}
+}
+
+func (t *InMemoryAttemptTracker) ReserveLoginAttempt(_ context.Context, a LoginAttempt, since time.Time, decide func(byEmail AttemptStats, byIp AttemptStats) time.Duration) (int, time.Duration, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var byEmail, byIp AttemptStats
+	for _, tracked := range t.attempts {
+		if tracked.CreatedAt.Before(since) {
+			continue
+		}
+		failed := tracked.pending || !tracked.Succeeded
+		if tracked.Email == a.Email {
+			if failed {
+				byEmail.Failures++
+				byEmail.LastFailureAt = tracked.CreatedAt
+			} else {
+				byEmail = AttemptStats{}
+			}
+		}
+		if tracked.Ip == a.Ip && failed {
+			byIp.Failures++
+			byIp.LastFailureAt = tracked.CreatedAt
+		}
+	}
+	if retryAfter := decide(byEmail, byIp); retryAfter > 0 {
+		return 0, retryAfter, nil
+	}
+
+	// attempts are appended in order: drop the expired prefix
+	cutoff := a.CreatedAt.Add(-t.maxAge)
+	i := 0
+	for i < len(t.attempts) && t.attempts[i].CreatedAt.Before(cutoff) {
+		i++
+	}
+	t.lastId++
+	t.attempts = append(t.attempts[i:], trackedAttempt{LoginAttempt: a, id: t.lastId, pending: true})
+	return t.lastId, 0, nil
+}
+
+func (t *InMemoryAttemptTracker) CompleteLoginAttempt(_ context.Context, id int, succeeded bool) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for i := range t.attempts {
+		if t.attempts[i].id == id {
+			t.attempts[i].pending = false
+			t.attempts[i].Succeeded = succeeded
+		}
+	}
+	return nil
+}
+
+func (t *InMemoryAttemptTracker) ReleaseLoginAttempt(_ context.Context, id int) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for i := range t.attempts {
+		if t.attempts[i].id == id && t.attempts[i].pending {
+			t.attempts = append(t.attempts[:i], t.attempts[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+func (t *InMemoryAttemptTracker) DeleteLoginAttemptsBefore(_ context.Context, before time.Time) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	// attempts are appended in order: drop the expired prefix
+	i := 0
+	for i < len(t.attempts) && t.attempts[i].CreatedAt.Before(before) {
+		i++
+	}
+	t.attempts = t.attempts[i:]
+	return nil
+}
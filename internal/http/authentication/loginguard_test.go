@@ -0,0 +1,163 @@
+//go:build unit
+
+package authentication
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newTestGuard() (*LoginGuard, *time.Time) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	guard := NewLoginGuard(NewInMemoryAttemptTracker(24*time.Hour), LoginGuardConfig{
+		Window:                  time.Hour,
+		Retention:               24 * time.Hour,
+		FreeAttempts:            3,
+		BaseDelay:               time.Second,
+		MaxDelay:                10 * time.Second,
+		AccountLockoutThreshold: 8,
+		IpLockoutThreshold:      20,
+		LockoutDuration:         15 * time.Minute,
+	})
+	guard.now = func() time.Time { return now }
+	return guard, &now
+}
+
+// record stores a completed attempt, whatever the throttling
+func record(t *testing.T, g *LoginGuard, a LoginAttempt) {
+	ctx := context.Background()
+	a.CreatedAt = g.now()
+	id, _, err := g.tracker.ReserveLoginAttempt(ctx, a, time.Time{}, func(AttemptStats, AttemptStats) time.Duration { return 0 })
+	require.NoError(t, err)
+	require.NoError(t, g.tracker.CompleteLoginAttempt(ctx, id, a.Succeeded))
+}
+
+func fail(t *testing.T, g *LoginGuard, email string, ip string) {
+	record(t, g, LoginAttempt{Email: email, Ip: ip})
+}
+
+// check returns the wait before a login for email from ip, releasing the attempt if there is none
+func check(t *testing.T, g *LoginGuard, email string, ip string) time.Duration {
+	id, wait, err := g.Reserve(context.Background(), LoginAttempt{Email: email, Ip: ip})
+	require.NoError(t, err)
+	if wait == 0 {
+		require.NoError(t, g.Release(context.Background(), id))
+	}
+	return wait
+}
+
+func TestLoginGuardProgressiveDelay(t *testing.T) {
+	g, now := newTestGuard()
+
+	for i := 0; i < 3; i++ {
+		assert.Zero(t, check(t, g, "p@mail.com", "1.1.1.1"), "the first attempts are free")
+		fail(t, g, "p@mail.com", "1.1.1.1")
+	}
+
+	for _, want := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 10 * time.Second} {
+		wait := check(t, g, "P@Mail.com ", "2.2.2.2")
+		assert.Equal(t, want, wait, "emails are compared case insensitively")
+
+		*now = now.Add(wait)
+		assert.Zero(t, check(t, g, "p@mail.com", "2.2.2.2"))
+		fail(t, g, "p@mail.com", "2.2.2.2")
+	}
+
+	// 8 failures: locked out
+	assert.Equal(t, 15*time.Minute, check(t, g, "p@mail.com", "3.3.3.3"))
+	assert.Zero(t, check(t, g, "other@mail.com", "3.3.3.3"), "other accounts are not affected")
+}
+
+func TestLoginGuardSuccessResetsAccountButNotIp(t *testing.T) {
+	g, _ := newTestGuard()
+
+	for i := 0; i < 5; i++ {
+		fail(t, g, "p@mail.com", "1.1.1.1")
+	}
+	for i := 0; i < 20; i++ {
+		fail(t, g, "victim@mail.com", "6.6.6.6")
+	}
+	record(t, g, LoginAttempt{Email: "p@mail.com", Ip: "1.1.1.1", Succeeded: true})
+	record(t, g, LoginAttempt{Email: "attacker@mail.com", Ip: "6.6.6.6", Succeeded: true})
+
+	assert.Zero(t, check(t, g, "p@mail.com", "5.5.5.5"))
+	assert.Equal(t, 15*time.Minute, check(t, g, "attacker@mail.com", "6.6.6.6"), "logging into another account does not unlock the ip")
+}
+
+func TestLoginGuardForgetsOldFailures(t *testing.T) {
+	g, now := newTestGuard()
+
+	for i := 0; i < 8; i++ {
+		fail(t, g, "p@mail.com", "1.1.1.1")
+	}
+	*now = now.Add(time.Hour + time.Second)
+
+	assert.Zero(t, check(t, g, "p@mail.com", "1.1.1.1"))
+}
+
+func TestLoginGuardPrune(t *testing.T) {
+	g, now := newTestGuard()
+	tracker := g.tracker.(*InMemoryAttemptTracker)
+
+	fail(t, g, "old@mail.com", "1.1.1.1")
+	*now = now.Add(12 * time.Hour)
+	fail(t, g, "outside-window@mail.com", "1.1.1.1")
+	*now = now.Add(12*time.Hour + time.Minute)
+
+	require.NoError(t, g.Prune(context.Background()))
+	require.Len(t, tracker.attempts, 1)
+	assert.Equal(t, "outside-window@mail.com", tracker.attempts[0].Email, "attempts outside the window are kept until the retention")
+	assert.Zero(t, check(t, g, "outside-window@mail.com", "1.1.1.1"), "but they do not count anymore")
+}
+
+func TestLoginGuardCountsPendingAttempts(t *testing.T) {
+	g, _ := newTestGuard()
+	ctx := context.Background()
+
+	id, wait, err := g.Reserve(ctx, LoginAttempt{Email: "p@mail.com", Ip: "1.1.1.1"})
+	require.NoError(t, err)
+	require.Zero(t, wait)
+	for i := 0; i < 2; i++ {
+		fail(t, g, "p@mail.com", "1.1.1.1")
+	}
+	assert.Equal(t, time.Second, check(t, g, "p@mail.com", "1.1.1.1"), "the pending attempt counts as a failure")
+
+	require.NoError(t, g.Complete(ctx, id, true))
+	assert.Zero(t, check(t, g, "p@mail.com", "1.1.1.1"), "its success resets the account")
+}
+
+// TestLoginGuardConcurrentGuesses fires a burst of guesses: those reaching the password check must be throttled as if
+// they had come one after the other
+func TestLoginGuardConcurrentGuesses(t *testing.T) {
+	g, _ := newTestGuard()
+	ctx := context.Background()
+	const guesses = 50
+
+	var checked atomic.Int32
+	var wg sync.WaitGroup
+	start := make(chan struct{})
+	for i := 0; i < guesses; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			id, wait, err := g.Reserve(ctx, LoginAttempt{Email: "p@mail.com", Ip: "1.1.1.1"})
+			if err != nil || wait > 0 {
+				return
+			}
+			// the password is wrong
+			checked.Add(1)
+			assert.NoError(t, g.Complete(ctx, id, false))
+		}()
+	}
+	close(start)
+	wg.Wait()
+
+	assert.LessOrEqual(t, int(checked.Load()), g.config.AccountLockoutThreshold)
+	assert.Equal(t, int32(g.config.FreeAttempts), checked.Load(), "the clock is stopped: only the free attempts pass")
+}
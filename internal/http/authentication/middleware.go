@@ -1,52 +1,125 @@
 package authentication
 
 import (
-	"fmt"
+	"context"
+	"github.com/antoniobelotti/splid_backend_clone/internal/http/problem"
+	"github.com/antoniobelotti/splid_backend_clone/internal/tracing"
 	"github.com/gin-gonic/gin"
 	"net/http"
+	"strconv"
 	"strings"
 )
 
-// AuthenticateMiddleware is a middleware that fetches user details from token
-func AuthenticateMiddleware() gin.HandlerFunc {
+// Codes of the problems reported by AuthenticateMiddleware, besides those of ErrInvalidToken and ErrSessionRevoked
+const (
+	CodeMissingToken          = "missing_token"
+	CodeMalformedToken        = "malformed_token"
+	CodeAccessTokenNotAllowed = "access_token_not_allowed"
+	CodeInsufficientScope     = "insufficient_scope"
+	CodeTokenNotValidForGroup = "token_not_valid_for_group"
+)
+
+// AuthenticateMiddleware is a middleware that fetches user details from token.
+// Tokens belonging to a revoked session are rejected.
+//
+// Personal access tokens are accepted only by routes that declare the scopes they require, and only if the token has
+// all of them: without scopes the route is reserved to sessions opened with a password. If the route has a :groupId
+// parameter, group-restricted tokens must include that group.
+func (s *Service) AuthenticateMiddleware(scopes ...Scope) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		if len(c.Request.Header["Authorization"]) == 0 {
-			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"message": "no Authorization header provided"})
+			problem.AbortWithStatus(c, http.StatusForbidden, CodeMissingToken, "no Authorization header provided")
 			return
 		}
 
 		tokenParts := strings.Split(c.Request.Header["Authorization"][0], " ")
 		if len(tokenParts) != 2 {
-			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"message": "invalid token format"})
+			problem.AbortWithStatus(c, http.StatusForbidden, CodeMalformedToken, "invalid token format")
 			return
 		}
 
 		if !strings.EqualFold(tokenParts[0], "Bearer") {
-			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"message": "invalid token type"})
+			problem.AbortWithStatus(c, http.StatusForbidden, CodeMalformedToken, "invalid token type")
 			return
 		}
 
 		jwtTokenString := tokenParts[1]
 
 		if len(jwtTokenString) == 0 {
-			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"message": "Please login to your account"})
+			problem.AbortWithStatus(c, http.StatusForbidden, CodeMissingToken, "Please login to your account")
 			return
 		}
 
-		personId, err := GetPersonIdFromValidJwtToken(jwtTokenString)
+		credential, err := s.Authenticate(c, jwtTokenString)
 		if err != nil {
-			switch err {
-			case ErrInvalidToken:
-				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"message": "invalid token"})
-			case ErrSigningKeyNotSet:
-				fmt.Println("JWT SIGNING KEY NOT SET - unable to authenticate")
-				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"message": "internal server error"})
-			default:
-				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"message": "internal server error"})
-			}
+			problem.AbortWithError(c, err)
+			return
+		}
+		if credential.PersonalAccessToken != nil {
+			s.authorizePersonalAccessTokenRequest(c, credential, scopes)
 			return
 		}
-		c.Set("PersonId", personId)
+
+		c.Set("PersonId", credential.PersonId)
+		c.Set("SessionId", credential.SessionId)
+		c.Set("Credential", credential)
 		c.Next()
 	}
 }
+
+// Authenticate returns the credential of a bearer token, either an access token of an active session or a personal
+// access token. It is up to the caller to check the scopes of personal access tokens.
+func (s *Service) Authenticate(ctx context.Context, token string) (_ Credential, err error) {
+	ctx, span := tracer.Start(ctx, "authentication.Authenticate")
+	defer func() { tracing.End(span, err) }()
+
+	if strings.HasPrefix(token, PersonalAccessTokenPrefix) {
+		pat, err := s.authenticatePersonalAccessToken(ctx, token)
+		if err != nil {
+			return Credential{}, err
+		}
+		return Credential{PersonId: pat.PersonId, PersonalAccessToken: &pat}, nil
+	}
+
+	claims, err := s.keys.ParseJwtToken(token)
+	if err != nil {
+		return Credential{}, err
+	}
+
+	active, err := s.IsSessionActive(ctx, claims.SessionId)
+	if err != nil {
+		return Credential{}, err
+	}
+	if !active {
+		return Credential{}, ErrSessionRevoked
+	}
+	return Credential{PersonId: claims.PersonId, SessionId: claims.SessionId}, nil
+}
+
+func (s *Service) authorizePersonalAccessTokenRequest(c *gin.Context, credential Credential, scopes []Scope) {
+	if len(scopes) == 0 {
+		problem.AbortWithStatus(c, http.StatusForbidden, CodeAccessTokenNotAllowed, "personal access tokens cannot be used here")
+		return
+	}
+	for _, scope := range scopes {
+		if !credential.HasScope(scope) {
+			problem.AbortWithStatus(c, http.StatusForbidden, CodeInsufficientScope, "insufficient scope: "+string(scope)+" required")
+			return
+		}
+	}
+	if groupId, err := strconv.Atoi(c.Param("groupId")); err == nil && !credential.CanAccessGroup(groupId) {
+		problem.AbortWithStatus(c, http.StatusForbidden, CodeTokenNotValidForGroup, "token not valid for this group")
+		return
+	}
+
+	c.Set("PersonId", credential.PersonId)
+	c.Set("Credential", credential)
+	c.Next()
+}
+
+// GetCredential returns the credential set by AuthenticateMiddleware
+func GetCredential(c *gin.Context) Credential {
+	credential, _ := c.Get("Credential")
+	cred, _ := credential.(Credential)
+	return cred
+}
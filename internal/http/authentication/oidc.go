@@ -0,0 +1,241 @@
+package authentication
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"github.com/antoniobelotti/splid_backend_clone/internal/apperror"
+	"github.com/antoniobelotti/splid_backend_clone/internal/tracing"
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+	"sort"
+	"time"
+)
+
+// OidcLoginStateTTL - time the person has to sign in at the provider
+const OidcLoginStateTTL = 10 * time.Minute
+
+// OidcProviderConfig - a provider is discovered from its issuer url
+type OidcProviderConfig struct {
+	// Name identifies the provider in our urls, e.g. "google"
+	Name         string
+	IssuerUrl    string
+	ClientId     string
+	ClientSecret string
+	// RedirectUrl - our callback url, as registered with the provider
+	RedirectUrl string
+	// Scopes requested besides openid. Defaults to email and profile.
+	Scopes []string
+}
+
+// OidcLoginState - what is needed to complete a login started by AuthorizationUrl. Only the hash of the state is
+// stored; the state is single-use.
+type OidcLoginState struct {
+	StateHash    string    `db:"state_hash"`
+	Provider     string    `db:"provider"`
+	CodeVerifier string    `db:"code_verifier"`
+	Nonce        string    `db:"nonce"`
+	CreatedAt    time.Time `db:"created_at"`
+	ExpiresAt    time.Time `db:"expires_at"`
+}
+
+type OidcStateStore interface {
+	CreateOidcLoginState(ctx context.Context, s OidcLoginState) error
+	// ConsumeOidcLoginState deletes and returns the state. Returns ErrInvalidOidcState if it does not exist or has
+	// expired.
+	ConsumeOidcLoginState(ctx context.Context, stateHash string) (OidcLoginState, error)
+}
+
+// OidcIdentity - who the provider says signed in
+type OidcIdentity struct {
+	Provider      string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+}
+
+var (
+	ErrUnknownOidcProvider = apperror.New(apperror.NotFound, "unknown_identity_provider", "unknown identity provider")
+	ErrInvalidOidcState    = apperror.NewInvalidField("state", "invalid_login_state", "invalid or expired login state")
+	ErrOidcLoginFailed     = apperror.New(apperror.Unauthorized, "identity_provider_login_failed", "login with the identity provider failed")
+)
+
+type oidcProvider struct {
+	oauth2   oauth2.Config
+	verifier *oidc.IDTokenVerifier
+}
+
+// Oidc - relying party of the OpenID Connect providers, using the authorization code flow with PKCE
+type Oidc struct {
+	store     OidcStateStore
+	providers map[string]oidcProvider
+}
+
+// NewOidc fetches the discovery document of every provider
+func NewOidc(ctx context.Context, store OidcStateStore, configs ...OidcProviderConfig) (*Oidc, error) {
+	o := &Oidc{store: store, providers: map[string]oidcProvider{}}
+	for _, c := range configs {
+		if _, ok := o.providers[c.Name]; ok {
+			return nil, fmt.Errorf("duplicate identity provider %s", c.Name)
+		}
+		provider, err := oidc.NewProvider(ctx, c.IssuerUrl)
+		if err != nil {
+			return nil, fmt.Errorf("unable to discover identity provider %s: %w", c.Name, err)
+		}
+		scopes := c.Scopes
+		if len(scopes) == 0 {
+			scopes = []string{"email", "profile"}
+		}
+		o.providers[c.Name] = oidcProvider{
+			oauth2: oauth2.Config{
+				ClientID:     c.ClientId,
+				ClientSecret: c.ClientSecret,
+				Endpoint:     provider.Endpoint(),
+				RedirectURL:  c.RedirectUrl,
+				Scopes:       append([]string{oidc.ScopeOpenID}, scopes...),
+			},
+			verifier: provider.Verifier(&oidc.Config{ClientID: c.ClientId}),
+		}
+	}
+	return o, nil
+}
+
+// Providers returns the names of the configured providers
+func (o *Oidc) Providers() []string {
+	names := []string{}
+	for name := range o.providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (o *Oidc) provider(name string) (oidcProvider, error) {
+	p, ok := o.providers[name]
+	if !ok {
+		return oidcProvider{}, ErrUnknownOidcProvider
+	}
+	return p, nil
+}
+
+// AuthorizationUrl starts a login: the person has to be sent to the returned url
+func (o *Oidc) AuthorizationUrl(ctx context.Context, providerName string) (string, error) {
+	p, err := o.provider(providerName)
+	if err != nil {
+		return "", err
+	}
+
+	var state, codeVerifier, nonce string
+	for _, v := range []*string{&state, &codeVerifier, &nonce} {
+		if *v, err = randomToken(32); err != nil {
+			return "", fmt.Errorf("%w %w", ErrUnexpected, err)
+		}
+	}
+
+	now := time.Now().UTC()
+	if err = o.store.CreateOidcLoginState(ctx, OidcLoginState{
+		StateHash:    hashToken(state),
+		Provider:     providerName,
+		CodeVerifier: codeVerifier,
+		Nonce:        nonce,
+		CreatedAt:    now,
+		ExpiresAt:    now.Add(OidcLoginStateTTL),
+	}); err != nil {
+		return "", fmt.Errorf("%w %w", ErrUnexpected, err)
+	}
+
+	challenge := sha256.Sum256([]byte(codeVerifier))
+	return p.oauth2.AuthCodeURL(
+		state,
+		oidc.Nonce(nonce),
+		oauth2.SetAuthURLParam("code_challenge", base64.RawURLEncoding.EncodeToString(challenge[:])),
+		oauth2.SetAuthURLParam("code_challenge_method", "S256"),
+	), nil
+}
+
+// Exchange completes a login: it redeems the authorization code the provider redirected back with and verifies the
+// id token
+func (o *Oidc) Exchange(ctx context.Context, providerName string, code string, state string) (OidcIdentity, error) {
+	p, err := o.provider(providerName)
+	if err != nil {
+		return OidcIdentity{}, err
+	}
+
+	loginState, err := o.store.ConsumeOidcLoginState(ctx, hashToken(state))
+	if err != nil {
+		return OidcIdentity{}, err
+	}
+	if loginState.Provider != providerName {
+		return OidcIdentity{}, ErrInvalidOidcState
+	}
+
+	token, err := p.oauth2.Exchange(ctx, code, oauth2.SetAuthURLParam("code_verifier", loginState.CodeVerifier))
+	if err != nil {
+		return OidcIdentity{}, fmt.Errorf("%w %w", ErrOidcLoginFailed, err)
+	}
+	rawIdToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return OidcIdentity{}, fmt.Errorf("%w: no id token in the token response", ErrOidcLoginFailed)
+	}
+	idToken, err := p.verifier.Verify(ctx, rawIdToken)
+	if err != nil {
+		return OidcIdentity{}, fmt.Errorf("%w %w", ErrOidcLoginFailed, err)
+	}
+	if idToken.Nonce != loginState.Nonce {
+		return OidcIdentity{}, fmt.Errorf("%w: nonce mismatch", ErrOidcLoginFailed)
+	}
+
+	var claims struct {
+		Email         string `json:"email"`
+		EmailVerified bool   `json:"email_verified"`
+		Name          string `json:"name"`
+	}
+	if err = idToken.Claims(&claims); err != nil {
+		return OidcIdentity{}, fmt.Errorf("%w %w", ErrOidcLoginFailed, err)
+	}
+	return OidcIdentity{
+		Provider:      providerName,
+		Subject:       idToken.Subject,
+		Email:         claims.Email,
+		EmailVerified: claims.EmailVerified,
+		Name:          claims.Name,
+	}, nil
+}
+
+// WithOidc returns a copy of the service also accepting logins from the identity providers of o
+func (s Service) WithOidc(o *Oidc) Service {
+	s.oidc = o
+	return s
+}
+
+// OidcProviders returns the names of the identity providers people can log in with
+func (s *Service) OidcProviders() []string {
+	if s.oidc == nil {
+		return []string{}
+	}
+	return s.oidc.Providers()
+}
+
+// OidcAuthorizationUrl - see Oidc.AuthorizationUrl
+func (s *Service) OidcAuthorizationUrl(ctx context.Context, providerName string) (_ string, err error) {
+	ctx, span := tracer.Start(ctx, "authentication.OidcAuthorizationUrl")
+	defer func() { tracing.End(span, err) }()
+
+	if s.oidc == nil {
+		return "", ErrUnknownOidcProvider
+	}
+	return s.oidc.AuthorizationUrl(ctx, providerName)
+}
+
+// OidcExchange - see Oidc.Exchange
+func (s *Service) OidcExchange(ctx context.Context, providerName string, code string, state string) (_ OidcIdentity, err error) {
+	ctx, span := tracer.Start(ctx, "authentication.OidcExchange")
+	defer func() { tracing.End(span, err) }()
+
+	if s.oidc == nil {
+		return OidcIdentity{}, ErrUnknownOidcProvider
+	}
+	return s.oidc.Exchange(ctx, providerName, code, state)
+}
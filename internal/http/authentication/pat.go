@@ -0,0 +1,186 @@
+package authentication
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/antoniobelotti/splid_backend_clone/internal/apperror"
+	"github.com/antoniobelotti/splid_backend_clone/internal/tracing"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// Scope - what a personal access token is allowed to do. Sessions opened with a password have every scope.
+type Scope string
+
+const (
+	// ScopeRead - read groups, balances, expenses and attachments
+	ScopeRead Scope = "read"
+	// ScopeWriteExpenses - create and delete expenses, transfers, recurring expenses and attachments
+	ScopeWriteExpenses Scope = "write:expenses"
+)
+
+var knownScopes = []Scope{ScopeRead, ScopeWriteExpenses}
+
+// PersonalAccessTokenPrefix - tells personal access tokens apart from JWTs, and makes leaked tokens easy to grep for
+const PersonalAccessTokenPrefix = "splid_pat_"
+
+// PersonalAccessToken - a long-lived credential for scripts and integrations. Only the sha256 hash of the token is
+// stored: the token itself is shown once, when created.
+type PersonalAccessToken struct {
+	Id        int     `json:"id"`
+	PersonId  int     `json:"person-id"`
+	Name      string  `json:"name"`
+	TokenHash string  `json:"-"`
+	Scopes    []Scope `json:"scopes"`
+	// GroupIds restricts the token to these groups. Empty means every group of the person.
+	GroupIds   []int      `json:"group-ids"`
+	CreatedAt  time.Time  `json:"created-at"`
+	ExpiresAt  *time.Time `json:"expires-at,omitempty"`
+	LastUsedAt *time.Time `json:"last-used-at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked-at,omitempty"`
+}
+
+var (
+	ErrInvalidScope                 = apperror.NewInvalidField("scopes", "invalid_scope", "invalid scope")
+	ErrInvalidTokenName             = apperror.NewInvalidField("name", "invalid_token_name", "token name cannot be empty")
+	ErrPersonalAccessTokenNotFound  = apperror.New(apperror.NotFound, "access_token_not_found", "personal access token not found")
+	ErrPersonalAccessTokenExpiresAt = apperror.NewInvalidField("expires-at", "invalid_expiration", "expiration must be in the future")
+)
+
+// ParseScopes validates scope names. At least one scope is required.
+func ParseScopes(names []string) ([]Scope, error) {
+	if len(names) == 0 {
+		return nil, fmt.Errorf("%w: at least one scope is required", ErrInvalidScope)
+	}
+	var scopes []Scope
+	for _, name := range names {
+		scope := Scope(strings.TrimSpace(name))
+		if !isKnownScope(scope) {
+			return nil, fmt.Errorf("%w %q", ErrInvalidScope, name)
+		}
+		scopes = append(scopes, scope)
+	}
+	return scopes, nil
+}
+
+func isKnownScope(scope Scope) bool {
+	for _, known := range knownScopes {
+		if known == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// CreatePersonalAccessToken returns the token in clear, along with what is stored about it
+func (s *Service) CreatePersonalAccessToken(ctx context.Context, personId int, name string, scopes []Scope, groupIds []int, expiresAt *time.Time) (_ string, _ PersonalAccessToken, err error) {
+	ctx, span := tracer.Start(ctx, "authentication.CreatePersonalAccessToken")
+	defer func() { tracing.End(span, err) }()
+
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", PersonalAccessToken{}, ErrInvalidTokenName
+	}
+	if expiresAt != nil && !expiresAt.After(time.Now()) {
+		return "", PersonalAccessToken{}, ErrPersonalAccessTokenExpiresAt
+	}
+
+	secret, err := randomToken(32)
+	if err != nil {
+		return "", PersonalAccessToken{}, fmt.Errorf("%w %w", ErrUnexpected, err)
+	}
+	token := PersonalAccessTokenPrefix + secret
+
+	if groupIds == nil {
+		groupIds = []int{}
+	}
+	pat := PersonalAccessToken{
+		PersonId:  personId,
+		Name:      name,
+		TokenHash: hashToken(token),
+		Scopes:    scopes,
+		GroupIds:  groupIds,
+		CreatedAt: time.Now().UTC(),
+		ExpiresAt: expiresAt,
+	}
+	if pat.Id, err = s.store.CreatePersonalAccessToken(ctx, pat); err != nil {
+		return "", PersonalAccessToken{}, fmt.Errorf("%w %w", ErrUnexpected, err)
+	}
+	return token, pat, nil
+}
+
+// GetPersonalAccessTokens lists the tokens of the person, revoked ones included
+func (s *Service) GetPersonalAccessTokens(ctx context.Context, personId int) (_ []PersonalAccessToken, err error) {
+	ctx, span := tracer.Start(ctx, "authentication.GetPersonalAccessTokens")
+	defer func() { tracing.End(span, err) }()
+
+	return s.store.GetPersonalAccessTokensByPersonId(ctx, personId)
+}
+
+// RevokePersonalAccessToken returns ErrPersonalAccessTokenNotFound if the person has no such token
+func (s *Service) RevokePersonalAccessToken(ctx context.Context, personId int, tokenId int) (err error) {
+	ctx, span := tracer.Start(ctx, "authentication.RevokePersonalAccessToken")
+	defer func() { tracing.End(span, err) }()
+
+	return s.store.RevokePersonalAccessToken(ctx, personId, tokenId)
+}
+
+// authenticatePersonalAccessToken returns ErrInvalidToken for unknown, revoked and expired tokens
+func (s *Service) authenticatePersonalAccessToken(ctx context.Context, token string) (PersonalAccessToken, error) {
+	pat, err := s.store.GetPersonalAccessTokenByHash(ctx, hashToken(token))
+	if err != nil {
+		if errors.Is(err, ErrPersonalAccessTokenNotFound) {
+			return PersonalAccessToken{}, ErrInvalidToken
+		}
+		return PersonalAccessToken{}, err
+	}
+	if pat.RevokedAt != nil || (pat.ExpiresAt != nil && time.Now().After(*pat.ExpiresAt)) {
+		return PersonalAccessToken{}, ErrInvalidToken
+	}
+
+	if err = s.store.MarkPersonalAccessTokenUsed(ctx, pat.Id, time.Now().UTC()); err != nil {
+		slog.WarnContext(ctx, "unable to update last use of personal access token", "access_token_id", pat.Id, "error", err)
+	}
+	return pat, nil
+}
+
+// Credential - who is making a request and what they are allowed to do
+type Credential struct {
+	PersonId int
+	// SessionId is empty when authenticated with a personal access token
+	SessionId           string
+	PersonalAccessToken *PersonalAccessToken
+}
+
+// HasScope - sessions have every scope
+func (c Credential) HasScope(scope Scope) bool {
+	if c.PersonalAccessToken == nil {
+		return true
+	}
+	for _, s := range c.PersonalAccessToken.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// IsGroupRestricted - whether the credential only works on some of the groups of the person
+func (c Credential) IsGroupRestricted() bool {
+	return c.PersonalAccessToken != nil && len(c.PersonalAccessToken.GroupIds) > 0
+}
+
+// CanAccessGroup - group membership is checked separately: this only applies the restriction of the token
+func (c Credential) CanAccessGroup(groupId int) bool {
+	if !c.IsGroupRestricted() {
+		return true
+	}
+	for _, id := range c.PersonalAccessToken.GroupIds {
+		if id == groupId {
+			return true
+		}
+	}
+	return false
+}
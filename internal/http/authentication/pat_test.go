@@ -0,0 +1,92 @@
+//go:build unit
+
+package authentication
+
+import (
+	"context"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestParseScopes(t *testing.T) {
+	scopes, err := ParseScopes([]string{"read", " write:expenses"})
+	require.NoError(t, err)
+	assert.Equal(t, []Scope{ScopeRead, ScopeWriteExpenses}, scopes)
+
+	_, err = ParseScopes(nil)
+	assert.ErrorIs(t, err, ErrInvalidScope)
+	_, err = ParseScopes([]string{"read", "admin"})
+	assert.ErrorIs(t, err, ErrInvalidScope)
+}
+
+func TestPersonalAccessTokenIsStoredHashed(t *testing.T) {
+	s, store := newTestService(t)
+	ctx := context.Background()
+
+	_, _, err := s.CreatePersonalAccessToken(ctx, 1, " ", []Scope{ScopeRead}, nil, nil)
+	assert.ErrorIs(t, err, ErrInvalidTokenName)
+	past := time.Now().Add(-time.Hour)
+	_, _, err = s.CreatePersonalAccessToken(ctx, 1, "bot", []Scope{ScopeRead}, nil, &past)
+	assert.ErrorIs(t, err, ErrPersonalAccessTokenExpiresAt)
+
+	token, pat, err := s.CreatePersonalAccessToken(ctx, 1, "bot", []Scope{ScopeRead}, nil, nil)
+	require.NoError(t, err)
+	assert.Contains(t, token, PersonalAccessTokenPrefix)
+	assert.NotContains(t, store.personalAccessTokens[0].TokenHash, token)
+	assert.Equal(t, hashToken(token), pat.TokenHash)
+
+	got, err := s.authenticatePersonalAccessToken(ctx, token)
+	require.NoError(t, err)
+	assert.Equal(t, pat.Id, got.Id)
+	assert.NotNil(t, store.personalAccessTokens[0].LastUsedAt)
+
+	assert.ErrorIs(t, s.RevokePersonalAccessToken(ctx, 2, pat.Id), ErrPersonalAccessTokenNotFound, "only the owner can revoke")
+	require.NoError(t, s.RevokePersonalAccessToken(ctx, 1, pat.Id))
+	_, err = s.authenticatePersonalAccessToken(ctx, token)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+}
+
+func TestMiddlewareEnforcesScopesAndGroups(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	s, _ := newTestService(t)
+	ctx := context.Background()
+
+	readOnly, _, err := s.CreatePersonalAccessToken(ctx, 1, "read", []Scope{ScopeRead}, nil, nil)
+	require.NoError(t, err)
+	groupWriter, _, err := s.CreatePersonalAccessToken(ctx, 1, "write", []Scope{ScopeRead, ScopeWriteExpenses}, []int{7}, nil)
+	require.NoError(t, err)
+	session, err := s.Login(ctx, 1)
+	require.NoError(t, err)
+
+	router := gin.New()
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+	router.GET("/profile", s.AuthenticateMiddleware(), ok)
+	router.GET("/group/:groupId", s.AuthenticateMiddleware(ScopeRead), ok)
+	router.POST("/group/:groupId/expense", s.AuthenticateMiddleware(ScopeWriteExpenses), ok)
+
+	for _, tc := range []struct {
+		method string
+		path   string
+		token  string
+		status int
+	}{
+		{http.MethodGet, "/profile", session.AccessToken, http.StatusOK},
+		{http.MethodGet, "/profile", readOnly, http.StatusForbidden},
+		{http.MethodGet, "/group/3", readOnly, http.StatusOK},
+		{http.MethodPost, "/group/3/expense", readOnly, http.StatusForbidden},
+		{http.MethodPost, "/group/7/expense", groupWriter, http.StatusOK},
+		{http.MethodPost, "/group/3/expense", groupWriter, http.StatusForbidden},
+		{http.MethodGet, "/group/3", PersonalAccessTokenPrefix + "unknown", http.StatusUnauthorized},
+	} {
+		req := httptest.NewRequest(tc.method, tc.path, nil)
+		req.Header.Set("Authorization", "Bearer "+tc.token)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		assert.Equal(t, tc.status, rr.Code, "%s %s", tc.method, tc.path)
+	}
+}
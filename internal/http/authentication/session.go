@@ -0,0 +1,263 @@
+package authentication
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/antoniobelotti/splid_backend_clone/internal/apperror"
+	"github.com/antoniobelotti/splid_backend_clone/internal/tracing"
+	"go.opentelemetry.io/otel"
+	"time"
+)
+
+var tracer = otel.Tracer("github.com/antoniobelotti/splid_backend_clone/internal/http/authentication")
+
+// Session - a login on one device. Access tokens carry the session id so that revoking the session invalidates them.
+type Session struct {
+	Id        string     `json:"id" db:"id"`
+	PersonId  int        `json:"person-id" db:"person_id"`
+	CreatedAt time.Time  `json:"created-at" db:"created_at"`
+	RevokedAt *time.Time `json:"revoked-at,omitempty" db:"revoked_at"`
+}
+
+// RefreshToken - only the sha256 hash of the token is stored. Every refresh token can be used once: using it returns
+// a new one. Presenting an already used token means it was stolen, so the whole session is revoked.
+type RefreshToken struct {
+	TokenHash string     `db:"token_hash"`
+	SessionId string     `db:"session_id"`
+	CreatedAt time.Time  `db:"created_at"`
+	ExpiresAt time.Time  `db:"expires_at"`
+	UsedAt    *time.Time `db:"used_at"`
+}
+
+type Store interface {
+	CreateSession(ctx context.Context, s Session) error
+	GetSessionById(ctx context.Context, sessionId string) (Session, error)
+	RevokeSession(ctx context.Context, sessionId string) error
+	RevokeAllSessionsOfPerson(ctx context.Context, personId int) error
+	CreateRefreshToken(ctx context.Context, rt RefreshToken) error
+	GetRefreshTokenByHash(ctx context.Context, tokenHash string) (RefreshToken, error)
+	// MarkRefreshTokenUsed returns false if the token had already been used
+	MarkRefreshTokenUsed(ctx context.Context, tokenHash string) (bool, error)
+	CreatePersonalAccessToken(ctx context.Context, t PersonalAccessToken) (int, error)
+	GetPersonalAccessTokensByPersonId(ctx context.Context, personId int) ([]PersonalAccessToken, error)
+	GetPersonalAccessTokenByHash(ctx context.Context, tokenHash string) (PersonalAccessToken, error)
+	// RevokePersonalAccessToken returns ErrPersonalAccessTokenNotFound if the person has no token with that id
+	RevokePersonalAccessToken(ctx context.Context, personId int, tokenId int) error
+	MarkPersonalAccessTokenUsed(ctx context.Context, tokenId int, at time.Time) error
+}
+
+// RefreshTokenTTL - a session that is not refreshed for this long expires
+const RefreshTokenTTL = 30 * 24 * time.Hour
+
+var (
+	ErrSessionNotFound      = apperror.New(apperror.Unauthorized, "session_not_found", "session not found")
+	ErrSessionRevoked       = apperror.New(apperror.Unauthorized, "session_revoked", "session revoked")
+	ErrInvalidRefreshToken  = apperror.New(apperror.Unauthorized, "invalid_refresh_token", "invalid refresh token")
+	ErrRefreshTokenReused   = apperror.New(apperror.Unauthorized, "refresh_token_reused", "refresh token already used: session revoked")
+	ErrRefreshTokenNotFound = apperror.New(apperror.Unauthorized, "refresh_token_not_found", "refresh token not found")
+	ErrUnexpected           = apperror.New(apperror.Internal, "unexpected_error", "unexpected error")
+)
+
+// Tokens - credentials returned on login and refresh
+type Tokens struct {
+	AccessToken  string
+	RefreshToken string
+	ExpiresAt    time.Time
+}
+
+type Service struct {
+	store Store
+	keys  *KeyManager
+	guard *LoginGuard
+	oidc  *Oidc
+}
+
+func NewService(store Store, keys *KeyManager, guard *LoginGuard) Service {
+	return Service{store: store, keys: keys, guard: guard}
+}
+
+// ReserveLoginAttempt returns how long the client has to wait before trying to log in again. When it is zero the
+// credentials can be checked, and the outcome must then be recorded with CompleteLoginAttempt or ReleaseLoginAttempt.
+func (s *Service) ReserveLoginAttempt(ctx context.Context, a LoginAttempt) (attemptId int, retryAfter time.Duration, err error) {
+	ctx, span := tracer.Start(ctx, "authentication.ReserveLoginAttempt")
+	defer func() { tracing.End(span, err) }()
+
+	return s.guard.Reserve(ctx, a)
+}
+
+// CompleteLoginAttempt stores the outcome of a reserved login attempt for throttling and auditing
+func (s *Service) CompleteLoginAttempt(ctx context.Context, attemptId int, succeeded bool) (err error) {
+	ctx, span := tracer.Start(ctx, "authentication.CompleteLoginAttempt")
+	defer func() { tracing.End(span, err) }()
+
+	return s.guard.Complete(ctx, attemptId, succeeded)
+}
+
+// ReleaseLoginAttempt forgets a reserved login attempt that was neither a success nor a failure
+func (s *Service) ReleaseLoginAttempt(ctx context.Context, attemptId int) (err error) {
+	ctx, span := tracer.Start(ctx, "authentication.ReleaseLoginAttempt")
+	defer func() { tracing.End(span, err) }()
+
+	return s.guard.Release(ctx, attemptId)
+}
+
+// Challenge - returned instead of Tokens when the password is correct but a second factor is required
+type Challenge struct {
+	Token     string
+	ExpiresAt time.Time
+}
+
+// NewChallenge starts a two-step login for the person, whose password must have already been verified
+func (s *Service) NewChallenge(personId int) (Challenge, error) {
+	token, expiresAt, err := s.keys.GetChallengeToken(personId)
+	if err != nil {
+		return Challenge{}, fmt.Errorf("%w %w", ErrUnexpected, err)
+	}
+	return Challenge{Token: token, ExpiresAt: expiresAt}, nil
+}
+
+// ResolveChallenge returns the person a challenge token was issued to
+func (s *Service) ResolveChallenge(challengeToken string) (int, error) {
+	return s.keys.ParseChallengeToken(challengeToken)
+}
+
+// JWKS - public keys other services can use to verify our access tokens
+func (s *Service) JWKS() JWKS {
+	return s.keys.JWKS()
+}
+
+func randomToken(size int) (string, error) {
+	b := make([]byte, size)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func hashToken(token string) string {
+	h := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(h[:])
+}
+
+// Login opens a new session for the person, whose credentials must have already been verified
+func (s *Service) Login(ctx context.Context, personId int) (_ Tokens, err error) {
+	ctx, span := tracer.Start(ctx, "authentication.Login")
+	defer func() { tracing.End(span, err) }()
+
+	sessionId, err := randomToken(16)
+	if err != nil {
+		return Tokens{}, fmt.Errorf("%w %w", ErrUnexpected, err)
+	}
+
+	if err = s.store.CreateSession(ctx, Session{
+		Id:        sessionId,
+		PersonId:  personId,
+		CreatedAt: time.Now().UTC(),
+	}); err != nil {
+		return Tokens{}, fmt.Errorf("%w %w", ErrUnexpected, err)
+	}
+
+	return s.issueTokens(ctx, personId, sessionId)
+}
+
+func (s *Service) issueTokens(ctx context.Context, personId int, sessionId string) (Tokens, error) {
+	accessToken, err := s.keys.GetJwtToken(personId, sessionId)
+	if err != nil {
+		return Tokens{}, fmt.Errorf("%w %w", ErrUnexpected, err)
+	}
+
+	refreshToken, err := randomToken(32)
+	if err != nil {
+		return Tokens{}, fmt.Errorf("%w %w", ErrUnexpected, err)
+	}
+	now := time.Now().UTC()
+	if err = s.store.CreateRefreshToken(ctx, RefreshToken{
+		TokenHash: hashToken(refreshToken),
+		SessionId: sessionId,
+		CreatedAt: now,
+		ExpiresAt: now.Add(RefreshTokenTTL),
+	}); err != nil {
+		return Tokens{}, fmt.Errorf("%w %w", ErrUnexpected, err)
+	}
+
+	return Tokens{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		ExpiresAt:    now.Add(AccessTokenTTL),
+	}, nil
+}
+
+// Refresh exchanges a refresh token for a new access token and a new refresh token
+func (s *Service) Refresh(ctx context.Context, refreshToken string) (_ Tokens, err error) {
+	ctx, span := tracer.Start(ctx, "authentication.Refresh")
+	defer func() { tracing.End(span, err) }()
+
+	rt, err := s.store.GetRefreshTokenByHash(ctx, hashToken(refreshToken))
+	if err != nil {
+		if errors.Is(err, ErrRefreshTokenNotFound) {
+			return Tokens{}, ErrInvalidRefreshToken
+		}
+		return Tokens{}, fmt.Errorf("%w %w", ErrUnexpected, err)
+	}
+
+	session, err := s.store.GetSessionById(ctx, rt.SessionId)
+	if err != nil {
+		return Tokens{}, fmt.Errorf("%w %w", ErrUnexpected, err)
+	}
+	if session.RevokedAt != nil {
+		return Tokens{}, ErrInvalidRefreshToken
+	}
+
+	firstUse, err := s.store.MarkRefreshTokenUsed(ctx, rt.TokenHash)
+	if err != nil {
+		return Tokens{}, fmt.Errorf("%w %w", ErrUnexpected, err)
+	}
+	if !firstUse {
+		if err = s.store.RevokeSession(ctx, session.Id); err != nil {
+			return Tokens{}, fmt.Errorf("%w %w", ErrUnexpected, err)
+		}
+		return Tokens{}, ErrRefreshTokenReused
+	}
+
+	if time.Now().After(rt.ExpiresAt) {
+		return Tokens{}, ErrInvalidRefreshToken
+	}
+
+	return s.issueTokens(ctx, session.PersonId, session.Id)
+}
+
+// Logout revokes a single session
+func (s *Service) Logout(ctx context.Context, sessionId string) (err error) {
+	ctx, span := tracer.Start(ctx, "authentication.Logout")
+	defer func() { tracing.End(span, err) }()
+
+	return s.store.RevokeSession(ctx, sessionId)
+}
+
+// LogoutAll revokes every session of the person, on every device
+func (s *Service) LogoutAll(ctx context.Context, personId int) (err error) {
+	ctx, span := tracer.Start(ctx, "authentication.LogoutAll")
+	defer func() { tracing.End(span, err) }()
+
+	return s.store.RevokeAllSessionsOfPerson(ctx, personId)
+}
+
+// IsSessionActive - false if the session has been revoked
+func (s *Service) IsSessionActive(ctx context.Context, sessionId string) (_ bool, err error) {
+	ctx, span := tracer.Start(ctx, "authentication.IsSessionActive")
+	defer func() { tracing.End(span, err) }()
+
+	session, err := s.store.GetSessionById(ctx, sessionId)
+	if err != nil {
+		if errors.Is(err, ErrSessionNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+	return session.RevokedAt == nil, nil
+}
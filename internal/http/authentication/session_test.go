@@ -0,0 +1,205 @@
+//go:build unit
+
+package authentication
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+type fakeStore struct {
+	sessions             map[string]Session
+	refreshTokens        map[string]RefreshToken
+	personalAccessTokens []PersonalAccessToken
+}
+
+func newFakeStore() *fakeStore {
+	return &fakeStore{sessions: map[string]Session{}, refreshTokens: map[string]RefreshToken{}}
+}
+
+func (f *fakeStore) CreateSession(_ context.Context, s Session) error {
+	f.sessions[s.Id] = s
+	return nil
+}
+
+func (f *fakeStore) GetSessionById(_ context.Context, sessionId string) (Session, error) {
+	s, ok := f.sessions[sessionId]
+	if !ok {
+		return Session{}, ErrSessionNotFound
+	}
+	return s, nil
+}
+
+func (f *fakeStore) RevokeSession(_ context.Context, sessionId string) error {
+	s := f.sessions[sessionId]
+	now := time.Now()
+	s.RevokedAt = &now
+	f.sessions[sessionId] = s
+	return nil
+}
+
+func (f *fakeStore) RevokeAllSessionsOfPerson(ctx context.Context, personId int) error {
+	for id, s := range f.sessions {
+		if s.PersonId == personId {
+			_ = f.RevokeSession(ctx, id)
+		}
+	}
+	return nil
+}
+
+func (f *fakeStore) CreateRefreshToken(_ context.Context, rt RefreshToken) error {
+	f.refreshTokens[rt.TokenHash] = rt
+	return nil
+}
+
+func (f *fakeStore) GetRefreshTokenByHash(_ context.Context, tokenHash string) (RefreshToken, error) {
+	rt, ok := f.refreshTokens[tokenHash]
+	if !ok {
+		return RefreshToken{}, ErrRefreshTokenNotFound
+	}
+	return rt, nil
+}
+
+func (f *fakeStore) MarkRefreshTokenUsed(_ context.Context, tokenHash string) (bool, error) {
+	rt := f.refreshTokens[tokenHash]
+	if rt.UsedAt != nil {
+		return false, nil
+	}
+	now := time.Now()
+	rt.UsedAt = &now
+	f.refreshTokens[tokenHash] = rt
+	return true, nil
+}
+
+func (f *fakeStore) CreatePersonalAccessToken(_ context.Context, t PersonalAccessToken) (int, error) {
+	t.Id = len(f.personalAccessTokens) + 1
+	f.personalAccessTokens = append(f.personalAccessTokens, t)
+	return t.Id, nil
+}
+
+func (f *fakeStore) GetPersonalAccessTokensByPersonId(_ context.Context, personId int) ([]PersonalAccessToken, error) {
+	tokens := []PersonalAccessToken{}
+	for _, t := range f.personalAccessTokens {
+		if t.PersonId == personId {
+			tokens = append(tokens, t)
+		}
+	}
+	return tokens, nil
+}
+
+func (f *fakeStore) GetPersonalAccessTokenByHash(_ context.Context, tokenHash string) (PersonalAccessToken, error) {
+	for _, t := range f.personalAccessTokens {
+		if t.TokenHash == tokenHash {
+			return t, nil
+		}
+	}
+	return PersonalAccessToken{}, ErrPersonalAccessTokenNotFound
+}
+
+func (f *fakeStore) RevokePersonalAccessToken(_ context.Context, personId int, tokenId int) error {
+	for i, t := range f.personalAccessTokens {
+		if t.Id == tokenId && t.PersonId == personId {
+			now := time.Now()
+			f.personalAccessTokens[i].RevokedAt = &now
+			return nil
+		}
+	}
+	return ErrPersonalAccessTokenNotFound
+}
+
+func (f *fakeStore) MarkPersonalAccessTokenUsed(_ context.Context, tokenId int, at time.Time) error {
+	for i, t := range f.personalAccessTokens {
+		if t.Id == tokenId {
+			f.personalAccessTokens[i].LastUsedAt = &at
+		}
+	}
+	return nil
+}
+
+func newTestService(t *testing.T) (Service, *fakeStore) {
+	keys, err := NewEphemeralKeyManager()
+	require.NoError(t, err)
+	store := newFakeStore()
+	guard := NewLoginGuard(NewInMemoryAttemptTracker(time.Hour), DefaultLoginGuardConfig())
+	return NewService(store, keys, guard), store
+}
+
+func TestRefreshRotatesTokens(t *testing.T) {
+	s, _ := newTestService(t)
+	ctx := context.Background()
+
+	login, err := s.Login(ctx, 1)
+	require.NoError(t, err)
+
+	refreshed, err := s.Refresh(ctx, login.RefreshToken)
+	require.NoError(t, err)
+	assert.NotEqual(t, login.RefreshToken, refreshed.RefreshToken)
+
+	claims, err := s.keys.ParseJwtToken(refreshed.AccessToken)
+	require.NoError(t, err)
+	assert.Equal(t, 1, claims.PersonId)
+
+	active, err := s.IsSessionActive(ctx, claims.SessionId)
+	require.NoError(t, err)
+	assert.True(t, active)
+}
+
+func TestRefreshTokenReuseRevokesSession(t *testing.T) {
+	s, _ := newTestService(t)
+	ctx := context.Background()
+
+	login, err := s.Login(ctx, 1)
+	require.NoError(t, err)
+	refreshed, err := s.Refresh(ctx, login.RefreshToken)
+	require.NoError(t, err)
+
+	_, err = s.Refresh(ctx, login.RefreshToken)
+	assert.ErrorIs(t, err, ErrRefreshTokenReused)
+
+	// the legitimate holder of the newest token is logged out too
+	_, err = s.Refresh(ctx, refreshed.RefreshToken)
+	assert.ErrorIs(t, err, ErrInvalidRefreshToken)
+
+	claims, err := s.keys.ParseJwtToken(refreshed.AccessToken)
+	require.NoError(t, err)
+	active, err := s.IsSessionActive(ctx, claims.SessionId)
+	require.NoError(t, err)
+	assert.False(t, active)
+}
+
+func TestRefreshRejectsExpiredAndUnknownTokens(t *testing.T) {
+	s, store := newTestService(t)
+	ctx := context.Background()
+
+	_, err := s.Refresh(ctx, "not-a-token")
+	assert.ErrorIs(t, err, ErrInvalidRefreshToken)
+
+	login, err := s.Login(ctx, 1)
+	require.NoError(t, err)
+	rt := store.refreshTokens[hashToken(login.RefreshToken)]
+	rt.ExpiresAt = time.Now().Add(-time.Minute)
+	store.refreshTokens[rt.TokenHash] = rt
+
+	_, err = s.Refresh(ctx, login.RefreshToken)
+	assert.ErrorIs(t, err, ErrInvalidRefreshToken)
+}
+
+func TestLogoutAllRevokesEverySession(t *testing.T) {
+	s, store := newTestService(t)
+	ctx := context.Background()
+
+	_, err := s.Login(ctx, 1)
+	require.NoError(t, err)
+	_, err = s.Login(ctx, 1)
+	require.NoError(t, err)
+	_, err = s.Login(ctx, 2)
+	require.NoError(t, err)
+
+	require.NoError(t, s.LogoutAll(ctx, 1))
+	for _, session := range store.sessions {
+		assert.Equal(t, session.PersonId == 1, session.RevokedAt != nil)
+	}
+}
@@ -2,8 +2,10 @@ package http
 
 import (
 	"github.com/antoniobelotti/splid_backend_clone/internal/expense"
+	"github.com/antoniobelotti/splid_backend_clone/internal/http/problem"
 	"github.com/gin-gonic/gin"
 	"net/http"
+	"strconv"
 )
 
 type ExpenseHandlers struct {
@@ -15,26 +17,53 @@ func NewExpenseHandlers(es expense.Service) ExpenseHandlers {
 }
 
 type CreateExpenseRequestBody struct {
-	AmountInCents int `json:"amount-in-cents"`
-	GroupId       int `json:"group-id"`
+	AmountInCents int                  `json:"amount-in-cents" binding:"required,gt=0"`
+	GroupId       int                  `json:"group-id" binding:"required,gt=0"`
+	Itemization   *expense.Itemization `json:"itemization,omitempty"`
+	Payers        []expense.Payer      `json:"payers,omitempty"`
 }
 
 func (h *ExpenseHandlers) handleCreateExpense(ctx *gin.Context) {
 	requestBody := CreateExpenseRequestBody{}
 
 	if err := ctx.ShouldBindJSON(&requestBody); err != nil {
-		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "malformed request body"})
+		problem.AbortWithBindingError(ctx, err)
+		return
+	}
+	if !requireGroupAccess(ctx, requestBody.GroupId) {
 		return
 	}
 
 	personId := ctx.GetInt("PersonId")
 
-	e, err := h.service.CreateExpense(ctx, requestBody.AmountInCents, personId, requestBody.GroupId)
+	e, err := h.service.CreateDetailedExpense(ctx, expense.Expense{
+		AmountInCents: requestBody.AmountInCents,
+		PersonId:      personId,
+		GroupId:       requestBody.GroupId,
+		Itemization:   requestBody.Itemization,
+		Payers:        requestBody.Payers,
+	})
 	if err != nil {
-		ctx.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "malformed request body"})
+		problem.AbortWithError(ctx, err)
 		return
 	}
 
 	ctx.JSON(http.StatusCreated, e)
 	return
 }
+
+func (h *ExpenseHandlers) handleDeleteExpense(ctx *gin.Context) {
+	expenseId, err := strconv.Atoi(ctx.Param("expenseId"))
+	if err != nil {
+		problem.Abort(ctx, problem.Invalid("expenseId", "must be an integer"))
+		return
+	}
+
+	err = h.service.DeleteExpense(ctx, expenseId, ctx.GetInt("PersonId"))
+	if err != nil {
+		problem.AbortWithError(ctx, err)
+		return
+	}
+
+	ctx.Status(http.StatusNoContent)
+}
@@ -0,0 +1,39 @@
+package http
+
+import (
+	"github.com/antoniobelotti/splid_backend_clone/internal/graphql"
+	"github.com/antoniobelotti/splid_backend_clone/internal/http/authentication"
+	"github.com/antoniobelotti/splid_backend_clone/internal/http/problem"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+type GraphQLHandlers struct {
+	schema graphql.Schema
+}
+
+func NewGraphQLHandlers(schema graphql.Schema) GraphQLHandlers {
+	return GraphQLHandlers{schema: schema}
+}
+
+type GraphQLRequestBody struct {
+	Query         string         `json:"query" binding:"required"`
+	OperationName string         `json:"operationName"`
+	Variables     map[string]any `json:"variables"`
+}
+
+// handleGraphQL - as usual for GraphQL, errors of the query are reported in the response body with status 200.
+// Only requests that are not GraphQL requests at all get a problem.
+func (h *GraphQLHandlers) handleGraphQL(ctx *gin.Context) {
+	requestBody := GraphQLRequestBody{}
+
+	if err := ctx.ShouldBindJSON(&requestBody); err != nil {
+		problem.AbortWithBindingError(ctx, err)
+		return
+	}
+
+	// the request context, unlike gin's, is cancelled when the client goes away
+	response := h.schema.Exec(ctx.Request.Context(), authentication.GetCredential(ctx),
+		requestBody.Query, requestBody.OperationName, requestBody.Variables)
+	ctx.JSON(http.StatusOK, response)
+}
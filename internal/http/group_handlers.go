@@ -1,8 +1,8 @@
 package http
 
 import (
-	"errors"
 	"github.com/antoniobelotti/splid_backend_clone/internal/group"
+	"github.com/antoniobelotti/splid_backend_clone/internal/http/problem"
 	"github.com/gin-gonic/gin"
 	"net/http"
 	"strconv"
@@ -26,14 +26,14 @@ func (h *GroupHandlers) handleCreateGroup(ctx *gin.Context) {
 	requestBody := CreateGroupRequestBody{}
 
 	if err := ctx.ShouldBindJSON(&requestBody); err != nil {
-		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "malformed request body"})
+		problem.AbortWithBindingError(ctx, err)
 		return
 	}
 
 	ownerIdStr := ctx.GetInt("PersonId")
 	g, err := h.service.CreateGroup(ctx, requestBody.Name, ownerIdStr)
 	if err != nil {
-		ctx.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "cannot create group"})
+		problem.AbortWithError(ctx, err)
 		return
 	}
 
@@ -41,50 +41,39 @@ func (h *GroupHandlers) handleCreateGroup(ctx *gin.Context) {
 	return
 }
 
+type JoinGroupResponseBody struct {
+	Message string `json:"message"`
+}
+
 func (h *GroupHandlers) handleJoinGroup(ctx *gin.Context) {
 	personId := ctx.GetInt("PersonId")
 
 	groupId, err := strconv.Atoi(ctx.Param("groupId"))
 	if err != nil {
-		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "malformed group id"})
+		problem.Abort(ctx, problem.Invalid("groupId", "must be an integer"))
 		return
 	}
 	requestInvitationCode := ctx.Query("invitationCode")
 
-	g, err := h.service.GetGroupById(ctx, groupId)
-	if err != nil {
-		if errors.Is(err, group.ErrGroupNotFound) {
-			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "the group you are trying to join does not exist"})
-			return
-		}
-		ctx.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
-		return
-	}
-
-	// request has wrong invitation code
-	if g.InvitationCode != requestInvitationCode {
-		ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
-		return
-	}
-
-	err = h.service.AddPersonToGroup(ctx, g, personId)
-	if err != nil {
+	if _, err = h.service.JoinGroup(ctx, groupId, requestInvitationCode, personId); err != nil {
+		problem.AbortWithError(ctx, err)
 		return
 	}
 
-	ctx.JSON(http.StatusOK, gin.H{"message": "successfully joined group"})
+	ctx.JSON(http.StatusOK, JoinGroupResponseBody{Message: "successfully joined group"})
 	return
 }
 
 func (h *GroupHandlers) handleGetBalance(ctx *gin.Context) {
 	groupId, err := strconv.Atoi(ctx.Param("groupId"))
 	if err != nil {
-		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "malformed group id"})
+		problem.Abort(ctx, problem.Invalid("groupId", "must be an integer"))
 		return
 	}
 	balance, err := h.service.GetGroupBalance(ctx, groupId)
 	if err != nil {
-		//todo
+		problem.AbortWithError(ctx, err)
+		return
 	}
 	ctx.JSON(http.StatusOK, balance)
 }
@@ -92,7 +81,7 @@ func (h *GroupHandlers) handleGetBalance(ctx *gin.Context) {
 func (h *GroupHandlers) handleGetOpsEvenBalance(ctx *gin.Context) {
 	groupId, err := strconv.Atoi(ctx.Param("groupId"))
 	if err != nil {
-		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "malformed group id"})
+		problem.Abort(ctx, problem.Invalid("groupId", "must be an integer"))
 		return
 	}
 
@@ -100,6 +89,10 @@ func (h *GroupHandlers) handleGetOpsEvenBalance(ctx *gin.Context) {
 	// because they are not actually made by the users.
 	// These are the SUGGESTED transfers to even out the balance
 	ops, err := h.service.GetOpsEvenBalance(ctx, groupId)
+	if err != nil {
+		problem.AbortWithError(ctx, err)
+		return
+	}
 
 	// it works as long as groupId and id have omitempty tag in transfer.Transfer
 	ctx.JSON(http.StatusOK, ops)
@@ -0,0 +1,45 @@
+package http
+
+import (
+	"github.com/antoniobelotti/splid_backend_clone/internal/buildinfo"
+	"github.com/antoniobelotti/splid_backend_clone/internal/health"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+// probePaths - polled every few seconds by the orchestrator and the metrics scraper, not worth a log line nor a span
+// each
+var probePaths = []string{"/healthz", "/readyz", "/metrics"}
+
+type HealthHandlers struct {
+	checker *health.Checker
+}
+
+func NewHealthHandlers(checker *health.Checker) HealthHandlers {
+	return HealthHandlers{checker: checker}
+}
+
+type LivenessResponseBody struct {
+	Status string `json:"status"`
+}
+
+// handleGetLiveness - answering at all is the proof of life. Dependencies are left to the readiness check: restarting
+// the server would not fix them.
+func (h *HealthHandlers) handleGetLiveness(ctx *gin.Context) {
+	ctx.Header("Cache-Control", "no-store")
+	ctx.JSON(http.StatusOK, LivenessResponseBody{Status: health.StatusOk})
+}
+
+func (h *HealthHandlers) handleGetReadiness(ctx *gin.Context) {
+	report := h.checker.Run(ctx.Request.Context())
+	status := http.StatusOK
+	if !report.IsReady() {
+		status = http.StatusServiceUnavailable
+	}
+	ctx.Header("Cache-Control", "no-store")
+	ctx.JSON(status, report)
+}
+
+func (h *HealthHandlers) handleGetVersion(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, buildinfo.Get())
+}
@@ -0,0 +1,61 @@
+//go:build unit
+
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/antoniobelotti/splid_backend_clone/internal/buildinfo"
+	"github.com/antoniobelotti/splid_backend_clone/internal/health"
+	"github.com/antoniobelotti/splid_backend_clone/migrations"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func get(server RESTServer, path string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+	return w
+}
+
+func TestLiveness(t *testing.T) {
+	checker := health.NewChecker(0)
+	checker.Register("database", func(context.Context) error { return errors.New("down") })
+
+	w := get(newTestServer(Dependencies{Checker: checker}), "/healthz")
+	assert.Equal(t, http.StatusOK, w.Code, "failing dependencies are not a reason to restart")
+	assert.JSONEq(t, `{"status": "ok"}`, w.Body.String())
+}
+
+func TestReadiness(t *testing.T) {
+	checker := health.NewChecker(0)
+	checker.Register("database", func(context.Context) error { return nil })
+	server := newTestServer(Dependencies{Checker: checker})
+
+	w := get(server, "/readyz")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+
+	checker.Register("event-dispatcher", func(context.Context) error { return errors.New("not started") })
+	w = get(server, "/readyz")
+	require.Equal(t, http.StatusServiceUnavailable, w.Code)
+	var report health.Report
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &report))
+	assert.Equal(t, health.StatusUnavailable, report.Status)
+	assert.Contains(t, report.Checks, health.CheckResult{Name: "event-dispatcher", Status: health.StatusUnavailable, Error: "not started"})
+}
+
+func TestVersion(t *testing.T) {
+	w := get(newTestServer(Dependencies{}), "/version")
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var info buildinfo.Info
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &info))
+	assert.NotEmpty(t, info.Commit)
+	assert.NotZero(t, info.SchemaVersion)
+	assert.Equal(t, migrations.LatestVersion(), info.SchemaVersion)
+}
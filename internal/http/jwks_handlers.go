@@ -0,0 +1,24 @@
+package http
+
+import (
+	"github.com/antoniobelotti/splid_backend_clone/internal/http/authentication"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+type JwksHandlers struct {
+	authService authentication.Service
+}
+
+func NewJwksHandlers(authService authentication.Service) JwksHandlers {
+	return JwksHandlers{
+		authService: authService,
+	}
+}
+
+// handleGetJwks publishes the public keys verifying our access tokens. Verifiers may cache the set for a few minutes
+// and should refetch it when they see an unknown kid.
+func (h *JwksHandlers) handleGetJwks(ctx *gin.Context) {
+	ctx.Header("Cache-Control", "public, max-age=300")
+	ctx.JSON(http.StatusOK, h.authService.JWKS())
+}
@@ -0,0 +1,63 @@
+package http
+
+import (
+	"github.com/antoniobelotti/splid_backend_clone/internal/logging"
+	"github.com/gin-gonic/gin"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// RequestIdHeader - the request id is read from it when the client, or a proxy in front of the server, sends one,
+// and always sent back in it
+const RequestIdHeader = "X-Request-Id"
+
+// assignRequestId puts the request id in the context of the request, for the services and the stores called with it
+// to log it. The router must have ContextWithFallback set, for the gin context to expose it.
+func assignRequestId(ctx *gin.Context) {
+	id := ctx.GetHeader(RequestIdHeader)
+	if !logging.IsValidRequestId(id) {
+		id = logging.NewRequestId()
+	}
+	ctx.Request = ctx.Request.WithContext(logging.WithRequestId(ctx.Request.Context(), id))
+	ctx.Header(RequestIdHeader, id)
+	ctx.Next()
+}
+
+// logRequests logs a line per request, except for those to skipPaths. The errors attached to the context are logged
+// with it, server errors at the error level.
+func logRequests(skipPaths ...string) gin.HandlerFunc {
+	skip := make(map[string]bool, len(skipPaths))
+	for _, path := range skipPaths {
+		skip[path] = true
+	}
+
+	return func(ctx *gin.Context) {
+		start := time.Now()
+		path := ctx.Request.URL.Path
+		ctx.Next()
+		if skip[path] {
+			return
+		}
+
+		status := ctx.Writer.Status()
+		attrs := []slog.Attr{
+			slog.String("method", ctx.Request.Method),
+			slog.String("route", ctx.FullPath()),
+			slog.String("path", path),
+			slog.Int("status", status),
+			slog.Duration("duration", time.Since(start)),
+			slog.String("client_ip", ctx.ClientIP()),
+			slog.Int("response_bytes", ctx.Writer.Size()),
+		}
+		if len(ctx.Errors) > 0 {
+			attrs = append(attrs, slog.Any("errors", ctx.Errors.Errors()))
+		}
+
+		level := slog.LevelInfo
+		if status >= http.StatusInternalServerError {
+			level = slog.LevelError
+		}
+		slog.LogAttrs(ctx.Request.Context(), level, "request", attrs...)
+	}
+}
@@ -0,0 +1,101 @@
+//go:build unit
+
+package http
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/antoniobelotti/splid_backend_clone/internal/logging"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// captureLogs makes the default logger write to the returned buffer for the duration of the test
+func captureLogs(t *testing.T) *bytes.Buffer {
+	var buf bytes.Buffer
+	previous := slog.Default()
+	slog.SetDefault(logging.New(&buf, slog.LevelInfo))
+	t.Cleanup(func() { slog.SetDefault(previous) })
+	return &buf
+}
+
+func records(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	var result []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var record map[string]any
+		require.NoError(t, json.Unmarshal([]byte(line), &record))
+		result = append(result, record)
+	}
+	return result
+}
+
+func newLoggingTestRouter(handler gin.HandlerFunc) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.ContextWithFallback = true
+	router.Use(assignRequestId, logRequests("/healthz"))
+	router.GET("/things/:id", handler)
+	router.GET("/healthz", func(ctx *gin.Context) { ctx.Status(http.StatusOK) })
+	return router
+}
+
+func TestRequestIdReachesTheServices(t *testing.T) {
+	logs := captureLogs(t)
+	router := newLoggingTestRouter(func(ctx *gin.Context) {
+		// what a service does with the context the handler passes to it
+		slog.InfoContext(ctx, "in the service")
+		ctx.Status(http.StatusOK)
+	})
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/things/1", nil))
+
+	id := w.Header().Get(RequestIdHeader)
+	require.True(t, logging.IsValidRequestId(id))
+	logged := records(t, logs)
+	require.Len(t, logged, 2)
+	assert.Equal(t, id, logged[0][logging.RequestIdKey])
+	assert.Equal(t, "in the service", logged[0]["msg"])
+	assert.Equal(t, id, logged[1][logging.RequestIdKey])
+	assert.Equal(t, "/things/:id", logged[1]["route"])
+	assert.Equal(t, 200.0, logged[1]["status"])
+}
+
+func TestRequestIdIsTakenFromTheRequest(t *testing.T) {
+	captureLogs(t)
+	router := newLoggingTestRouter(func(ctx *gin.Context) { ctx.Status(http.StatusOK) })
+
+	for id, kept := range map[string]bool{"from-the-proxy": true, "forged\"id": false} {
+		req := httptest.NewRequest(http.MethodGet, "/things/1", nil)
+		req.Header.Set(RequestIdHeader, id)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, kept, w.Header().Get(RequestIdHeader) == id, id)
+	}
+}
+
+func TestServerErrorsAreLoggedWithTheRequest(t *testing.T) {
+	logs := captureLogs(t)
+	router := newLoggingTestRouter(func(ctx *gin.Context) {
+		_ = ctx.Error(assert.AnError)
+		ctx.Status(http.StatusInternalServerError)
+	})
+
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/things/1?token=secret", nil))
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/healthz", nil))
+
+	logged := records(t, logs)
+	require.Len(t, logged, 1)
+	assert.Equal(t, "ERROR", logged[0]["level"])
+	assert.Equal(t, []any{assert.AnError.Error()}, logged[0]["errors"])
+	assert.Equal(t, "/things/1", logged[0]["path"])
+}
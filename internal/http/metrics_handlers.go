@@ -0,0 +1,36 @@
+package http
+
+import (
+	"github.com/antoniobelotti/splid_backend_clone/internal/metrics"
+	"github.com/gin-gonic/gin"
+	"time"
+)
+
+// unmatchedRoute - the route label of the requests no route matched, so that scanners cannot create a series per path
+const unmatchedRoute = "unmatched"
+
+// observeRequests - counts and times every request, labelled with the route pattern rather than the path
+func observeRequests(m *metrics.Metrics) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		start := time.Now()
+		ctx.Next()
+
+		route := ctx.FullPath()
+		if route == "" {
+			route = unmatchedRoute
+		}
+		m.ObserveHTTPRequest(route, ctx.Request.Method, ctx.Writer.Status(), time.Since(start))
+	}
+}
+
+type MetricsHandlers struct {
+	metrics *metrics.Metrics
+}
+
+func NewMetricsHandlers(m *metrics.Metrics) MetricsHandlers {
+	return MetricsHandlers{metrics: m}
+}
+
+func (h *MetricsHandlers) handleGetMetrics(ctx *gin.Context) {
+	h.metrics.Handler().ServeHTTP(ctx.Writer, ctx.Request)
+}
@@ -0,0 +1,26 @@
+//go:build unit
+
+package http
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestMetricsAreLabelledByRoute(t *testing.T) {
+	server := newTestServer(Dependencies{})
+
+	get(server, "/healthz")
+	get(server, "/no/such/path/1")
+	get(server, "/no/such/path/2")
+
+	w := get(server, "/metrics")
+	require.Equal(t, http.StatusOK, w.Code)
+	body := w.Body.String()
+	assert.True(t, strings.Contains(body, `splid_http_requests_total{code="200",method="GET",route="/healthz"} 1`), body)
+	assert.True(t, strings.Contains(body, `splid_http_requests_total{code="404",method="GET",route="unmatched"} 2`), body)
+	assert.False(t, strings.Contains(body, "/no/such/path"))
+}
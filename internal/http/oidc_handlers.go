@@ -0,0 +1,82 @@
+package http
+
+import (
+	"github.com/antoniobelotti/splid_backend_clone/internal/http/authentication"
+	"github.com/antoniobelotti/splid_backend_clone/internal/http/problem"
+	"github.com/antoniobelotti/splid_backend_clone/internal/person"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+type OidcProvidersResponseBody struct {
+	Providers []string `json:"providers"`
+}
+
+func (h *PersonHandlers) handleGetOidcProviders(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, OidcProvidersResponseBody{Providers: h.authService.OidcProviders()})
+}
+
+// handleOidcLogin sends the browser to the identity provider, which redirects back to handleOidcCallback
+func (h *PersonHandlers) handleOidcLogin(ctx *gin.Context) {
+	authorizationUrl, err := h.authService.OidcAuthorizationUrl(ctx, ctx.Param("provider"))
+	if err != nil {
+		problem.AbortWithError(ctx, err)
+		return
+	}
+
+	ctx.Redirect(http.StatusFound, authorizationUrl)
+}
+
+// handleOidcCallback logs in the person linked to the identity the provider vouches for, the same way handleLogin does
+func (h *PersonHandlers) handleOidcCallback(ctx *gin.Context) {
+	if providerError := ctx.Query("error"); providerError != "" {
+		problem.AbortWithStatus(ctx, http.StatusUnauthorized, authentication.ErrOidcLoginFailed.Code, "login refused by the identity provider: "+providerError)
+		return
+	}
+	code, state := ctx.Query("code"), ctx.Query("state")
+	if code == "" {
+		problem.Abort(ctx, problem.Invalid("code", "is required"))
+		return
+	}
+	if state == "" {
+		problem.Abort(ctx, problem.Invalid("state", "is required"))
+		return
+	}
+
+	identity, err := h.authService.OidcExchange(ctx, ctx.Param("provider"), code, state)
+	if err != nil {
+		problem.AbortWithError(ctx, err)
+		return
+	}
+
+	p, err := h.service.LoginWithExternalIdentity(ctx, person.ExternalIdentity{
+		Provider:      identity.Provider,
+		Subject:       identity.Subject,
+		Email:         identity.Email,
+		EmailVerified: identity.EmailVerified,
+		Name:          identity.Name,
+	})
+	if err != nil {
+		problem.AbortWithError(ctx, err)
+		return
+	}
+
+	// the identity provider replaces the password, not our second factor
+	totpEnabled, err := h.service.IsTotpEnabled(ctx, p.Id)
+	if err != nil {
+		problem.AbortWithError(ctx, err)
+		return
+	}
+	if totpEnabled {
+		h.respondWithChallenge(ctx, p.Id)
+		return
+	}
+
+	tokens, err := h.authService.Login(ctx, p.Id)
+	if err != nil {
+		problem.AbortWithError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, newLoginResponseBody(tokens))
+}
@@ -0,0 +1,181 @@
+package openapi
+
+import (
+	"path"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// Schemas - generates the schemas of Go types as encoding/json marshals them. Named structs become components,
+// referenced by the schemas of the types using them. Binding tags become validation keywords.
+type Schemas struct {
+	components map[string]*Schema
+	names      map[reflect.Type]string
+}
+
+func NewSchemas() *Schemas {
+	return &Schemas{components: map[string]*Schema{}, names: map[reflect.Type]string{}}
+}
+
+// Components returns the schemas of the named structs met so far
+func (s *Schemas) Components() map[string]*Schema {
+	return s.components
+}
+
+// Of returns the schema of the type of v
+func (s *Schemas) Of(v any) *Schema {
+	return s.of(reflect.TypeOf(v))
+}
+
+func (s *Schemas) of(t reflect.Type) *Schema {
+	if t == timeType {
+		return &Schema{Type: "string", Format: "date-time"}
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		schema := s.of(t.Elem())
+		if schema.Ref == "" {
+			schema.Nullable = true
+		}
+		return schema
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return &Schema{Type: "integer"}
+	case reflect.Int64, reflect.Uint64:
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte"}
+		}
+		return &Schema{Type: "array", Items: s.of(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: s.of(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return s.structSchema(t)
+		}
+		return &Schema{Ref: "#/components/schemas/" + s.component(t)}
+	default:
+		return &Schema{}
+	}
+}
+
+// component registers the schema of the named struct, and returns its name
+func (s *Schemas) component(t reflect.Type) string {
+	if name, ok := s.names[t]; ok {
+		return name
+	}
+
+	name := t.Name()
+	if _, taken := s.components[name]; taken {
+		pkg := path.Base(t.PkgPath())
+		name = strings.ToUpper(pkg[:1]) + pkg[1:] + name
+	}
+	// registered before its fields, for the recursive types
+	s.names[t] = name
+	s.components[name] = &Schema{}
+	*s.components[name] = *s.structSchema(t)
+	return name
+}
+
+func (s *Schemas) structSchema(t reflect.Type) *Schema {
+	schema := &Schema{Type: "object", Properties: map[string]*Schema{}}
+	s.addFields(schema, t)
+	return schema
+}
+
+func (s *Schemas) addFields(schema *Schema, t reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		jsonTag := field.Tag.Get("json")
+		if jsonTag == "-" {
+			continue
+		}
+		name, options, _ := strings.Cut(jsonTag, ",")
+
+		// encoding/json promotes the fields of embedded structs without a name
+		if field.Anonymous && name == "" {
+			embedded := field.Type
+			if embedded.Kind() == reflect.Pointer {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				s.addFields(schema, embedded)
+				continue
+			}
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		fieldSchema := s.of(field.Type)
+		required := applyBinding(fieldSchema, field.Type, field.Tag.Get("binding"))
+		if options == "string" {
+			fieldSchema = &Schema{Type: "string"}
+		}
+		schema.Properties[name] = fieldSchema
+		if required {
+			schema.Required = append(schema.Required, name)
+		}
+	}
+}
+
+// applyBinding translates the validator rules of gin to validation keywords. Returns whether the field is required.
+func applyBinding(schema *Schema, t reflect.Type, binding string) bool {
+	if binding == "" {
+		return false
+	}
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	required := false
+	for _, rule := range strings.Split(binding, ",") {
+		tag, param, _ := strings.Cut(rule, "=")
+		switch tag {
+		case "required":
+			required = true
+		case "email":
+			schema.Format = "email"
+		case "oneof":
+			schema.Enum = strings.Fields(param)
+		case "min", "max", "gt", "gte", "lte":
+			n, err := strconv.ParseFloat(param, 64)
+			if err != nil {
+				continue
+			}
+			if t.Kind() == reflect.String {
+				length := int(n)
+				if tag == "min" {
+					schema.MinLength = &length
+				} else if tag == "max" {
+					schema.MaxLength = &length
+				}
+				continue
+			}
+			switch tag {
+			case "min", "gte":
+				schema.Minimum = &n
+			case "gt":
+				schema.Minimum = &n
+				schema.ExclusiveMinimum = true
+			case "max", "lte":
+				schema.Maximum = &n
+			}
+		}
+	}
+	return required
+}
@@ -0,0 +1,490 @@
+package http
+
+import (
+	"github.com/antoniobelotti/splid_backend_clone/internal/account"
+	"github.com/antoniobelotti/splid_backend_clone/internal/attachment"
+	"github.com/antoniobelotti/splid_backend_clone/internal/buildinfo"
+	"github.com/antoniobelotti/splid_backend_clone/internal/expense"
+	"github.com/antoniobelotti/splid_backend_clone/internal/group"
+	"github.com/antoniobelotti/splid_backend_clone/internal/health"
+	"github.com/antoniobelotti/splid_backend_clone/internal/http/authentication"
+	"github.com/antoniobelotti/splid_backend_clone/internal/http/openapi"
+	"github.com/antoniobelotti/splid_backend_clone/internal/http/problem"
+	"github.com/antoniobelotti/splid_backend_clone/internal/person"
+	"github.com/antoniobelotti/splid_backend_clone/internal/recurring"
+	"github.com/antoniobelotti/splid_backend_clone/internal/transfer"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	bearerSecurityScheme              = "bearer"
+	personalAccessTokenSecurityScheme = "personalAccessToken"
+)
+
+// apiOperation - what the OpenAPI document says about a route, besides what the route itself tells
+type apiOperation struct {
+	summary string
+	tag     string
+
+	query       []openapi.Parameter
+	requestBody any
+	// multipartFile - the name of the file field of a multipart/form-data request body
+	multipartFile string
+
+	status int
+	// otherStatuses - answered with the same body as status
+	otherStatuses []int
+	// responseBodies - the schema of the response is the oneOf of many bodies
+	responseBodies []any
+	// responseContentType - for responses that are not json
+	responseContentType string
+	responseHeaders     map[string]openapi.Header
+	// errors - the statuses of the problems the route reports, besides the ones every route of its kind reports
+	errors []int
+}
+
+func queryParam(name string, description string, required bool, schema *openapi.Schema) openapi.Parameter {
+	return openapi.Parameter{Name: name, In: "query", Description: description, Required: required, Schema: schema}
+}
+
+var stringSchema = &openapi.Schema{Type: "string"}
+
+var retryAfterHeader = openapi.Header{Description: "seconds to wait before trying again", Schema: &openapi.Schema{Type: "integer"}}
+
+// apiOperations - every route of NewRESTServer, keyed by method and path as registered in gin
+var apiOperations = map[string]apiOperation{
+	"GET /healthz": {
+		summary: "Liveness: whether the server is up", tag: "meta",
+		status: http.StatusOK, responseBodies: []any{LivenessResponseBody{}},
+		responseHeaders: map[string]openapi.Header{"Cache-Control": {Schema: stringSchema}},
+	},
+	"GET /readyz": {
+		summary: "Readiness: whether the database, its schema and the background workers are fine", tag: "meta",
+		status: http.StatusOK, otherStatuses: []int{http.StatusServiceUnavailable}, responseBodies: []any{health.Report{}},
+		responseHeaders: map[string]openapi.Header{"Cache-Control": {Schema: stringSchema}},
+	},
+	"GET /version": {
+		summary: "The commit, build time and database schema version of the running server", tag: "meta",
+		status: http.StatusOK, responseBodies: []any{buildinfo.Info{}},
+	},
+	"GET /metrics": {
+		summary: "Metrics in the Prometheus text format, for the scraper on the internal network", tag: "meta",
+		status: http.StatusOK, responseContentType: "text/plain",
+	},
+	"GET /.well-known/jwks.json": {
+		summary: "Public keys verifying the access tokens", tag: "authentication",
+		status: http.StatusOK, responseBodies: []any{authentication.JWKS{}},
+		responseHeaders: map[string]openapi.Header{"Cache-Control": {Schema: stringSchema}},
+	},
+	"GET /api/v1/openapi.json": {
+		summary: "This document", tag: "meta",
+		// describing the OpenAPI document format itself would add little but noise to this one
+		status: http.StatusOK, responseBodies: []any{map[string]any{}},
+	},
+
+	"POST /api/v1/group": {
+		summary: "Create a group", tag: "group",
+		requestBody: CreateGroupRequestBody{},
+		status:      http.StatusCreated, responseBodies: []any{group.Group{}},
+	},
+	"POST /api/v1/group/:groupId/join": {
+		summary: "Join a group with its invitation code", tag: "group",
+		query:  []openapi.Parameter{queryParam("invitationCode", "", true, stringSchema)},
+		status: http.StatusOK, responseBodies: []any{JoinGroupResponseBody{}},
+		errors: []int{http.StatusNotFound},
+	},
+	"GET /api/v1/group/:groupId/balance": {
+		summary: "Balance of every member of a group, in cents, by person id", tag: "group",
+		status: http.StatusOK, responseBodies: []any{map[string]int{}},
+		errors: []int{http.StatusNotFound},
+	},
+	"GET /api/v1/group/:groupId/operations-to-even-balance": {
+		summary: "Transfers that would even the balance of a group", tag: "group",
+		status: http.StatusOK, responseBodies: []any{[]transfer.Transfer{}},
+		errors: []int{http.StatusNotFound},
+	},
+
+	"POST /api/v1/group/:groupId/recurring-expense": {
+		summary: "Create a recurring expense", tag: "recurring expense",
+		requestBody: CreateRecurringExpenseRequestBody{},
+		status:      http.StatusCreated, responseBodies: []any{recurring.Template{}},
+		errors: []int{http.StatusNotFound},
+	},
+	"GET /api/v1/group/:groupId/recurring-expense": {
+		summary: "Recurring expenses of a group", tag: "recurring expense",
+		status: http.StatusOK, responseBodies: []any{[]recurring.Template{}},
+	},
+	"DELETE /api/v1/group/:groupId/recurring-expense/:recurringExpenseId": {
+		summary: "Stop a recurring expense", tag: "recurring expense",
+		status: http.StatusNoContent,
+		errors: []int{http.StatusNotFound},
+	},
+
+	"POST /api/v1/person/signup": {
+		summary: "Sign up", tag: "person",
+		requestBody: CreatePersonRequestBody{},
+		status:      http.StatusCreated, responseBodies: []any{person.Person{}},
+		errors: []int{http.StatusConflict},
+	},
+	"POST /api/v1/person/login": {
+		summary: "Log in, or start a two factor login", tag: "person",
+		requestBody: LoginRequestBody{},
+		status:      http.StatusOK, responseBodies: []any{LoginResponseBody{}, TwoFactorChallengeResponseBody{}},
+		errors: []int{http.StatusUnauthorized, http.StatusTooManyRequests},
+	},
+	"POST /api/v1/person/login/2fa": {
+		summary: "Complete a two factor login", tag: "person",
+		requestBody: LoginSecondFactorRequestBody{},
+		status:      http.StatusOK, responseBodies: []any{LoginResponseBody{}},
+		errors: []int{http.StatusUnauthorized, http.StatusTooManyRequests},
+	},
+	"POST /api/v1/person/token/refresh": {
+		summary: "Rotate a refresh token", tag: "person",
+		requestBody: RefreshTokenRequestBody{},
+		status:      http.StatusOK, responseBodies: []any{LoginResponseBody{}},
+		errors: []int{http.StatusUnauthorized},
+	},
+	"POST /api/v1/person/logout": {
+		summary: "Revoke the current session", tag: "person",
+		status: http.StatusNoContent,
+	},
+	"POST /api/v1/person/logout-all": {
+		summary: "Revoke every session", tag: "person",
+		status: http.StatusNoContent,
+	},
+	"POST /api/v1/person/password-reset/request": {
+		summary: "Email a password reset link", tag: "person",
+		requestBody: RequestPasswordResetRequestBody{},
+		status:      http.StatusAccepted,
+	},
+	"POST /api/v1/person/password-reset/confirm": {
+		summary: "Reset the password", tag: "person",
+		requestBody: ConfirmPasswordResetRequestBody{},
+		status:      http.StatusNoContent,
+	},
+	"POST /api/v1/person/email-verification/confirm": {
+		summary: "Verify the email", tag: "person",
+		requestBody: VerifyEmailRequestBody{},
+		status:      http.StatusNoContent,
+		errors:      []int{http.StatusConflict},
+	},
+	"POST /api/v1/person/email-verification/resend": {
+		summary: "Send the verification email again", tag: "person",
+		status: http.StatusAccepted,
+		errors: []int{http.StatusConflict, http.StatusTooManyRequests},
+	},
+	"GET /api/v1/person": {
+		summary: "The logged-in person", tag: "person",
+		status: http.StatusOK, responseBodies: []any{person.Person{}},
+	},
+	"PATCH /api/v1/person": {
+		summary: "Update the profile", tag: "person",
+		requestBody: UpdatePersonRequestBody{},
+		status:      http.StatusOK, responseBodies: []any{person.Person{}},
+	},
+	"PUT /api/v1/person/email": {
+		summary: "Change the email", tag: "person",
+		requestBody: ChangeEmailRequestBody{},
+		status:      http.StatusOK, responseBodies: []any{person.Person{}},
+		errors: []int{http.StatusConflict},
+	},
+	"PUT /api/v1/person/password": {
+		summary: "Change the password", tag: "person",
+		requestBody: ChangePasswordRequestBody{},
+		status:      http.StatusNoContent,
+	},
+	"POST /api/v1/person/2fa/totp": {
+		summary: "Start enrolling an authenticator app", tag: "person",
+		status: http.StatusOK, responseBodies: []any{person.TotpEnrollment{}},
+		errors: []int{http.StatusConflict},
+	},
+	"POST /api/v1/person/2fa/totp/confirm": {
+		summary: "Enable two factor authentication", tag: "person",
+		requestBody: ConfirmTotpEnrollmentRequestBody{},
+		status:      http.StatusOK, responseBodies: []any{ConfirmTotpEnrollmentResponseBody{}},
+		errors: []int{http.StatusConflict},
+	},
+	"DELETE /api/v1/person/2fa/totp": {
+		summary: "Disable two factor authentication", tag: "person",
+		requestBody: DisableTotpRequestBody{},
+		status:      http.StatusNoContent,
+		errors:      []int{http.StatusConflict},
+	},
+
+	"GET /api/v1/auth/oidc": {
+		summary: "Names of the configured identity providers", tag: "authentication",
+		status: http.StatusOK, responseBodies: []any{OidcProvidersResponseBody{}},
+	},
+	"GET /api/v1/auth/oidc/:provider/login": {
+		summary: "Log in with an identity provider", tag: "authentication",
+		status:          http.StatusFound,
+		responseHeaders: map[string]openapi.Header{"Location": {Description: "the authorization endpoint of the provider", Schema: stringSchema}},
+		errors:          []int{http.StatusNotFound},
+	},
+	"GET /api/v1/auth/oidc/:provider/callback": {
+		summary: "Where the identity provider redirects back to", tag: "authentication",
+		query: []openapi.Parameter{
+			queryParam("code", "", false, stringSchema),
+			queryParam("state", "", false, stringSchema),
+			queryParam("error", "set by the provider when the login failed", false, stringSchema),
+		},
+		status: http.StatusOK, responseBodies: []any{LoginResponseBody{}},
+		errors: []int{http.StatusUnauthorized, http.StatusNotFound},
+	},
+
+	"POST /api/v1/person/access-token": {
+		summary: "Create a personal access token", tag: "access token",
+		requestBody: CreateAccessTokenRequestBody{},
+		status:      http.StatusCreated, responseBodies: []any{CreateAccessTokenResponseBody{}},
+	},
+	"GET /api/v1/person/access-token": {
+		summary: "Personal access tokens of the logged-in person", tag: "access token",
+		status: http.StatusOK, responseBodies: []any{[]authentication.PersonalAccessToken{}},
+	},
+	"DELETE /api/v1/person/access-token/:tokenId": {
+		summary: "Revoke a personal access token", tag: "access token",
+		status: http.StatusNoContent,
+		errors: []int{http.StatusNotFound},
+	},
+
+	"GET /api/v1/person/export": {
+		summary: "Export the personal data", tag: "account",
+		query: []openapi.Parameter{
+			queryParam("format", "zip includes the uploaded files", false, &openapi.Schema{Type: "string", Enum: []string{"json", "zip"}}),
+		},
+		status: http.StatusOK, responseBodies: []any{account.Export{}},
+		responseHeaders: map[string]openapi.Header{"Content-Disposition": {Schema: stringSchema}},
+	},
+	"DELETE /api/v1/person": {
+		summary: "Delete the account", tag: "account",
+		requestBody: DeleteAccountRequestBody{},
+		status:      http.StatusNoContent,
+	},
+
+	"POST /api/v1/expense": {
+		summary: "Create an expense", tag: "expense",
+		requestBody: CreateExpenseRequestBody{},
+		status:      http.StatusCreated, responseBodies: []any{expense.Expense{}},
+		errors: []int{http.StatusNotFound},
+	},
+	"DELETE /api/v1/expense/:expenseId": {
+		summary: "Delete an expense", tag: "expense",
+		status: http.StatusNoContent,
+		errors: []int{http.StatusNotFound},
+	},
+
+	"POST /api/v1/expense/:expenseId/attachment": {
+		summary: "Attach a receipt to an expense", tag: "attachment",
+		multipartFile: "file",
+		status:        http.StatusCreated, responseBodies: []any{attachment.Attachment{}},
+		errors: []int{http.StatusNotFound, http.StatusRequestEntityTooLarge, http.StatusUnsupportedMediaType},
+	},
+	"GET /api/v1/expense/:expenseId/attachment": {
+		summary: "Attachments of an expense", tag: "attachment",
+		status: http.StatusOK, responseBodies: []any{[]attachment.Attachment{}},
+		errors: []int{http.StatusNotFound},
+	},
+	"GET /api/v1/expense/:expenseId/attachment/:attachmentId": {
+		summary: "Download an attachment", tag: "attachment",
+		status: http.StatusOK, responseContentType: "application/octet-stream",
+		responseHeaders: map[string]openapi.Header{"Content-Disposition": {Schema: stringSchema}},
+		errors:          []int{http.StatusNotFound},
+	},
+	"GET /api/v1/expense/:expenseId/attachment/:attachmentId/thumbnail": {
+		summary: "Download the thumbnail of an image attachment", tag: "attachment",
+		status: http.StatusOK, responseContentType: "image/jpeg",
+		errors: []int{http.StatusNotFound},
+	},
+
+	"POST /api/v1/transfer": {
+		summary: "Record a transfer between two members of a group", tag: "transfer",
+		requestBody: CreateTransferRequestBody{},
+		status:      http.StatusCreated, responseBodies: []any{transfer.Transfer{}},
+	},
+
+	"POST /api/v1/graphql": {
+		summary: "Run a GraphQL query. Errors of the query are reported in the errors of the response, with status 200", tag: "graphql",
+		requestBody: GraphQLRequestBody{},
+		// the shape of the data depends on the query: the GraphQL schema describes it
+		status: http.StatusOK, responseBodies: []any{map[string]any{}},
+	},
+}
+
+var pathParamRegexp = regexp.MustCompile(`:([A-Za-z]+)`)
+
+// newOpenApiDocument describes the routes with apiOperations and the authentication they were registered with, keyed
+// the same way. Routes missing from either are left out: the tests make sure there are none.
+func newOpenApiDocument(routes gin.RoutesInfo, auths map[string]routeAuth) openapi.Document {
+	schemas := openapi.NewSchemas()
+	problemSchema := schemas.Of(problem.Problem{})
+
+	doc := openapi.Document{
+		OpenApi: openapi.Version,
+		Info: openapi.Info{
+			Title:       "Splid backend clone",
+			Description: "Errors are reported as RFC 7807 problem details, whose code is stable.",
+			Version:     "1",
+		},
+		Paths: map[string]openapi.PathItem{},
+		Components: openapi.Components{
+			SecuritySchemes: map[string]openapi.SecurityScheme{
+				bearerSecurityScheme: {
+					Type: "http", Scheme: "bearer", BearerFormat: "JWT",
+					Description: "an access token returned by login",
+				},
+				personalAccessTokenSecurityScheme: {
+					Type: "http", Scheme: "bearer",
+					Description: "a personal access token, accepted only by the operations listing the scopes it needs in x-scopes",
+				},
+			},
+		},
+	}
+
+	for _, route := range routes {
+		op, ok := apiOperations[route.Method+" "+route.Path]
+		auth, registered := auths[route.Method+" "+route.Path]
+		if !ok || !registered {
+			continue
+		}
+		path := pathParamRegexp.ReplaceAllString(route.Path, "{$1}")
+		if doc.Paths[path] == nil {
+			doc.Paths[path] = openapi.PathItem{}
+		}
+		doc.Paths[path][strings.ToLower(route.Method)] = op.document(route, auth, schemas, problemSchema)
+	}
+
+	doc.Components.Schemas = schemas.Components()
+	return doc
+}
+
+func (op apiOperation) document(route gin.RouteInfo, auth routeAuth, schemas *openapi.Schemas, problemSchema *openapi.Schema) openapi.Operation {
+	doc := openapi.Operation{
+		OperationId: operationId(route),
+		Summary:     op.summary,
+		Tags:        []string{op.tag},
+		Responses:   map[string]openapi.Response{},
+		Security:    []openapi.SecurityRequirement{},
+	}
+
+	for _, match := range pathParamRegexp.FindAllStringSubmatch(route.Path, -1) {
+		schema := stringSchema
+		if strings.HasSuffix(match[1], "Id") {
+			schema = &openapi.Schema{Type: "integer"}
+		}
+		doc.Parameters = append(doc.Parameters, openapi.Parameter{Name: match[1], In: "path", Required: true, Schema: schema})
+	}
+	doc.Parameters = append(doc.Parameters, op.query...)
+
+	if op.requestBody != nil {
+		doc.RequestBody = &openapi.RequestBody{
+			Required: true,
+			Content:  map[string]openapi.MediaType{"application/json": {Schema: schemas.Of(op.requestBody)}},
+		}
+	}
+	if op.multipartFile != "" {
+		doc.RequestBody = &openapi.RequestBody{
+			Required: true,
+			Content: map[string]openapi.MediaType{"multipart/form-data": {Schema: &openapi.Schema{
+				Type:       "object",
+				Properties: map[string]*openapi.Schema{op.multipartFile: {Type: "string", Format: "binary"}},
+				Required:   []string{op.multipartFile},
+			}}},
+		}
+	}
+
+	if !auth.public {
+		doc.Security = append(doc.Security, openapi.SecurityRequirement{bearerSecurityScheme: {}})
+		if len(auth.scopes) > 0 {
+			doc.Security = append(doc.Security, openapi.SecurityRequirement{personalAccessTokenSecurityScheme: {}})
+			for _, scope := range auth.scopes {
+				doc.Scopes = append(doc.Scopes, string(scope))
+			}
+		}
+	}
+
+	doc.Responses[strconv.Itoa(op.status)] = op.successResponse(schemas)
+	for _, status := range op.otherStatuses {
+		response := op.successResponse(schemas)
+		response.Description = http.StatusText(status)
+		doc.Responses[strconv.Itoa(status)] = response
+	}
+
+	errorStatuses := append([]int{http.StatusInternalServerError}, op.errors...)
+	if op.requestBody != nil || op.multipartFile != "" || len(op.query) > 0 || len(doc.Parameters) > 0 {
+		errorStatuses = append(errorStatuses, http.StatusBadRequest)
+	}
+	if op.requestBody != nil {
+		// see limitRequestBody
+		errorStatuses = append(errorStatuses, http.StatusRequestEntityTooLarge)
+	}
+	if !auth.public {
+		// see AuthenticateMiddleware
+		errorStatuses = append(errorStatuses, http.StatusUnauthorized, http.StatusForbidden)
+	}
+	for _, status := range errorStatuses {
+		response := openapi.Response{
+			Description: http.StatusText(status),
+			Content:     map[string]openapi.MediaType{problem.ContentType: {Schema: problemSchema}},
+		}
+		if status == http.StatusTooManyRequests {
+			response.Headers = map[string]openapi.Header{"Retry-After": retryAfterHeader}
+		}
+		doc.Responses[strconv.Itoa(status)] = response
+	}
+	return doc
+}
+
+func (op apiOperation) successResponse(schemas *openapi.Schemas) openapi.Response {
+	response := openapi.Response{Description: http.StatusText(op.status), Headers: op.responseHeaders}
+
+	switch {
+	case op.responseContentType != "":
+		response.Content = map[string]openapi.MediaType{
+			op.responseContentType: {Schema: &openapi.Schema{Type: "string", Format: "binary"}},
+		}
+	case len(op.responseBodies) == 1:
+		response.Content = map[string]openapi.MediaType{"application/json": {Schema: schemas.Of(op.responseBodies[0])}}
+	case len(op.responseBodies) > 1:
+		schema := &openapi.Schema{}
+		for _, body := range op.responseBodies {
+			schema.OneOf = append(schema.OneOf, schemas.Of(body))
+		}
+		response.Content = map[string]openapi.MediaType{"application/json": {Schema: schema}}
+	}
+	return response
+}
+
+// operationId - e.g. postApiV1GroupGroupIdJoin
+func operationId(route gin.RouteInfo) string {
+	words := strings.FieldsFunc(route.Path, func(r rune) bool {
+		return !('a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || '0' <= r && r <= '9')
+	})
+	id := strings.ToLower(route.Method)
+	for _, word := range words {
+		id += strings.ToUpper(word[:1]) + word[1:]
+	}
+	return id
+}
+
+// OpenApiHandlers - serves the document describing the routes registered before it is set
+type OpenApiHandlers struct {
+	document *openapi.Document
+}
+
+func NewOpenApiHandlers() OpenApiHandlers {
+	return OpenApiHandlers{document: &openapi.Document{}}
+}
+
+func (h *OpenApiHandlers) setRoutes(routes gin.RoutesInfo, auths map[string]routeAuth) {
+	sort.Slice(routes, func(i, j int) bool { return routes[i].Path < routes[j].Path })
+	*h.document = newOpenApiDocument(routes, auths)
+}
+
+func (h *OpenApiHandlers) handleGetOpenApiDocument(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, h.document)
+}
@@ -0,0 +1,91 @@
+//go:build unit
+
+package http
+
+import (
+	"encoding/json"
+	"github.com/antoniobelotti/splid_backend_clone/internal/http/authentication"
+	"github.com/antoniobelotti/splid_backend_clone/internal/http/openapi"
+	"github.com/antoniobelotti/splid_backend_clone/internal/http/problem"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestOpenApiOperationsMatchRoutes fails when a route is added or removed without updating apiOperations
+func TestOpenApiOperationsMatchRoutes(t *testing.T) {
+	routes := map[string]bool{}
+	for _, route := range newTestServer(Dependencies{}).Routes() {
+		key := route.Method + " " + route.Path
+		routes[key] = true
+		assert.Contains(t, apiOperations, key, "route missing from apiOperations")
+	}
+	for key := range apiOperations {
+		assert.Contains(t, routes, key, "apiOperations describes a route that is not registered")
+	}
+}
+
+func getOpenApiDocument(t *testing.T, server RESTServer) openapi.Document {
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/openapi.json", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var doc openapi.Document
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &doc))
+	return doc
+}
+
+// TestOpenApiSecurityMatchesMiddleware fails when the document and the router disagree on which routes need a token
+func TestOpenApiSecurityMatchesMiddleware(t *testing.T) {
+	server := newTestServer(Dependencies{})
+	doc := getOpenApiDocument(t, server)
+
+	for _, route := range server.Routes() {
+		op := doc.Paths[pathParamRegexp.ReplaceAllString(route.Path, "{$1}")][strings.ToLower(route.Method)]
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, httptest.NewRequest(route.Method, route.Path, nil))
+
+		var p problem.Problem
+		_ = json.Unmarshal(w.Body.Bytes(), &p)
+		rejected := w.Code == http.StatusForbidden && p.Code == authentication.CodeMissingToken
+		assert.Equal(t, len(op.Security) > 0, rejected, "%s %s: the document and the middleware disagree", route.Method, route.Path)
+	}
+}
+
+func TestServeOpenApiDocument(t *testing.T) {
+	server := newTestServer(Dependencies{})
+	doc := getOpenApiDocument(t, server)
+	assert.Equal(t, openapi.Version, doc.OpenApi)
+
+	for _, route := range server.Routes() {
+		path := pathParamRegexp.ReplaceAllString(route.Path, "{$1}")
+		require.Contains(t, doc.Paths, path)
+		op, ok := doc.Paths[path][strings.ToLower(route.Method)]
+		require.True(t, ok, "%s %s is not documented", route.Method, path)
+
+		assert.Contains(t, op.Responses, "500")
+		for _, param := range op.Parameters {
+			if param.In == "path" {
+				assert.Contains(t, path, "{"+param.Name+"}")
+			}
+		}
+	}
+
+	createExpense := doc.Paths["/api/v1/expense"]["post"]
+	assert.Equal(t, "#/components/schemas/CreateExpenseRequestBody", createExpense.RequestBody.Content["application/json"].Schema.Ref)
+	assert.Equal(t, []string{string(authentication.ScopeWriteExpenses)}, createExpense.Scopes)
+	assert.Contains(t, createExpense.Responses, "401")
+	assert.Contains(t, createExpense.Responses, "413")
+	assert.Contains(t, doc.Components.Schemas, "Problem")
+	assert.Contains(t, doc.Components.Schemas["CreateExpenseRequestBody"].Properties, "amount-in-cents")
+	assert.Contains(t, doc.Components.Schemas["CreateExpenseRequestBody"].Required, "amount-in-cents")
+	assert.True(t, doc.Components.Schemas["CreateExpenseRequestBody"].Properties["amount-in-cents"].ExclusiveMinimum)
+
+	login := doc.Paths["/api/v1/person/login"]["post"]
+	assert.Empty(t, login.Security)
+	assert.Len(t, login.Responses["200"].Content["application/json"].Schema.OneOf, 2)
+	assert.Contains(t, login.Responses["429"].Headers, "Retry-After")
+}
@@ -1,20 +1,27 @@
 package http
 
 import (
+	"errors"
 	"github.com/antoniobelotti/splid_backend_clone/internal/http/authentication"
+	"github.com/antoniobelotti/splid_backend_clone/internal/http/problem"
 	"github.com/antoniobelotti/splid_backend_clone/internal/person"
 	"github.com/gin-gonic/gin"
-	"golang.org/x/crypto/bcrypt"
+	"log/slog"
+	"math"
 	"net/http"
+	"strconv"
+	"time"
 )
 
 type PersonHandlers struct {
-	service person.Service
+	service     person.Service
+	authService authentication.Service
 }
 
-func NewPersonHandlers(service person.Service) PersonHandlers {
+func NewPersonHandlers(service person.Service, authService authentication.Service) PersonHandlers {
 	return PersonHandlers{
-		service: service,
+		service:     service,
+		authService: authService,
 	}
 }
 
@@ -29,13 +36,13 @@ func (h *PersonHandlers) handleCreatePerson(ctx *gin.Context) {
 	requestBody := CreatePersonRequestBody{}
 
 	if err := ctx.ShouldBindJSON(&requestBody); err != nil {
-		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "malformed request body"})
+		problem.AbortWithBindingError(ctx, err)
 		return
 	}
 
 	p, err := h.service.CreatePerson(ctx, requestBody.Name, requestBody.Email, requestBody.Password)
 	if err != nil {
-		ctx.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "cannot create person"})
+		problem.AbortWithError(ctx, err)
 		return
 	}
 
@@ -44,14 +51,9 @@ func (h *PersonHandlers) handleCreatePerson(ctx *gin.Context) {
 }
 
 func (h *PersonHandlers) handleGetPerson(ctx *gin.Context) {
-	personId, exists := ctx.Get("PersonId")
-	if !exists {
-		ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "login required"})
-	}
-
-	p, err := h.service.GetPersonById(ctx, personId.(int))
+	p, err := h.service.GetPersonById(ctx, ctx.GetInt("PersonId"))
 	if err != nil {
-		ctx.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "person not found"})
+		problem.AbortWithError(ctx, err)
 		return
 	}
 
@@ -65,36 +67,414 @@ type LoginRequestBody struct {
 }
 
 type LoginResponseBody struct {
-	SignedToken string `json:"signed-token"`
+	SignedToken  string    `json:"signed-token"`
+	RefreshToken string    `json:"refresh-token"`
+	ExpiresAt    time.Time `json:"expires-at"`
+}
+
+func newLoginResponseBody(tokens authentication.Tokens) LoginResponseBody {
+	return LoginResponseBody{
+		SignedToken:  tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
+		ExpiresAt:    tokens.ExpiresAt,
+	}
 }
 
 func (h *PersonHandlers) handleLogin(ctx *gin.Context) {
 	requestBody := LoginRequestBody{}
 
 	if err := ctx.ShouldBindJSON(&requestBody); err != nil {
-		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "malformed request body"})
+		problem.AbortWithBindingError(ctx, err)
 		return
 	}
 
-	p, err := h.service.GetPersonByEmail(ctx, requestBody.Email)
+	// reserved before the password is checked, so that concurrent guesses are counted
+	attemptId, retryAfter, err := h.authService.ReserveLoginAttempt(ctx, authentication.LoginAttempt{
+		Email:     requestBody.Email,
+		Ip:        ctx.ClientIP(),
+		UserAgent: ctx.Request.UserAgent(),
+	})
 	if err != nil {
-		// TODO: better error handling
-		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "internal server error"})
+		problem.AbortWithError(ctx, err)
+		return
+	}
+	if retryAfter > 0 {
+		abortTooManyLoginAttempts(ctx, retryAfter)
+		return
+	}
+
+	p, err := h.service.Authenticate(ctx, requestBody.Email, requestBody.Password)
+	if err != nil && !errors.Is(err, person.ErrInvalidCredentials) {
+		h.releaseLoginAttempt(ctx, attemptId)
+		problem.AbortWithError(ctx, err)
+		return
+	}
+
+	if err == nil {
+		totpEnabled, totpErr := h.service.IsTotpEnabled(ctx, p.Id)
+		if totpErr != nil {
+			h.releaseLoginAttempt(ctx, attemptId)
+			problem.AbortWithError(ctx, totpErr)
+			return
+		}
+		if totpEnabled {
+			// the attempt is recorded after the second step: recording a success now would reset the failures that
+			// throttle guessing the code
+			h.releaseLoginAttempt(ctx, attemptId)
+			h.respondWithChallenge(ctx, p.Id)
+			return
+		}
+	}
+
+	if completeErr := h.authService.CompleteLoginAttempt(ctx, attemptId, err == nil); completeErr != nil {
+		problem.AbortWithError(ctx, completeErr)
 		return
 	}
 
-	err = bcrypt.CompareHashAndPassword([]byte(p.Password), []byte(requestBody.Password))
 	if err != nil {
-		ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		problem.AbortWithError(ctx, person.ErrInvalidCredentials)
 		return
 	}
 
-	signedJwtToken, err := authentication.GetJwtToken(p.Id)
+	tokens, err := h.authService.Login(ctx, p.Id)
 	if err != nil {
-		ctx.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "unable to login: internal server error"})
+		problem.AbortWithError(ctx, err)
+		return
 	}
 
-	ctx.JSON(http.StatusOK, LoginResponseBody{
-		SignedToken: signedJwtToken,
+	ctx.JSON(http.StatusOK, newLoginResponseBody(tokens))
+}
+
+const codeInvalidChallengeToken = "invalid_challenge_token"
+
+// releaseLoginAttempt forgets an attempt that ended before the credentials were found right or wrong. The response is
+// already decided, so a failure is only logged: the attempt then counts as a failure until it leaves the window.
+func (h *PersonHandlers) releaseLoginAttempt(ctx *gin.Context, attemptId int) {
+	if err := h.authService.ReleaseLoginAttempt(ctx, attemptId); err != nil {
+		slog.ErrorContext(ctx, "unable to release the login attempt", "error", err)
+	}
+}
+
+func abortTooManyLoginAttempts(ctx *gin.Context, retryAfter time.Duration) {
+	ctx.Header("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	problem.AbortWithStatus(ctx, http.StatusTooManyRequests, "too_many_login_attempts", "too many failed login attempts: try again later")
+}
+
+type TwoFactorChallengeResponseBody struct {
+	TwoFactorRequired bool      `json:"two-factor-required"`
+	ChallengeToken    string    `json:"challenge-token"`
+	ExpiresAt         time.Time `json:"expires-at"`
+}
+
+func (h *PersonHandlers) respondWithChallenge(ctx *gin.Context, personId int) {
+	challenge, err := h.authService.NewChallenge(personId)
+	if err != nil {
+		problem.AbortWithError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, TwoFactorChallengeResponseBody{
+		TwoFactorRequired: true,
+		ChallengeToken:    challenge.Token,
+		ExpiresAt:         challenge.ExpiresAt,
+	})
+}
+
+type LoginSecondFactorRequestBody struct {
+	ChallengeToken string `json:"challenge-token" binding:"required"`
+	// Code is either the current TOTP code or an unused recovery code
+	Code string `json:"code" binding:"required"`
+}
+
+// handleLoginSecondFactor completes a login started by handleLogin for a person with 2FA enabled
+func (h *PersonHandlers) handleLoginSecondFactor(ctx *gin.Context) {
+	requestBody := LoginSecondFactorRequestBody{}
+
+	if err := ctx.ShouldBindJSON(&requestBody); err != nil {
+		problem.AbortWithBindingError(ctx, err)
+		return
+	}
+
+	personId, err := h.authService.ResolveChallenge(requestBody.ChallengeToken)
+	if err != nil {
+		problem.AbortWithStatus(ctx, http.StatusUnauthorized, codeInvalidChallengeToken, "invalid or expired challenge token")
+		return
+	}
+	p, err := h.service.GetPersonById(ctx, personId)
+	if err != nil {
+		problem.AbortWithStatus(ctx, http.StatusUnauthorized, codeInvalidChallengeToken, "invalid or expired challenge token")
+		return
+	}
+
+	// codes are guessed under the same limits as passwords
+	attemptId, retryAfter, err := h.authService.ReserveLoginAttempt(ctx, authentication.LoginAttempt{
+		Email:     p.Email,
+		Ip:        ctx.ClientIP(),
+		UserAgent: ctx.Request.UserAgent(),
 	})
+	if err != nil {
+		problem.AbortWithError(ctx, err)
+		return
+	}
+	if retryAfter > 0 {
+		abortTooManyLoginAttempts(ctx, retryAfter)
+		return
+	}
+
+	err = h.service.VerifySecondFactor(ctx, p.Id, requestBody.Code)
+	if err != nil && !errors.Is(err, person.ErrInvalidTotpCode) && !errors.Is(err, person.ErrTotpNotEnabled) {
+		h.releaseLoginAttempt(ctx, attemptId)
+		problem.AbortWithError(ctx, err)
+		return
+	}
+
+	if completeErr := h.authService.CompleteLoginAttempt(ctx, attemptId, err == nil); completeErr != nil {
+		problem.AbortWithError(ctx, completeErr)
+		return
+	}
+
+	if err != nil {
+		// a wrong code is a failed login here, not a validation error
+		problem.AbortWithStatus(ctx, http.StatusUnauthorized, person.ErrInvalidTotpCode.Code, person.ErrInvalidTotpCode.Message)
+		return
+	}
+
+	tokens, err := h.authService.Login(ctx, p.Id)
+	if err != nil {
+		problem.AbortWithError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, newLoginResponseBody(tokens))
+}
+
+type RefreshTokenRequestBody struct {
+	RefreshToken string `json:"refresh-token" binding:"required"`
+}
+
+func (h *PersonHandlers) handleRefreshToken(ctx *gin.Context) {
+	requestBody := RefreshTokenRequestBody{}
+
+	if err := ctx.ShouldBindJSON(&requestBody); err != nil {
+		problem.AbortWithBindingError(ctx, err)
+		return
+	}
+
+	tokens, err := h.authService.Refresh(ctx, requestBody.RefreshToken)
+	if err != nil {
+		problem.AbortWithError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, newLoginResponseBody(tokens))
+}
+
+func (h *PersonHandlers) handleLogout(ctx *gin.Context) {
+	if err := h.authService.Logout(ctx, ctx.GetString("SessionId")); err != nil {
+		problem.AbortWithError(ctx, err)
+		return
+	}
+	ctx.Status(http.StatusNoContent)
+}
+
+func (h *PersonHandlers) handleLogoutAll(ctx *gin.Context) {
+	if err := h.authService.LogoutAll(ctx, ctx.GetInt("PersonId")); err != nil {
+		problem.AbortWithError(ctx, err)
+		return
+	}
+	ctx.Status(http.StatusNoContent)
+}
+
+type RequestPasswordResetRequestBody struct {
+	Email string `json:"email" binding:"email,required"`
+}
+
+// handleRequestPasswordReset answers the same way whether the email is registered or not
+func (h *PersonHandlers) handleRequestPasswordReset(ctx *gin.Context) {
+	requestBody := RequestPasswordResetRequestBody{}
+
+	if err := ctx.ShouldBindJSON(&requestBody); err != nil {
+		problem.AbortWithBindingError(ctx, err)
+		return
+	}
+
+	if err := h.service.RequestPasswordReset(ctx, requestBody.Email); err != nil {
+		problem.AbortWithError(ctx, err)
+		return
+	}
+
+	ctx.Status(http.StatusAccepted)
+}
+
+type ConfirmPasswordResetRequestBody struct {
+	Token           string `json:"token" binding:"required"`
+	Password        string `json:"password" binding:"min=8,required"`
+	ConfirmPassword string `json:"confirm-password" binding:"min=8,required,eqfield=Password"`
+}
+
+func (h *PersonHandlers) handleConfirmPasswordReset(ctx *gin.Context) {
+	requestBody := ConfirmPasswordResetRequestBody{}
+
+	if err := ctx.ShouldBindJSON(&requestBody); err != nil {
+		problem.AbortWithBindingError(ctx, err)
+		return
+	}
+
+	if err := h.service.ResetPassword(ctx, requestBody.Token, requestBody.Password); err != nil {
+		problem.AbortWithError(ctx, err)
+		return
+	}
+
+	ctx.Status(http.StatusNoContent)
+}
+
+type VerifyEmailRequestBody struct {
+	Token string `json:"token" binding:"required"`
+}
+
+func (h *PersonHandlers) handleVerifyEmail(ctx *gin.Context) {
+	requestBody := VerifyEmailRequestBody{}
+
+	if err := ctx.ShouldBindJSON(&requestBody); err != nil {
+		problem.AbortWithBindingError(ctx, err)
+		return
+	}
+
+	if err := h.service.VerifyEmail(ctx, requestBody.Token); err != nil {
+		problem.AbortWithError(ctx, err)
+		return
+	}
+
+	ctx.Status(http.StatusNoContent)
+}
+
+func (h *PersonHandlers) handleResendVerificationEmail(ctx *gin.Context) {
+	err := h.service.ResendVerificationEmail(ctx, ctx.GetInt("PersonId"))
+	if err != nil {
+		problem.AbortWithError(ctx, err)
+		return
+	}
+
+	ctx.Status(http.StatusAccepted)
+}
+
+type UpdatePersonRequestBody struct {
+	Name string `json:"name" binding:"required"`
+}
+
+func (h *PersonHandlers) handleUpdatePerson(ctx *gin.Context) {
+	requestBody := UpdatePersonRequestBody{}
+
+	if err := ctx.ShouldBindJSON(&requestBody); err != nil {
+		problem.AbortWithBindingError(ctx, err)
+		return
+	}
+
+	p, err := h.service.UpdateName(ctx, ctx.GetInt("PersonId"), requestBody.Name)
+	if err != nil {
+		problem.AbortWithError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, p)
+}
+
+type ChangeEmailRequestBody struct {
+	Email    string `json:"email" binding:"email,required"`
+	Password string `json:"password" binding:"required"`
+}
+
+func (h *PersonHandlers) handleChangeEmail(ctx *gin.Context) {
+	requestBody := ChangeEmailRequestBody{}
+
+	if err := ctx.ShouldBindJSON(&requestBody); err != nil {
+		problem.AbortWithBindingError(ctx, err)
+		return
+	}
+
+	p, err := h.service.ChangeEmail(ctx, ctx.GetInt("PersonId"), requestBody.Password, requestBody.Email)
+	if err != nil {
+		problem.AbortWithError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, p)
+}
+
+type ChangePasswordRequestBody struct {
+	CurrentPassword string `json:"current-password" binding:"required"`
+	Password        string `json:"password" binding:"min=8,required"`
+	ConfirmPassword string `json:"confirm-password" binding:"min=8,required,eqfield=Password"`
+}
+
+// handleChangePassword keeps the session making the request, every other one is logged out
+func (h *PersonHandlers) handleChangePassword(ctx *gin.Context) {
+	requestBody := ChangePasswordRequestBody{}
+
+	if err := ctx.ShouldBindJSON(&requestBody); err != nil {
+		problem.AbortWithBindingError(ctx, err)
+		return
+	}
+
+	err := h.service.ChangePassword(ctx, ctx.GetInt("PersonId"), ctx.GetString("SessionId"), requestBody.CurrentPassword, requestBody.Password)
+	if err != nil {
+		problem.AbortWithError(ctx, err)
+		return
+	}
+
+	ctx.Status(http.StatusNoContent)
+}
+
+func (h *PersonHandlers) handleBeginTotpEnrollment(ctx *gin.Context) {
+	enrollment, err := h.service.BeginTotpEnrollment(ctx, ctx.GetInt("PersonId"))
+	if err != nil {
+		problem.AbortWithError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, enrollment)
+}
+
+type ConfirmTotpEnrollmentRequestBody struct {
+	Code string `json:"code" binding:"required"`
+}
+
+type ConfirmTotpEnrollmentResponseBody struct {
+	RecoveryCodes []string `json:"recovery-codes"`
+}
+
+func (h *PersonHandlers) handleConfirmTotpEnrollment(ctx *gin.Context) {
+	requestBody := ConfirmTotpEnrollmentRequestBody{}
+
+	if err := ctx.ShouldBindJSON(&requestBody); err != nil {
+		problem.AbortWithBindingError(ctx, err)
+		return
+	}
+
+	codes, err := h.service.ConfirmTotpEnrollment(ctx, ctx.GetInt("PersonId"), requestBody.Code)
+	if err != nil {
+		problem.AbortWithError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, ConfirmTotpEnrollmentResponseBody{RecoveryCodes: codes})
+}
+
+type DisableTotpRequestBody struct {
+	Password string `json:"password" binding:"required"`
+}
+
+func (h *PersonHandlers) handleDisableTotp(ctx *gin.Context) {
+	requestBody := DisableTotpRequestBody{}
+
+	if err := ctx.ShouldBindJSON(&requestBody); err != nil {
+		problem.AbortWithBindingError(ctx, err)
+		return
+	}
+
+	if err := h.service.DisableTotp(ctx, ctx.GetInt("PersonId"), requestBody.Password); err != nil {
+		problem.AbortWithError(ctx, err)
+		return
+	}
+
+	ctx.Status(http.StatusNoContent)
 }
@@ -0,0 +1,231 @@
+package problem
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/antoniobelotti/splid_backend_clone/internal/apperror"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+	"log/slog"
+	"net/http"
+	"reflect"
+	"runtime/debug"
+	"strings"
+	"sync"
+)
+
+// ContentType - RFC 7807
+const ContentType = "application/problem+json"
+
+// TypePrefix - the type of a problem is TypePrefix followed by its code
+const TypePrefix = "urn:splid:problem:"
+
+const (
+	CodeInternal             = "internal_error"
+	CodeMalformedRequestBody = "malformed_request_body"
+	CodeRequestBodyTooLarge  = "request_body_too_large"
+	CodeValidationFailed     = "validation_failed"
+	CodeRouteNotFound        = "route_not_found"
+	CodeMethodNotAllowed     = "method_not_allowed"
+)
+
+// Problem - the body of every error response
+type Problem struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+	// Code is stable and meant for programs, e.g. "group_not_found"
+	Code          string         `json:"code"`
+	InvalidParams []InvalidParam `json:"invalid-params,omitempty"`
+}
+
+// InvalidParam - what is wrong with a field of the request
+type InvalidParam struct {
+	Name   string `json:"name"`
+	Reason string `json:"reason"`
+}
+
+func New(status int, code string, detail string) Problem {
+	return Problem{
+		Type:   TypePrefix + code,
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+		Code:   code,
+	}
+}
+
+// Invalid - a validation error about a single parameter of the request
+func Invalid(name string, reason string) Problem {
+	p := New(http.StatusBadRequest, CodeValidationFailed, name+" "+reason)
+	p.InvalidParams = []InvalidParam{{Name: name, Reason: reason}}
+	return p
+}
+
+var statusByKind = map[apperror.Kind]int{
+	apperror.Invalid:              http.StatusBadRequest,
+	apperror.Unauthorized:         http.StatusUnauthorized,
+	apperror.Forbidden:            http.StatusForbidden,
+	apperror.NotFound:             http.StatusNotFound,
+	apperror.Conflict:             http.StatusConflict,
+	apperror.Gone:                 http.StatusGone,
+	apperror.TooLarge:             http.StatusRequestEntityTooLarge,
+	apperror.UnsupportedMediaType: http.StatusUnsupportedMediaType,
+	apperror.TooManyRequests:      http.StatusTooManyRequests,
+}
+
+// FromError maps the domain errors to problems. Any other error is an internal error, whose details are not disclosed.
+func FromError(err error) Problem {
+	var appErr *apperror.Error
+	if !errors.As(err, &appErr) {
+		return New(http.StatusInternalServerError, CodeInternal, "internal server error")
+	}
+	status, ok := statusByKind[appErr.Kind]
+	if !ok {
+		return New(http.StatusInternalServerError, CodeInternal, "internal server error")
+	}
+
+	detail := appErr.Message
+	if appErr.Kind == apperror.Invalid {
+		// validation errors are wrapped with what exactly is wrong, other errors may be wrapped with database errors
+		detail = err.Error()
+	}
+	p := New(status, appErr.Code, detail)
+	if appErr.Field != "" {
+		p.InvalidParams = []InvalidParam{{Name: appErr.Field, Reason: detail}}
+	}
+	return p
+}
+
+// FromBindingError describes why the request could not be bound, field by field when possible
+func FromBindingError(err error) Problem {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		return New(http.StatusRequestEntityTooLarge, CodeRequestBodyTooLarge, fmt.Sprintf("request body exceeds the maximum size of %d bytes", maxBytesErr.Limit))
+	}
+
+	var validationErrs validator.ValidationErrors
+	if errors.As(err, &validationErrs) {
+		p := New(http.StatusBadRequest, CodeValidationFailed, "invalid request")
+		for _, fieldErr := range validationErrs {
+			p.InvalidParams = append(p.InvalidParams, InvalidParam{Name: fieldErr.Field(), Reason: reason(fieldErr)})
+		}
+		return p
+	}
+
+	p := New(http.StatusBadRequest, CodeMalformedRequestBody, "malformed request body")
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) && typeErr.Field != "" {
+		p.InvalidParams = []InvalidParam{{Name: typeErr.Field, Reason: "must be of type " + typeErr.Type.String()}}
+	}
+	return p
+}
+
+func reason(fieldErr validator.FieldError) string {
+	switch fieldErr.Tag() {
+	case "required":
+		return "is required"
+	case "email":
+		return "must be a valid email"
+	case "min":
+		if fieldErr.Kind() == reflect.String {
+			return fmt.Sprintf("must be at least %s characters long", fieldErr.Param())
+		}
+		return "must be at least " + fieldErr.Param()
+	case "gt":
+		return "must be greater than " + fieldErr.Param()
+	case "gte":
+		return "must be at least " + fieldErr.Param()
+	case "lte":
+		return "must be at most " + fieldErr.Param()
+	case "oneof":
+		return "must be one of " + strings.ReplaceAll(fieldErr.Param(), " ", ", ")
+	case "eqfield":
+		return "must be equal to " + strings.ToLower(fieldErr.Param())
+	default:
+		return fmt.Sprintf("does not satisfy %s %s", fieldErr.Tag(), fieldErr.Param())
+	}
+}
+
+// Abort ends the request with the problem
+func Abort(ctx *gin.Context, p Problem) {
+	p.Instance = ctx.Request.URL.Path
+	ctx.Abort()
+	ctx.Render(p.Status, render{p})
+}
+
+// AbortWithStatus - see New
+func AbortWithStatus(ctx *gin.Context, status int, code string, detail string) {
+	Abort(ctx, New(status, code, detail))
+}
+
+// AbortWithError - see FromError. Internal errors are attached to the context, for the logs.
+func AbortWithError(ctx *gin.Context, err error) {
+	p := FromError(err)
+	if p.Status == http.StatusInternalServerError {
+		_ = ctx.Error(err)
+	}
+	Abort(ctx, p)
+}
+
+// AbortWithBindingError - see FromBindingError
+func AbortWithBindingError(ctx *gin.Context, err error) {
+	Abort(ctx, FromBindingError(err))
+}
+
+func NoRoute(ctx *gin.Context) {
+	AbortWithStatus(ctx, http.StatusNotFound, CodeRouteNotFound, "no such route")
+}
+
+func NoMethod(ctx *gin.Context) {
+	AbortWithStatus(ctx, http.StatusMethodNotAllowed, CodeMethodNotAllowed, "method not allowed for this route")
+}
+
+// Recovery turns panics into internal errors, logging where they happened
+func Recovery(ctx *gin.Context, recovered any) {
+	slog.ErrorContext(ctx.Request.Context(), "panic", "error", recovered, "stack", string(debug.Stack()))
+	_ = ctx.Error(fmt.Errorf("panic: %v", recovered))
+	AbortWithStatus(ctx, http.StatusInternalServerError, CodeInternal, "internal server error")
+}
+
+var useJsonFieldNamesOnce sync.Once
+
+// UseJsonFieldNames makes binding errors name fields as they are named in the request body, instead of as in the
+// struct they are bound to
+func UseJsonFieldNames() {
+	useJsonFieldNamesOnce.Do(func() {
+		v, ok := binding.Validator.Engine().(*validator.Validate)
+		if !ok {
+			return
+		}
+		v.RegisterTagNameFunc(func(field reflect.StructField) string {
+			for _, tag := range []string{"json", "form", "uri"} {
+				name, _, _ := strings.Cut(field.Tag.Get(tag), ",")
+				if name == "-" {
+					return ""
+				}
+				if name != "" {
+					return name
+				}
+			}
+			return field.Name
+		})
+	})
+}
+
+type render struct {
+	problem Problem
+}
+
+func (r render) Render(w http.ResponseWriter) error {
+	r.WriteContentType(w)
+	return json.NewEncoder(w).Encode(r.problem)
+}
+
+func (r render) WriteContentType(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", ContentType)
+}
@@ -0,0 +1,99 @@
+//go:build unit
+
+package problem
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/antoniobelotti/splid_backend_clone/internal/apperror"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+var (
+	errNotFound = apperror.New(apperror.NotFound, "thing_not_found", "thing not found")
+	errInvalid  = apperror.NewInvalidField("amount", "invalid_amount", "invalid amount")
+)
+
+func TestFromError(t *testing.T) {
+	p := FromError(fmt.Errorf("%w %w", errNotFound, errors.New("sql: no rows in result set")))
+	assert.Equal(t, http.StatusNotFound, p.Status)
+	assert.Equal(t, "thing_not_found", p.Code)
+	assert.Equal(t, TypePrefix+"thing_not_found", p.Type)
+	assert.Equal(t, "thing not found", p.Detail, "only validation errors disclose what they wrap")
+	assert.Empty(t, p.InvalidParams)
+
+	p = FromError(fmt.Errorf("%w: must be positive", errInvalid))
+	assert.Equal(t, http.StatusBadRequest, p.Status)
+	assert.Equal(t, "invalid amount: must be positive", p.Detail)
+	assert.Equal(t, []InvalidParam{{Name: "amount", Reason: "invalid amount: must be positive"}}, p.InvalidParams)
+
+	for _, err := range []error{
+		errors.New("connection refused"),
+		fmt.Errorf("%w %w", apperror.New(apperror.Internal, "unexpected_error", "unexpected error"), errNotFound),
+	} {
+		p = FromError(err)
+		assert.Equal(t, http.StatusInternalServerError, p.Status)
+		assert.Equal(t, CodeInternal, p.Code)
+		assert.Equal(t, "internal server error", p.Detail)
+	}
+}
+
+type requestBody struct {
+	Email           string `json:"email" binding:"required,email"`
+	Password        string `json:"password" binding:"required,min=8"`
+	ConfirmPassword string `json:"confirm-password" binding:"required,eqfield=Password"`
+	Amount          int    `json:"amount-in-cents"`
+}
+
+func bind(t *testing.T, body string) Problem {
+	gin.SetMode(gin.TestMode)
+	UseJsonFieldNames()
+
+	router := gin.New()
+	router.POST("/", func(ctx *gin.Context) {
+		var b requestBody
+		if err := ctx.ShouldBindJSON(&b); err != nil {
+			AbortWithBindingError(ctx, err)
+			return
+		}
+		ctx.Status(http.StatusNoContent)
+	})
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body)))
+
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	require.Equal(t, ContentType, w.Header().Get("Content-Type"))
+	var p Problem
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &p))
+	assert.Equal(t, "/", p.Instance)
+	return p
+}
+
+func TestFromBindingError(t *testing.T) {
+	p := bind(t, `{"email": "not an email", "password": "short", "confirm-password": "other"}`)
+	assert.Equal(t, CodeValidationFailed, p.Code)
+	assert.Equal(t, []InvalidParam{
+		{Name: "email", Reason: "must be a valid email"},
+		{Name: "password", Reason: "must be at least 8 characters long"},
+		{Name: "confirm-password", Reason: "must be equal to password"},
+	}, p.InvalidParams)
+
+	p = bind(t, `{"amount-in-cents": "ten"}`)
+	assert.Equal(t, CodeMalformedRequestBody, p.Code)
+	assert.Equal(t, []InvalidParam{{Name: "amount-in-cents", Reason: "must be of type int"}}, p.InvalidParams)
+
+	p = bind(t, `{`)
+	assert.Equal(t, CodeMalformedRequestBody, p.Code)
+	assert.Empty(t, p.InvalidParams)
+
+	p = FromBindingError(fmt.Errorf("bind: %w", &http.MaxBytesError{Limit: 10}))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, p.Status)
+	assert.Equal(t, CodeRequestBodyTooLarge, p.Code)
+}
@@ -0,0 +1,112 @@
+package http
+
+import (
+	"github.com/antoniobelotti/splid_backend_clone/internal/http/problem"
+	"github.com/antoniobelotti/splid_backend_clone/internal/recurring"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+type RecurringExpenseHandlers struct {
+	service recurring.Service
+}
+
+func NewRecurringExpenseHandlers(rs recurring.Service) RecurringExpenseHandlers {
+	return RecurringExpenseHandlers{service: rs}
+}
+
+const dateLayout = "2006-01-02"
+
+type CreateRecurringExpenseRequestBody struct {
+	AmountInCents int    `json:"amount-in-cents" binding:"required,gt=0"`
+	Frequency     string `json:"frequency" binding:"required,oneof=weekly monthly yearly"`
+	Interval      int    `json:"interval" binding:"gte=0"`
+	DayOfMonth    int    `json:"day-of-month" binding:"gte=0,lte=31"`
+	StartDate     string `json:"start-date" binding:"required"`
+	EndDate       string `json:"end-date"`
+}
+
+func (h *RecurringExpenseHandlers) handleCreateRecurringExpense(ctx *gin.Context) {
+	groupId, err := strconv.Atoi(ctx.Param("groupId"))
+	if err != nil {
+		problem.Abort(ctx, problem.Invalid("groupId", "must be an integer"))
+		return
+	}
+
+	requestBody := CreateRecurringExpenseRequestBody{}
+	if err := ctx.ShouldBindJSON(&requestBody); err != nil {
+		problem.AbortWithBindingError(ctx, err)
+		return
+	}
+
+	startDate, err := time.Parse(dateLayout, requestBody.StartDate)
+	if err != nil {
+		problem.Abort(ctx, problem.Invalid("start-date", "must be a date formatted as "+dateLayout))
+		return
+	}
+	var endDate *time.Time
+	if requestBody.EndDate != "" {
+		d, err := time.Parse(dateLayout, requestBody.EndDate)
+		if err != nil {
+			problem.Abort(ctx, problem.Invalid("end-date", "must be a date formatted as "+dateLayout))
+			return
+		}
+		endDate = &d
+	}
+
+	t, err := h.service.CreateTemplate(ctx, recurring.Template{
+		AmountInCents: requestBody.AmountInCents,
+		PersonId:      ctx.GetInt("PersonId"),
+		GroupId:       groupId,
+		Frequency:     recurring.Frequency(requestBody.Frequency),
+		Interval:      requestBody.Interval,
+		DayOfMonth:    requestBody.DayOfMonth,
+		StartDate:     startDate,
+		EndDate:       endDate,
+	})
+	if err != nil {
+		problem.AbortWithError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, t)
+}
+
+func (h *RecurringExpenseHandlers) handleGetRecurringExpenses(ctx *gin.Context) {
+	groupId, err := strconv.Atoi(ctx.Param("groupId"))
+	if err != nil {
+		problem.Abort(ctx, problem.Invalid("groupId", "must be an integer"))
+		return
+	}
+
+	templates, err := h.service.GetTemplatesByGroupId(ctx, groupId, ctx.GetInt("PersonId"))
+	if err != nil {
+		problem.AbortWithError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, templates)
+}
+
+func (h *RecurringExpenseHandlers) handleDeleteRecurringExpense(ctx *gin.Context) {
+	groupId, err := strconv.Atoi(ctx.Param("groupId"))
+	if err != nil {
+		problem.Abort(ctx, problem.Invalid("groupId", "must be an integer"))
+		return
+	}
+	templateId, err := strconv.Atoi(ctx.Param("recurringExpenseId"))
+	if err != nil {
+		problem.Abort(ctx, problem.Invalid("recurringExpenseId", "must be an integer"))
+		return
+	}
+
+	err = h.service.DeleteTemplate(ctx, groupId, templateId, ctx.GetInt("PersonId"))
+	if err != nil {
+		problem.AbortWithError(ctx, err)
+		return
+	}
+
+	ctx.Status(http.StatusNoContent)
+}
@@ -1,56 +1,222 @@
 package http
 
 import (
+	"github.com/antoniobelotti/splid_backend_clone/internal/account"
+	"github.com/antoniobelotti/splid_backend_clone/internal/attachment"
 	"github.com/antoniobelotti/splid_backend_clone/internal/expense"
+	"github.com/antoniobelotti/splid_backend_clone/internal/graphql"
 	"github.com/antoniobelotti/splid_backend_clone/internal/group"
+	"github.com/antoniobelotti/splid_backend_clone/internal/health"
 	"github.com/antoniobelotti/splid_backend_clone/internal/http/authentication"
+	"github.com/antoniobelotti/splid_backend_clone/internal/http/problem"
+	"github.com/antoniobelotti/splid_backend_clone/internal/metrics"
 	"github.com/antoniobelotti/splid_backend_clone/internal/person"
+	"github.com/antoniobelotti/splid_backend_clone/internal/recurring"
 	"github.com/antoniobelotti/splid_backend_clone/internal/transfer"
 	"github.com/gin-gonic/gin"
+	"io"
+	"net/http"
+	"path"
 )
 
 type RESTServer struct {
 	*gin.Engine
+	config ServerConfig
 }
 
-func NewRESTServer(ps person.Service, gs group.Service, es expense.Service, ts transfer.Service) RESTServer {
+// Dependencies - what the REST server serves. Every field may be left to its zero value: a zero service is fine as
+// long as its routes are not called, a nil Checker reports ready, nil Metrics start from zero and a zero Config is
+// DefaultServerConfig.
+type Dependencies struct {
+	Person     person.Service
+	Group      group.Service
+	Expense    expense.Service
+	Transfer   transfer.Service
+	Recurring  recurring.Service
+	Attachment attachment.Service
+	Account    account.Service
+	Auth       authentication.Service
+	Checker    *health.Checker
+	Metrics    *metrics.Metrics
+	Config     ServerConfig
+}
+
+func NewRESTServer(deps Dependencies) RESTServer {
+	checker, m, config := deps.Checker, deps.Metrics, deps.Config
+	if checker == nil {
+		checker = health.NewChecker(health.DefaultCheckTimeout)
+	}
+	if m == nil {
+		m = metrics.New()
+	}
+	if config == (ServerConfig{}) {
+		config = DefaultServerConfig()
+	}
+
 	router := gin.New()
+	problem.UseJsonFieldNames()
+
+	// the handlers pass the gin context to the services: it must expose the values of the context of the request
+	router.ContextWithFallback = true
+
+	router.Use(assignRequestId)
+	router.Use(traceRequests(probePaths...))
+	router.Use(logRequests(probePaths...))
+	router.Use(observeRequests(m))
+	// problem.Recovery logs the panics
+	router.Use(gin.CustomRecoveryWithWriter(io.Discard, problem.Recovery))
+	router.Use(limitRequestBody(config.MaxBodyBytes, attachmentUploadPath))
+
+	// every error is reported as problem details, including those of the router itself
+	router.HandleMethodNotAllowed = true
+	router.NoRoute(problem.NoRoute)
+	router.NoMethod(problem.NoMethod)
+
+	routes := newRoutes(deps.Auth)
+
+	// no authentication: the load balancer and the orchestrator have no token
+	healthHandlers := NewHealthHandlers(checker)
+	routes.handle(&router.RouterGroup, http.MethodGet, "/healthz", publicRoute, healthHandlers.handleGetLiveness)
+	routes.handle(&router.RouterGroup, http.MethodGet, "/readyz", publicRoute, healthHandlers.handleGetReadiness)
+	routes.handle(&router.RouterGroup, http.MethodGet, "/version", publicRoute, healthHandlers.handleGetVersion)
 
-	router.Use(gin.Logger())
-	router.Use(gin.Recovery())
+	// not to be exposed by the load balancer, see README
+	metricsHandlers := NewMetricsHandlers(m)
+	routes.handle(&router.RouterGroup, http.MethodGet, "/metrics", publicRoute, metricsHandlers.handleGetMetrics)
+
+	jwksHandlers := NewJwksHandlers(deps.Auth)
+	routes.handle(&router.RouterGroup, http.MethodGet, "/.well-known/jwks.json", publicRoute, jwksHandlers.handleGetJwks)
 
 	v1 := router.Group("/api/v1")
 
-	groupHandlers := NewGroupHandlers(gs)
+	openApiHandlers := NewOpenApiHandlers()
+	routes.handle(v1, http.MethodGet, "/openapi.json", publicRoute, openApiHandlers.handleGetOpenApiDocument)
+
+	groupHandlers := NewGroupHandlers(deps.Group)
 	groupEndpoints := v1.Group("/group")
 	{
-		groupEndpoints.POST("", authentication.AuthenticateMiddleware(), groupHandlers.handleCreateGroup)
-		groupEndpoints.POST("/:groupId/join", authentication.AuthenticateMiddleware(), groupHandlers.handleJoinGroup)
-		groupEndpoints.GET("/:groupId/balance", authentication.AuthenticateMiddleware(), groupHandlers.handleGetBalance)
-		groupEndpoints.GET("/:groupId/operations-to-even-balance", authentication.AuthenticateMiddleware(), groupHandlers.handleGetOpsEvenBalance)
+		routes.handle(groupEndpoints, http.MethodPost, "", sessionRoute, requireAllowed(deps.Person, person.ActionCreateGroup), groupHandlers.handleCreateGroup)
+		routes.handle(groupEndpoints, http.MethodPost, "/:groupId/join", sessionRoute, requireAllowed(deps.Person, person.ActionJoinGroup), groupHandlers.handleJoinGroup)
+		routes.handle(groupEndpoints, http.MethodGet, "/:groupId/balance", readRoute, groupHandlers.handleGetBalance)
+		routes.handle(groupEndpoints, http.MethodGet, "/:groupId/operations-to-even-balance", readRoute, groupHandlers.handleGetOpsEvenBalance)
+	}
+
+	recurringExpenseHandlers := NewRecurringExpenseHandlers(deps.Recurring)
+	recurringExpenseEndpoints := groupEndpoints.Group("/:groupId/recurring-expense")
+	{
+		routes.handle(recurringExpenseEndpoints, http.MethodPost, "", writeExpensesRoute, recurringExpenseHandlers.handleCreateRecurringExpense)
+		routes.handle(recurringExpenseEndpoints, http.MethodGet, "", readRoute, recurringExpenseHandlers.handleGetRecurringExpenses)
+		routes.handle(recurringExpenseEndpoints, http.MethodDelete, "/:recurringExpenseId", writeExpensesRoute, recurringExpenseHandlers.handleDeleteRecurringExpense)
 	}
 
-	personHandlers := NewPersonHandlers(ps)
+	personHandlers := NewPersonHandlers(deps.Person, deps.Auth)
 	personEndpoints := v1.Group("/person")
 	{
-		personEndpoints.POST("/signup", personHandlers.handleCreatePerson)
-		personEndpoints.POST("/login", personHandlers.handleLogin)
-		personEndpoints.GET("", authentication.AuthenticateMiddleware(), personHandlers.handleGetPerson)
+		routes.handle(personEndpoints, http.MethodPost, "/signup", publicRoute, personHandlers.handleCreatePerson)
+		routes.handle(personEndpoints, http.MethodPost, "/login", publicRoute, personHandlers.handleLogin)
+		routes.handle(personEndpoints, http.MethodPost, "/login/2fa", publicRoute, personHandlers.handleLoginSecondFactor)
+		routes.handle(personEndpoints, http.MethodPost, "/token/refresh", publicRoute, personHandlers.handleRefreshToken)
+		routes.handle(personEndpoints, http.MethodPost, "/logout", sessionRoute, personHandlers.handleLogout)
+		routes.handle(personEndpoints, http.MethodPost, "/logout-all", sessionRoute, personHandlers.handleLogoutAll)
+		routes.handle(personEndpoints, http.MethodPost, "/password-reset/request", publicRoute, personHandlers.handleRequestPasswordReset)
+		routes.handle(personEndpoints, http.MethodPost, "/password-reset/confirm", publicRoute, personHandlers.handleConfirmPasswordReset)
+		routes.handle(personEndpoints, http.MethodPost, "/email-verification/confirm", publicRoute, personHandlers.handleVerifyEmail)
+		routes.handle(personEndpoints, http.MethodPost, "/email-verification/resend", sessionRoute, personHandlers.handleResendVerificationEmail)
+		routes.handle(personEndpoints, http.MethodGet, "", readRoute, personHandlers.handleGetPerson)
+		routes.handle(personEndpoints, http.MethodPatch, "", sessionRoute, personHandlers.handleUpdatePerson)
+		routes.handle(personEndpoints, http.MethodPut, "/email", sessionRoute, personHandlers.handleChangeEmail)
+		routes.handle(personEndpoints, http.MethodPut, "/password", sessionRoute, personHandlers.handleChangePassword)
+		routes.handle(personEndpoints, http.MethodPost, "/2fa/totp", sessionRoute, personHandlers.handleBeginTotpEnrollment)
+		routes.handle(personEndpoints, http.MethodPost, "/2fa/totp/confirm", sessionRoute, personHandlers.handleConfirmTotpEnrollment)
+		routes.handle(personEndpoints, http.MethodDelete, "/2fa/totp", sessionRoute, personHandlers.handleDisableTotp)
 	}
 
-	expenseHandlers := NewExpenseHandlers(es)
+	oidcEndpoints := v1.Group("/auth/oidc")
+	{
+		routes.handle(oidcEndpoints, http.MethodGet, "", publicRoute, personHandlers.handleGetOidcProviders)
+		routes.handle(oidcEndpoints, http.MethodGet, "/:provider/login", publicRoute, personHandlers.handleOidcLogin)
+		routes.handle(oidcEndpoints, http.MethodGet, "/:provider/callback", publicRoute, personHandlers.handleOidcCallback)
+	}
+
+	accessTokenHandlers := NewAccessTokenHandlers(deps.Auth, deps.Group)
+	{
+		routes.handle(personEndpoints, http.MethodPost, "/access-token", sessionRoute, accessTokenHandlers.handleCreateAccessToken)
+		routes.handle(personEndpoints, http.MethodGet, "/access-token", sessionRoute, accessTokenHandlers.handleGetAccessTokens)
+		routes.handle(personEndpoints, http.MethodDelete, "/access-token/:tokenId", sessionRoute, accessTokenHandlers.handleRevokeAccessToken)
+	}
+
+	accountHandlers := NewAccountHandlers(deps.Account)
+	{
+		routes.handle(personEndpoints, http.MethodGet, "/export", sessionRoute, accountHandlers.handleExportData)
+		routes.handle(personEndpoints, http.MethodDelete, "", sessionRoute, accountHandlers.handleDeleteAccount)
+	}
+
+	expenseHandlers := NewExpenseHandlers(deps.Expense)
+	expenseGroupAccess := requireExpenseGroupAccess(deps.Expense)
 	expenseEndpoints := v1.Group("/expense")
 	{
-		expenseEndpoints.POST("", authentication.AuthenticateMiddleware(), expenseHandlers.handleCreateExpense)
+		routes.handle(expenseEndpoints, http.MethodPost, "", writeExpensesRoute, expenseHandlers.handleCreateExpense)
+		routes.handle(expenseEndpoints, http.MethodDelete, "/:expenseId", writeExpensesRoute, expenseGroupAccess, expenseHandlers.handleDeleteExpense)
+	}
+
+	attachmentHandlers := NewAttachmentHandlers(deps.Attachment)
+	attachmentEndpoints := expenseEndpoints.Group("/:expenseId/attachment")
+	{
+		routes.handle(attachmentEndpoints, http.MethodPost, "", writeExpensesRoute, expenseGroupAccess, attachmentHandlers.handleUploadAttachment)
+		routes.handle(attachmentEndpoints, http.MethodGet, "", readRoute, expenseGroupAccess, attachmentHandlers.handleGetAttachments)
+		routes.handle(attachmentEndpoints, http.MethodGet, "/:attachmentId", readRoute, expenseGroupAccess, attachmentHandlers.handleDownloadAttachment)
+		routes.handle(attachmentEndpoints, http.MethodGet, "/:attachmentId/thumbnail", readRoute, expenseGroupAccess, attachmentHandlers.handleDownloadThumbnail)
 	}
 
-	transferHandlers := NewTransferHandlers(ts)
+	transferHandlers := NewTransferHandlers(deps.Transfer)
 	transferEndpoints := v1.Group("/transfer")
 	{
-		transferEndpoints.POST("", authentication.AuthenticateMiddleware(), transferHandlers.handleCreateTransfer)
+		routes.handle(transferEndpoints, http.MethodPost, "", writeExpensesRoute, transferHandlers.handleCreateTransfer)
 	}
 
+	graphQLHandlers := NewGraphQLHandlers(graphql.NewSchema(deps.Person, deps.Group, deps.Expense, deps.Transfer))
+	routes.handle(v1, http.MethodPost, "/graphql", readRoute, graphQLHandlers.handleGraphQL)
+
+	// last, to describe every route
+	openApiHandlers.setRoutes(router.Routes(), routes.auths)
+
 	return RESTServer{
-		router,
+		Engine: router,
+		config: config,
+	}
+}
+
+// routeAuth - who may call a route. Routes that are not public accept personal access tokens only if they have scopes.
+type routeAuth struct {
+	public bool
+	scopes []authentication.Scope
+}
+
+var (
+	publicRoute = routeAuth{public: true}
+	// sessionRoute - reserved to sessions opened with a password
+	sessionRoute       = routeAuth{}
+	readRoute          = routeAuth{scopes: []authentication.Scope{authentication.ScopeRead}}
+	writeExpensesRoute = routeAuth{scopes: []authentication.Scope{authentication.ScopeWriteExpenses}}
+)
+
+// routes registers the routes along with their authentication, so that the OpenAPI document describes the one the
+// router enforces
+type routes struct {
+	auth authentication.Service
+	// auths - keyed by method and path as registered in gin
+	auths map[string]routeAuth
+}
+
+func newRoutes(auth authentication.Service) *routes {
+	return &routes{auth: auth, auths: map[string]routeAuth{}}
+}
+
+// handle registers the handlers at relativePath of group, behind AuthenticateMiddleware unless the route is public
+func (r *routes) handle(group *gin.RouterGroup, method string, relativePath string, auth routeAuth, handlers ...gin.HandlerFunc) {
+	if !auth.public {
+		handlers = append([]gin.HandlerFunc{r.auth.AuthenticateMiddleware(auth.scopes...)}, handlers...)
 	}
+	group.Handle(method, relativePath, handlers...)
+	r.auths[method+" "+path.Join(group.BasePath(), relativePath)] = auth
 }
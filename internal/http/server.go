@@ -0,0 +1,72 @@
+package http
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"time"
+)
+
+// ServerConfig - limits protecting the server from slow and oversized requests
+type ServerConfig struct {
+	ReadHeaderTimeout time.Duration
+	// ReadTimeout - to read the whole request, body included
+	ReadTimeout time.Duration
+	// WriteTimeout - from the end of the request headers to the end of the response
+	WriteTimeout   time.Duration
+	IdleTimeout    time.Duration
+	MaxHeaderBytes int
+	// MaxBodyBytes - of every request but attachment uploads, which are limited by attachment.MaxAttachmentSizeInBytes
+	MaxBodyBytes int64
+}
+
+// DefaultServerConfig - ReadTimeout leaves time to upload the largest attachment on a slow connection
+func DefaultServerConfig() ServerConfig {
+	return ServerConfig{
+		ReadHeaderTimeout: 5 * time.Second,
+		ReadTimeout:       60 * time.Second,
+		WriteTimeout:      60 * time.Second,
+		IdleTimeout:       120 * time.Second,
+		MaxHeaderBytes:    1 << 20,
+		MaxBodyBytes:      1 << 20,
+	}
+}
+
+// limitRequestBody caps the body of the requests, except for the routes in exempt which set a limit of their own.
+// Reading past the limit fails, and the handlers report it as a problem like any other binding error.
+func limitRequestBody(maxBytes int64, exempt ...string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		for _, path := range exempt {
+			if ctx.FullPath() == path {
+				return
+			}
+		}
+		ctx.Request.Body = http.MaxBytesReader(ctx.Writer, ctx.Request.Body, maxBytes)
+	}
+}
+
+// Server - serves a RESTServer with the timeouts of its ServerConfig
+type Server struct {
+	*http.Server
+}
+
+func (s RESTServer) NewServer(addr string) Server {
+	return Server{&http.Server{
+		Addr:              addr,
+		Handler:           s,
+		ReadHeaderTimeout: s.config.ReadHeaderTimeout,
+		ReadTimeout:       s.config.ReadTimeout,
+		WriteTimeout:      s.config.WriteTimeout,
+		IdleTimeout:       s.config.IdleTimeout,
+		MaxHeaderBytes:    s.config.MaxHeaderBytes,
+	}}
+}
+
+// Run serves until Shutdown is called, which makes it return nil as soon as it stops accepting connections. Shutdown
+// itself returns when the requests in flight are done.
+func (s Server) Run() error {
+	if err := s.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
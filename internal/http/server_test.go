@@ -0,0 +1,100 @@
+//go:build unit
+
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/antoniobelotti/splid_backend_clone/internal/http/problem"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestServer returns the REST server of deps, the services left out being zero values
+func newTestServer(deps Dependencies) RESTServer {
+	gin.SetMode(gin.TestMode)
+	return NewRESTServer(deps)
+}
+
+func TestRequestBodyLimit(t *testing.T) {
+	config := DefaultServerConfig()
+	config.MaxBodyBytes = 64
+	server := newTestServer(Dependencies{Config: config})
+
+	body := `{"name": "` + strings.Repeat("a", 100) + `", "email": "a@example.com"}`
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/v1/person/signup", strings.NewReader(body)))
+
+	require.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+	var p problem.Problem
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &p))
+	assert.Equal(t, problem.CodeRequestBodyTooLarge, p.Code)
+}
+
+// TestAttachmentUploadIsExemptFromBodyLimit fails if the upload route moves without updating attachmentUploadPath
+func TestAttachmentUploadIsExemptFromBodyLimit(t *testing.T) {
+	var found bool
+	for _, route := range newTestServer(Dependencies{}).Routes() {
+		found = found || (route.Method == http.MethodPost && route.Path == attachmentUploadPath)
+	}
+	assert.True(t, found)
+}
+
+func TestServerShutdownDrainsRequests(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	router := gin.New()
+	router.GET("/slow", func(ctx *gin.Context) {
+		close(entered)
+		<-release
+		ctx.Status(http.StatusOK)
+	})
+	server := RESTServer{Engine: router, config: DefaultServerConfig()}.NewServer("")
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	served := make(chan error, 1)
+	go func() {
+		served <- server.Serve(listener)
+	}()
+
+	responses := make(chan int, 1)
+	go func() {
+		resp, err := http.Get("http://" + listener.Addr().String() + "/slow")
+		if err != nil {
+			responses <- 0
+			return
+		}
+		_ = resp.Body.Close()
+		responses <- resp.StatusCode
+	}()
+	<-entered
+
+	shutdown := make(chan error, 1)
+	go func() {
+		shutdown <- server.Shutdown(context.Background())
+	}()
+	// no new connections while draining
+	require.Eventually(t, func() bool {
+		_, err := net.Dial("tcp", listener.Addr().String())
+		return err != nil
+	}, time.Second, 10*time.Millisecond)
+	select {
+	case <-shutdown:
+		t.Fatal("shutdown returned before the request in flight was done")
+	default:
+	}
+
+	close(release)
+	assert.Equal(t, http.StatusOK, <-responses)
+	assert.NoError(t, <-shutdown)
+	assert.ErrorIs(t, <-served, http.ErrServerClosed)
+}
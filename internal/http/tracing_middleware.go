@@ -0,0 +1,60 @@
+package http
+
+import (
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+	"net/http"
+)
+
+var tracer = otel.Tracer("github.com/antoniobelotti/splid_backend_clone/internal/http")
+
+// traceRequests starts a span per request, except for those to skipPaths. It is the child of the span of the caller
+// when the request carries a W3C traceparent header. Its context becomes the one of the request, so that the spans of
+// the services and of the queries are its children.
+func traceRequests(skipPaths ...string) gin.HandlerFunc {
+	skip := make(map[string]bool, len(skipPaths))
+	for _, path := range skipPaths {
+		skip[path] = true
+	}
+
+	return func(ctx *gin.Context) {
+		if skip[ctx.Request.URL.Path] {
+			ctx.Next()
+			return
+		}
+
+		// the route is known before the handlers run; named after it, the spans of a route can be grouped
+		route := ctx.FullPath()
+		name := ctx.Request.Method + " " + route
+		if route == "" {
+			name = ctx.Request.Method + " " + unmatchedRoute
+		}
+		propagated := otel.GetTextMapPropagator().Extract(ctx.Request.Context(), propagation.HeaderCarrier(ctx.Request.Header))
+		spanCtx, span := tracer.Start(propagated, name,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPMethod(ctx.Request.Method),
+				semconv.HTTPRoute(route),
+				semconv.HTTPTarget(ctx.Request.URL.Path),
+				semconv.ClientAddress(ctx.ClientIP()),
+			),
+		)
+		defer span.End()
+		ctx.Request = ctx.Request.WithContext(spanCtx)
+
+		ctx.Next()
+
+		status := ctx.Writer.Status()
+		span.SetAttributes(semconv.HTTPStatusCode(status))
+		for _, err := range ctx.Errors {
+			span.RecordError(err.Err)
+		}
+		if status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(status))
+		}
+	}
+}
@@ -0,0 +1,102 @@
+//go:build unit
+
+package http
+
+import (
+	"github.com/antoniobelotti/splid_backend_clone/internal/logging"
+	"github.com/antoniobelotti/splid_backend_clone/internal/tracing"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+var (
+	spans        = tracetest.NewInMemoryExporter()
+	installSpans sync.Once
+)
+
+// recordSpans - the tracers of the packages are bound to the first provider installed, so every test shares this one
+func recordSpans(t *testing.T) *tracetest.InMemoryExporter {
+	installSpans.Do(func() {
+		tracing.Install(sdktrace.NewTracerProvider(sdktrace.WithSyncer(spans)))
+	})
+	spans.Reset()
+	t.Cleanup(spans.Reset)
+	return spans
+}
+
+func newTracingTestRouter(handler gin.HandlerFunc) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.ContextWithFallback = true
+	router.Use(traceRequests("/healthz"))
+	router.GET("/things/:id", handler)
+	router.GET("/healthz", func(ctx *gin.Context) { ctx.Status(http.StatusOK) })
+	return router
+}
+
+func TestTraceRequests(t *testing.T) {
+	exporter := recordSpans(t)
+	router := newTracingTestRouter(func(ctx *gin.Context) {
+		// what a service does with the context the handler passes to it
+		_, span := tracer.Start(ctx, "service")
+		span.End()
+		ctx.Status(http.StatusOK)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/things/1", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	ended := exporter.GetSpans()
+	require.Len(t, ended, 2)
+	service, server := ended[0], ended[1]
+	assert.Equal(t, "GET /things/:id", server.Name)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", server.SpanContext.TraceID().String())
+	assert.Equal(t, "00f067aa0ba902b7", server.Parent.SpanID().String())
+	assert.Equal(t, server.SpanContext.SpanID(), service.Parent.SpanID())
+	assert.Contains(t, server.Attributes, semconv.HTTPStatusCode(http.StatusOK))
+}
+
+func TestTraceRequestsServerError(t *testing.T) {
+	exporter := recordSpans(t)
+	router := newTracingTestRouter(func(ctx *gin.Context) {
+		_ = ctx.Error(assert.AnError)
+		ctx.Status(http.StatusInternalServerError)
+	})
+
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/things/1", nil))
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/healthz", nil))
+
+	ended := exporter.GetSpans()
+	require.Len(t, ended, 1)
+	assert.Equal(t, codes.Error, ended[0].Status.Code)
+	require.Len(t, ended[0].Events, 1)
+	assert.Equal(t, "exception", ended[0].Events[0].Name)
+}
+
+func TestLogsReportTheTrace(t *testing.T) {
+	recordSpans(t)
+	logs := captureLogs(t)
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.ContextWithFallback = true
+	router.Use(traceRequests(), logRequests())
+	router.GET("/logged", func(ctx *gin.Context) { ctx.Status(http.StatusOK) })
+
+	req := httptest.NewRequest(http.MethodGet, "/logged", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	logged := records(t, logs)
+	require.Len(t, logged, 1)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", logged[0][logging.TraceIdKey])
+}
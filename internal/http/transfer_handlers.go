@@ -1,6 +1,7 @@
 package http
 
 import (
+	"github.com/antoniobelotti/splid_backend_clone/internal/http/problem"
 	"github.com/antoniobelotti/splid_backend_clone/internal/transfer"
 	"github.com/gin-gonic/gin"
 	"net/http"
@@ -15,8 +16,8 @@ func NewTransferHandlers(ts transfer.Service) TransferHandlers {
 }
 
 type CreateTransferRequestBody struct {
-	AmountInCents int `json:"amount-in-cents"`
-	GroupId       int `json:"group-id"`
+	AmountInCents int `json:"amount-in-cents" binding:"required,gt=0"`
+	GroupId       int `json:"group-id" binding:"required,gt=0"`
 	ReceiverId    int `json:"receiver-id"`
 }
 
@@ -24,7 +25,10 @@ func (h *TransferHandlers) handleCreateTransfer(ctx *gin.Context) {
 	requestBody := CreateTransferRequestBody{}
 
 	if err := ctx.ShouldBindJSON(&requestBody); err != nil {
-		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "malformed request body"})
+		problem.AbortWithBindingError(ctx, err)
+		return
+	}
+	if !requireGroupAccess(ctx, requestBody.GroupId) {
 		return
 	}
 
@@ -32,7 +36,7 @@ func (h *TransferHandlers) handleCreateTransfer(ctx *gin.Context) {
 
 	e, err := h.service.CreateTransfer(ctx, requestBody.AmountInCents, requestBody.GroupId, senderId, requestBody.ReceiverId)
 	if err != nil {
-		ctx.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "malformed request body"})
+		problem.AbortWithError(ctx, err)
 		return
 	}
 
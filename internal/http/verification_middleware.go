@@ -0,0 +1,26 @@
+package http
+
+import (
+	"fmt"
+	"github.com/antoniobelotti/splid_backend_clone/internal/http/problem"
+	"github.com/antoniobelotti/splid_backend_clone/internal/person"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+// requireAllowed rejects the request if the unverified accounts policy forbids the logged-in person the action.
+// Must run after the authentication middleware.
+func requireAllowed(ps person.Service, action person.Action) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		allowed, err := ps.IsAllowed(ctx, ctx.GetInt("PersonId"), action)
+		if err != nil {
+			problem.AbortWithError(ctx, err)
+			return
+		}
+		if !allowed {
+			problem.AbortWithStatus(ctx, http.StatusForbidden, person.ErrEmailNotVerified.Code, fmt.Sprintf("%s: verify your email to %s", person.ErrEmailNotVerified, action))
+			return
+		}
+		ctx.Next()
+	}
+}
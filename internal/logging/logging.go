@@ -0,0 +1,180 @@
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"go.opentelemetry.io/otel/trace"
+	"io"
+	"log/slog"
+	"reflect"
+	"regexp"
+	"strings"
+)
+
+// RequestIdKey - the attribute carrying the request id of the context, added to every record logged with one
+const RequestIdKey = "request_id"
+
+// TraceIdKey and SpanIdKey - the attributes carrying the span of the context, added to every record logged with one
+const (
+	TraceIdKey = "trace_id"
+	SpanIdKey  = "span_id"
+)
+
+// Redacted replaces the value of the sensitive attributes
+const Redacted = "[REDACTED]"
+
+// sensitiveKeys - an attribute, or a field of a struct or map logged as an attribute, is redacted when its key contains
+// one of these, case-insensitively. Keys ending in "id" are not, e.g. "access_token_id".
+var sensitiveKeys = []string{"password", "secret", "token", "authorization", "cookie", "otp", "private_key", "code_verifier"}
+
+// sensitivePrefixes - string values starting with one of these are redacted whatever their key
+var sensitivePrefixes = []string{"Bearer ", "Basic ", "splid_pat_"}
+
+// New - a logger writing JSON records to w. The records logged with a context report its request id, sensitive
+// attributes are redacted.
+func New(w io.Writer, level slog.Leveler) *slog.Logger {
+	return slog.New(contextHandler{slog.NewJSONHandler(w, &slog.HandlerOptions{Level: level, ReplaceAttr: redact})})
+}
+
+type requestIdKey struct{}
+
+// WithRequestId returns a copy of ctx carrying the request id, which every record logged with it will report
+func WithRequestId(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIdKey{}, id)
+}
+
+// RequestId - the request id of ctx, "" when it has none
+func RequestId(ctx context.Context) string {
+	id, _ := ctx.Value(requestIdKey{}).(string)
+	return id
+}
+
+// validRequestId - the ids received are logged as they are, so they must not be able to forge log lines
+var validRequestId = regexp.MustCompile(`^[A-Za-z0-9._-]{1,128}$`)
+
+// IsValidRequestId - whether an id received from a client or a proxy can be used as it is
+func IsValidRequestId(id string) bool {
+	return validRequestId.MatchString(id)
+}
+
+// NewRequestId returns a random id, 32 hex characters
+func NewRequestId() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// contextHandler adds the request id and the span of the context to the records
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if id := RequestId(ctx); id != "" {
+		r.AddAttrs(slog.String(RequestIdKey, id))
+	}
+	if span := trace.SpanContextFromContext(ctx); span.IsValid() {
+		r.AddAttrs(slog.String(TraceIdKey, span.TraceID().String()), slog.String(SpanIdKey, span.SpanID().String()))
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
+
+// redact is the ReplaceAttr of the handler
+func redact(_ []string, a slog.Attr) slog.Attr {
+	if isSensitive(a.Key) {
+		return slog.String(a.Key, Redacted)
+	}
+
+	switch a.Value.Kind() {
+	case slog.KindString:
+		if hasSensitivePrefix(a.Value.String()) {
+			return slog.String(a.Key, Redacted)
+		}
+	case slog.KindAny:
+		if v, ok := redactValue(a.Value.Any()); ok {
+			return slog.Any(a.Key, v)
+		}
+	}
+	return a
+}
+
+func isSensitive(key string) bool {
+	key = strings.ToLower(key)
+	if strings.HasSuffix(key, "id") {
+		return false
+	}
+	for _, k := range sensitiveKeys {
+		if strings.Contains(key, k) {
+			return true
+		}
+	}
+	return false
+}
+
+func hasSensitivePrefix(s string) bool {
+	for _, p := range sensitivePrefixes {
+		if strings.HasPrefix(s, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// redactValue redacts the sensitive fields of structs and maps, at any depth. It goes through their json encoding,
+// which is the way the handler would print them anyway. ok is false when v is left as it is.
+func redactValue(v any) (any, bool) {
+	if _, isErr := v.(error); isErr || v == nil {
+		return nil, false
+	}
+	t := reflect.TypeOf(v)
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Struct, reflect.Map, reflect.Slice, reflect.Array:
+	default:
+		return nil, false
+	}
+
+	encoded, err := json.Marshal(v)
+	if err != nil {
+		return nil, false
+	}
+	var decoded any
+	if err = json.Unmarshal(encoded, &decoded); err != nil {
+		return nil, false
+	}
+	return redactDecoded(decoded), true
+}
+
+func redactDecoded(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for key, value := range v {
+			if isSensitive(key) {
+				v[key] = Redacted
+			} else {
+				v[key] = redactDecoded(value)
+			}
+		}
+	case []any:
+		for i, value := range v {
+			v[i] = redactDecoded(value)
+		}
+	case string:
+		if hasSensitivePrefix(v) {
+			return Redacted
+		}
+	}
+	return v
+}
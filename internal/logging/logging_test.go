@@ -0,0 +1,97 @@
+//go:build unit
+
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"log/slog"
+	"testing"
+)
+
+func logOne(t *testing.T, ctx context.Context, args ...any) map[string]any {
+	var buf bytes.Buffer
+	New(&buf, slog.LevelInfo).InfoContext(ctx, "message", args...)
+
+	var record map[string]any
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &record))
+	return record
+}
+
+func TestRequestIdIsLogged(t *testing.T) {
+	record := logOne(t, WithRequestId(context.Background(), "abc"))
+	assert.Equal(t, "abc", record[RequestIdKey])
+
+	record = logOne(t, context.Background())
+	assert.NotContains(t, record, RequestIdKey)
+}
+
+func TestRequestIdIsLoggedWithAttrs(t *testing.T) {
+	var buf bytes.Buffer
+	New(&buf, slog.LevelInfo).With("component", "test").InfoContext(WithRequestId(context.Background(), "abc"), "message")
+
+	var record map[string]any
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &record))
+	assert.Equal(t, "abc", record[RequestIdKey])
+	assert.Equal(t, "test", record["component"])
+}
+
+func TestSensitiveAttributesAreRedacted(t *testing.T) {
+	record := logOne(t, context.Background(),
+		"password", "hunter22",
+		"refreshToken", "abc",
+		"access_token_id", 42,
+		"header", "Bearer eyJhbGciOi",
+		"pat", "splid_pat_0123456789",
+		"email", "a@example.com",
+		"error", errors.New("boom"),
+	)
+
+	assert.Equal(t, Redacted, record["password"])
+	assert.Equal(t, Redacted, record["refreshToken"])
+	assert.Equal(t, 42.0, record["access_token_id"])
+	assert.Equal(t, Redacted, record["header"])
+	assert.Equal(t, Redacted, record["pat"])
+	assert.Equal(t, "a@example.com", record["email"])
+	assert.Equal(t, "boom", record["error"])
+}
+
+func TestSensitiveFieldsOfStructsAreRedacted(t *testing.T) {
+	type credentials struct {
+		Email    string `json:"email"`
+		Password string `json:"password"`
+	}
+	type body struct {
+		Credentials credentials    `json:"credentials"`
+		Headers     map[string]any `json:"headers"`
+		Tags        []string       `json:"tags"`
+	}
+
+	record := logOne(t, context.Background(), "body", &body{
+		Credentials: credentials{Email: "a@example.com", Password: "hunter22"},
+		Headers:     map[string]any{"Authorization": "Basic YTpi", "Accept": "*/*"},
+		Tags:        []string{"Bearer eyJhbGciOi", "ok"},
+	})
+
+	assert.Equal(t, map[string]any{
+		"credentials": map[string]any{"email": "a@example.com", "password": Redacted},
+		"headers":     map[string]any{"Authorization": Redacted, "Accept": "*/*"},
+		"tags":        []any{Redacted, "ok"},
+	}, record["body"])
+}
+
+func TestSensitiveAttributesInGroupsAreRedacted(t *testing.T) {
+	record := logOne(t, context.Background(), slog.Group("login", "email", "a@example.com", "password", "hunter22"))
+	assert.Equal(t, map[string]any{"email": "a@example.com", "password": Redacted}, record["login"])
+}
+
+func TestIsValidRequestId(t *testing.T) {
+	assert.True(t, IsValidRequestId(NewRequestId()))
+	assert.True(t, IsValidRequestId("req-1.A_b"))
+	assert.False(t, IsValidRequestId(""))
+	assert.False(t, IsValidRequestId("id\n{\"level\":\"ERROR\"}"))
+}
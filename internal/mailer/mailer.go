@@ -0,0 +1,142 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Message - a plain text email
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer - delivers emails. Implementations must be safe for concurrent use.
+type Mailer interface {
+	Send(ctx context.Context, m Message) error
+}
+
+func (m Message) rfc822(from string) []byte {
+	var b strings.Builder
+	if from != "" {
+		b.WriteString("From: " + from + "\r\n")
+	}
+	b.WriteString("To: " + m.To + "\r\n")
+	b.WriteString("Subject: " + m.Subject + "\r\n")
+	b.WriteString("Date: " + time.Now().UTC().Format(time.RFC1123Z) + "\r\n")
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	b.WriteString(strings.ReplaceAll(m.Body, "\n", "\r\n"))
+	return []byte(b.String())
+}
+
+// headerInjection - a recipient or subject containing a line break could add arbitrary headers
+var headerInjection = regexp.MustCompile(`[\r\n]`)
+
+func (m Message) validate() error {
+	if headerInjection.MatchString(m.To) || headerInjection.MatchString(m.Subject) {
+		return fmt.Errorf("invalid email header in message to %q", m.To)
+	}
+	return nil
+}
+
+// InMemoryMailer - keeps sent messages in memory. Meant for tests.
+type InMemoryMailer struct {
+	mu       sync.Mutex
+	messages []Message
+}
+
+func NewInMemoryMailer() *InMemoryMailer {
+	return &InMemoryMailer{}
+}
+
+func (im *InMemoryMailer) Send(_ context.Context, m Message) error {
+	if err := m.validate(); err != nil {
+		return err
+	}
+	im.mu.Lock()
+	defer im.mu.Unlock()
+	im.messages = append(im.messages, m)
+	return nil
+}
+
+// Messages returns the messages sent so far
+func (im *InMemoryMailer) Messages() []Message {
+	im.mu.Lock()
+	defer im.mu.Unlock()
+	return append([]Message(nil), im.messages...)
+}
+
+// MessagesTo returns the messages sent so far to the given address
+func (im *InMemoryMailer) MessagesTo(to string) []Message {
+	var messages []Message
+	for _, m := range im.Messages() {
+		if m.To == to {
+			messages = append(messages, m)
+		}
+	}
+	return messages
+}
+
+// FileMailer - writes every message to a .eml file in a directory instead of sending it. Meant for local development.
+type FileMailer struct {
+	dir string
+}
+
+func NewFileMailer(dir string) (*FileMailer, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, err
+	}
+	return &FileMailer{dir: dir}, nil
+}
+
+var unsafeFileNameChars = regexp.MustCompile(`[^a-zA-Z0-9@._-]`)
+
+func (fm *FileMailer) Send(_ context.Context, m Message) error {
+	if err := m.validate(); err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%d-%s.eml", time.Now().UnixNano(), unsafeFileNameChars.ReplaceAllString(m.To, "_"))
+	return os.WriteFile(filepath.Join(fm.dir, name), m.rfc822(""), 0o640)
+}
+
+// SMTPConfig - connection parameters of an SMTP relay
+type SMTPConfig struct {
+	// Addr is host:port
+	Addr     string
+	Username string
+	Password string
+	From     string
+}
+
+// SMTPMailer - sends messages through an SMTP relay, authenticating with PLAIN auth if a username is set
+type SMTPMailer struct {
+	config SMTPConfig
+}
+
+func NewSMTPMailer(config SMTPConfig) *SMTPMailer {
+	return &SMTPMailer{config: config}
+}
+
+func (sm *SMTPMailer) Send(_ context.Context, m Message) error {
+	if err := m.validate(); err != nil {
+		return err
+	}
+	var auth smtp.Auth
+	if sm.config.Username != "" {
+		host := sm.config.Addr
+		if i := strings.LastIndex(host, ":"); i >= 0 {
+			host = host[:i]
+		}
+		auth = smtp.PlainAuth("", sm.config.Username, sm.config.Password, host)
+	}
+	return smtp.SendMail(sm.config.Addr, auth, sm.config.From, []string{m.To}, m.rfc822(sm.config.From))
+}
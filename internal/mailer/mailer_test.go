@@ -0,0 +1,38 @@
+//go:build unit
+
+package mailer
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFileMailerWritesEml(t *testing.T) {
+	dir := t.TempDir()
+	fm, err := NewFileMailer(dir)
+	require.NoError(t, err)
+
+	require.NoError(t, fm.Send(context.Background(), Message{To: "a/b@mail.com", Subject: "hello", Body: "line 1\nline 2"}))
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.eml"))
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	assert.True(t, strings.HasSuffix(files[0], "-a_b@mail.com.eml"))
+
+	content, err := os.ReadFile(files[0])
+	require.NoError(t, err)
+	assert.Contains(t, string(content), "To: a/b@mail.com\r\nSubject: hello\r\n")
+	assert.True(t, strings.HasSuffix(string(content), "\r\n\r\nline 1\r\nline 2"))
+}
+
+func TestMailersRejectHeaderInjection(t *testing.T) {
+	m := NewInMemoryMailer()
+	err := m.Send(context.Background(), Message{To: "a@mail.com\r\nBcc: everyone@mail.com", Subject: "hi"})
+	assert.Error(t, err)
+	assert.Empty(t, m.Messages())
+}
@@ -0,0 +1,116 @@
+package metrics
+
+import (
+	"context"
+	"database/sql"
+	"github.com/antoniobelotti/splid_backend_clone/internal/event"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const namespace = "splid"
+
+// Metrics - every metric of the server, in a registry of its own. The domain packages know nothing about it: they
+// are observed through their events and their Observer interfaces.
+type Metrics struct {
+	registry *prometheus.Registry
+
+	httpRequests        *prometheus.CounterVec
+	httpRequestDuration *prometheus.HistogramVec
+
+	expensesCreated    prometheus.Counter
+	transfersCreated   prometheus.Counter
+	settlementPlanSize prometheus.Histogram
+	balanceDuration    prometheus.Histogram
+}
+
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		httpRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace, Subsystem: "http", Name: "requests_total",
+			Help: "HTTP requests by route, method and status code.",
+		}, []string{"route", "method", "code"}),
+		httpRequestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace, Subsystem: "http", Name: "request_duration_seconds",
+			Help:    "Time to serve HTTP requests, by route and method.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"route", "method"}),
+		expensesCreated: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace, Name: "expenses_created_total",
+			Help: "Expenses created, counted when their event is dispatched.",
+		}),
+		transfersCreated: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace, Name: "transfers_created_total",
+			Help: "Transfers created, counted when their event is dispatched.",
+		}),
+		settlementPlanSize: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: namespace, Name: "settlement_plan_transfers",
+			Help:    "Transfers suggested to even out the balance of a group.",
+			Buckets: []float64{0, 1, 2, 3, 5, 8, 13, 21, 34},
+		}),
+		balanceDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: namespace, Name: "balance_computation_seconds",
+			Help:    "Time to compute the balance of a group, reads included.",
+			Buckets: prometheus.DefBuckets,
+		}),
+	}
+
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.httpRequests,
+		m.httpRequestDuration,
+		m.expensesCreated,
+		m.transfersCreated,
+		m.settlementPlanSize,
+		m.balanceDuration,
+	)
+	return m
+}
+
+// Handler serves the metrics in the Prometheus text format
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{Registry: m.registry})
+}
+
+// RegisterDB exports the statistics of the connection pool, e.g. open and idle connections and the time spent
+// waiting for one
+func (m *Metrics) RegisterDB(db *sql.DB, name string) {
+	m.registry.MustRegister(collectors.NewDBStatsCollector(db, name))
+}
+
+// ObserveHTTPRequest - route is the pattern the request matched, e.g. "/api/v1/group/:groupId/join", so that the
+// number of series stays bounded
+func (m *Metrics) ObserveHTTPRequest(route string, method string, code int, d time.Duration) {
+	m.httpRequests.WithLabelValues(route, method, strconv.Itoa(code)).Inc()
+	m.httpRequestDuration.WithLabelValues(route, method).Observe(d.Seconds())
+}
+
+// EventTypes - the types of the events HandleEvent counts
+var EventTypes = []event.Type{event.ExpenseCreated, event.TransferCreated}
+
+// HandleEvent is the event.Handler to subscribe to the dispatcher for the EventTypes
+func (m *Metrics) HandleEvent(_ context.Context, e event.Event) error {
+	switch e.Type {
+	case event.ExpenseCreated:
+		m.expensesCreated.Inc()
+	case event.TransferCreated:
+		m.transfersCreated.Inc()
+	}
+	return nil
+}
+
+// BalanceComputed - see group.Observer
+func (m *Metrics) BalanceComputed(d time.Duration) {
+	m.balanceDuration.Observe(d.Seconds())
+}
+
+// SettlementPlanned - see group.Observer
+func (m *Metrics) SettlementPlanned(transfers int) {
+	m.settlementPlanSize.Observe(float64(transfers))
+}
@@ -0,0 +1,57 @@
+//go:build unit
+
+package metrics
+
+import (
+	"context"
+	"github.com/antoniobelotti/splid_backend_clone/internal/event"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHandleEvent(t *testing.T) {
+	m := New()
+	for _, typ := range []event.Type{event.ExpenseCreated, event.ExpenseCreated, event.TransferCreated, event.ExpenseDeleted} {
+		require.NoError(t, m.HandleEvent(context.Background(), event.Event{Type: typ}))
+	}
+
+	assert.Equal(t, 2.0, testutil.ToFloat64(m.expensesCreated))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.transfersCreated))
+}
+
+func TestObserveHTTPRequest(t *testing.T) {
+	m := New()
+	m.ObserveHTTPRequest("/api/v1/group/:groupId/balance", http.MethodGet, http.StatusOK, time.Millisecond)
+	m.ObserveHTTPRequest("/api/v1/group/:groupId/balance", http.MethodGet, http.StatusOK, time.Millisecond)
+	m.ObserveHTTPRequest("/api/v1/group/:groupId/balance", http.MethodGet, http.StatusNotFound, time.Millisecond)
+
+	assert.Equal(t, 2.0, testutil.ToFloat64(m.httpRequests.WithLabelValues("/api/v1/group/:groupId/balance", http.MethodGet, "200")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.httpRequests.WithLabelValues("/api/v1/group/:groupId/balance", http.MethodGet, "404")))
+	assert.Equal(t, 1, testutil.CollectAndCount(m.httpRequestDuration))
+}
+
+func TestHandler(t *testing.T) {
+	m := New()
+	m.BalanceComputed(3 * time.Millisecond)
+	m.SettlementPlanned(2)
+
+	w := httptest.NewRecorder()
+	m.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	require.Equal(t, http.StatusOK, w.Code)
+	body := w.Body.String()
+	for _, name := range []string{
+		"splid_balance_computation_seconds_count 1",
+		"splid_settlement_plan_transfers_sum 2",
+		"splid_expenses_created_total 0",
+		"go_goroutines",
+	} {
+		assert.True(t, strings.Contains(body, name), name)
+	}
+}
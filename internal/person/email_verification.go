@@ -0,0 +1,143 @@
+package person
+
+import (
+	"context"
+	"fmt"
+	"github.com/antoniobelotti/splid_backend_clone/internal/apperror"
+	"github.com/antoniobelotti/splid_backend_clone/internal/mailer"
+	"github.com/antoniobelotti/splid_backend_clone/internal/tracing"
+	"strings"
+	"time"
+)
+
+const (
+	EmailVerificationToken TokenPurpose = "email-verification"
+
+	// EmailVerificationTokenTTL - a verification link older than this does not work, a new one can be requested
+	EmailVerificationTokenTTL = 48 * time.Hour
+	// VerificationEmailInterval - minimum time between two verification emails to the same person
+	VerificationEmailInterval = time.Minute
+	// MaxVerificationEmailsPerDay - verification emails sent to the same person in the last 24 hours
+	MaxVerificationEmailsPerDay = 5
+)
+
+var (
+	ErrInvalidVerificationToken  = apperror.NewInvalidField("token", "invalid_verification_token", "invalid or expired email verification token")
+	ErrEmailAlreadyVerified      = apperror.New(apperror.Conflict, "email_already_verified", "email already verified")
+	ErrTooManyVerificationEmails = apperror.New(apperror.TooManyRequests, "too_many_verification_emails", "too many verification emails requested: try again later")
+	ErrEmailNotVerified          = apperror.New(apperror.Forbidden, "email_not_verified", "email not verified")
+)
+
+// Action - something an account may be prevented from doing until its email is verified
+type Action string
+
+const (
+	ActionCreateGroup Action = "create-group"
+	ActionJoinGroup   Action = "join-group"
+)
+
+// UnverifiedPolicy - the actions accounts with an unverified email may not perform
+type UnverifiedPolicy struct {
+	Restricted map[Action]bool
+}
+
+// DefaultUnverifiedPolicy - unverified accounts can use the app on their own but cannot join someone else's group: the
+// other members would see, and split expenses with, an address nobody has proven to own
+func DefaultUnverifiedPolicy() UnverifiedPolicy {
+	return UnverifiedPolicy{Restricted: map[Action]bool{
+		ActionJoinGroup: true,
+	}}
+}
+
+// ParseUnverifiedPolicy reads a comma separated list of restricted actions, e.g. "create-group,join-group". Only the
+// actions the api enforces are accepted.
+func ParseUnverifiedPolicy(restricted string) (UnverifiedPolicy, error) {
+	known := map[Action]bool{
+		ActionCreateGroup: true,
+		ActionJoinGroup:   true,
+	}
+	policy := UnverifiedPolicy{Restricted: map[Action]bool{}}
+	for _, a := range strings.Split(restricted, ",") {
+		a = strings.TrimSpace(a)
+		if a == "" {
+			continue
+		}
+		if !known[Action(a)] {
+			return UnverifiedPolicy{}, fmt.Errorf("unknown action %q", a)
+		}
+		policy.Restricted[Action(a)] = true
+	}
+	return policy, nil
+}
+
+// WithUnverifiedPolicy returns a copy of the service enforcing policy
+func (s Service) WithUnverifiedPolicy(policy UnverifiedPolicy) Service {
+	s.unverifiedPolicy = policy
+	return s
+}
+
+// IsAllowed tells whether the person may perform the action given the state of their email verification
+func (s *Service) IsAllowed(ctx context.Context, personId int, action Action) (_ bool, err error) {
+	ctx, span := tracer.Start(ctx, "person.IsAllowed")
+	defer func() { tracing.End(span, err) }()
+
+	if !s.unverifiedPolicy.Restricted[action] {
+		return true, nil
+	}
+	p, err := s.store.GetPersonById(ctx, personId)
+	if err != nil {
+		return false, err
+	}
+	return p.IsEmailVerified(), nil
+}
+
+// sendVerificationEmail issues a new token and mails the verification link
+func (s *Service) sendVerificationEmail(ctx context.Context, p Person) error {
+	token, err := s.issueToken(ctx, p.Id, EmailVerificationToken, EmailVerificationTokenTTL)
+	if err != nil {
+		return fmt.Errorf("%w %w", ErrUnexpected, err)
+	}
+
+	s.sendInBackground(ctx, mailer.Message{
+		To:      p.Email,
+		Subject: "Verify your email",
+		Body: fmt.Sprintf(
+			"Hi %s,\n\nplease confirm this is your email address by opening this link within %s:\n\n%s\n\nIf you did not sign up you can ignore this email.\n",
+			p.Name, EmailVerificationTokenTTL, s.link("/verify-email", token),
+		),
+	})
+	return nil
+}
+
+// ResendVerificationEmail sends a new verification link, at most once per VerificationEmailInterval and
+// MaxVerificationEmailsPerDay times a day
+func (s *Service) ResendVerificationEmail(ctx context.Context, personId int) (err error) {
+	ctx, span := tracer.Start(ctx, "person.ResendVerificationEmail")
+	defer func() { tracing.End(span, err) }()
+
+	p, err := s.store.GetPersonById(ctx, personId)
+	if err != nil {
+		return err
+	}
+	if p.IsEmailVerified() {
+		return ErrEmailAlreadyVerified
+	}
+
+	throttled, err := s.tooManyTokens(ctx, personId, EmailVerificationToken, VerificationEmailInterval, MaxVerificationEmailsPerDay)
+	if err != nil {
+		return fmt.Errorf("%w %w", ErrUnexpected, err)
+	}
+	if throttled {
+		return ErrTooManyVerificationEmails
+	}
+
+	return s.sendVerificationEmail(ctx, p)
+}
+
+// VerifyEmail marks the email of the token owner as verified
+func (s *Service) VerifyEmail(ctx context.Context, token string) (err error) {
+	ctx, span := tracer.Start(ctx, "person.VerifyEmail")
+	defer func() { tracing.End(span, err) }()
+
+	return s.store.VerifyEmail(ctx, hashToken(token))
+}
@@ -0,0 +1,92 @@
+//go:build unit
+
+package person
+
+import (
+	"context"
+	"github.com/antoniobelotti/splid_backend_clone/internal/mailer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestSignupSendsVerificationEmail(t *testing.T) {
+	store := newFakeStore()
+	m := mailer.NewInMemoryMailer()
+	s := NewService(store, m, "https://splid.example.com")
+	ctx := context.Background()
+
+	p, err := s.CreatePerson(ctx, "p", "p@mail.com", "password123")
+	require.NoError(t, err)
+	assert.False(t, p.IsEmailVerified())
+	require.Eventually(t, func() bool { return len(m.MessagesTo("p@mail.com")) == 1 }, time.Second, time.Millisecond)
+
+	token := tokenFromMail(t, m.Messages()[0], "/verify-email")
+	assert.ErrorIs(t, s.ResetPassword(ctx, token, "newPassword"), ErrInvalidResetToken, "tokens only work for their purpose")
+
+	require.NoError(t, s.VerifyEmail(ctx, token))
+	p, err = s.GetPersonById(ctx, p.Id)
+	require.NoError(t, err)
+	assert.True(t, p.IsEmailVerified())
+
+	assert.ErrorIs(t, s.VerifyEmail(ctx, token), ErrInvalidVerificationToken)
+	assert.ErrorIs(t, s.ResendVerificationEmail(ctx, p.Id), ErrEmailAlreadyVerified)
+}
+
+func TestResendVerificationEmailIsThrottled(t *testing.T) {
+	store := newFakeStore(Person{Id: 1, Email: "p@mail.com"})
+	s := NewService(store, mailer.NewInMemoryMailer(), "")
+	ctx := context.Background()
+
+	require.NoError(t, s.ResendVerificationEmail(ctx, 1))
+	assert.ErrorIs(t, s.ResendVerificationEmail(ctx, 1), ErrTooManyVerificationEmails)
+
+	// pretend the previous emails were sent a while ago: the daily limit still applies
+	for hash, token := range store.tokens {
+		token.CreatedAt = token.CreatedAt.Add(-2 * VerificationEmailInterval)
+		store.tokens[hash] = token
+	}
+	for i := 1; i < MaxVerificationEmailsPerDay; i++ {
+		require.NoError(t, store.CreateToken(ctx, Token{
+			TokenHash: hashToken(string(rune('a' + i))),
+			PersonId:  1,
+			Purpose:   EmailVerificationToken,
+			CreatedAt: time.Now().Add(-time.Hour),
+		}))
+	}
+	assert.ErrorIs(t, s.ResendVerificationEmail(ctx, 1), ErrTooManyVerificationEmails)
+}
+
+func TestUnverifiedPolicy(t *testing.T) {
+	verifiedAt := time.Now()
+	store := newFakeStore(Person{Id: 1}, Person{Id: 2, EmailVerifiedAt: &verifiedAt})
+	s := NewService(store, mailer.NewInMemoryMailer(), "")
+	ctx := context.Background()
+
+	allowed, err := s.IsAllowed(ctx, 1, ActionCreateGroup)
+	require.NoError(t, err)
+	assert.True(t, allowed)
+	for personId, want := range map[int]bool{1: false, 2: true} {
+		allowed, err = s.IsAllowed(ctx, personId, ActionJoinGroup)
+		require.NoError(t, err)
+		assert.Equal(t, want, allowed, "by default only verified accounts can join a group")
+	}
+
+	policy, err := ParseUnverifiedPolicy(" create-group ")
+	require.NoError(t, err)
+	s = s.WithUnverifiedPolicy(policy)
+	for personId, want := range map[int]bool{1: false, 2: true} {
+		allowed, err = s.IsAllowed(ctx, personId, ActionCreateGroup)
+		require.NoError(t, err)
+		assert.Equal(t, want, allowed)
+	}
+	allowed, err = s.IsAllowed(ctx, 1, ActionJoinGroup)
+	require.NoError(t, err)
+	assert.True(t, allowed)
+
+	_, err = ParseUnverifiedPolicy("fly")
+	assert.Error(t, err)
+	_, err = ParseUnverifiedPolicy("receive-reminders")
+	assert.Error(t, err, "no reminders are sent: the action cannot be restricted")
+}
@@ -0,0 +1,94 @@
+package person
+
+import (
+	"context"
+	"errors"
+	"github.com/antoniobelotti/splid_backend_clone/internal/apperror"
+	"github.com/antoniobelotti/splid_backend_clone/internal/tracing"
+	"strings"
+	"time"
+)
+
+// ExternalIdentity - an account at an OpenID Connect provider. Once linked, it logs in as the person.
+type ExternalIdentity struct {
+	Provider      string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+}
+
+var (
+	ErrExternalEmailNotVerified = apperror.New(apperror.Forbidden, "external_email_not_verified", "the identity provider has not verified the email")
+	ErrAccountEmailNotVerified  = apperror.New(apperror.Conflict, "account_email_not_verified", "an account with this email exists but its email is not verified: log in with the password and verify it first")
+	ErrExternalIdentityLinked   = apperror.New(apperror.Conflict, "external_identity_already_linked", "the identity is already linked to an account")
+)
+
+// LoginWithExternalIdentity returns the person the identity is linked to. An identity that is not linked yet is linked
+// to the person with the same email, or to a new person: in both cases the provider must have verified the email.
+//
+// Linking to an existing person also requires their email to be verified: whoever signed up with someone else's
+// address must not be handed their account when they sign in with their provider.
+func (s *Service) LoginWithExternalIdentity(ctx context.Context, identity ExternalIdentity) (_ Person, err error) {
+	ctx, span := tracer.Start(ctx, "person.LoginWithExternalIdentity")
+	defer func() { tracing.End(span, err) }()
+
+	p, err := s.resolveExternalIdentity(ctx, identity)
+	if errors.Is(err, ErrEmailAlreadyInUse) || errors.Is(err, ErrExternalIdentityLinked) {
+		// a concurrent first login created or linked the person in the meantime: resolve again, to that person
+		p, err = s.resolveExternalIdentity(ctx, identity)
+	}
+	return p, err
+}
+
+// resolveExternalIdentity - see LoginWithExternalIdentity
+func (s *Service) resolveExternalIdentity(ctx context.Context, identity ExternalIdentity) (Person, error) {
+	p, err := s.store.GetPersonByExternalIdentity(ctx, identity.Provider, identity.Subject)
+	if err == nil {
+		return p, nil
+	}
+	if !errors.Is(err, ErrPersonNotFound) {
+		return Person{}, err
+	}
+
+	if !identity.EmailVerified || identity.Email == "" {
+		return Person{}, ErrExternalEmailNotVerified
+	}
+
+	p, err = s.store.GetPersonByEmail(ctx, identity.Email)
+	switch {
+	case err == nil:
+		if !p.IsEmailVerified() {
+			return Person{}, ErrAccountEmailNotVerified
+		}
+		if err = s.store.LinkExternalIdentity(ctx, p.Id, identity.Provider, identity.Subject); err != nil {
+			return Person{}, err
+		}
+		return p, nil
+	case errors.Is(err, ErrPersonNotFound):
+		return s.createPersonWithExternalIdentity(ctx, identity)
+	default:
+		return Person{}, err
+	}
+}
+
+// createPersonWithExternalIdentity signs up a person without a password: they can set one with a password reset
+func (s *Service) createPersonWithExternalIdentity(ctx context.Context, identity ExternalIdentity) (Person, error) {
+	name := strings.TrimSpace(identity.Name)
+	if name == "" {
+		name, _, _ = strings.Cut(identity.Email, "@")
+	}
+	verifiedAt := time.Now().UTC()
+	p := Person{
+		Name:            name,
+		Email:           identity.Email,
+		EmailVerifiedAt: &verifiedAt,
+	}
+
+	id, err := s.store.CreatePersonWithExternalIdentity(ctx, p, identity.Provider, identity.Subject)
+	if err != nil {
+		return Person{}, err
+	}
+	p.Id = id
+	return p, nil
+}
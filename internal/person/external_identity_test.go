@@ -0,0 +1,76 @@
+//go:build unit
+
+package person
+
+import (
+	"context"
+	"github.com/antoniobelotti/splid_backend_clone/internal/mailer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestLoginWithExternalIdentityCreatesPerson(t *testing.T) {
+	store := newFakeStore()
+	s := NewService(store, mailer.NewInMemoryMailer(), "")
+	ctx := context.Background()
+	identity := ExternalIdentity{Provider: "google", Subject: "42", Email: "new@mail.com", EmailVerified: true}
+
+	p, err := s.LoginWithExternalIdentity(ctx, identity)
+	require.NoError(t, err)
+	assert.Equal(t, "new", p.Name)
+	assert.True(t, p.IsEmailVerified())
+	assert.Empty(t, p.Password)
+
+	// the link wins over the email, which may have changed at the provider
+	identity.Email = "changed@mail.com"
+	again, err := s.LoginWithExternalIdentity(ctx, identity)
+	require.NoError(t, err)
+	assert.Equal(t, p.Id, again.Id)
+	assert.Len(t, store.people, 1)
+}
+
+func TestLoginWithExternalIdentityRequiresVerifiedEmails(t *testing.T) {
+	verifiedAt := time.Now()
+	store := newFakeStore(
+		Person{Id: 1, Name: "verified", Email: "verified@mail.com", EmailVerifiedAt: &verifiedAt},
+		Person{Id: 2, Name: "unverified", Email: "unverified@mail.com"},
+	)
+	s := NewService(store, mailer.NewInMemoryMailer(), "")
+	ctx := context.Background()
+
+	_, err := s.LoginWithExternalIdentity(ctx, ExternalIdentity{Provider: "google", Subject: "1", Email: "verified@mail.com"})
+	assert.ErrorIs(t, err, ErrExternalEmailNotVerified)
+
+	_, err = s.LoginWithExternalIdentity(ctx, ExternalIdentity{Provider: "google", Subject: "2", Email: "unverified@mail.com", EmailVerified: true})
+	assert.ErrorIs(t, err, ErrAccountEmailNotVerified)
+
+	p, err := s.LoginWithExternalIdentity(ctx, ExternalIdentity{Provider: "google", Subject: "1", Email: "verified@mail.com", EmailVerified: true})
+	require.NoError(t, err)
+	assert.Equal(t, 1, p.Id)
+	assert.Equal(t, 1, store.externalIdentities["google/1"])
+	assert.Len(t, store.people, 2)
+}
+
+// racingStore - a concurrent first login with the same identity creates the person right before this one
+type racingStore struct {
+	*fakeStore
+}
+
+func (r racingStore) CreatePersonWithExternalIdentity(ctx context.Context, p Person, provider string, subject string) (int, error) {
+	if _, err := r.fakeStore.CreatePersonWithExternalIdentity(ctx, p, provider, subject); err != nil {
+		return 0, err
+	}
+	return 0, ErrEmailAlreadyInUse
+}
+
+func TestConcurrentFirstLoginsResolveToTheSamePerson(t *testing.T) {
+	store := newFakeStore()
+	s := NewService(racingStore{store}, mailer.NewInMemoryMailer(), "")
+
+	p, err := s.LoginWithExternalIdentity(context.Background(), ExternalIdentity{Provider: "google", Subject: "42", Email: "new@mail.com", EmailVerified: true})
+	require.NoError(t, err)
+	require.Len(t, store.people, 1)
+	assert.Equal(t, store.people[0].Id, p.Id)
+}
@@ -0,0 +1,164 @@
+package person
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/antoniobelotti/splid_backend_clone/internal/apperror"
+	"github.com/antoniobelotti/splid_backend_clone/internal/mailer"
+	"github.com/antoniobelotti/splid_backend_clone/internal/tracing"
+	"golang.org/x/crypto/bcrypt"
+	"log/slog"
+	"net/url"
+	"time"
+)
+
+// TokenPurpose - what a Token can be used for. A token of one purpose is never accepted for another.
+type TokenPurpose string
+
+const (
+	PasswordResetToken TokenPurpose = "password-reset"
+)
+
+const (
+	// PasswordResetTokenTTL - a reset link older than this does not work
+	PasswordResetTokenTTL = time.Hour
+	// PasswordResetEmailInterval - minimum time between two reset emails to the same person
+	PasswordResetEmailInterval = time.Minute
+	// MaxPasswordResetEmailsPerDay - reset emails sent to the same person in the last 24 hours
+	MaxPasswordResetEmailsPerDay = 5
+)
+
+// Token - a single-use secret mailed to a person. Only its sha256 hash is stored.
+type Token struct {
+	TokenHash string       `db:"token_hash"`
+	PersonId  int          `db:"person_id"`
+	Purpose   TokenPurpose `db:"purpose"`
+	CreatedAt time.Time    `db:"created_at"`
+	ExpiresAt time.Time    `db:"expires_at"`
+	UsedAt    *time.Time   `db:"used_at"`
+}
+
+var (
+	ErrInvalidResetToken = apperror.NewInvalidField("token", "invalid_reset_token", "invalid or expired password reset token")
+)
+
+func newToken(size int) (string, error) {
+	b := make([]byte, size)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func hashToken(token string) string {
+	h := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(h[:])
+}
+
+// issueToken stores a new token for the person and returns it in clear
+func (s *Service) issueToken(ctx context.Context, personId int, purpose TokenPurpose, ttl time.Duration) (string, error) {
+	token, err := newToken(32)
+	if err != nil {
+		return "", err
+	}
+	now := time.Now().UTC()
+	err = s.store.CreateToken(ctx, Token{
+		TokenHash: hashToken(token),
+		PersonId:  personId,
+		Purpose:   purpose,
+		CreatedAt: now,
+		ExpiresAt: now.Add(ttl),
+	})
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// tooManyTokens tells whether a token of purpose was issued to the person in the last interval, or maxPerDay of them
+// in the last 24 hours
+func (s *Service) tooManyTokens(ctx context.Context, personId int, purpose TokenPurpose, interval time.Duration, maxPerDay int) (bool, error) {
+	now := time.Now().UTC()
+	recent, err := s.store.CountTokensCreatedSince(ctx, personId, purpose, now.Add(-interval))
+	if err != nil {
+		return false, err
+	}
+	today, err := s.store.CountTokensCreatedSince(ctx, personId, purpose, now.Add(-24*time.Hour))
+	if err != nil {
+		return false, err
+	}
+	return recent > 0 || today >= maxPerDay, nil
+}
+
+// sendInBackground delivers the message without making the caller wait, so that response times do not reveal whether
+// a mail was sent. The delivery outlives ctx, keeping its values for the logs.
+func (s *Service) sendInBackground(ctx context.Context, m mailer.Message) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 30*time.Second)
+		defer cancel()
+		if err := s.mailer.Send(ctx, m); err != nil {
+			slog.ErrorContext(ctx, "unable to send mail", "subject", m.Subject, "error", err)
+		}
+	}()
+}
+
+func (s *Service) link(path string, token string) string {
+	return s.appBaseUrl + path + "?token=" + url.QueryEscape(token)
+}
+
+// RequestPasswordReset mails a reset link to the person with the given email, at most once per
+// PasswordResetEmailInterval and MaxPasswordResetEmailsPerDay times a day. Neither an unknown email nor a throttled
+// request is an error: the caller must not be able to tell whether the email is registered.
+func (s *Service) RequestPasswordReset(ctx context.Context, email string) (err error) {
+	ctx, span := tracer.Start(ctx, "person.RequestPasswordReset")
+	defer func() { tracing.End(span, err) }()
+
+	p, err := s.store.GetPersonByEmail(ctx, email)
+	if err != nil {
+		if errors.Is(err, ErrPersonNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	throttled, err := s.tooManyTokens(ctx, p.Id, PasswordResetToken, PasswordResetEmailInterval, MaxPasswordResetEmailsPerDay)
+	if err != nil {
+		return fmt.Errorf("%w %w", ErrUnexpected, err)
+	}
+	if throttled {
+		return nil
+	}
+
+	token, err := s.issueToken(ctx, p.Id, PasswordResetToken, PasswordResetTokenTTL)
+	if err != nil {
+		return fmt.Errorf("%w %w", ErrUnexpected, err)
+	}
+
+	s.sendInBackground(ctx, mailer.Message{
+		To:      p.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf(
+			"Hi %s,\n\nsomeone asked to reset the password of your account. If it was you, open this link within %s:\n\n%s\n\nOtherwise you can ignore this email.\n",
+			p.Name, PasswordResetTokenTTL, s.link("/reset-password", token),
+		),
+	})
+	return nil
+}
+
+// ResetPassword sets a new password using a token obtained with RequestPasswordReset. Every session of the person is
+// revoked and every other outstanding reset token is invalidated.
+func (s *Service) ResetPassword(ctx context.Context, token string, clearPassword string) (err error) {
+	ctx, span := tracer.Start(ctx, "person.ResetPassword")
+	defer func() { tracing.End(span, err) }()
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(clearPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return ErrUnexpected
+	}
+	return s.store.ResetPassword(ctx, hashToken(token), string(hashedPassword))
+}
@@ -0,0 +1,303 @@
+//go:build unit
+
+package person
+
+import (
+	"context"
+	"github.com/antoniobelotti/splid_backend_clone/internal/mailer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+type fakeStore struct {
+	people []Person
+	tokens map[string]Token
+	totp   map[int]TotpSecret
+	// recoveryCodes maps the hash of each unused recovery code to its owner
+	recoveryCodes map[string]int
+	// externalIdentities maps provider/subject to the linked person
+	externalIdentities map[string]int
+}
+
+func newFakeStore(people ...Person) *fakeStore {
+	return &fakeStore{people: people, tokens: map[string]Token{}, totp: map[int]TotpSecret{}, recoveryCodes: map[string]int{}, externalIdentities: map[string]int{}}
+}
+
+func (f *fakeStore) GetPersonById(_ context.Context, id int) (Person, error) {
+	for _, p := range f.people {
+		if p.Id == id {
+			return p, nil
+		}
+	}
+	return Person{}, ErrPersonNotFound
+}
+
+func (f *fakeStore) GetPersonsByIds(_ context.Context, ids []int) ([]Person, error) {
+	var found []Person
+	for _, p := range f.people {
+		for _, id := range ids {
+			if p.Id == id {
+				found = append(found, p)
+			}
+		}
+	}
+	return found, nil
+}
+
+func (f *fakeStore) CreatePerson(_ context.Context, p Person) (int, error) {
+	p.Id = len(f.people) + 1
+	f.people = append(f.people, p)
+	return p.Id, nil
+}
+
+func (f *fakeStore) GetPersonByEmail(_ context.Context, email string) (Person, error) {
+	for _, p := range f.people {
+		if p.Email == email {
+			return p, nil
+		}
+	}
+	return Person{}, ErrPersonNotFound
+}
+
+func (f *fakeStore) CreateToken(_ context.Context, t Token) error {
+	f.tokens[t.TokenHash] = t
+	return nil
+}
+
+func (f *fakeStore) ResetPassword(_ context.Context, tokenHash string, hashedPassword string) error {
+	t, ok := f.tokens[tokenHash]
+	if !ok || t.Purpose != PasswordResetToken || t.UsedAt != nil || time.Now().After(t.ExpiresAt) {
+		return ErrInvalidResetToken
+	}
+	now := time.Now()
+	t.UsedAt = &now
+	f.tokens[tokenHash] = t
+	for i := range f.people {
+		if f.people[i].Id == t.PersonId {
+			f.people[i].Password = hashedPassword
+		}
+	}
+	return nil
+}
+
+// tokenFromMail extracts the token from the link to path in the mail body
+func tokenFromMail(t *testing.T, m mailer.Message, path string) string {
+	_, link, found := strings.Cut(m.Body, "https://splid.example.com"+path+"?")
+	require.True(t, found)
+	query, err := url.ParseQuery(strings.Fields(link)[0])
+	require.NoError(t, err)
+	return query.Get("token")
+}
+
+func TestRequestPasswordResetMailsSingleUseToken(t *testing.T) {
+	store := newFakeStore(Person{Id: 1, Name: "p", Email: "p@mail.com"})
+	m := mailer.NewInMemoryMailer()
+	s := NewService(store, m, "https://splid.example.com/")
+	ctx := context.Background()
+
+	require.NoError(t, s.RequestPasswordReset(ctx, "p@mail.com"))
+	require.Eventually(t, func() bool { return len(m.Messages()) == 1 }, time.Second, time.Millisecond)
+
+	token := tokenFromMail(t, m.Messages()[0], "/reset-password")
+	stored, ok := store.tokens[hashToken(token)]
+	require.True(t, ok, "only the hash of the token is stored")
+	assert.Equal(t, 1, stored.PersonId)
+	assert.Equal(t, PasswordResetToken, stored.Purpose)
+	assert.WithinDuration(t, time.Now().Add(PasswordResetTokenTTL), stored.ExpiresAt, time.Minute)
+
+	require.NoError(t, s.ResetPassword(ctx, token, "newPassword"))
+	assert.NoError(t, bcrypt.CompareHashAndPassword([]byte(store.people[0].Password), []byte("newPassword")))
+
+	assert.ErrorIs(t, s.ResetPassword(ctx, token, "anotherPassword"), ErrInvalidResetToken)
+}
+
+func TestRequestPasswordResetForUnknownEmail(t *testing.T) {
+	m := mailer.NewInMemoryMailer()
+	s := NewService(newFakeStore(), m, "https://splid.example.com")
+
+	assert.NoError(t, s.RequestPasswordReset(context.Background(), "nobody@mail.com"))
+	time.Sleep(10 * time.Millisecond)
+	assert.Empty(t, m.Messages())
+}
+
+func TestRequestPasswordResetIsThrottled(t *testing.T) {
+	store := newFakeStore(Person{Id: 1, Email: "p@mail.com"})
+	m := mailer.NewInMemoryMailer()
+	s := NewService(store, m, "https://splid.example.com")
+	ctx := context.Background()
+
+	require.NoError(t, s.RequestPasswordReset(ctx, "p@mail.com"))
+	assert.NoError(t, s.RequestPasswordReset(ctx, "p@mail.com"), "throttling must not reveal that the email is registered")
+	assert.Len(t, store.tokens, 1)
+
+	// pretend the previous email was sent a while ago: the daily limit still applies
+	for hash, token := range store.tokens {
+		token.CreatedAt = token.CreatedAt.Add(-2 * PasswordResetEmailInterval)
+		store.tokens[hash] = token
+	}
+	for i := 1; i < MaxPasswordResetEmailsPerDay; i++ {
+		require.NoError(t, store.CreateToken(ctx, Token{
+			TokenHash: hashToken(string(rune('a' + i))),
+			PersonId:  1,
+			Purpose:   PasswordResetToken,
+			CreatedAt: time.Now().Add(-time.Hour),
+		}))
+	}
+	assert.NoError(t, s.RequestPasswordReset(ctx, "p@mail.com"))
+	assert.Len(t, store.tokens, MaxPasswordResetEmailsPerDay)
+
+	time.Sleep(10 * time.Millisecond)
+	assert.Len(t, m.Messages(), 1)
+}
+
+func TestResetPasswordRejectsExpiredToken(t *testing.T) {
+	store := newFakeStore(Person{Id: 1, Email: "p@mail.com"})
+	s := NewService(store, mailer.NewInMemoryMailer(), "")
+	store.tokens[hashToken("expired")] = Token{
+		TokenHash: hashToken("expired"),
+		PersonId:  1,
+		Purpose:   PasswordResetToken,
+		ExpiresAt: time.Now().Add(-time.Minute),
+	}
+
+	assert.ErrorIs(t, s.ResetPassword(context.Background(), "expired", "newPassword"), ErrInvalidResetToken)
+}
+
+func (f *fakeStore) CountTokensCreatedSince(_ context.Context, personId int, purpose TokenPurpose, since time.Time) (int, error) {
+	count := 0
+	for _, t := range f.tokens {
+		if t.PersonId == personId && t.Purpose == purpose && t.CreatedAt.After(since) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (f *fakeStore) VerifyEmail(_ context.Context, tokenHash string) error {
+	t, ok := f.tokens[tokenHash]
+	if !ok || t.Purpose != EmailVerificationToken || t.UsedAt != nil || time.Now().After(t.ExpiresAt) {
+		return ErrInvalidVerificationToken
+	}
+	now := time.Now()
+	t.UsedAt = &now
+	f.tokens[tokenHash] = t
+	for i := range f.people {
+		if f.people[i].Id == t.PersonId {
+			f.people[i].EmailVerifiedAt = &now
+		}
+	}
+	return nil
+}
+
+func (f *fakeStore) UpdatePersonName(_ context.Context, personId int, name string) error {
+	for i := range f.people {
+		if f.people[i].Id == personId {
+			f.people[i].Name = name
+			return nil
+		}
+	}
+	return ErrPersonNotFound
+}
+
+func (f *fakeStore) UpdatePersonEmail(_ context.Context, personId int, email string) error {
+	for _, p := range f.people {
+		if p.Id != personId && strings.EqualFold(p.Email, email) {
+			return ErrEmailAlreadyInUse
+		}
+	}
+	for i := range f.people {
+		if f.people[i].Id == personId {
+			f.people[i].Email = email
+			f.people[i].EmailVerifiedAt = nil
+		}
+	}
+	return nil
+}
+
+func (f *fakeStore) UpdatePassword(_ context.Context, personId int, hashedPassword string, _ string) error {
+	for i := range f.people {
+		if f.people[i].Id == personId {
+			f.people[i].Password = hashedPassword
+		}
+	}
+	return nil
+}
+
+func (f *fakeStore) SaveTotpSecret(_ context.Context, personId int, secret string) error {
+	if t, ok := f.totp[personId]; ok && t.EnabledAt != nil {
+		return ErrTotpAlreadyEnabled
+	}
+	f.totp[personId] = TotpSecret{PersonId: personId, Secret: secret}
+	return nil
+}
+
+func (f *fakeStore) GetTotpSecret(_ context.Context, personId int) (TotpSecret, error) {
+	t, ok := f.totp[personId]
+	if !ok {
+		return TotpSecret{}, ErrTotpNotEnabled
+	}
+	return t, nil
+}
+
+func (f *fakeStore) EnableTotp(_ context.Context, personId int, step int64, recoveryCodeHashes []string) error {
+	t := f.totp[personId]
+	now := time.Now()
+	t.EnabledAt = &now
+	t.LastUsedStep = step
+	f.totp[personId] = t
+	for _, h := range recoveryCodeHashes {
+		f.recoveryCodes[h] = personId
+	}
+	return nil
+}
+
+func (f *fakeStore) UseTotpStep(_ context.Context, personId int, step int64) (bool, error) {
+	t := f.totp[personId]
+	if t.LastUsedStep >= step {
+		return false, nil
+	}
+	t.LastUsedStep = step
+	f.totp[personId] = t
+	return true, nil
+}
+
+func (f *fakeStore) UseRecoveryCode(_ context.Context, personId int, codeHash string) (bool, error) {
+	if owner, ok := f.recoveryCodes[codeHash]; !ok || owner != personId {
+		return false, nil
+	}
+	delete(f.recoveryCodes, codeHash)
+	return true, nil
+}
+
+func (f *fakeStore) DeleteTotp(_ context.Context, personId int) error {
+	delete(f.totp, personId)
+	for h, owner := range f.recoveryCodes {
+		if owner == personId {
+			delete(f.recoveryCodes, h)
+		}
+	}
+	return nil
+}
+
+func (f *fakeStore) GetPersonByExternalIdentity(ctx context.Context, provider string, subject string) (Person, error) {
+	personId, ok := f.externalIdentities[provider+"/"+subject]
+	if !ok {
+		return Person{}, ErrPersonNotFound
+	}
+	return f.GetPersonById(ctx, personId)
+}
+
+func (f *fakeStore) LinkExternalIdentity(_ context.Context, personId int, provider string, subject string) error {
+	f.externalIdentities[provider+"/"+subject] = personId
+	return nil
+}
+
+func (f *fakeStore) CreatePersonWithExternalIdentity(ctx context.Context, p Person, provider string, subject string) (int, error) {
+	id, _ := f.CreatePerson(ctx, p)
+	return id, f.LinkExternalIdentity(ctx, id, provider, subject)
+}
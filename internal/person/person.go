@@ -3,47 +3,151 @@ package person
 import (
 	"context"
 	"errors"
+	"github.com/antoniobelotti/splid_backend_clone/internal/apperror"
+	"github.com/antoniobelotti/splid_backend_clone/internal/mailer"
+	"github.com/antoniobelotti/splid_backend_clone/internal/tracing"
+	"go.opentelemetry.io/otel"
 	"golang.org/x/crypto/bcrypt"
+	"log/slog"
+	"strings"
+	"time"
 )
 
+var tracer = otel.Tracer("github.com/antoniobelotti/splid_backend_clone/internal/person")
+
 // Person - models users of the application
 type Person struct {
-	Id       int    `json:"id"`
-	Name     string `json:"name"`
-	Password string `json:"-"` // never exported in json
-	Email    string `json:"email"`
+	Id              int        `json:"id"`
+	Name            string     `json:"name"`
+	Password        string     `json:"-"` // never exported in json
+	Email           string     `json:"email"`
+	EmailVerifiedAt *time.Time `json:"email-verified-at,omitempty" db:"email_verified_at"`
+	DeletedAt       *time.Time `json:"-" db:"deleted_at"`
+}
+
+func (p Person) IsEmailVerified() bool {
+	return p.EmailVerifiedAt != nil
+}
+
+// IsDeleted - deleted accounts are kept, anonymized, so that the expenses they took part in still add up
+func (p Person) IsDeleted() bool {
+	return p.DeletedAt != nil
 }
 
 // Store - this interface defines all methods the service needs to work
 type Store interface {
 	GetPersonById(ctx context.Context, id int) (Person, error)
+	// GetPersonsByIds returns the persons found, in no particular order
+	GetPersonsByIds(ctx context.Context, ids []int) ([]Person, error)
 	CreatePerson(ctx context.Context, person Person) (int, error)
 	GetPersonByEmail(ctx context.Context, email string) (Person, error)
+	CreateToken(ctx context.Context, t Token) error
+	// ResetPassword consumes the unused, unexpired password reset token, replaces the password and revokes every
+	// session of the person in a single transaction. Returns ErrInvalidResetToken if the token cannot be used.
+	ResetPassword(ctx context.Context, tokenHash string, hashedPassword string) error
+	CountTokensCreatedSince(ctx context.Context, personId int, purpose TokenPurpose, since time.Time) (int, error)
+	// VerifyEmail consumes the unused, unexpired email verification token and marks the email of its owner as verified.
+	// Returns ErrInvalidVerificationToken if the token cannot be used.
+	VerifyEmail(ctx context.Context, tokenHash string) error
+	UpdatePersonName(ctx context.Context, personId int, name string) error
+	// UpdatePersonEmail sets the email as unverified and invalidates the outstanding verification tokens.
+	// Returns ErrEmailAlreadyInUse if another person has the email.
+	UpdatePersonEmail(ctx context.Context, personId int, email string) error
+	// UpdatePassword replaces the password and revokes every session of the person except keepSessionId
+	UpdatePassword(ctx context.Context, personId int, hashedPassword string, keepSessionId string) error
+	// SaveTotpSecret stores a pending TOTP secret. Returns ErrTotpAlreadyEnabled if 2FA is already enabled.
+	SaveTotpSecret(ctx context.Context, personId int, secret string) error
+	// GetTotpSecret returns ErrTotpNotEnabled if the person never started enrolling
+	GetTotpSecret(ctx context.Context, personId int) (TotpSecret, error)
+	// EnableTotp enables 2FA, marks step as used and replaces the recovery codes
+	EnableTotp(ctx context.Context, personId int, step int64, recoveryCodeHashes []string) error
+	// UseTotpStep returns false if a code of this step, or of a later one, has already been used
+	UseTotpStep(ctx context.Context, personId int, step int64) (bool, error)
+	// UseRecoveryCode returns false if the code does not exist or has already been used
+	UseRecoveryCode(ctx context.Context, personId int, codeHash string) (bool, error)
+	DeleteTotp(ctx context.Context, personId int) error
+	// GetPersonByExternalIdentity returns ErrPersonNotFound if the identity is not linked to anybody
+	GetPersonByExternalIdentity(ctx context.Context, provider string, subject string) (Person, error)
+	// LinkExternalIdentity returns ErrExternalIdentityLinked if the identity is already linked
+	LinkExternalIdentity(ctx context.Context, personId int, provider string, subject string) error
+	// CreatePersonWithExternalIdentity creates the person and links the identity to them in a single transaction.
+	// Returns ErrEmailAlreadyInUse or ErrExternalIdentityLinked if a person has the email or the identity is linked.
+	CreatePersonWithExternalIdentity(ctx context.Context, p Person, provider string, subject string) (int, error)
 }
 
 var (
-	ErrPersonNotFound = errors.New("person does not exist")
-	ErrUnexpected     = errors.New("unexpected error")
+	ErrPersonNotFound     = apperror.New(apperror.NotFound, "person_not_found", "person does not exist")
+	ErrInvalidCredentials = apperror.New(apperror.Unauthorized, "invalid_credentials", "invalid email or password")
+	ErrUnexpected         = apperror.New(apperror.Internal, "unexpected_error", "unexpected error")
 )
 
+// dummyPasswordHash is checked when the email is unknown, so that answering takes as long as for a wrong password
+var dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("not a real password"), bcrypt.DefaultCost)
+
 // Service - will handle all logic related to Person types
 type Service struct {
-	store Store
+	store  Store
+	mailer mailer.Mailer
+	// appBaseUrl is the prefix of the links put in emails, e.g. https://splid.example.com
+	appBaseUrl       string
+	unverifiedPolicy UnverifiedPolicy
 }
 
-func NewService(store Store) Service {
-	return Service{store: store}
+func NewService(store Store, m mailer.Mailer, appBaseUrl string) Service {
+	return Service{
+		store:            store,
+		mailer:           m,
+		appBaseUrl:       strings.TrimSuffix(appBaseUrl, "/"),
+		unverifiedPolicy: DefaultUnverifiedPolicy(),
+	}
 }
 
-func (s *Service) GetPersonById(ctx context.Context, id int) (Person, error) {
+func (s *Service) GetPersonById(ctx context.Context, id int) (_ Person, err error) {
+	ctx, span := tracer.Start(ctx, "person.GetPersonById")
+	defer func() { tracing.End(span, err) }()
+
 	return s.store.GetPersonById(ctx, id)
 }
 
-func (s *Service) GetPersonByEmail(ctx context.Context, email string) (Person, error) {
+func (s *Service) GetPersonsByIds(ctx context.Context, ids []int) (_ []Person, err error) {
+	ctx, span := tracer.Start(ctx, "person.GetPersonsByIds")
+	defer func() { tracing.End(span, err) }()
+
+	return s.store.GetPersonsByIds(ctx, ids)
+}
+
+func (s *Service) GetPersonByEmail(ctx context.Context, email string) (_ Person, err error) {
+	ctx, span := tracer.Start(ctx, "person.GetPersonByEmail")
+	defer func() { tracing.End(span, err) }()
+
 	return s.store.GetPersonByEmail(ctx, email)
 }
 
-func (s *Service) CreatePerson(ctx context.Context, name string, email string, clearPassword string) (Person, error) {
+// Authenticate returns the person with the given credentials. Unknown emails and wrong passwords are
+// indistinguishable: both return ErrInvalidCredentials after a bcrypt comparison.
+func (s *Service) Authenticate(ctx context.Context, email string, clearPassword string) (_ Person, err error) {
+	ctx, span := tracer.Start(ctx, "person.Authenticate")
+	defer func() { tracing.End(span, err) }()
+
+	p, err := s.store.GetPersonByEmail(ctx, email)
+	if err != nil {
+		if !errors.Is(err, ErrPersonNotFound) {
+			return Person{}, err
+		}
+		_ = bcrypt.CompareHashAndPassword(dummyPasswordHash, []byte(clearPassword))
+		return Person{}, ErrInvalidCredentials
+	}
+
+	if bcrypt.CompareHashAndPassword([]byte(p.Password), []byte(clearPassword)) != nil {
+		return Person{}, ErrInvalidCredentials
+	}
+	return p, nil
+}
+
+func (s *Service) CreatePerson(ctx context.Context, name string, email string, clearPassword string) (_ Person, err error) {
+	ctx, span := tracer.Start(ctx, "person.CreatePerson")
+	defer func() { tracing.End(span, err) }()
+
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(clearPassword), bcrypt.DefaultCost)
 	if err != nil {
 		return Person{}, ErrUnexpected
@@ -61,5 +165,10 @@ func (s *Service) CreatePerson(ctx context.Context, name string, email string, c
 	}
 	p.Id = id
 
+	// the account exists anyway: the person can ask for a new verification email
+	if err = s.sendVerificationEmail(ctx, p); err != nil {
+		slog.ErrorContext(ctx, "unable to send verification email", "person_id", p.Id, "error", err)
+	}
+
 	return p, nil
 }
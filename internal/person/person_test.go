@@ -0,0 +1,25 @@
+//go:build unit
+
+package person
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestAuthenticate(t *testing.T) {
+	s, _, _, p := newProfileTestService(t)
+	ctx := context.Background()
+
+	got, err := s.Authenticate(ctx, "p@mail.com", "password123")
+	require.NoError(t, err)
+	assert.Equal(t, p.Id, got.Id)
+
+	_, err = s.Authenticate(ctx, "p@mail.com", "wrong")
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+
+	_, err = s.Authenticate(ctx, "unknown@mail.com", "password123")
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+}
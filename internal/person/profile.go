@@ -0,0 +1,99 @@
+package person
+
+import (
+	"context"
+	"fmt"
+	"github.com/antoniobelotti/splid_backend_clone/internal/apperror"
+	"github.com/antoniobelotti/splid_backend_clone/internal/mailer"
+	"github.com/antoniobelotti/splid_backend_clone/internal/tracing"
+	"golang.org/x/crypto/bcrypt"
+	"log/slog"
+	"strings"
+)
+
+var (
+	ErrWrongPassword     = apperror.New(apperror.Unauthorized, "wrong_password", "wrong password")
+	ErrEmailAlreadyInUse = apperror.New(apperror.Conflict, "email_already_in_use", "email already in use")
+	ErrInvalidName       = apperror.NewInvalidField("name", "invalid_name", "name cannot be empty")
+)
+
+func (s *Service) checkPassword(p Person, clearPassword string) error {
+	if bcrypt.CompareHashAndPassword([]byte(p.Password), []byte(clearPassword)) != nil {
+		return ErrWrongPassword
+	}
+	return nil
+}
+
+// UpdateName changes the display name of the person
+func (s *Service) UpdateName(ctx context.Context, personId int, name string) (_ Person, err error) {
+	ctx, span := tracer.Start(ctx, "person.UpdateName")
+	defer func() { tracing.End(span, err) }()
+
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return Person{}, ErrInvalidName
+	}
+	if err := s.store.UpdatePersonName(ctx, personId, name); err != nil {
+		return Person{}, err
+	}
+	return s.store.GetPersonById(ctx, personId)
+}
+
+// ChangeEmail replaces the email of the person, who has to confirm it with their password. The new email is
+// unverified until the link mailed to it is opened; the old address is told about the change.
+func (s *Service) ChangeEmail(ctx context.Context, personId int, clearPassword string, email string) (_ Person, err error) {
+	ctx, span := tracer.Start(ctx, "person.ChangeEmail")
+	defer func() { tracing.End(span, err) }()
+
+	p, err := s.store.GetPersonById(ctx, personId)
+	if err != nil {
+		return Person{}, err
+	}
+	if err = s.checkPassword(p, clearPassword); err != nil {
+		return Person{}, err
+	}
+	if strings.EqualFold(p.Email, email) {
+		return p, nil
+	}
+
+	if err = s.store.UpdatePersonEmail(ctx, personId, email); err != nil {
+		return Person{}, err
+	}
+	oldEmail := p.Email
+	p.Email = email
+	p.EmailVerifiedAt = nil
+
+	if err = s.sendVerificationEmail(ctx, p); err != nil {
+		slog.ErrorContext(ctx, "unable to send verification email", "person_id", p.Id, "error", err)
+	}
+	s.sendInBackground(ctx, mailer.Message{
+		To:      oldEmail,
+		Subject: "Your email has been changed",
+		Body: fmt.Sprintf(
+			"Hi %s,\n\nthe email of your account has been changed to %s. If you did not do it, reset your password and contact us.\n",
+			p.Name, email,
+		),
+	})
+	return p, nil
+}
+
+// ChangePassword replaces the password of the person, who has to provide the current one. Every session except
+// currentSessionId is revoked.
+func (s *Service) ChangePassword(ctx context.Context, personId int, currentSessionId string, currentPassword string, newPassword string) (err error) {
+	ctx, span := tracer.Start(ctx, "person.ChangePassword")
+	defer func() { tracing.End(span, err) }()
+
+	p, err := s.store.GetPersonById(ctx, personId)
+	if err != nil {
+		return err
+	}
+	if err = s.checkPassword(p, currentPassword); err != nil {
+		return err
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return ErrUnexpected
+	}
+	return s.store.UpdatePassword(ctx, personId, string(hashedPassword), currentSessionId)
+}
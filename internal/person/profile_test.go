@@ -0,0 +1,67 @@
+//go:build unit
+
+package person
+
+import (
+	"context"
+	"github.com/antoniobelotti/splid_backend_clone/internal/mailer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+	"testing"
+	"time"
+)
+
+func newProfileTestService(t *testing.T) (Service, *fakeStore, *mailer.InMemoryMailer, Person) {
+	store := newFakeStore()
+	m := mailer.NewInMemoryMailer()
+	s := NewService(store, m, "https://splid.example.com")
+	p, err := s.CreatePerson(context.Background(), "p", "p@mail.com", "password123")
+	require.NoError(t, err)
+	require.Eventually(t, func() bool { return len(m.Messages()) == 1 }, time.Second, time.Millisecond)
+	return s, store, m, p
+}
+
+func TestUpdateName(t *testing.T) {
+	s, _, _, p := newProfileTestService(t)
+
+	_, err := s.UpdateName(context.Background(), p.Id, " ")
+	assert.ErrorIs(t, err, ErrInvalidName)
+
+	updated, err := s.UpdateName(context.Background(), p.Id, " new name ")
+	require.NoError(t, err)
+	assert.Equal(t, "new name", updated.Name)
+}
+
+func TestChangeEmailRequiresPasswordAndReverification(t *testing.T) {
+	s, store, m, p := newProfileTestService(t)
+	ctx := context.Background()
+	verifiedAt := time.Now()
+	store.people[0].EmailVerifiedAt = &verifiedAt
+	store.people = append(store.people, Person{Id: 2, Email: "taken@mail.com"})
+
+	_, err := s.ChangeEmail(ctx, p.Id, "wrong", "new@mail.com")
+	assert.ErrorIs(t, err, ErrWrongPassword)
+	_, err = s.ChangeEmail(ctx, p.Id, "password123", "Taken@mail.com")
+	assert.ErrorIs(t, err, ErrEmailAlreadyInUse)
+
+	updated, err := s.ChangeEmail(ctx, p.Id, "password123", "new@mail.com")
+	require.NoError(t, err)
+	assert.Equal(t, "new@mail.com", updated.Email)
+	assert.False(t, updated.IsEmailVerified())
+
+	require.Eventually(t, func() bool {
+		return len(m.MessagesTo("new@mail.com")) == 1 && len(m.MessagesTo("p@mail.com")) == 2
+	}, time.Second, time.Millisecond)
+	assert.Equal(t, "Verify your email", m.MessagesTo("new@mail.com")[0].Subject)
+}
+
+func TestChangePassword(t *testing.T) {
+	s, store, _, p := newProfileTestService(t)
+	ctx := context.Background()
+
+	assert.ErrorIs(t, s.ChangePassword(ctx, p.Id, "session", "wrong", "newPassword"), ErrWrongPassword)
+
+	require.NoError(t, s.ChangePassword(ctx, p.Id, "session", "password123", "newPassword"))
+	assert.NoError(t, bcrypt.CompareHashAndPassword([]byte(store.people[0].Password), []byte("newPassword")))
+}
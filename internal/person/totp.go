@@ -0,0 +1,233 @@
+package person
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/antoniobelotti/splid_backend_clone/internal/apperror"
+	"github.com/antoniobelotti/splid_backend_clone/internal/tracing"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// TOTP parameters, see RFC 6238. These are the defaults every authenticator app supports.
+const (
+	totpDigits = 6
+	totpPeriod = 30 * time.Second
+	// totpSkew - codes of the adjacent periods are accepted too, to tolerate clock drift
+	totpSkew   = 1
+	totpIssuer = "Splid clone"
+
+	// RecoveryCodeCount - recovery codes handed out when 2FA is enabled. Each works once, in place of a TOTP code.
+	RecoveryCodeCount = 10
+)
+
+// TotpSecret - the shared secret of a person's authenticator. Until EnabledAt is set the enrollment is pending and the
+// secret is not required on login.
+type TotpSecret struct {
+	PersonId  int        `db:"person_id"`
+	Secret    string     `db:"secret"`
+	EnabledAt *time.Time `db:"enabled_at"`
+	// LastUsedStep - a code is accepted only once: codes of this step and earlier ones are refused
+	LastUsedStep int64 `db:"last_used_step"`
+}
+
+// TotpEnrollment - what the authenticator app needs. ProvisioningUri is meant to be shown as a QR code.
+type TotpEnrollment struct {
+	Secret          string `json:"secret"`
+	ProvisioningUri string `json:"provisioning-uri"`
+}
+
+var (
+	ErrTotpNotEnabled     = apperror.New(apperror.Conflict, "totp_not_enabled", "two-factor authentication is not enabled")
+	ErrTotpAlreadyEnabled = apperror.New(apperror.Conflict, "totp_already_enabled", "two-factor authentication is already enabled")
+	ErrInvalidTotpCode    = apperror.NewInvalidField("code", "invalid_totp_code", "invalid two-factor authentication code")
+)
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// totpCode returns the code of the given time step, see RFC 4226 section 5.3
+func totpCode(secret []byte, step int64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(step))
+	mac := hmac.New(sha1.New, secret)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, value%1_000_000)
+}
+
+// matchTotp returns the time step the code belongs to, if it is valid at the given time
+func matchTotp(secret string, code string, now time.Time) (int64, bool) {
+	key, err := totpEncoding.DecodeString(secret)
+	if err != nil || len(code) != totpDigits {
+		return 0, false
+	}
+	current := now.Unix() / int64(totpPeriod.Seconds())
+	for step := current - totpSkew; step <= current+totpSkew; step++ {
+		if subtle.ConstantTimeCompare([]byte(totpCode(key, step)), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+func provisioningUri(secret string, accountName string) string {
+	query := url.Values{}
+	query.Set("secret", secret)
+	query.Set("issuer", totpIssuer)
+	query.Set("algorithm", "SHA1")
+	query.Set("digits", fmt.Sprint(totpDigits))
+	query.Set("period", fmt.Sprint(int(totpPeriod.Seconds())))
+	return (&url.URL{
+		Scheme:   "otpauth",
+		Host:     "totp",
+		Path:     "/" + totpIssuer + ":" + accountName,
+		RawQuery: query.Encode(),
+	}).String()
+}
+
+// newRecoveryCode returns a code like "k3j9d-2mxq7"
+func newRecoveryCode() (string, error) {
+	b := make([]byte, 7)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	code := strings.ToLower(totpEncoding.EncodeToString(b))[:10]
+	return code[:5] + "-" + code[5:], nil
+}
+
+// normalizeRecoveryCode makes codes typed with different case or separators compare equal
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+}
+
+// IsTotpEnabled - whether the person has to enter a TOTP code on login
+func (s *Service) IsTotpEnabled(ctx context.Context, personId int) (_ bool, err error) {
+	ctx, span := tracer.Start(ctx, "person.IsTotpEnabled")
+	defer func() { tracing.End(span, err) }()
+
+	t, err := s.store.GetTotpSecret(ctx, personId)
+	if err != nil {
+		if errors.Is(err, ErrTotpNotEnabled) {
+			return false, nil
+		}
+		return false, err
+	}
+	return t.EnabledAt != nil, nil
+}
+
+// BeginTotpEnrollment generates a new secret for the person. 2FA is enabled once a code generated from it is confirmed
+// with ConfirmTotpEnrollment. Starting again replaces a pending secret.
+func (s *Service) BeginTotpEnrollment(ctx context.Context, personId int) (_ TotpEnrollment, err error) {
+	ctx, span := tracer.Start(ctx, "person.BeginTotpEnrollment")
+	defer func() { tracing.End(span, err) }()
+
+	p, err := s.store.GetPersonById(ctx, personId)
+	if err != nil {
+		return TotpEnrollment{}, err
+	}
+
+	key := make([]byte, 20)
+	if _, err = rand.Read(key); err != nil {
+		return TotpEnrollment{}, fmt.Errorf("%w %w", ErrUnexpected, err)
+	}
+	secret := totpEncoding.EncodeToString(key)
+
+	if err = s.store.SaveTotpSecret(ctx, personId, secret); err != nil {
+		return TotpEnrollment{}, err
+	}
+	return TotpEnrollment{Secret: secret, ProvisioningUri: provisioningUri(secret, p.Email)}, nil
+}
+
+// ConfirmTotpEnrollment enables 2FA if code is valid for the pending secret and returns the recovery codes. They are
+// shown only this once: only their hashes are stored.
+func (s *Service) ConfirmTotpEnrollment(ctx context.Context, personId int, code string) (_ []string, err error) {
+	ctx, span := tracer.Start(ctx, "person.ConfirmTotpEnrollment")
+	defer func() { tracing.End(span, err) }()
+
+	t, err := s.store.GetTotpSecret(ctx, personId)
+	if err != nil {
+		return nil, err
+	}
+	if t.EnabledAt != nil {
+		return nil, ErrTotpAlreadyEnabled
+	}
+	step, ok := matchTotp(t.Secret, code, time.Now())
+	if !ok {
+		return nil, ErrInvalidTotpCode
+	}
+
+	codes := make([]string, RecoveryCodeCount)
+	hashes := make([]string, RecoveryCodeCount)
+	for i := range codes {
+		if codes[i], err = newRecoveryCode(); err != nil {
+			return nil, fmt.Errorf("%w %w", ErrUnexpected, err)
+		}
+		hashes[i] = hashToken(normalizeRecoveryCode(codes[i]))
+	}
+
+	if err = s.store.EnableTotp(ctx, personId, step, hashes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// DisableTotp removes the secret and the recovery codes. The person has to confirm with their password.
+func (s *Service) DisableTotp(ctx context.Context, personId int, clearPassword string) (err error) {
+	ctx, span := tracer.Start(ctx, "person.DisableTotp")
+	defer func() { tracing.End(span, err) }()
+
+	p, err := s.store.GetPersonById(ctx, personId)
+	if err != nil {
+		return err
+	}
+	if err = s.checkPassword(p, clearPassword); err != nil {
+		return err
+	}
+	return s.store.DeleteTotp(ctx, personId)
+}
+
+// VerifySecondFactor accepts either a TOTP code or an unused recovery code. Each code works only once.
+func (s *Service) VerifySecondFactor(ctx context.Context, personId int, code string) (err error) {
+	ctx, span := tracer.Start(ctx, "person.VerifySecondFactor")
+	defer func() { tracing.End(span, err) }()
+
+	t, err := s.store.GetTotpSecret(ctx, personId)
+	if err != nil {
+		return err
+	}
+	if t.EnabledAt == nil {
+		return ErrTotpNotEnabled
+	}
+
+	code = strings.TrimSpace(code)
+	if step, ok := matchTotp(t.Secret, code, time.Now()); ok {
+		used, err := s.store.UseTotpStep(ctx, personId, step)
+		if err != nil {
+			return err
+		}
+		if !used {
+			return ErrInvalidTotpCode
+		}
+		return nil
+	}
+
+	used, err := s.store.UseRecoveryCode(ctx, personId, hashToken(normalizeRecoveryCode(code)))
+	if err != nil {
+		return err
+	}
+	if !used {
+		return ErrInvalidTotpCode
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+//go:build unit
+
+package person
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// currentTotpCode plays the authenticator app
+func currentTotpCode(t *testing.T, secret string) string {
+	key, err := totpEncoding.DecodeString(secret)
+	require.NoError(t, err)
+	return totpCode(key, time.Now().Unix()/int64(totpPeriod.Seconds()))
+}
+
+func TestTotpCodeMatchesRfc6238(t *testing.T) {
+	// test vectors of RFC 6238 appendix B, truncated to 6 digits
+	key := []byte("12345678901234567890")
+	assert.Equal(t, "287082", totpCode(key, 59/30))
+	assert.Equal(t, "081804", totpCode(key, 1111111109/30))
+	assert.Equal(t, "005924", totpCode(key, 1234567890/30))
+
+	secret := totpEncoding.EncodeToString(key)
+	now := time.Unix(1111111109, 0)
+	step, ok := matchTotp(secret, "081804", now.Add(totpPeriod))
+	assert.True(t, ok, "codes of the previous period are accepted")
+	assert.Equal(t, int64(1111111109/30), step)
+	_, ok = matchTotp(secret, "081804", now.Add(3*totpPeriod))
+	assert.False(t, ok)
+}
+
+func TestTotpEnrollment(t *testing.T) {
+	s, _, _, p := newProfileTestService(t)
+	ctx := context.Background()
+
+	enabled, err := s.IsTotpEnabled(ctx, p.Id)
+	require.NoError(t, err)
+	assert.False(t, enabled)
+
+	enrollment, err := s.BeginTotpEnrollment(ctx, p.Id)
+	require.NoError(t, err)
+	uri, err := url.Parse(enrollment.ProvisioningUri)
+	require.NoError(t, err)
+	assert.Equal(t, "otpauth", uri.Scheme)
+	assert.Equal(t, enrollment.Secret, uri.Query().Get("secret"))
+	assert.Contains(t, uri.Path, p.Email)
+
+	_, err = s.ConfirmTotpEnrollment(ctx, p.Id, "000000")
+	assert.ErrorIs(t, err, ErrInvalidTotpCode)
+
+	codes, err := s.ConfirmTotpEnrollment(ctx, p.Id, currentTotpCode(t, enrollment.Secret))
+	require.NoError(t, err)
+	assert.Len(t, codes, RecoveryCodeCount)
+
+	enabled, err = s.IsTotpEnabled(ctx, p.Id)
+	require.NoError(t, err)
+	assert.True(t, enabled)
+
+	_, err = s.BeginTotpEnrollment(ctx, p.Id)
+	assert.ErrorIs(t, err, ErrTotpAlreadyEnabled)
+}
+
+func TestVerifySecondFactor(t *testing.T) {
+	s, store, _, p := newProfileTestService(t)
+	ctx := context.Background()
+
+	enrollment, err := s.BeginTotpEnrollment(ctx, p.Id)
+	require.NoError(t, err)
+	codes, err := s.ConfirmTotpEnrollment(ctx, p.Id, currentTotpCode(t, enrollment.Secret))
+	require.NoError(t, err)
+
+	assert.ErrorIs(t, s.VerifySecondFactor(ctx, p.Id, currentTotpCode(t, enrollment.Secret)), ErrInvalidTotpCode,
+		"the code used to confirm the enrollment cannot be replayed")
+
+	// pretend the enrollment happened a few periods ago
+	secret := store.totp[p.Id]
+	secret.LastUsedStep -= 5
+	store.totp[p.Id] = secret
+	code := currentTotpCode(t, enrollment.Secret)
+	require.NoError(t, s.VerifySecondFactor(ctx, p.Id, code))
+	assert.ErrorIs(t, s.VerifySecondFactor(ctx, p.Id, code), ErrInvalidTotpCode)
+
+	require.NoError(t, s.VerifySecondFactor(ctx, p.Id, " "+codes[0]+" "))
+	assert.ErrorIs(t, s.VerifySecondFactor(ctx, p.Id, codes[0]), ErrInvalidTotpCode, "recovery codes work once")
+	assert.NoError(t, s.VerifySecondFactor(ctx, p.Id, "  "+codes[1][:5]+codes[1][6:]), "the separator is optional")
+}
+
+func TestDisableTotpRequiresPassword(t *testing.T) {
+	s, _, _, p := newProfileTestService(t)
+	ctx := context.Background()
+
+	enrollment, err := s.BeginTotpEnrollment(ctx, p.Id)
+	require.NoError(t, err)
+	_, err = s.ConfirmTotpEnrollment(ctx, p.Id, currentTotpCode(t, enrollment.Secret))
+	require.NoError(t, err)
+
+	assert.ErrorIs(t, s.DisableTotp(ctx, p.Id, "wrong"), ErrWrongPassword)
+	require.NoError(t, s.DisableTotp(ctx, p.Id, "password123"))
+
+	enabled, err := s.IsTotpEnabled(ctx, p.Id)
+	require.NoError(t, err)
+	assert.False(t, enabled)
+}
@@ -0,0 +1,116 @@
+package postgresdb
+
+import (
+	"context"
+	"fmt"
+	"github.com/antoniobelotti/splid_backend_clone/internal/account"
+	"github.com/antoniobelotti/splid_backend_clone/internal/attachment"
+	"github.com/antoniobelotti/splid_backend_clone/internal/event"
+	"github.com/antoniobelotti/splid_backend_clone/internal/expense"
+	"github.com/antoniobelotti/splid_backend_clone/internal/recurring"
+	"github.com/antoniobelotti/splid_backend_clone/internal/transfer"
+)
+
+// expensesInvolvingPerson - expenses the person recorded, paid or consumed items of
+const expensesInvolvingPerson = `(e.person_id = $1
+				OR EXISTS(SELECT 1 FROM expense_payer p WHERE p.expense_id = e.id AND p.person_id = $1)
+				OR EXISTS(SELECT 1 FROM expense_item_consumer c JOIN expense_item i ON i.id = c.item_id
+				          WHERE i.expense_id = e.id AND c.person_id = $1))`
+
+func (pg *PostgresDatabase) GetExpensesByPersonId(ctx context.Context, personId int) ([]expense.Expense, error) {
+	expenses := []expense.Expense{}
+	err := pg.SelectContext(
+		ctx,
+		&expenses,
+		`SELECT e.id, e.amount_in_cents, e.person_id, e.group_id FROM expense e WHERE `+expensesInvolvingPerson+` ORDER BY e.id`,
+		personId,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w %w", account.ErrUnexpected, err)
+	}
+
+	if err = pg.loadExpenseDetails(ctx, expenses, expensesInvolvingPerson, personId); err != nil {
+		return nil, fmt.Errorf("%w %w", account.ErrUnexpected, err)
+	}
+	return expenses, nil
+}
+
+func (pg *PostgresDatabase) GetTransfersByPersonId(ctx context.Context, personId int) ([]transfer.Transfer, error) {
+	transfers := []transfer.Transfer{}
+	err := pg.SelectContext(
+		ctx,
+		&transfers,
+		`SELECT id, amount_in_cents, group_id, sender_id, receiver_id FROM transfer WHERE sender_id=$1 OR receiver_id=$1 ORDER BY id`,
+		personId,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w %w", account.ErrUnexpected, err)
+	}
+	return transfers, nil
+}
+
+func (pg *PostgresDatabase) GetRecurringExpensesByPersonId(ctx context.Context, personId int) ([]recurring.Template, error) {
+	templates := []recurring.Template{}
+	err := pg.SelectContext(
+		ctx,
+		&templates,
+		`SELECT `+recurringExpenseColumns+` FROM recurring_expense WHERE person_id=$1 ORDER BY id`,
+		personId,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w %w", account.ErrUnexpected, err)
+	}
+	return templates, nil
+}
+
+func (pg *PostgresDatabase) GetAttachmentsByUploaderId(ctx context.Context, personId int) ([]attachment.Attachment, error) {
+	attachments := []attachment.Attachment{}
+	err := pg.SelectContext(ctx, &attachments, `SELECT `+attachmentColumns+` FROM attachment WHERE uploader_id=$1 ORDER BY id`, personId)
+	if err != nil {
+		return nil, fmt.Errorf("%w %w", account.ErrUnexpected, err)
+	}
+	for i := range attachments {
+		attachments[i].HasThumbnail = attachments[i].ThumbnailKey != nil
+	}
+	return attachments, nil
+}
+
+func (pg *PostgresDatabase) AnonymizePerson(ctx context.Context, personId int) error {
+	transaction, err := pg.DB.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%w %w", account.ErrUnexpected, err)
+	}
+
+	for _, query := range []string{
+		// before the email is overwritten: the attempts are stored with the normalized email
+		`DELETE FROM login_attempt WHERE email = (SELECT lower(trim(email)) FROM person WHERE id=$1)`,
+		// the email must stay unique: not being an email address, nobody can sign up with it
+		`UPDATE person
+				SET name = 'Deleted user', email = 'deleted-' || id, password = '',
+				    email_verified_at = NULL, deleted_at = now()
+				WHERE id=$1`,
+		`DELETE FROM refresh_token WHERE session_id IN (SELECT id FROM session WHERE person_id=$1)`,
+		`DELETE FROM session WHERE person_id=$1`,
+		`DELETE FROM personal_access_token WHERE person_id=$1`,
+		`DELETE FROM external_identity WHERE person_id=$1`,
+		`DELETE FROM person_token WHERE person_id=$1`,
+		`DELETE FROM totp_recovery_code WHERE person_id=$1`,
+		`DELETE FROM person_totp WHERE person_id=$1`,
+		`DELETE FROM recurring_expense WHERE person_id=$1`,
+	} {
+		if _, err = transaction.ExecContext(ctx, query, personId); err != nil {
+			_ = transaction.Rollback()
+			return fmt.Errorf("%w %w", account.ErrUnexpected, err)
+		}
+	}
+
+	if err = insertOutboxEvent(ctx, transaction, event.PersonDeleted, event.PersonDeletedPayload{PersonId: personId}); err != nil {
+		_ = transaction.Rollback()
+		return fmt.Errorf("%w %w", account.ErrUnexpected, err)
+	}
+
+	if err = transaction.Commit(); err != nil {
+		return fmt.Errorf("%w %w", account.ErrUnexpected, err)
+	}
+	return nil
+}
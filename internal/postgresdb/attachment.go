@@ -0,0 +1,58 @@
+package postgresdb
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/antoniobelotti/splid_backend_clone/internal/attachment"
+)
+
+const attachmentColumns = `id, expense_id, uploader_id, file_name, content_type, size_in_bytes, blob_key, thumbnail_key, created_at`
+
+func (pg *PostgresDatabase) CreateAttachment(ctx context.Context, a attachment.Attachment) (int, error) {
+	var attachmentId int
+	err := pg.QueryRowContext(
+		ctx,
+		`INSERT INTO attachment(expense_id, uploader_id, file_name, content_type, size_in_bytes, blob_key, thumbnail_key, created_at)
+				VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+				RETURNING id`,
+		a.ExpenseId, a.UploaderId, a.FileName, a.ContentType, a.SizeInBytes, a.BlobKey, a.ThumbnailKey, a.CreatedAt,
+	).Scan(&attachmentId)
+	if err != nil {
+		return 0, fmt.Errorf("CreateAttachment unable to insert: %w", err)
+	}
+	return attachmentId, nil
+}
+
+func (pg *PostgresDatabase) GetAttachmentById(ctx context.Context, attachmentId int) (attachment.Attachment, error) {
+	var a attachment.Attachment
+	err := pg.GetContext(ctx, &a, `SELECT `+attachmentColumns+` FROM attachment WHERE id=$1`, attachmentId)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return a, fmt.Errorf("%w %w", attachment.ErrAttachmentNotFound, err)
+		}
+		return a, fmt.Errorf("%w %w", attachment.ErrUnexpected, err)
+	}
+	a.HasThumbnail = a.ThumbnailKey != nil
+	return a, nil
+}
+
+func (pg *PostgresDatabase) GetAttachmentsByExpenseId(ctx context.Context, expenseId int) ([]attachment.Attachment, error) {
+	attachments := []attachment.Attachment{}
+	err := pg.SelectContext(ctx, &attachments, `SELECT `+attachmentColumns+` FROM attachment WHERE expense_id=$1 ORDER BY id`, expenseId)
+	if err != nil {
+		return nil, fmt.Errorf("%w %w", attachment.ErrUnexpected, err)
+	}
+	for i := range attachments {
+		attachments[i].HasThumbnail = attachments[i].ThumbnailKey != nil
+	}
+	return attachments, nil
+}
+
+func (pg *PostgresDatabase) DeleteAttachment(ctx context.Context, attachmentId int) error {
+	if _, err := pg.ExecContext(ctx, `DELETE FROM attachment WHERE id=$1`, attachmentId); err != nil {
+		return fmt.Errorf("%w %w", attachment.ErrUnexpected, err)
+	}
+	return nil
+}
@@ -1,47 +1,74 @@
 package postgresdb
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"github.com/XSAM/otelsql"
 	"github.com/jmoiron/sqlx"
 	_ "github.com/lib/pq"
-	"os"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"log/slog"
 )
 
 var (
 	ErrDBConnectionError = errors.New("unable to connect to postgres database")
 )
 
+// uniqueViolation - postgres error code of unique constraint violations
+const uniqueViolation = "23505"
+
 type PostgresDatabase struct {
 	*sqlx.DB
 }
 
-func mustGetEnv(key string) string {
-	value := os.Getenv(key)
-	if value == "" {
-		panic(fmt.Sprintf("%s env variable is not set", key))
-	}
-	return value
-}
-
+// NewDatabase connects to the database of connectionStr, e.g. config.Database.ConnectionString()
 func NewDatabase(connectionStr string) (*PostgresDatabase, error) {
-	if connectionStr == "" {
-		fmt.Println("building postgres connection string from environment variables")
-		connectionStr = fmt.Sprintf("host=%s port=%s dbname=%s user=%s password=%s sslmode=%s",
-			mustGetEnv("DB_HOST"),
-			mustGetEnv("DB_PORT"),
-			mustGetEnv("DB_NAME"),
-			mustGetEnv("DB_USERNAME"),
-			mustGetEnv("DB_PASSWORD"),
-			mustGetEnv("DB_SSLMODE"),
-		)
-	}
-
-	db, err := sqlx.Connect("postgres", connectionStr)
+	// every query is traced, as a child of the span of the context it is run with
+	sqlDb, err := otelsql.Open("postgres", connectionStr,
+		otelsql.WithAttributes(semconv.DBSystemPostgreSQL),
+		otelsql.WithSpanOptions(otelsql.SpanOptions{DisableErrSkip: true, OmitConnResetSession: true, OmitRows: true}),
+	)
 	if err != nil {
-		fmt.Println(err.Error())
+		slog.Error("unable to connect to the database", "error", err)
+		return &PostgresDatabase{}, ErrDBConnectionError
+	}
+	db := sqlx.NewDb(sqlDb, "postgres")
+	if err = db.Ping(); err != nil {
+		_ = db.Close()
+		slog.Error("unable to connect to the database", "error", err)
 		return &PostgresDatabase{}, ErrDBConnectionError
 	}
 
 	return &PostgresDatabase{db}, nil
 }
+
+// SchemaVersion returns the version of the last migration applied by golang-migrate, and whether it failed halfway
+func (pg *PostgresDatabase) SchemaVersion(ctx context.Context) (uint, bool, error) {
+	var (
+		version uint
+		dirty   bool
+	)
+	err := pg.QueryRowxContext(ctx, `SELECT version, dirty FROM schema_migrations LIMIT 1;`).Scan(&version, &dirty)
+	if err != nil {
+		return 0, false, fmt.Errorf("SchemaVersion %w", err)
+	}
+	return version, dirty, nil
+}
+
+// CheckSchemaVersion is a health.Check failing unless the database is at the expected migration version
+func (pg *PostgresDatabase) CheckSchemaVersion(expected uint) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		version, dirty, err := pg.SchemaVersion(ctx)
+		if err != nil {
+			return err
+		}
+		if dirty {
+			return fmt.Errorf("migration %d failed and must be fixed by hand", version)
+		}
+		if version != expected {
+			return fmt.Errorf("schema at version %d, expected %d", version, expected)
+		}
+		return nil
+	}
+}
@@ -2,8 +2,13 @@ package postgresdb
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"fmt"
+	"github.com/antoniobelotti/splid_backend_clone/internal/event"
 	"github.com/antoniobelotti/splid_backend_clone/internal/expense"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 )
 
 func (pg *PostgresDatabase) IsPersonInGroup(ctx context.Context, groupId int, personId int) (bool, error) {
@@ -18,27 +23,287 @@ func (pg *PostgresDatabase) IsPersonInGroup(ctx context.Context, groupId int, pe
 	return personInGroup, nil
 }
 
-func (pg *PostgresDatabase) CreateExpense(ctx context.Context, AmountInCents int, PersonId int, GroupId int) (int, error) {
-	var expenseId int
-	err := pg.QueryRowContext(
+func (pg *PostgresDatabase) CreateExpense(ctx context.Context, e expense.Expense, idempotencyKey string) (int, error) {
+	transaction, err := pg.DB.BeginTxx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("CreateExpense unable to begin transaction: %w", err)
+	}
+
+	err = transaction.QueryRowContext(
 		ctx,
-		`INSERT INTO expense(amount_in_cents, person_id, group_id)
-				VALUES ($1, $2, $3)
+		`INSERT INTO expense(amount_in_cents, person_id, group_id, idempotency_key)
+				VALUES ($1, $2, $3, NULLIF($4, ''))
+				ON CONFLICT (idempotency_key) DO NOTHING
 				RETURNING id`,
-		AmountInCents, PersonId, GroupId,
-	).Scan(&expenseId)
+		e.AmountInCents, e.PersonId, e.GroupId, idempotencyKey,
+	).Scan(&e.Id)
+	if errors.Is(err, sql.ErrNoRows) {
+		// the expense was already created by a previous call with the same key: nothing to do, the event was emitted back then
+		_ = transaction.Rollback()
+		if err = pg.GetContext(ctx, &e.Id, `SELECT id FROM expense WHERE idempotency_key=$1`, idempotencyKey); err != nil {
+			return 0, fmt.Errorf("CreateExpense unable to get existing expense: %w", err)
+		}
+		return e.Id, nil
+	}
 	if err != nil {
+		_ = transaction.Rollback()
 		return 0, fmt.Errorf("CreateExpense unable to insert: %w", err)
 	}
 
-	return expenseId, nil
+	if e.Itemization != nil {
+		if err = insertItemization(ctx, transaction, e.Id, *e.Itemization); err != nil {
+			_ = transaction.Rollback()
+			return 0, fmt.Errorf("CreateExpense %w", err)
+		}
+	}
+
+	for _, p := range e.Payers {
+		if _, err = transaction.ExecContext(
+			ctx,
+			`INSERT INTO expense_payer(expense_id, person_id, amount_in_cents) VALUES ($1, $2, $3)`,
+			e.Id, p.PersonId, p.AmountInCents,
+		); err != nil {
+			_ = transaction.Rollback()
+			return 0, fmt.Errorf("CreateExpense unable to insert payer: %w", err)
+		}
+	}
+
+	if err = insertOutboxEvent(ctx, transaction, event.ExpenseCreated, e); err != nil {
+		_ = transaction.Rollback()
+		return 0, fmt.Errorf("CreateExpense %w", err)
+	}
+
+	return e.Id, transaction.Commit()
+}
+
+func insertItemization(ctx context.Context, transaction *sqlx.Tx, expenseId int, it expense.Itemization) error {
+	if _, err := transaction.ExecContext(
+		ctx,
+		`INSERT INTO expense_itemization(expense_id, tax_in_cents, tip_in_cents, tax_rule, tip_rule)
+				VALUES ($1, $2, $3, $4, $5)`,
+		expenseId, it.TaxInCents, it.TipInCents, it.TaxRule, it.TipRule,
+	); err != nil {
+		return fmt.Errorf("insertItemization unable to insert itemization: %w", err)
+	}
+
+	for position, item := range it.Items {
+		var itemId int
+		if err := transaction.QueryRowContext(
+			ctx,
+			`INSERT INTO expense_item(expense_id, position, description, unit_price_in_cents, quantity)
+					VALUES ($1, $2, $3, $4, $5)
+					RETURNING id`,
+			expenseId, position, item.Description, item.UnitPriceInCents, item.Quantity,
+		).Scan(&itemId); err != nil {
+			return fmt.Errorf("insertItemization unable to insert item: %w", err)
+		}
+
+		for _, consumerId := range item.ConsumerIds {
+			if _, err := transaction.ExecContext(
+				ctx,
+				`INSERT INTO expense_item_consumer(item_id, person_id) VALUES ($1, $2)`,
+				itemId, consumerId,
+			); err != nil {
+				return fmt.Errorf("insertItemization unable to insert item consumer: %w", err)
+			}
+		}
+	}
+	return nil
 }
 
 func (pg *PostgresDatabase) GetExpenseByGroupId(ctx context.Context, groupId int) ([]expense.Expense, error) {
 	var expenses []expense.Expense
-	err := pg.SelectContext(ctx, &expenses, `SELECT * FROM expense WHERE group_id=$1`, groupId)
+	err := pg.SelectContext(ctx, &expenses, `SELECT id, amount_in_cents, person_id, group_id FROM expense WHERE group_id=$1`, groupId)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = pg.loadExpenseDetails(ctx, expenses, `e.group_id=$1`, groupId); err != nil {
+		return nil, err
+	}
+	return expenses, nil
+}
+
+func (pg *PostgresDatabase) GetExpensesByGroupIds(ctx context.Context, groupIds []int) ([]expense.Expense, error) {
+	var expenses []expense.Expense
+	err := pg.SelectContext(
+		ctx,
+		&expenses,
+		`SELECT id, amount_in_cents, person_id, group_id FROM expense WHERE group_id = ANY($1) ORDER BY id DESC`,
+		pq.Array(groupIds),
+	)
 	if err != nil {
 		return nil, err
 	}
+
+	if err = pg.loadExpenseDetails(ctx, expenses, `e.group_id = ANY($1)`, pq.Array(groupIds)); err != nil {
+		return nil, err
+	}
 	return expenses, nil
 }
+
+func (pg *PostgresDatabase) GetExpenseById(ctx context.Context, expenseId int) (expense.Expense, error) {
+	var e expense.Expense
+	err := pg.GetContext(ctx, &e, `SELECT id, amount_in_cents, person_id, group_id FROM expense WHERE id=$1`, expenseId)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return e, fmt.Errorf("%w %w", expense.ErrExpenseNotFound, err)
+		}
+		return e, fmt.Errorf("%w %w", expense.ErrUnexpected, err)
+	}
+
+	expenses := []expense.Expense{e}
+	if err = pg.loadExpenseDetails(ctx, expenses, `e.id=$1`, expenseId); err != nil {
+		return expense.Expense{}, fmt.Errorf("%w %w", expense.ErrUnexpected, err)
+	}
+	return expenses[0], nil
+}
+
+func (pg *PostgresDatabase) DeleteExpense(ctx context.Context, e expense.Expense) error {
+	transaction, err := pg.DB.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%w %w", expense.ErrUnexpected, err)
+	}
+
+	for _, query := range []string{
+		`DELETE FROM expense_item_consumer WHERE item_id IN (SELECT id FROM expense_item WHERE expense_id=$1)`,
+		`DELETE FROM expense_item WHERE expense_id=$1`,
+		`DELETE FROM expense_itemization WHERE expense_id=$1`,
+		`DELETE FROM expense_payer WHERE expense_id=$1`,
+		`DELETE FROM expense WHERE id=$1`,
+	} {
+		if _, err = transaction.ExecContext(ctx, query, e.Id); err != nil {
+			_ = transaction.Rollback()
+			return fmt.Errorf("%w %w", expense.ErrUnexpected, err)
+		}
+	}
+
+	if err = insertOutboxEvent(ctx, transaction, event.ExpenseDeleted, e); err != nil {
+		_ = transaction.Rollback()
+		return fmt.Errorf("%w %w", expense.ErrUnexpected, err)
+	}
+
+	if err = transaction.Commit(); err != nil {
+		return fmt.Errorf("%w %w", expense.ErrUnexpected, err)
+	}
+	return nil
+}
+
+// loadExpenseDetails fills itemization and payers of expenses. condition selects the same expenses, aliased as e.
+func (pg *PostgresDatabase) loadExpenseDetails(ctx context.Context, expenses []expense.Expense, condition string, args ...any) error {
+	itemizations, err := pg.getItemizations(ctx, condition, args...)
+	if err != nil {
+		return err
+	}
+
+	payers, err := pg.getPayers(ctx, condition, args...)
+	if err != nil {
+		return err
+	}
+
+	for i := range expenses {
+		if it, ok := itemizations[expenses[i].Id]; ok {
+			expenses[i].Itemization = it
+		}
+		expenses[i].Payers = payers[expenses[i].Id]
+	}
+	return nil
+}
+
+func (pg *PostgresDatabase) getPayers(ctx context.Context, condition string, args ...any) (map[int][]expense.Payer, error) {
+	var rows []struct {
+		ExpenseId int `db:"expense_id"`
+		expense.Payer
+	}
+	err := pg.SelectContext(
+		ctx,
+		&rows,
+		`SELECT p.expense_id, p.person_id, p.amount_in_cents
+				FROM expense_payer p JOIN expense e ON e.id = p.expense_id
+				WHERE `+condition+`
+				ORDER BY p.expense_id, p.person_id`,
+		args...,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("getPayers unexpected: %w", err)
+	}
+
+	payers := make(map[int][]expense.Payer)
+	for _, r := range rows {
+		payers[r.ExpenseId] = append(payers[r.ExpenseId], r.Payer)
+	}
+	return payers, nil
+}
+
+func (pg *PostgresDatabase) getItemizations(ctx context.Context, condition string, args ...any) (map[int]*expense.Itemization, error) {
+	var itemizationRows []struct {
+		ExpenseId  int               `db:"expense_id"`
+		TaxInCents int               `db:"tax_in_cents"`
+		TipInCents int               `db:"tip_in_cents"`
+		TaxRule    expense.SplitRule `db:"tax_rule"`
+		TipRule    expense.SplitRule `db:"tip_rule"`
+	}
+	err := pg.SelectContext(
+		ctx,
+		&itemizationRows,
+		`SELECT i.expense_id, i.tax_in_cents, i.tip_in_cents, i.tax_rule, i.tip_rule
+				FROM expense_itemization i JOIN expense e ON e.id = i.expense_id
+				WHERE `+condition,
+		args...,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("getItemizations unexpected: %w", err)
+	}
+
+	itemizations := make(map[int]*expense.Itemization, len(itemizationRows))
+	for _, r := range itemizationRows {
+		itemizations[r.ExpenseId] = &expense.Itemization{
+			TaxInCents: r.TaxInCents,
+			TipInCents: r.TipInCents,
+			TaxRule:    r.TaxRule,
+			TipRule:    r.TipRule,
+		}
+	}
+	if len(itemizations) == 0 {
+		return itemizations, nil
+	}
+
+	var itemRows []struct {
+		ExpenseId        int           `db:"expense_id"`
+		Description      string        `db:"description"`
+		UnitPriceInCents int           `db:"unit_price_in_cents"`
+		Quantity         int           `db:"quantity"`
+		ConsumerIds      pq.Int64Array `db:"consumer_ids"`
+	}
+	err = pg.SelectContext(
+		ctx,
+		&itemRows,
+		`SELECT it.expense_id, it.description, it.unit_price_in_cents, it.quantity,
+					array_remove(array_agg(c.person_id ORDER BY c.person_id), NULL) AS consumer_ids
+				FROM expense_item it
+					JOIN expense e ON e.id = it.expense_id
+					LEFT JOIN expense_item_consumer c ON c.item_id = it.id
+				WHERE `+condition+`
+				GROUP BY it.id
+				ORDER BY it.expense_id, it.position`,
+		args...,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("getItemizations unexpected: %w", err)
+	}
+
+	for _, r := range itemRows {
+		consumerIds := make([]int, len(r.ConsumerIds))
+		for i, c := range r.ConsumerIds {
+			consumerIds[i] = int(c)
+		}
+		it := itemizations[r.ExpenseId]
+		it.Items = append(it.Items, expense.Item{
+			Description:      r.Description,
+			UnitPriceInCents: r.UnitPriceInCents,
+			Quantity:         r.Quantity,
+			ConsumerIds:      consumerIds,
+		})
+	}
+	return itemizations, nil
+}
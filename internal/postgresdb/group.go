@@ -5,7 +5,9 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"github.com/antoniobelotti/splid_backend_clone/internal/event"
 	"github.com/antoniobelotti/splid_backend_clone/internal/group"
+	"github.com/lib/pq"
 )
 
 func (pg *PostgresDatabase) CreateGroup(ctx context.Context, g group.Group) (int, error) {
@@ -37,6 +39,12 @@ func (pg *PostgresDatabase) CreateGroup(ctx context.Context, g group.Group) (int
 		return 0, fmt.Errorf("CreateGroup unable to insert into group_person %w", transaction.Rollback())
 	}
 
+	g.Id = groupId
+	if err = insertOutboxEvent(ctx, transaction, event.GroupCreated, g); err != nil {
+		_ = transaction.Rollback()
+		return 0, fmt.Errorf("CreateGroup %w", err)
+	}
+
 	return groupId, transaction.Commit()
 }
 
@@ -53,12 +61,32 @@ func (pg *PostgresDatabase) GetGroupById(ctx context.Context, groupId int) (grou
 }
 
 func (pg *PostgresDatabase) AddPersonToGroup(ctx context.Context, g group.Group, personId int) error {
-	res, err := pg.ExecContext(ctx, `INSERT INTO group_person(group_id, person_id) VALUES ($1, $2)`, g.Id, personId)
+	transaction, err := pg.DB.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%w %w", group.ErrUnexpected, err)
+	}
+
+	res, err := transaction.ExecContext(ctx, `INSERT INTO group_person(group_id, person_id) VALUES ($1, $2)`, g.Id, personId)
 	if err != nil {
+		_ = transaction.Rollback()
 		return fmt.Errorf("%w %w", group.ErrUnexpected, err)
 	}
 
 	if ra, err := res.RowsAffected(); err != nil && ra != 1 {
+		_ = transaction.Rollback()
+		return fmt.Errorf("%w %w", group.ErrUnexpected, err)
+	}
+
+	err = insertOutboxEvent(ctx, transaction, event.MemberJoined, event.MemberJoinedPayload{
+		GroupId:  g.Id,
+		PersonId: personId,
+	})
+	if err != nil {
+		_ = transaction.Rollback()
+		return fmt.Errorf("%w %w", group.ErrUnexpected, err)
+	}
+
+	if err = transaction.Commit(); err != nil {
 		return fmt.Errorf("%w %w", group.ErrUnexpected, err)
 	}
 	return nil
@@ -75,3 +103,41 @@ func (pg *PostgresDatabase) GetGroupComponentsById(ctx context.Context, groupId
 	}
 	return componentIds, nil
 }
+
+func (pg *PostgresDatabase) GetGroupsByIds(ctx context.Context, groupIds []int) ([]group.Group, error) {
+	return pg.selectGroupsWithComponents(ctx, `g.id = ANY($1)`, pq.Array(groupIds))
+}
+
+func (pg *PostgresDatabase) GetGroupsByPersonId(ctx context.Context, personId int) ([]group.Group, error) {
+	return pg.selectGroupsWithComponents(ctx, `EXISTS(SELECT 1 FROM group_person gp WHERE gp.group_id = g.id AND gp.person_id = $1)`, personId)
+}
+
+// selectGroupsWithComponents - condition selects the groups, aliased as g
+func (pg *PostgresDatabase) selectGroupsWithComponents(ctx context.Context, condition string, args ...any) ([]group.Group, error) {
+	var rows []struct {
+		group.Group
+		ComponentIds pq.Int64Array `db:"component_ids"`
+	}
+	err := pg.SelectContext(
+		ctx,
+		&rows,
+		`SELECT g.id, g.name, g.owner_id, g.invitation_code,
+       				(SELECT array_agg(gp.person_id ORDER BY gp.person_id) FROM group_person gp WHERE gp.group_id = g.id) AS component_ids
+				FROM "group" g
+				WHERE `+condition+`
+				ORDER BY g.id`,
+		args...,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w %w", group.ErrUnexpected, err)
+	}
+
+	groups := make([]group.Group, len(rows))
+	for i, r := range rows {
+		groups[i] = r.Group
+		for _, id := range r.ComponentIds {
+			groups[i].ComponentIds = append(groups[i].ComponentIds, int(id))
+		}
+	}
+	return groups, nil
+}
@@ -0,0 +1,112 @@
+package postgresdb
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/antoniobelotti/splid_backend_clone/internal/http/authentication"
+	"github.com/jmoiron/sqlx"
+	"time"
+)
+
+// advisory lock namespaces of the login attempts: the email ones are always taken before the ip ones, so that two
+// reservations cannot deadlock
+const (
+	loginAttemptEmailLock = 1
+	loginAttemptIpLock    = 2
+)
+
+func (pg *PostgresDatabase) ReserveLoginAttempt(ctx context.Context, a authentication.LoginAttempt, since time.Time, decide func(byEmail authentication.AttemptStats, byIp authentication.AttemptStats) time.Duration) (int, time.Duration, error) {
+	transaction, err := pg.DB.BeginTxx(ctx, nil)
+	if err != nil {
+		return 0, 0, fmt.Errorf("ReserveLoginAttempt unable to begin transaction: %w", err)
+	}
+
+	// held until the end of the transaction: the next reservation for the email or the ip sees this one
+	if _, err = transaction.ExecContext(ctx, `SELECT pg_advisory_xact_lock($1, hashtext($2))`, loginAttemptEmailLock, a.Email); err != nil {
+		_ = transaction.Rollback()
+		return 0, 0, fmt.Errorf("ReserveLoginAttempt unable to lock the email: %w", err)
+	}
+	if _, err = transaction.ExecContext(ctx, `SELECT pg_advisory_xact_lock($1, hashtext($2))`, loginAttemptIpLock, a.Ip); err != nil {
+		_ = transaction.Rollback()
+		return 0, 0, fmt.Errorf("ReserveLoginAttempt unable to lock the ip: %w", err)
+	}
+
+	// pending attempts, whose succeeded is NULL, count as failures
+	byEmail, err := getAttemptStats(
+		ctx, transaction,
+		`SELECT count(*), max(created_at) FROM login_attempt
+				WHERE email=$1 AND succeeded IS NOT TRUE AND created_at >= $2
+				  AND created_at > coalesce(
+				      (SELECT max(created_at) FROM login_attempt WHERE email=$1 AND succeeded), '-infinity'
+				  )`,
+		a.Email, since,
+	)
+	if err != nil {
+		_ = transaction.Rollback()
+		return 0, 0, fmt.Errorf("ReserveLoginAttempt stats by email: %w", err)
+	}
+	byIp, err := getAttemptStats(
+		ctx, transaction,
+		`SELECT count(*), max(created_at) FROM login_attempt WHERE ip=$1 AND succeeded IS NOT TRUE AND created_at >= $2`,
+		a.Ip, since,
+	)
+	if err != nil {
+		_ = transaction.Rollback()
+		return 0, 0, fmt.Errorf("ReserveLoginAttempt stats by ip: %w", err)
+	}
+
+	if retryAfter := decide(byEmail, byIp); retryAfter > 0 {
+		_ = transaction.Rollback()
+		return 0, retryAfter, nil
+	}
+
+	var id int
+	err = transaction.QueryRowxContext(
+		ctx,
+		`INSERT INTO login_attempt(email, ip, user_agent, succeeded, created_at) VALUES ($1, $2, $3, NULL, $4) RETURNING id`,
+		a.Email, a.Ip, a.UserAgent, a.CreatedAt,
+	).Scan(&id)
+	if err != nil {
+		_ = transaction.Rollback()
+		return 0, 0, fmt.Errorf("ReserveLoginAttempt unable to insert: %w", err)
+	}
+	if err = transaction.Commit(); err != nil {
+		return 0, 0, fmt.Errorf("ReserveLoginAttempt unable to commit: %w", err)
+	}
+	return id, 0, nil
+}
+
+func getAttemptStats(ctx context.Context, q sqlx.QueryerContext, query string, args ...any) (authentication.AttemptStats, error) {
+	var stats authentication.AttemptStats
+	var lastFailureAt sql.NullTime
+	if err := q.QueryRowxContext(ctx, query, args...).Scan(&stats.Failures, &lastFailureAt); err != nil {
+		return stats, err
+	}
+	stats.LastFailureAt = lastFailureAt.Time
+	return stats, nil
+}
+
+func (pg *PostgresDatabase) CompleteLoginAttempt(ctx context.Context, id int, succeeded bool) error {
+	_, err := pg.ExecContext(ctx, `UPDATE login_attempt SET succeeded=$2 WHERE id=$1`, id, succeeded)
+	if err != nil {
+		return fmt.Errorf("CompleteLoginAttempt unable to update: %w", err)
+	}
+	return nil
+}
+
+func (pg *PostgresDatabase) ReleaseLoginAttempt(ctx context.Context, id int) error {
+	_, err := pg.ExecContext(ctx, `DELETE FROM login_attempt WHERE id=$1 AND succeeded IS NULL`, id)
+	if err != nil {
+		return fmt.Errorf("ReleaseLoginAttempt unable to delete: %w", err)
+	}
+	return nil
+}
+
+func (pg *PostgresDatabase) DeleteLoginAttemptsBefore(ctx context.Context, before time.Time) error {
+	_, err := pg.ExecContext(ctx, `DELETE FROM login_attempt WHERE created_at < $1`, before)
+	if err != nil {
+		return fmt.Errorf("DeleteLoginAttemptsBefore unable to delete: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package postgresdb
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/antoniobelotti/splid_backend_clone/internal/http/authentication"
+	"github.com/antoniobelotti/splid_backend_clone/internal/person"
+	"github.com/lib/pq"
+)
+
+func (pg *PostgresDatabase) CreateOidcLoginState(ctx context.Context, s authentication.OidcLoginState) error {
+	// abandoned logins are cleaned up as new ones start
+	if _, err := pg.ExecContext(ctx, `DELETE FROM oidc_login_state WHERE expires_at < now()`); err != nil {
+		return fmt.Errorf("%w %w", authentication.ErrUnexpected, err)
+	}
+	_, err := pg.ExecContext(
+		ctx,
+		`INSERT INTO oidc_login_state(state_hash, provider, code_verifier, nonce, created_at, expires_at)
+				VALUES ($1, $2, $3, $4, $5, $6)`,
+		s.StateHash, s.Provider, s.CodeVerifier, s.Nonce, s.CreatedAt, s.ExpiresAt,
+	)
+	if err != nil {
+		return fmt.Errorf("CreateOidcLoginState unable to insert: %w", err)
+	}
+	return nil
+}
+
+func (pg *PostgresDatabase) ConsumeOidcLoginState(ctx context.Context, stateHash string) (authentication.OidcLoginState, error) {
+	var s authentication.OidcLoginState
+	err := pg.GetContext(
+		ctx,
+		&s,
+		`DELETE FROM oidc_login_state WHERE state_hash=$1 AND expires_at > now()
+				RETURNING state_hash, provider, code_verifier, nonce, created_at, expires_at`,
+		stateHash,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return s, authentication.ErrInvalidOidcState
+		}
+		return s, fmt.Errorf("%w %w", authentication.ErrUnexpected, err)
+	}
+	return s, nil
+}
+
+func (pg *PostgresDatabase) GetPersonByExternalIdentity(ctx context.Context, provider string, subject string) (person.Person, error) {
+	var p person.Person
+	err := pg.GetContext(
+		ctx,
+		&p,
+		`SELECT person.* FROM person JOIN external_identity ON external_identity.person_id = person.id
+				WHERE external_identity.provider=$1 AND external_identity.subject=$2`,
+		provider, subject,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return p, fmt.Errorf("%w %w", person.ErrPersonNotFound, err)
+		}
+		return p, fmt.Errorf("%w %w", person.ErrUnexpected, err)
+	}
+	return p, nil
+}
+
+func (pg *PostgresDatabase) LinkExternalIdentity(ctx context.Context, personId int, provider string, subject string) error {
+	_, err := pg.ExecContext(
+		ctx,
+		`INSERT INTO external_identity(provider, subject, person_id) VALUES ($1, $2, $3)`,
+		provider, subject, personId,
+	)
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == uniqueViolation {
+			return person.ErrExternalIdentityLinked
+		}
+		return fmt.Errorf("%w %w", person.ErrUnexpected, err)
+	}
+	return nil
+}
+
+func (pg *PostgresDatabase) CreatePersonWithExternalIdentity(ctx context.Context, p person.Person, provider string, subject string) (int, error) {
+	transaction, err := pg.DB.BeginTxx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("%w %w", person.ErrUnexpected, err)
+	}
+
+	var personId int
+	err = transaction.QueryRowContext(
+		ctx,
+		`INSERT INTO person(name, email, password, email_verified_at) VALUES ($1, $2, $3, $4) RETURNING id`,
+		p.Name, p.Email, p.Password, p.EmailVerifiedAt,
+	).Scan(&personId)
+	if err != nil {
+		_ = transaction.Rollback()
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == uniqueViolation {
+			return 0, person.ErrEmailAlreadyInUse
+		}
+		return 0, fmt.Errorf("%w %w", person.ErrUnexpected, err)
+	}
+
+	if _, err = transaction.ExecContext(
+		ctx,
+		`INSERT INTO external_identity(provider, subject, person_id) VALUES ($1, $2, $3)`,
+		provider, subject, personId,
+	); err != nil {
+		_ = transaction.Rollback()
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == uniqueViolation {
+			return 0, person.ErrExternalIdentityLinked
+		}
+		return 0, fmt.Errorf("%w %w", person.ErrUnexpected, err)
+	}
+
+	if err = transaction.Commit(); err != nil {
+		return 0, fmt.Errorf("%w %w", person.ErrUnexpected, err)
+	}
+	return personId, nil
+}
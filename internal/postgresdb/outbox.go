@@ -0,0 +1,104 @@
+package postgresdb
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/antoniobelotti/splid_backend_clone/internal/event"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"time"
+)
+
+// insertOutboxEvent must be called with the same transaction that persists the change the event describes,
+// so that the event is recorded if and only if the change is committed.
+func insertOutboxEvent(ctx context.Context, transaction *sqlx.Tx, eventType event.Type, payload any) error {
+	jsonPayload, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("insertOutboxEvent unable to marshal payload: %w", err)
+	}
+
+	if _, err = transaction.ExecContext(
+		ctx,
+		`INSERT INTO outbox_event(event_type, payload) VALUES ($1, $2)`,
+		eventType, jsonPayload,
+	); err != nil {
+		return fmt.Errorf("insertOutboxEvent unable to insert: %w", err)
+	}
+	return nil
+}
+
+// ClaimPendingEvents locks the pending rows with SKIP LOCKED, so that concurrent claims never return the same event,
+// and marks them claimed until claimFor from now: the other dispatchers skip them after the statement commits too.
+func (pg *PostgresDatabase) ClaimPendingEvents(ctx context.Context, limit int, claimFor time.Duration) ([]event.Event, error) {
+	var events []event.Event
+	err := pg.SelectContext(
+		ctx,
+		&events,
+		`WITH claimed AS (
+					UPDATE outbox_event SET claimed_until = now() + make_interval(secs => $3)
+					WHERE id IN (
+						SELECT id FROM outbox_event
+						WHERE dispatched_at IS NULL AND attempts < $1 AND (claimed_until IS NULL OR claimed_until < now())
+						ORDER BY id
+						LIMIT $2
+						FOR UPDATE SKIP LOCKED
+					)
+					RETURNING id, event_type, payload, created_at, attempts
+				)
+				SELECT * FROM claimed ORDER BY id`,
+		event.MaxDeliveryAttempts, limit, claimFor.Seconds(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("ClaimPendingEvents unexpected: %w", err)
+	}
+	return events, nil
+}
+
+func (pg *PostgresDatabase) GetDeliveredHandlers(ctx context.Context, eventId int) ([]string, error) {
+	var handlers []string
+	err := pg.SelectContext(ctx, &handlers, `SELECT handler FROM outbox_delivery WHERE event_id=$1`, eventId)
+	if err != nil {
+		return nil, fmt.Errorf("GetDeliveredHandlers unexpected: %w", err)
+	}
+	return handlers, nil
+}
+
+func (pg *PostgresDatabase) MarkEventDispatched(ctx context.Context, eventId int) error {
+	_, err := pg.ExecContext(ctx, `UPDATE outbox_event SET dispatched_at=now(), claimed_until=NULL WHERE id=$1`, eventId)
+	if err != nil {
+		return fmt.Errorf("MarkEventDispatched unexpected: %w", err)
+	}
+	return nil
+}
+
+func (pg *PostgresDatabase) MarkEventFailed(ctx context.Context, eventId int, reason string, deliveredTo []string) error {
+	transaction, err := pg.DB.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("MarkEventFailed unable to begin transaction: %w", err)
+	}
+
+	if _, err = transaction.ExecContext(
+		ctx,
+		`INSERT INTO outbox_delivery(event_id, handler) SELECT $1, unnest($2::text[]) ON CONFLICT DO NOTHING`,
+		eventId, pq.Array(deliveredTo),
+	); err != nil {
+		_ = transaction.Rollback()
+		return fmt.Errorf("MarkEventFailed unable to record the deliveries: %w", err)
+	}
+
+	// released: the event is retried on the next poll, by whichever dispatcher claims it
+	if _, err = transaction.ExecContext(
+		ctx,
+		`UPDATE outbox_event SET attempts=attempts+1, last_error=$2, claimed_until=NULL WHERE id=$1`,
+		eventId, reason,
+	); err != nil {
+		_ = transaction.Rollback()
+		return fmt.Errorf("MarkEventFailed unexpected: %w", err)
+	}
+
+	if err = transaction.Commit(); err != nil {
+		return fmt.Errorf("MarkEventFailed unable to commit: %w", err)
+	}
+	return nil
+}
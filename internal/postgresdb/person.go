@@ -6,6 +6,9 @@ import (
 	"errors"
 	"fmt"
 	"github.com/antoniobelotti/splid_backend_clone/internal/person"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"time"
 )
 
 func (pg *PostgresDatabase) GetPersonById(ctx context.Context, personId int) (person.Person, error) {
@@ -20,6 +23,15 @@ func (pg *PostgresDatabase) GetPersonById(ctx context.Context, personId int) (pe
 	return p, err
 }
 
+func (pg *PostgresDatabase) GetPersonsByIds(ctx context.Context, ids []int) ([]person.Person, error) {
+	var persons []person.Person
+	err := pg.SelectContext(ctx, &persons, `SELECT * FROM person WHERE id = ANY($1)`, pq.Array(ids))
+	if err != nil {
+		return nil, fmt.Errorf("%w %w", person.ErrUnexpected, err)
+	}
+	return persons, nil
+}
+
 func (pg *PostgresDatabase) GetPersonByEmail(ctx context.Context, email string) (person.Person, error) {
 	var p person.Person
 	err := pg.GetContext(ctx, &p, `SELECT * FROM person WHERE email=$1`, email)
@@ -41,8 +53,198 @@ func (pg *PostgresDatabase) CreatePerson(ctx context.Context, p person.Person) (
 	).Scan(&personId)
 
 	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == uniqueViolation {
+			return 0, person.ErrEmailAlreadyInUse
+		}
 		return 0, fmt.Errorf("CreatePerson error: %w %w", person.ErrUnexpected, err)
 	}
 
 	return personId, nil
 }
+
+func (pg *PostgresDatabase) CreateToken(ctx context.Context, t person.Token) error {
+	_, err := pg.ExecContext(
+		ctx,
+		`INSERT INTO person_token(token_hash, person_id, purpose, created_at, expires_at) VALUES ($1, $2, $3, $4, $5)`,
+		t.TokenHash, t.PersonId, t.Purpose, t.CreatedAt, t.ExpiresAt,
+	)
+	if err != nil {
+		return fmt.Errorf("CreateToken error: %w %w", person.ErrUnexpected, err)
+	}
+	return nil
+}
+
+// consumeToken marks the token used and returns its owner. Fails with sql.ErrNoRows if the token does not exist,
+// has a different purpose, has expired or has already been used.
+func consumeToken(ctx context.Context, tx *sqlx.Tx, tokenHash string, purpose person.TokenPurpose) (int, error) {
+	var personId int
+	err := tx.QueryRowContext(
+		ctx,
+		`UPDATE person_token SET used_at=now()
+		 WHERE token_hash=$1 AND purpose=$2 AND used_at IS NULL AND expires_at > now()
+		 RETURNING person_id`,
+		tokenHash, purpose,
+	).Scan(&personId)
+	return personId, err
+}
+
+func (pg *PostgresDatabase) ResetPassword(ctx context.Context, tokenHash string, hashedPassword string) error {
+	transaction, err := pg.DB.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%w %w", person.ErrUnexpected, err)
+	}
+
+	personId, err := consumeToken(ctx, transaction, tokenHash, person.PasswordResetToken)
+	if err != nil {
+		_ = transaction.Rollback()
+		if errors.Is(err, sql.ErrNoRows) {
+			return person.ErrInvalidResetToken
+		}
+		return fmt.Errorf("%w %w", person.ErrUnexpected, err)
+	}
+
+	if _, err = transaction.ExecContext(ctx, `UPDATE person SET password=$1 WHERE id=$2`, hashedPassword, personId); err != nil {
+		_ = transaction.Rollback()
+		return fmt.Errorf("%w %w", person.ErrUnexpected, err)
+	}
+
+	if _, err = transaction.ExecContext(
+		ctx,
+		`UPDATE person_token SET used_at=now() WHERE person_id=$1 AND purpose=$2 AND used_at IS NULL`,
+		personId, person.PasswordResetToken,
+	); err != nil {
+		_ = transaction.Rollback()
+		return fmt.Errorf("%w %w", person.ErrUnexpected, err)
+	}
+
+	if _, err = transaction.ExecContext(
+		ctx,
+		`UPDATE session SET revoked_at=now() WHERE person_id=$1 AND revoked_at IS NULL`,
+		personId,
+	); err != nil {
+		_ = transaction.Rollback()
+		return fmt.Errorf("%w %w", person.ErrUnexpected, err)
+	}
+
+	if err = transaction.Commit(); err != nil {
+		return fmt.Errorf("%w %w", person.ErrUnexpected, err)
+	}
+	return nil
+}
+
+func (pg *PostgresDatabase) CountTokensCreatedSince(ctx context.Context, personId int, purpose person.TokenPurpose, since time.Time) (int, error) {
+	var count int
+	err := pg.GetContext(
+		ctx,
+		&count,
+		`SELECT count(*) FROM person_token WHERE person_id=$1 AND purpose=$2 AND created_at > $3`,
+		personId, purpose, since,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("%w %w", person.ErrUnexpected, err)
+	}
+	return count, nil
+}
+
+func (pg *PostgresDatabase) VerifyEmail(ctx context.Context, tokenHash string) error {
+	transaction, err := pg.DB.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%w %w", person.ErrUnexpected, err)
+	}
+
+	personId, err := consumeToken(ctx, transaction, tokenHash, person.EmailVerificationToken)
+	if err != nil {
+		_ = transaction.Rollback()
+		if errors.Is(err, sql.ErrNoRows) {
+			return person.ErrInvalidVerificationToken
+		}
+		return fmt.Errorf("%w %w", person.ErrUnexpected, err)
+	}
+
+	if _, err = transaction.ExecContext(
+		ctx,
+		`UPDATE person SET email_verified_at=now() WHERE id=$1 AND email_verified_at IS NULL`,
+		personId,
+	); err != nil {
+		_ = transaction.Rollback()
+		return fmt.Errorf("%w %w", person.ErrUnexpected, err)
+	}
+
+	if err = transaction.Commit(); err != nil {
+		return fmt.Errorf("%w %w", person.ErrUnexpected, err)
+	}
+	return nil
+}
+
+func (pg *PostgresDatabase) UpdatePersonName(ctx context.Context, personId int, name string) error {
+	res, err := pg.ExecContext(ctx, `UPDATE person SET name=$1 WHERE id=$2`, name, personId)
+	if err != nil {
+		return fmt.Errorf("%w %w", person.ErrUnexpected, err)
+	}
+	if ra, err := res.RowsAffected(); err == nil && ra == 0 {
+		return person.ErrPersonNotFound
+	}
+	return nil
+}
+
+func (pg *PostgresDatabase) UpdatePersonEmail(ctx context.Context, personId int, email string) error {
+	transaction, err := pg.DB.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%w %w", person.ErrUnexpected, err)
+	}
+
+	if _, err = transaction.ExecContext(
+		ctx,
+		`UPDATE person SET email=$1, email_verified_at=NULL WHERE id=$2`,
+		email, personId,
+	); err != nil {
+		_ = transaction.Rollback()
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == uniqueViolation {
+			return person.ErrEmailAlreadyInUse
+		}
+		return fmt.Errorf("%w %w", person.ErrUnexpected, err)
+	}
+
+	// a link sent to the old address must not verify the new one
+	if _, err = transaction.ExecContext(
+		ctx,
+		`UPDATE person_token SET used_at=now() WHERE person_id=$1 AND purpose=$2 AND used_at IS NULL`,
+		personId, person.EmailVerificationToken,
+	); err != nil {
+		_ = transaction.Rollback()
+		return fmt.Errorf("%w %w", person.ErrUnexpected, err)
+	}
+
+	if err = transaction.Commit(); err != nil {
+		return fmt.Errorf("%w %w", person.ErrUnexpected, err)
+	}
+	return nil
+}
+
+func (pg *PostgresDatabase) UpdatePassword(ctx context.Context, personId int, hashedPassword string, keepSessionId string) error {
+	transaction, err := pg.DB.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%w %w", person.ErrUnexpected, err)
+	}
+
+	if _, err = transaction.ExecContext(ctx, `UPDATE person SET password=$1 WHERE id=$2`, hashedPassword, personId); err != nil {
+		_ = transaction.Rollback()
+		return fmt.Errorf("%w %w", person.ErrUnexpected, err)
+	}
+
+	if _, err = transaction.ExecContext(
+		ctx,
+		`UPDATE session SET revoked_at=now() WHERE person_id=$1 AND id<>$2 AND revoked_at IS NULL`,
+		personId, keepSessionId,
+	); err != nil {
+		_ = transaction.Rollback()
+		return fmt.Errorf("%w %w", person.ErrUnexpected, err)
+	}
+
+	if err = transaction.Commit(); err != nil {
+		return fmt.Errorf("%w %w", person.ErrUnexpected, err)
+	}
+	return nil
+}
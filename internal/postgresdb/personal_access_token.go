@@ -0,0 +1,125 @@
+package postgresdb
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/antoniobelotti/splid_backend_clone/internal/http/authentication"
+	"github.com/lib/pq"
+	"time"
+)
+
+const personalAccessTokenColumns = `id, person_id, name, token_hash, scopes, group_ids, created_at, expires_at, last_used_at, revoked_at`
+
+// personalAccessTokenRow - postgres arrays need the pq types to be scanned
+type personalAccessTokenRow struct {
+	Id         int            `db:"id"`
+	PersonId   int            `db:"person_id"`
+	Name       string         `db:"name"`
+	TokenHash  string         `db:"token_hash"`
+	Scopes     pq.StringArray `db:"scopes"`
+	GroupIds   pq.Int64Array  `db:"group_ids"`
+	CreatedAt  time.Time      `db:"created_at"`
+	ExpiresAt  *time.Time     `db:"expires_at"`
+	LastUsedAt *time.Time     `db:"last_used_at"`
+	RevokedAt  *time.Time     `db:"revoked_at"`
+}
+
+func (r personalAccessTokenRow) toPersonalAccessToken() authentication.PersonalAccessToken {
+	t := authentication.PersonalAccessToken{
+		Id:         r.Id,
+		PersonId:   r.PersonId,
+		Name:       r.Name,
+		TokenHash:  r.TokenHash,
+		Scopes:     []authentication.Scope{},
+		GroupIds:   []int{},
+		CreatedAt:  r.CreatedAt,
+		ExpiresAt:  r.ExpiresAt,
+		LastUsedAt: r.LastUsedAt,
+		RevokedAt:  r.RevokedAt,
+	}
+	for _, s := range r.Scopes {
+		t.Scopes = append(t.Scopes, authentication.Scope(s))
+	}
+	for _, id := range r.GroupIds {
+		t.GroupIds = append(t.GroupIds, int(id))
+	}
+	return t
+}
+
+func (pg *PostgresDatabase) CreatePersonalAccessToken(ctx context.Context, t authentication.PersonalAccessToken) (int, error) {
+	scopes := pq.StringArray{}
+	for _, s := range t.Scopes {
+		scopes = append(scopes, string(s))
+	}
+	groupIds := pq.Int64Array{}
+	for _, id := range t.GroupIds {
+		groupIds = append(groupIds, int64(id))
+	}
+
+	var tokenId int
+	err := pg.QueryRowContext(
+		ctx,
+		`INSERT INTO personal_access_token(person_id, name, token_hash, scopes, group_ids, created_at, expires_at)
+				VALUES ($1, $2, $3, $4, $5, $6, $7)
+				RETURNING id`,
+		t.PersonId, t.Name, t.TokenHash, scopes, groupIds, t.CreatedAt, t.ExpiresAt,
+	).Scan(&tokenId)
+	if err != nil {
+		return 0, fmt.Errorf("CreatePersonalAccessToken unable to insert: %w", err)
+	}
+	return tokenId, nil
+}
+
+func (pg *PostgresDatabase) GetPersonalAccessTokensByPersonId(ctx context.Context, personId int) ([]authentication.PersonalAccessToken, error) {
+	var rows []personalAccessTokenRow
+	err := pg.SelectContext(
+		ctx,
+		&rows,
+		`SELECT `+personalAccessTokenColumns+` FROM personal_access_token WHERE person_id=$1 ORDER BY id`,
+		personId,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w %w", authentication.ErrUnexpected, err)
+	}
+	tokens := []authentication.PersonalAccessToken{}
+	for _, r := range rows {
+		tokens = append(tokens, r.toPersonalAccessToken())
+	}
+	return tokens, nil
+}
+
+func (pg *PostgresDatabase) GetPersonalAccessTokenByHash(ctx context.Context, tokenHash string) (authentication.PersonalAccessToken, error) {
+	var r personalAccessTokenRow
+	err := pg.GetContext(ctx, &r, `SELECT `+personalAccessTokenColumns+` FROM personal_access_token WHERE token_hash=$1`, tokenHash)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return authentication.PersonalAccessToken{}, fmt.Errorf("%w %w", authentication.ErrPersonalAccessTokenNotFound, err)
+		}
+		return authentication.PersonalAccessToken{}, fmt.Errorf("%w %w", authentication.ErrUnexpected, err)
+	}
+	return r.toPersonalAccessToken(), nil
+}
+
+func (pg *PostgresDatabase) RevokePersonalAccessToken(ctx context.Context, personId int, tokenId int) error {
+	res, err := pg.ExecContext(
+		ctx,
+		`UPDATE personal_access_token SET revoked_at=coalesce(revoked_at, now()) WHERE id=$1 AND person_id=$2`,
+		tokenId, personId,
+	)
+	if err != nil {
+		return fmt.Errorf("%w %w", authentication.ErrUnexpected, err)
+	}
+	if ra, err := res.RowsAffected(); err == nil && ra == 0 {
+		return authentication.ErrPersonalAccessTokenNotFound
+	}
+	return nil
+}
+
+func (pg *PostgresDatabase) MarkPersonalAccessTokenUsed(ctx context.Context, tokenId int, at time.Time) error {
+	if _, err := pg.ExecContext(ctx, `UPDATE personal_access_token SET last_used_at=$2 WHERE id=$1`, tokenId, at); err != nil {
+		return fmt.Errorf("%w %w", authentication.ErrUnexpected, err)
+	}
+	return nil
+}
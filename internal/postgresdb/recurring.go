@@ -0,0 +1,115 @@
+package postgresdb
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/antoniobelotti/splid_backend_clone/internal/recurring"
+	"time"
+)
+
+const recurringExpenseColumns = `id, amount_in_cents, person_id, group_id, frequency, interval_count, day_of_month,
+				start_date, end_date, occurrence_count, next_occurrence_at, failure_count, retry_at`
+
+func (pg *PostgresDatabase) CreateRecurringExpense(ctx context.Context, t recurring.Template) (int, error) {
+	var templateId int
+	err := pg.QueryRowContext(
+		ctx,
+		`INSERT INTO recurring_expense(amount_in_cents, person_id, group_id, frequency, interval_count, day_of_month,
+				start_date, end_date, occurrence_count, next_occurrence_at)
+				VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+				RETURNING id`,
+		t.AmountInCents, t.PersonId, t.GroupId, t.Frequency, t.Interval, t.DayOfMonth,
+		t.StartDate, t.EndDate, t.OccurrenceCount, t.NextOccurrenceAt,
+	).Scan(&templateId)
+	if err != nil {
+		return 0, fmt.Errorf("CreateRecurringExpense unable to insert: %w", err)
+	}
+	return templateId, nil
+}
+
+func (pg *PostgresDatabase) GetRecurringExpensesByGroupId(ctx context.Context, groupId int) ([]recurring.Template, error) {
+	templates := []recurring.Template{}
+	err := pg.SelectContext(
+		ctx,
+		&templates,
+		`SELECT `+recurringExpenseColumns+` FROM recurring_expense WHERE group_id=$1 ORDER BY id`,
+		groupId,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w %w", recurring.ErrUnexpected, err)
+	}
+	return templates, nil
+}
+
+func (pg *PostgresDatabase) GetRecurringExpenseById(ctx context.Context, templateId int) (recurring.Template, error) {
+	var t recurring.Template
+	err := pg.GetContext(ctx, &t, `SELECT `+recurringExpenseColumns+` FROM recurring_expense WHERE id=$1`, templateId)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return t, fmt.Errorf("%w %w", recurring.ErrTemplateNotFound, err)
+		}
+		return t, fmt.Errorf("%w %w", recurring.ErrUnexpected, err)
+	}
+	return t, nil
+}
+
+func (pg *PostgresDatabase) DeleteRecurringExpense(ctx context.Context, templateId int) error {
+	res, err := pg.ExecContext(ctx, `DELETE FROM recurring_expense WHERE id=$1`, templateId)
+	if err != nil {
+		return fmt.Errorf("%w %w", recurring.ErrUnexpected, err)
+	}
+	if ra, err := res.RowsAffected(); err == nil && ra == 0 {
+		return recurring.ErrTemplateNotFound
+	}
+	return nil
+}
+
+func (pg *PostgresDatabase) GetDueRecurringExpenses(ctx context.Context, now time.Time, limit int) ([]recurring.Template, error) {
+	var templates []recurring.Template
+	err := pg.SelectContext(
+		ctx,
+		&templates,
+		`SELECT `+recurringExpenseColumns+`
+				FROM recurring_expense
+				WHERE next_occurrence_at <= $1 AND (retry_at IS NULL OR retry_at <= $1)
+				ORDER BY next_occurrence_at, id
+				LIMIT $2`,
+		now, limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("GetDueRecurringExpenses unexpected: %w", err)
+	}
+	return templates, nil
+}
+
+func (pg *PostgresDatabase) AdvanceRecurringExpense(ctx context.Context, templateId int, fromCount int, nextOccurrenceAt *time.Time) (bool, error) {
+	res, err := pg.ExecContext(
+		ctx,
+		`UPDATE recurring_expense
+				SET occurrence_count=$2+1, next_occurrence_at=$3, failure_count=0, retry_at=NULL, last_error=NULL
+				WHERE id=$1 AND occurrence_count=$2`,
+		templateId, fromCount, nextOccurrenceAt,
+	)
+	if err != nil {
+		return false, fmt.Errorf("AdvanceRecurringExpense unexpected: %w", err)
+	}
+	ra, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("AdvanceRecurringExpense unexpected: %w", err)
+	}
+	return ra == 1, nil
+}
+
+func (pg *PostgresDatabase) DeferRecurringExpense(ctx context.Context, templateId int, retryAt time.Time, reason string) error {
+	_, err := pg.ExecContext(
+		ctx,
+		`UPDATE recurring_expense SET failure_count=failure_count+1, retry_at=$2, last_error=$3 WHERE id=$1`,
+		templateId, retryAt, reason,
+	)
+	if err != nil {
+		return fmt.Errorf("DeferRecurringExpense unexpected: %w", err)
+	}
+	return nil
+}
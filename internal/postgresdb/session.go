@@ -0,0 +1,90 @@
+package postgresdb
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/antoniobelotti/splid_backend_clone/internal/http/authentication"
+)
+
+func (pg *PostgresDatabase) CreateSession(ctx context.Context, s authentication.Session) error {
+	_, err := pg.ExecContext(
+		ctx,
+		`INSERT INTO session(id, person_id, created_at) VALUES ($1, $2, $3)`,
+		s.Id, s.PersonId, s.CreatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("CreateSession unable to insert: %w", err)
+	}
+	return nil
+}
+
+func (pg *PostgresDatabase) GetSessionById(ctx context.Context, sessionId string) (authentication.Session, error) {
+	var s authentication.Session
+	err := pg.GetContext(ctx, &s, `SELECT id, person_id, created_at, revoked_at FROM session WHERE id=$1`, sessionId)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return s, fmt.Errorf("%w %w", authentication.ErrSessionNotFound, err)
+		}
+		return s, fmt.Errorf("%w %w", authentication.ErrUnexpected, err)
+	}
+	return s, nil
+}
+
+func (pg *PostgresDatabase) RevokeSession(ctx context.Context, sessionId string) error {
+	_, err := pg.ExecContext(ctx, `UPDATE session SET revoked_at=now() WHERE id=$1 AND revoked_at IS NULL`, sessionId)
+	if err != nil {
+		return fmt.Errorf("%w %w", authentication.ErrUnexpected, err)
+	}
+	return nil
+}
+
+func (pg *PostgresDatabase) RevokeAllSessionsOfPerson(ctx context.Context, personId int) error {
+	_, err := pg.ExecContext(ctx, `UPDATE session SET revoked_at=now() WHERE person_id=$1 AND revoked_at IS NULL`, personId)
+	if err != nil {
+		return fmt.Errorf("%w %w", authentication.ErrUnexpected, err)
+	}
+	return nil
+}
+
+func (pg *PostgresDatabase) CreateRefreshToken(ctx context.Context, rt authentication.RefreshToken) error {
+	_, err := pg.ExecContext(
+		ctx,
+		`INSERT INTO refresh_token(token_hash, session_id, created_at, expires_at) VALUES ($1, $2, $3, $4)`,
+		rt.TokenHash, rt.SessionId, rt.CreatedAt, rt.ExpiresAt,
+	)
+	if err != nil {
+		return fmt.Errorf("CreateRefreshToken unable to insert: %w", err)
+	}
+	return nil
+}
+
+func (pg *PostgresDatabase) GetRefreshTokenByHash(ctx context.Context, tokenHash string) (authentication.RefreshToken, error) {
+	var rt authentication.RefreshToken
+	err := pg.GetContext(
+		ctx,
+		&rt,
+		`SELECT token_hash, session_id, created_at, expires_at, used_at FROM refresh_token WHERE token_hash=$1`,
+		tokenHash,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return rt, fmt.Errorf("%w %w", authentication.ErrRefreshTokenNotFound, err)
+		}
+		return rt, fmt.Errorf("%w %w", authentication.ErrUnexpected, err)
+	}
+	return rt, nil
+}
+
+func (pg *PostgresDatabase) MarkRefreshTokenUsed(ctx context.Context, tokenHash string) (bool, error) {
+	res, err := pg.ExecContext(ctx, `UPDATE refresh_token SET used_at=now() WHERE token_hash=$1 AND used_at IS NULL`, tokenHash)
+	if err != nil {
+		return false, fmt.Errorf("%w %w", authentication.ErrUnexpected, err)
+	}
+	ra, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("%w %w", authentication.ErrUnexpected, err)
+	}
+	return ra == 1, nil
+}
@@ -0,0 +1,133 @@
+package postgresdb
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/antoniobelotti/splid_backend_clone/internal/person"
+)
+
+func (pg *PostgresDatabase) SaveTotpSecret(ctx context.Context, personId int, secret string) error {
+	res, err := pg.ExecContext(
+		ctx,
+		`INSERT INTO person_totp(person_id, secret) VALUES ($1, $2)
+				ON CONFLICT (person_id) DO UPDATE SET secret=excluded.secret, last_used_step=0
+				WHERE person_totp.enabled_at IS NULL`,
+		personId, secret,
+	)
+	if err != nil {
+		return fmt.Errorf("%w %w", person.ErrUnexpected, err)
+	}
+	if ra, err := res.RowsAffected(); err == nil && ra == 0 {
+		return person.ErrTotpAlreadyEnabled
+	}
+	return nil
+}
+
+func (pg *PostgresDatabase) GetTotpSecret(ctx context.Context, personId int) (person.TotpSecret, error) {
+	var t person.TotpSecret
+	err := pg.GetContext(ctx, &t, `SELECT person_id, secret, enabled_at, last_used_step FROM person_totp WHERE person_id=$1`, personId)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return t, person.ErrTotpNotEnabled
+		}
+		return t, fmt.Errorf("%w %w", person.ErrUnexpected, err)
+	}
+	return t, nil
+}
+
+func (pg *PostgresDatabase) EnableTotp(ctx context.Context, personId int, step int64, recoveryCodeHashes []string) error {
+	transaction, err := pg.DB.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%w %w", person.ErrUnexpected, err)
+	}
+
+	res, err := transaction.ExecContext(
+		ctx,
+		`UPDATE person_totp SET enabled_at=now(), last_used_step=$2 WHERE person_id=$1 AND enabled_at IS NULL`,
+		personId, step,
+	)
+	if err != nil {
+		_ = transaction.Rollback()
+		return fmt.Errorf("%w %w", person.ErrUnexpected, err)
+	}
+	if ra, err := res.RowsAffected(); err == nil && ra == 0 {
+		_ = transaction.Rollback()
+		return person.ErrTotpAlreadyEnabled
+	}
+
+	if _, err = transaction.ExecContext(ctx, `DELETE FROM totp_recovery_code WHERE person_id=$1`, personId); err != nil {
+		_ = transaction.Rollback()
+		return fmt.Errorf("%w %w", person.ErrUnexpected, err)
+	}
+	for _, hash := range recoveryCodeHashes {
+		if _, err = transaction.ExecContext(
+			ctx,
+			`INSERT INTO totp_recovery_code(code_hash, person_id) VALUES ($1, $2)`,
+			hash, personId,
+		); err != nil {
+			_ = transaction.Rollback()
+			return fmt.Errorf("%w %w", person.ErrUnexpected, err)
+		}
+	}
+
+	if err = transaction.Commit(); err != nil {
+		return fmt.Errorf("%w %w", person.ErrUnexpected, err)
+	}
+	return nil
+}
+
+func (pg *PostgresDatabase) UseTotpStep(ctx context.Context, personId int, step int64) (bool, error) {
+	res, err := pg.ExecContext(
+		ctx,
+		`UPDATE person_totp SET last_used_step=$2 WHERE person_id=$1 AND enabled_at IS NOT NULL AND last_used_step < $2`,
+		personId, step,
+	)
+	if err != nil {
+		return false, fmt.Errorf("%w %w", person.ErrUnexpected, err)
+	}
+	ra, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("%w %w", person.ErrUnexpected, err)
+	}
+	return ra == 1, nil
+}
+
+func (pg *PostgresDatabase) UseRecoveryCode(ctx context.Context, personId int, codeHash string) (bool, error) {
+	res, err := pg.ExecContext(
+		ctx,
+		`UPDATE totp_recovery_code SET used_at=now() WHERE person_id=$1 AND code_hash=$2 AND used_at IS NULL`,
+		personId, codeHash,
+	)
+	if err != nil {
+		return false, fmt.Errorf("%w %w", person.ErrUnexpected, err)
+	}
+	ra, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("%w %w", person.ErrUnexpected, err)
+	}
+	return ra == 1, nil
+}
+
+func (pg *PostgresDatabase) DeleteTotp(ctx context.Context, personId int) error {
+	transaction, err := pg.DB.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%w %w", person.ErrUnexpected, err)
+	}
+
+	for _, query := range []string{
+		`DELETE FROM totp_recovery_code WHERE person_id=$1`,
+		`DELETE FROM person_totp WHERE person_id=$1`,
+	} {
+		if _, err = transaction.ExecContext(ctx, query, personId); err != nil {
+			_ = transaction.Rollback()
+			return fmt.Errorf("%w %w", person.ErrUnexpected, err)
+		}
+	}
+
+	if err = transaction.Commit(); err != nil {
+		return fmt.Errorf("%w %w", person.ErrUnexpected, err)
+	}
+	return nil
+}
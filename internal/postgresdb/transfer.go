@@ -3,12 +3,19 @@ package postgresdb
 import (
 	"context"
 	"fmt"
+	"github.com/antoniobelotti/splid_backend_clone/internal/event"
 	"github.com/antoniobelotti/splid_backend_clone/internal/transfer"
+	"github.com/lib/pq"
 )
 
 func (pg *PostgresDatabase) CreateTransfer(ctx context.Context, amountInCents int, groupId int, senderId int, receiverId int) (int, error) {
+	transaction, err := pg.DB.BeginTxx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("CreateTransfer unable to begin transaction: %w", err)
+	}
+
 	var transferId int
-	err := pg.QueryRowContext(
+	err = transaction.QueryRowContext(
 		ctx,
 		`INSERT INTO transfer(amount_in_cents, sender_id, receiver_id, group_id)
 				VALUES ($1, $2, $3, $4)
@@ -16,10 +23,23 @@ func (pg *PostgresDatabase) CreateTransfer(ctx context.Context, amountInCents in
 		amountInCents, senderId, receiverId, groupId,
 	).Scan(&transferId)
 	if err != nil {
+		_ = transaction.Rollback()
 		return 0, fmt.Errorf("CreateTransfer unable to insert: %w", err)
 	}
 
-	return transferId, nil
+	err = insertOutboxEvent(ctx, transaction, event.TransferCreated, transfer.Transfer{
+		Id:            transferId,
+		AmountInCents: amountInCents,
+		GroupId:       groupId,
+		SenderId:      senderId,
+		ReceiverId:    receiverId,
+	})
+	if err != nil {
+		_ = transaction.Rollback()
+		return 0, fmt.Errorf("CreateTransfer %w", err)
+	}
+
+	return transferId, transaction.Commit()
 }
 
 func (pg *PostgresDatabase) GetTransfersByGroupId(ctx context.Context, groupId int) ([]transfer.Transfer, error) {
@@ -30,3 +50,12 @@ func (pg *PostgresDatabase) GetTransfersByGroupId(ctx context.Context, groupId i
 	}
 	return transfers, nil
 }
+
+func (pg *PostgresDatabase) GetTransfersByGroupIds(ctx context.Context, groupIds []int) ([]transfer.Transfer, error) {
+	var transfers []transfer.Transfer
+	err := pg.SelectContext(ctx, &transfers, `SELECT * FROM transfer WHERE group_id = ANY($1) ORDER BY id DESC`, pq.Array(groupIds))
+	if err != nil {
+		return nil, err
+	}
+	return transfers, nil
+}
@@ -0,0 +1,329 @@
+package recurring
+
+import (
+	"context"
+	"fmt"
+	"github.com/antoniobelotti/splid_backend_clone/internal/apperror"
+	"github.com/antoniobelotti/splid_backend_clone/internal/expense"
+	"github.com/antoniobelotti/splid_backend_clone/internal/health"
+	"github.com/antoniobelotti/splid_backend_clone/internal/tracing"
+	"go.opentelemetry.io/otel"
+	"log/slog"
+	"time"
+)
+
+var tracer = otel.Tracer("github.com/antoniobelotti/splid_backend_clone/internal/recurring")
+
+type Frequency string
+
+const (
+	Weekly  Frequency = "weekly"
+	Monthly Frequency = "monthly"
+	Yearly  Frequency = "yearly"
+)
+
+// Template - an expense that is automatically added to the group on a schedule.
+//
+// Occurrences are counted from StartDate: the n-th occurrence is StartDate plus n*Interval weeks, months or years.
+// Monthly templates fall on DayOfMonth, clamped to the last day of shorter months (e.g. 31 -> 30 april).
+type Template struct {
+	Id               int        `json:"id" db:"id"`
+	AmountInCents    int        `json:"amount-in-cents" db:"amount_in_cents"`
+	PersonId         int        `json:"person-id" db:"person_id"`
+	GroupId          int        `json:"group-id" db:"group_id"`
+	Frequency        Frequency  `json:"frequency" db:"frequency"`
+	Interval         int        `json:"interval" db:"interval_count"`
+	DayOfMonth       int        `json:"day-of-month,omitempty" db:"day_of_month"`
+	StartDate        time.Time  `json:"start-date" db:"start_date"`
+	EndDate          *time.Time `json:"end-date,omitempty" db:"end_date"`
+	OccurrenceCount  int        `json:"occurrence-count" db:"occurrence_count"`
+	NextOccurrenceAt *time.Time `json:"next-occurrence-at,omitempty" db:"next_occurrence_at"`
+	// FailureCount - consecutive failures to create the next occurrence, which is not retried before RetryAt
+	FailureCount int        `json:"-" db:"failure_count"`
+	RetryAt      *time.Time `json:"-" db:"retry_at"`
+}
+
+// Occurrence returns the date of the n-th occurrence, starting from 0
+func (t Template) Occurrence(n int) time.Time {
+	start := t.StartDate
+	switch t.Frequency {
+	case Weekly:
+		return start.AddDate(0, 0, 7*t.Interval*n)
+	case Monthly:
+		// the schedule starts in the following month if DayOfMonth has already passed in the start month
+		offset := 0
+		if clampDay(time.Date(start.Year(), start.Month(), 1, 0, 0, 0, 0, time.UTC), t.DayOfMonth) < start.Day() {
+			offset = 1
+		}
+		firstOfMonth := time.Date(start.Year(), start.Month()+time.Month(offset+t.Interval*n), 1, 0, 0, 0, 0, time.UTC)
+		return time.Date(firstOfMonth.Year(), firstOfMonth.Month(), clampDay(firstOfMonth, t.DayOfMonth), 0, 0, 0, 0, time.UTC)
+	case Yearly:
+		firstOfMonth := time.Date(start.Year()+t.Interval*n, start.Month(), 1, 0, 0, 0, 0, time.UTC)
+		return time.Date(firstOfMonth.Year(), firstOfMonth.Month(), clampDay(firstOfMonth, start.Day()), 0, 0, 0, 0, time.UTC)
+	}
+	return time.Time{}
+}
+
+// nextOccurrence returns the occurrence following the ones already materialized, or nil if the schedule is over
+func (t Template) nextOccurrence() *time.Time {
+	next := t.Occurrence(t.OccurrenceCount)
+	if t.EndDate != nil && next.After(*t.EndDate) {
+		return nil
+	}
+	return &next
+}
+
+func clampDay(firstOfMonth time.Time, day int) int {
+	lastDay := firstOfMonth.AddDate(0, 1, -1).Day()
+	if day > lastDay {
+		return lastDay
+	}
+	return day
+}
+
+func toDate(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+type Store interface {
+	IsPersonInGroup(ctx context.Context, groupId int, personId int) (bool, error)
+	CreateRecurringExpense(ctx context.Context, t Template) (int, error)
+	GetRecurringExpensesByGroupId(ctx context.Context, groupId int) ([]Template, error)
+	GetRecurringExpenseById(ctx context.Context, templateId int) (Template, error)
+	DeleteRecurringExpense(ctx context.Context, templateId int) error
+	// GetDueRecurringExpenses returns the templates whose next occurrence is due at now, skipping those not to be
+	// retried yet, by next occurrence
+	GetDueRecurringExpenses(ctx context.Context, now time.Time, limit int) ([]Template, error)
+	// AdvanceRecurringExpense sets the occurrence count to fromCount+1 only if it is still fromCount, and clears the
+	// failures. Returns false if another scheduler advanced the template first.
+	AdvanceRecurringExpense(ctx context.Context, templateId int, fromCount int, nextOccurrenceAt *time.Time) (bool, error)
+	// DeferRecurringExpense records a failure to create the next occurrence, to be retried at retryAt
+	DeferRecurringExpense(ctx context.Context, templateId int, retryAt time.Time, reason string) error
+}
+
+var (
+	ErrTemplateNotFound = apperror.New(apperror.NotFound, "recurring_expense_not_found", "recurring expense not found")
+	ErrInvalidSchedule  = apperror.New(apperror.Invalid, "invalid_schedule", "invalid schedule")
+	ErrInvalidAmount    = apperror.NewInvalidField("amount-in-cents", "invalid_amount", "amount must be positive")
+	ErrPersonNotInGroup = apperror.New(apperror.Forbidden, "person_not_in_group", "person does not belong to the group")
+	ErrNotOwner         = apperror.New(apperror.Forbidden, "not_recurring_expense_owner", "only the person who created the recurring expense can delete it")
+	ErrUnexpected       = apperror.New(apperror.Internal, "unexpected_error", "unexpected error")
+)
+
+type Service struct {
+	store          Store
+	expenseService expense.Service
+}
+
+func NewService(store Store, es expense.Service) Service {
+	return Service{store: store, expenseService: es}
+}
+
+func (s *Service) CreateTemplate(ctx context.Context, t Template) (_ Template, err error) {
+	ctx, span := tracer.Start(ctx, "recurring.CreateTemplate")
+	defer func() { tracing.End(span, err) }()
+
+	if t.AmountInCents <= 0 {
+		return Template{}, ErrInvalidAmount
+	}
+	if t.Interval == 0 {
+		t.Interval = 1
+	}
+	t.StartDate = toDate(t.StartDate)
+	if t.EndDate != nil {
+		endDate := toDate(*t.EndDate)
+		t.EndDate = &endDate
+	}
+	if t.Frequency == Monthly && t.DayOfMonth == 0 {
+		t.DayOfMonth = t.StartDate.Day()
+	}
+	if err := validateSchedule(t); err != nil {
+		return Template{}, err
+	}
+
+	isPersonInGroup, err := s.store.IsPersonInGroup(ctx, t.GroupId, t.PersonId)
+	if err != nil {
+		return Template{}, fmt.Errorf("%w %w", ErrUnexpected, err)
+	}
+	if !isPersonInGroup {
+		return Template{}, ErrPersonNotInGroup
+	}
+
+	t.OccurrenceCount = 0
+	t.NextOccurrenceAt = t.nextOccurrence()
+
+	t.Id, err = s.store.CreateRecurringExpense(ctx, t)
+	if err != nil {
+		return Template{}, fmt.Errorf("%w %w", ErrUnexpected, err)
+	}
+	return t, nil
+}
+
+func validateSchedule(t Template) error {
+	switch t.Frequency {
+	case Weekly, Yearly:
+	case Monthly:
+		if t.DayOfMonth < 1 || t.DayOfMonth > 31 {
+			return fmt.Errorf("%w: day of month must be between 1 and 31", ErrInvalidSchedule)
+		}
+	default:
+		return fmt.Errorf("%w: unknown frequency %q", ErrInvalidSchedule, t.Frequency)
+	}
+	if t.Interval < 1 {
+		return fmt.Errorf("%w: interval must be positive", ErrInvalidSchedule)
+	}
+	if t.StartDate.IsZero() {
+		return fmt.Errorf("%w: start date is required", ErrInvalidSchedule)
+	}
+	if t.EndDate != nil && t.EndDate.Before(t.StartDate) {
+		return fmt.Errorf("%w: end date is before start date", ErrInvalidSchedule)
+	}
+	return nil
+}
+
+// GetTemplatesByGroupId returns the templates of the group, which personId must belong to
+func (s *Service) GetTemplatesByGroupId(ctx context.Context, groupId int, personId int) (_ []Template, err error) {
+	ctx, span := tracer.Start(ctx, "recurring.GetTemplatesByGroupId")
+	defer func() { tracing.End(span, err) }()
+
+	isPersonInGroup, err := s.store.IsPersonInGroup(ctx, groupId, personId)
+	if err != nil {
+		return nil, fmt.Errorf("%w %w", ErrUnexpected, err)
+	}
+	if !isPersonInGroup {
+		return nil, ErrPersonNotInGroup
+	}
+	return s.store.GetRecurringExpensesByGroupId(ctx, groupId)
+}
+
+// DeleteTemplate stops the schedule. Expenses already materialized are kept.
+func (s *Service) DeleteTemplate(ctx context.Context, groupId int, templateId int, personId int) (err error) {
+	ctx, span := tracer.Start(ctx, "recurring.DeleteTemplate")
+	defer func() { tracing.End(span, err) }()
+
+	t, err := s.store.GetRecurringExpenseById(ctx, templateId)
+	if err != nil {
+		return err
+	}
+	if t.GroupId != groupId {
+		return ErrTemplateNotFound
+	}
+	if t.PersonId != personId {
+		return ErrNotOwner
+	}
+	return s.store.DeleteRecurringExpense(ctx, templateId)
+}
+
+// dueBatchSize - templates materialized per query
+const dueBatchSize = 100
+
+// maxRetryDelay caps the backoff of the templates whose occurrences cannot be created
+const maxRetryDelay = 24 * time.Hour
+
+// retryDelay - how long after its n-th consecutive failure a template is retried: DefaultSchedulerInterval, doubled
+// at each failure
+func retryDelay(failures int) time.Duration {
+	d := DefaultSchedulerInterval
+	for i := 1; i < failures && d < maxRetryDelay; i++ {
+		d *= 2
+	}
+	return min(d, maxRetryDelay)
+}
+
+// MaterializeDue creates an expense for every occurrence due at or before now, catching up on occurrences missed
+// while the server was down. It returns the number of expenses created.
+//
+// Each occurrence is created with an idempotency key derived from the template and the occurrence number, and the
+// template is advanced only afterwards: a crash in between results in a retry that finds the existing expense.
+// A template whose occurrence cannot be created, e.g. because its owner left the group, is retried with a backoff,
+// so that it does not hold back the templates due after it.
+func (s *Service) MaterializeDue(ctx context.Context, now time.Time) (_ int, err error) {
+	ctx, span := tracer.Start(ctx, "recurring.MaterializeDue")
+	defer func() { tracing.End(span, err) }()
+
+	created := 0
+	for {
+		due, err := s.store.GetDueRecurringExpenses(ctx, now, dueBatchSize)
+		if err != nil {
+			return created, fmt.Errorf("%w %w", ErrUnexpected, err)
+		}
+		if len(due) == 0 {
+			return created, nil
+		}
+
+		handled := 0
+		for _, t := range due {
+			if ctx.Err() != nil {
+				return created, ctx.Err()
+			}
+
+			key := fmt.Sprintf("recurring-expense-%d-%d", t.Id, t.OccurrenceCount)
+			_, err := s.expenseService.CreateExpense(expense.WithIdempotencyKey(ctx, key), t.AmountInCents, t.PersonId, t.GroupId)
+			if err != nil {
+				retryAt := now.Add(retryDelay(t.FailureCount + 1))
+				slog.ErrorContext(ctx, "unable to create the occurrence of a recurring expense", "recurring_expense_id", t.Id, "occurrence", t.OccurrenceCount, "retry_at", retryAt, "error", err)
+				if err = s.store.DeferRecurringExpense(ctx, t.Id, retryAt, err.Error()); err != nil {
+					return created, fmt.Errorf("%w %w", ErrUnexpected, err)
+				}
+				handled++
+				continue
+			}
+
+			t.OccurrenceCount++
+			ok, err := s.store.AdvanceRecurringExpense(ctx, t.Id, t.OccurrenceCount-1, t.nextOccurrence())
+			if err != nil {
+				return created, fmt.Errorf("%w %w", ErrUnexpected, err)
+			}
+			if ok {
+				created++
+				handled++
+			}
+		}
+
+		if handled == 0 {
+			// every due template was handled by someone else: try again on the next tick
+			return created, nil
+		}
+	}
+}
+
+const DefaultSchedulerInterval = time.Minute
+
+// Scheduler - periodically materializes due recurring expenses
+type Scheduler struct {
+	service   Service
+	interval  time.Duration
+	now       func() time.Time
+	heartbeat *health.Heartbeat
+}
+
+func NewScheduler(service Service, interval time.Duration) *Scheduler {
+	if interval <= 0 {
+		interval = DefaultSchedulerInterval
+	}
+	return &Scheduler{service: service, interval: interval, now: time.Now, heartbeat: health.NewHeartbeat(3 * interval)}
+}
+
+// CheckRunning is a health.Check failing when Run is not running, or is stuck
+func (s *Scheduler) CheckRunning(ctx context.Context) error {
+	return s.heartbeat.Check(ctx)
+}
+
+// Run materializes due expenses until ctx is cancelled
+func (s *Scheduler) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := s.service.MaterializeDue(ctx, s.now()); err != nil && ctx.Err() == nil {
+			slog.ErrorContext(ctx, "unable to materialize the due recurring expenses", "error", err)
+		}
+		s.heartbeat.Beat()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
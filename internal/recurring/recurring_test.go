@@ -0,0 +1,287 @@
+//go:build unit
+
+package recurring
+
+import (
+	"context"
+	"errors"
+	"github.com/antoniobelotti/splid_backend_clone/internal/expense"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"sort"
+	"testing"
+	"time"
+)
+
+func date(year int, month time.Month, day int) time.Time {
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+func TestOccurrence(t *testing.T) {
+	table := []struct {
+		name     string
+		template Template
+		expected []time.Time
+	}{
+		{
+			name:     "monthly on the 31st is clamped to the end of shorter months",
+			template: Template{Frequency: Monthly, Interval: 1, DayOfMonth: 31, StartDate: date(2023, time.January, 31)},
+			expected: []time.Time{date(2023, time.January, 31), date(2023, time.February, 28), date(2023, time.March, 31), date(2023, time.April, 30)},
+		},
+		{
+			name:     "monthly starting the month after if the day has already passed",
+			template: Template{Frequency: Monthly, Interval: 2, DayOfMonth: 5, StartDate: date(2023, time.November, 20)},
+			expected: []time.Time{date(2023, time.December, 5), date(2024, time.February, 5), date(2024, time.April, 5)},
+		},
+		{
+			name:     "weekly",
+			template: Template{Frequency: Weekly, Interval: 1, StartDate: date(2023, time.December, 25)},
+			expected: []time.Time{date(2023, time.December, 25), date(2024, time.January, 1), date(2024, time.January, 8)},
+		},
+		{
+			name:     "yearly on the 29th of february",
+			template: Template{Frequency: Yearly, Interval: 1, StartDate: date(2024, time.February, 29)},
+			expected: []time.Time{date(2024, time.February, 29), date(2025, time.February, 28), date(2026, time.February, 28), date(2027, time.February, 28), date(2028, time.February, 29)},
+		},
+	}
+
+	for _, tc := range table {
+		for n, want := range tc.expected {
+			assert.Equal(t, want, tc.template.Occurrence(n), "%s: occurrence %d", tc.name, n)
+		}
+	}
+}
+
+type memoryStore struct {
+	templates map[int]Template
+}
+
+func (m *memoryStore) IsPersonInGroup(_ context.Context, _ int, _ int) (bool, error) {
+	return true, nil
+}
+
+func (m *memoryStore) CreateRecurringExpense(_ context.Context, t Template) (int, error) {
+	t.Id = len(m.templates) + 1
+	m.templates[t.Id] = t
+	return t.Id, nil
+}
+
+func (m *memoryStore) GetRecurringExpensesByGroupId(_ context.Context, _ int) ([]Template, error) {
+	return nil, nil
+}
+
+func (m *memoryStore) GetRecurringExpenseById(_ context.Context, templateId int) (Template, error) {
+	return m.templates[templateId], nil
+}
+
+func (m *memoryStore) DeleteRecurringExpense(_ context.Context, templateId int) error {
+	delete(m.templates, templateId)
+	return nil
+}
+
+func (m *memoryStore) GetDueRecurringExpenses(_ context.Context, now time.Time, limit int) ([]Template, error) {
+	var due []Template
+	for _, t := range m.templates {
+		if t.NextOccurrenceAt != nil && !t.NextOccurrenceAt.After(now) && (t.RetryAt == nil || !t.RetryAt.After(now)) {
+			due = append(due, t)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool {
+		if !due[i].NextOccurrenceAt.Equal(*due[j].NextOccurrenceAt) {
+			return due[i].NextOccurrenceAt.Before(*due[j].NextOccurrenceAt)
+		}
+		return due[i].Id < due[j].Id
+	})
+	if len(due) > limit {
+		due = due[:limit]
+	}
+	return due, nil
+}
+
+func (m *memoryStore) AdvanceRecurringExpense(_ context.Context, templateId int, fromCount int, next *time.Time) (bool, error) {
+	t := m.templates[templateId]
+	if t.OccurrenceCount != fromCount {
+		return false, nil
+	}
+	t.OccurrenceCount = fromCount + 1
+	t.NextOccurrenceAt = next
+	t.FailureCount = 0
+	t.RetryAt = nil
+	m.templates[templateId] = t
+	return true, nil
+}
+
+func (m *memoryStore) DeferRecurringExpense(_ context.Context, templateId int, retryAt time.Time, _ string) error {
+	t := m.templates[templateId]
+	t.FailureCount++
+	t.RetryAt = &retryAt
+	m.templates[templateId] = t
+	return nil
+}
+
+// expenseStore records created expenses by idempotency key, optionally failing once after the insert to simulate a
+// crash between the creation of the expense and the advancement of the template
+type expenseStore struct {
+	byKey          map[string]int
+	failAfterWrite bool
+	// notInGroup - persons who cannot add expenses
+	notInGroup map[int]bool
+}
+
+func (m *expenseStore) CreateExpense(_ context.Context, _ expense.Expense, key string) (int, error) {
+	if _, ok := m.byKey[key]; !ok {
+		m.byKey[key] = len(m.byKey) + 1
+	}
+	if m.failAfterWrite {
+		m.failAfterWrite = false
+		return 0, errors.New("connection lost")
+	}
+	return m.byKey[key], nil
+}
+
+func (m *expenseStore) IsPersonInGroup(_ context.Context, _ int, personId int) (bool, error) {
+	return !m.notInGroup[personId], nil
+}
+
+func (m *expenseStore) GetExpenseByGroupId(_ context.Context, _ int) ([]expense.Expense, error) {
+	return nil, nil
+}
+
+func (m *expenseStore) GetExpensesByGroupIds(_ context.Context, _ []int) ([]expense.Expense, error) {
+	return nil, nil
+}
+
+func (m *expenseStore) GetExpenseById(_ context.Context, _ int) (expense.Expense, error) {
+	return expense.Expense{}, expense.ErrExpenseNotFound
+}
+
+func (m *expenseStore) DeleteExpense(_ context.Context, _ expense.Expense) error {
+	return nil
+}
+
+func TestMaterializeDueCreatesEachOccurrenceExactlyOnce(t *testing.T) {
+	ctx := context.Background()
+	es := &expenseStore{byKey: map[string]int{}, failAfterWrite: true}
+	s := NewService(&memoryStore{templates: map[int]Template{}}, expense.NewService(es))
+
+	_, err := s.CreateTemplate(ctx, Template{
+		AmountInCents: 80000,
+		PersonId:      1,
+		GroupId:       1,
+		Frequency:     Monthly,
+		StartDate:     date(2023, time.January, 1),
+	})
+	assert.NoError(t, err)
+
+	// the first attempt "crashes" after writing the expense: the template is not advanced
+	created, err := s.MaterializeDue(ctx, date(2023, time.January, 1))
+	assert.NoError(t, err)
+	assert.Equal(t, 0, created)
+
+	// the retry, after the backoff, finds the existing expense and advances the template
+	created, err = s.MaterializeDue(ctx, date(2023, time.January, 1).Add(DefaultSchedulerInterval))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, created)
+	assert.Len(t, es.byKey, 1)
+
+	// catching up after some downtime
+	created, err = s.MaterializeDue(ctx, date(2023, time.April, 15))
+	assert.NoError(t, err)
+	assert.Equal(t, 3, created)
+	assert.Len(t, es.byKey, 4)
+
+	// nothing due
+	created, err = s.MaterializeDue(ctx, date(2023, time.April, 30))
+	assert.NoError(t, err)
+	assert.Equal(t, 0, created)
+	assert.Len(t, es.byKey, 4)
+}
+
+func TestMaterializeDueStopsAtEndDate(t *testing.T) {
+	ctx := context.Background()
+	es := &expenseStore{byKey: map[string]int{}}
+	s := NewService(&memoryStore{templates: map[int]Template{}}, expense.NewService(es))
+
+	endDate := date(2023, time.January, 20)
+	tmpl, err := s.CreateTemplate(ctx, Template{
+		AmountInCents: 1000,
+		PersonId:      1,
+		GroupId:       1,
+		Frequency:     Weekly,
+		StartDate:     date(2023, time.January, 1),
+		EndDate:       &endDate,
+	})
+	assert.NoError(t, err)
+
+	created, err := s.MaterializeDue(ctx, date(2023, time.December, 31))
+	assert.NoError(t, err)
+	assert.Equal(t, 3, created)
+
+	stored, _ := s.store.GetRecurringExpenseById(ctx, tmpl.Id)
+	assert.Nil(t, stored.NextOccurrenceAt)
+}
+
+// TestMaterializeDueDefersFailingTemplates - templates that keep failing must not starve those due after them
+func TestMaterializeDueDefersFailingTemplates(t *testing.T) {
+	ctx := context.Background()
+	es := &expenseStore{byKey: map[string]int{}, notInGroup: map[int]bool{2: true}}
+	store := &memoryStore{templates: map[int]Template{}}
+	s := NewService(store, expense.NewService(es))
+
+	// the owner of these left the group
+	for i := 0; i < dueBatchSize+1; i++ {
+		_, err := s.CreateTemplate(ctx, Template{AmountInCents: 1000, PersonId: 2, GroupId: 1, Frequency: Monthly, StartDate: date(2023, time.January, 1)})
+		require.NoError(t, err)
+	}
+	valid, err := s.CreateTemplate(ctx, Template{AmountInCents: 1000, PersonId: 1, GroupId: 1, Frequency: Monthly, StartDate: date(2023, time.January, 2)})
+	require.NoError(t, err)
+
+	now := date(2023, time.January, 2)
+	created, err := s.MaterializeDue(ctx, now)
+	require.NoError(t, err)
+	assert.Equal(t, 1, created)
+	assert.Equal(t, 1, store.templates[valid.Id].OccurrenceCount)
+
+	failing := store.templates[1]
+	assert.Equal(t, 1, failing.FailureCount)
+	assert.Equal(t, now.Add(DefaultSchedulerInterval), *failing.RetryAt)
+
+	// not retried before the backoff
+	created, err = s.MaterializeDue(ctx, now.Add(DefaultSchedulerInterval/2))
+	require.NoError(t, err)
+	assert.Zero(t, created)
+	assert.Equal(t, 1, store.templates[1].FailureCount)
+
+	later := now.Add(DefaultSchedulerInterval)
+	_, err = s.MaterializeDue(ctx, later)
+	require.NoError(t, err)
+	assert.Equal(t, 2, store.templates[1].FailureCount)
+	assert.Equal(t, later.Add(2*DefaultSchedulerInterval), *store.templates[1].RetryAt, "the backoff doubles")
+
+	// the owner is back in the group
+	es.notInGroup = nil
+	created, err = s.MaterializeDue(ctx, later.Add(2*DefaultSchedulerInterval))
+	require.NoError(t, err)
+	assert.Equal(t, dueBatchSize+1, created)
+	assert.Zero(t, store.templates[1].FailureCount)
+	assert.Nil(t, store.templates[1].RetryAt)
+}
+
+func TestRetryDelay(t *testing.T) {
+	assert.Equal(t, DefaultSchedulerInterval, retryDelay(1))
+	assert.Equal(t, 4*DefaultSchedulerInterval, retryDelay(3))
+	assert.Equal(t, maxRetryDelay, retryDelay(100))
+}
+
+func TestCreateTemplateValidatesSchedule(t *testing.T) {
+	s := NewService(&memoryStore{templates: map[int]Template{}}, expense.Service{})
+
+	_, err := s.CreateTemplate(context.Background(), Template{AmountInCents: 100, Frequency: "daily", StartDate: date(2023, time.January, 1)})
+	assert.ErrorIs(t, err, ErrInvalidSchedule)
+
+	_, err = s.CreateTemplate(context.Background(), Template{AmountInCents: 100, Frequency: Weekly})
+	assert.ErrorIs(t, err, ErrInvalidSchedule)
+
+	_, err = s.CreateTemplate(context.Background(), Template{AmountInCents: -1, Frequency: Weekly, StartDate: date(2023, time.January, 1)})
+	assert.ErrorIs(t, err, ErrInvalidAmount)
+}
@@ -0,0 +1,87 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// ExporterNone - spans are not recorded, the default
+	ExporterNone = "none"
+	// ExporterOtlp - spans are sent over OTLP/HTTP, to the collector the OTEL_EXPORTER_OTLP_* variables point to
+	ExporterOtlp = "otlp"
+)
+
+// ServiceName - the name of the service in the spans, unless OTEL_SERVICE_NAME says otherwise
+const ServiceName = "splid-backend"
+
+type Config struct {
+	// Exporter - ExporterNone or ExporterOtlp
+	Exporter       string
+	ServiceVersion string
+}
+
+// Install makes tp the provider of the tracers of every package, and propagates the trace context and the baggage
+// in the W3C headers
+func Install(tp trace.TracerProvider) {
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+}
+
+// End ends span, recording err, if any, as the reason it failed. Services end their spans with
+// `defer func() { tracing.End(span, err) }()`, err being the named error result.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// NewProvider returns a provider exporting the spans to exporter in batches. Sampling follows the OTEL_TRACES_SAMPLER
+// variables, every trace by default.
+func NewProvider(ctx context.Context, exporter sdktrace.SpanExporter, config Config) (*sdktrace.TracerProvider, error) {
+	// the later options win: OTEL_SERVICE_NAME and OTEL_RESOURCE_ATTRIBUTES override the defaults
+	res, err := resource.New(ctx,
+		resource.WithSchemaURL(semconv.SchemaURL),
+		resource.WithAttributes(semconv.ServiceName(ServiceName), semconv.ServiceVersion(config.ServiceVersion)),
+		resource.WithTelemetrySDK(),
+		resource.WithHost(),
+		resource.WithFromEnv(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter), sdktrace.WithResource(res)), nil
+}
+
+// Setup installs the provider of config.Exporter. The W3C headers are read even when spans are not recorded, so that
+// the logs report the trace of the caller. shutdown flushes the spans not exported yet.
+func Setup(ctx context.Context, config Config) (shutdown func(ctx context.Context) error, err error) {
+	switch config.Exporter {
+	case "", ExporterNone:
+		Install(trace.NewNoopTracerProvider())
+		return func(context.Context) error { return nil }, nil
+	case ExporterOtlp:
+		exporter, err := otlptracehttp.New(ctx)
+		if err != nil {
+			return nil, err
+		}
+		tp, err := NewProvider(ctx, exporter, config)
+		if err != nil {
+			return nil, err
+		}
+		Install(tp)
+		return tp.Shutdown, nil
+	default:
+		return nil, fmt.Errorf("unknown exporter %q", config.Exporter)
+	}
+}
@@ -0,0 +1,93 @@
+//go:build unit
+
+package tracing
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+	"net/http"
+	"testing"
+)
+
+func TestSetup(t *testing.T) {
+	shutdown, err := Setup(context.Background(), Config{})
+	require.NoError(t, err)
+	assert.NoError(t, shutdown(context.Background()))
+
+	_, err = Setup(context.Background(), Config{Exporter: "jaeger"})
+	assert.Error(t, err)
+}
+
+func TestNewProvider(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	tp, err := NewProvider(context.Background(), exporter, Config{ServiceVersion: "abc123"})
+	require.NoError(t, err)
+
+	_, span := tp.Tracer("test").Start(context.Background(), "work")
+	span.End()
+	require.NoError(t, tp.ForceFlush(context.Background()))
+
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 1)
+	assert.Equal(t, "work", spans[0].Name)
+	attrs := spans[0].Resource.Set()
+	name, _ := attrs.Value(semconv.ServiceNameKey)
+	assert.Equal(t, ServiceName, name.AsString())
+	version, _ := attrs.Value(semconv.ServiceVersionKey)
+	assert.Equal(t, "abc123", version.AsString())
+}
+
+func TestEnd(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	tp, err := NewProvider(context.Background(), exporter, Config{})
+	require.NoError(t, err)
+
+	_, span := tp.Tracer("test").Start(context.Background(), "work")
+	End(span, nil)
+	_, span = tp.Tracer("test").Start(context.Background(), "failing work")
+	End(span, errors.New("broken"))
+	require.NoError(t, tp.ForceFlush(context.Background()))
+
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 2)
+	assert.Equal(t, codes.Unset, spans[0].Status.Code)
+	assert.Empty(t, spans[0].Events)
+	assert.Equal(t, codes.Error, spans[1].Status.Code)
+	assert.Equal(t, "broken", spans[1].Status.Description)
+	require.Len(t, spans[1].Events, 1)
+	assert.Equal(t, "exception", spans[1].Events[0].Name)
+}
+
+func TestNewProviderServiceNameFromEnv(t *testing.T) {
+	t.Setenv("OTEL_SERVICE_NAME", "splid-staging")
+	exporter := tracetest.NewInMemoryExporter()
+	tp, err := NewProvider(context.Background(), exporter, Config{})
+	require.NoError(t, err)
+	_, span := tp.Tracer("test").Start(context.Background(), "work")
+	span.End()
+	require.NoError(t, tp.ForceFlush(context.Background()))
+
+	name, _ := exporter.GetSpans()[0].Resource.Set().Value(semconv.ServiceNameKey)
+	assert.Equal(t, "splid-staging", name.AsString())
+}
+
+func TestInstallPropagatesW3CTraceContext(t *testing.T) {
+	Install(trace.NewNoopTracerProvider())
+
+	header := http.Header{}
+	header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	ctx := otel.GetTextMapPropagator().Extract(context.Background(), propagation.HeaderCarrier(header))
+
+	span := trace.SpanContextFromContext(ctx)
+	require.True(t, span.IsValid())
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", span.TraceID().String())
+	assert.True(t, span.IsRemote())
+}
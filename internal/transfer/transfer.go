@@ -3,8 +3,13 @@ package transfer
 import (
 	"context"
 	"fmt"
+	"github.com/antoniobelotti/splid_backend_clone/internal/apperror"
+	"github.com/antoniobelotti/splid_backend_clone/internal/tracing"
+	"go.opentelemetry.io/otel"
 )
 
+var tracer = otel.Tracer("github.com/antoniobelotti/splid_backend_clone/internal/transfer")
+
 type Transfer struct {
 	Id            int `json:"id,omitempty" db:"id"`
 	AmountInCents int `json:"amount-in-cents" db:"amount_in_cents"`
@@ -17,8 +22,17 @@ type Store interface {
 	CreateTransfer(ctx context.Context, amountInCents int, groupId int, senderId int, receiverId int) (int, error)
 	IsPersonInGroup(ctx context.Context, groupId int, personId int) (bool, error)
 	GetTransfersByGroupId(ctx context.Context, groupId int) ([]Transfer, error)
+	// GetTransfersByGroupIds returns the transfers of all the groups, most recent first
+	GetTransfersByGroupIds(ctx context.Context, groupIds []int) ([]Transfer, error)
 }
 
+var (
+	ErrPersonNotInGroup   = apperror.New(apperror.Forbidden, "person_not_in_group", "person does not belong to the group")
+	ErrInvalidAmount      = apperror.NewInvalidField("amount-in-cents", "invalid_amount", "amount must be positive")
+	ErrReceiverNotInGroup = apperror.NewInvalidField("receiver-id", "receiver_not_in_group", "the receiver does not belong to the group")
+	ErrUnexpected         = apperror.New(apperror.Internal, "unexpected_error", "unexpected error")
+)
+
 type Service struct {
 	store Store
 }
@@ -27,17 +41,26 @@ func NewService(store Store) Service {
 	return Service{store: store}
 }
 
-func (s *Service) CreateTransfer(ctx context.Context, amountInCents int, groupId int, senderId int, receiverId int) (Transfer, error) {
+func (s *Service) CreateTransfer(ctx context.Context, amountInCents int, groupId int, senderId int, receiverId int) (_ Transfer, err error) {
+	ctx, span := tracer.Start(ctx, "transfer.CreateTransfer")
+	defer func() { tracing.End(span, err) }()
+
+	if amountInCents <= 0 {
+		return Transfer{}, ErrInvalidAmount
+	}
 	isSenderInGroup, err := s.store.IsPersonInGroup(ctx, groupId, senderId)
 	if err != nil {
-		return Transfer{}, fmt.Errorf("unexpected error: %w", err)
+		return Transfer{}, fmt.Errorf("%w %w", ErrUnexpected, err)
+	}
+	if !isSenderInGroup {
+		return Transfer{}, fmt.Errorf("sender %d does not belong to group %d: %w", senderId, groupId, ErrPersonNotInGroup)
 	}
 	isReceiverInGroup, err := s.store.IsPersonInGroup(ctx, groupId, receiverId)
 	if err != nil {
-		return Transfer{}, fmt.Errorf("unexpected error: %w", err)
+		return Transfer{}, fmt.Errorf("%w %w", ErrUnexpected, err)
 	}
-	if !isSenderInGroup || !isReceiverInGroup {
-		return Transfer{}, fmt.Errorf("either sender of receiver do not belong to group %d: %w", groupId, err)
+	if !isReceiverInGroup {
+		return Transfer{}, fmt.Errorf("%w: person %d is not a member of group %d", ErrReceiverNotInGroup, receiverId, groupId)
 	}
 
 	e := Transfer{
@@ -48,13 +71,27 @@ func (s *Service) CreateTransfer(ctx context.Context, amountInCents int, groupId
 	}
 	id, err := s.store.CreateTransfer(ctx, amountInCents, groupId, senderId, receiverId)
 	if err != nil {
-		return Transfer{}, fmt.Errorf("unable to create Transfer: %w", err)
+		return Transfer{}, fmt.Errorf("%w unable to create Transfer: %w", ErrUnexpected, err)
 	}
 	e.Id = id
 
 	return e, nil
 }
 
-func (s *Service) GetTransfersByGroupId(ctx context.Context, groupId int) ([]Transfer, error) {
+func (s *Service) GetTransfersByGroupId(ctx context.Context, groupId int) (_ []Transfer, err error) {
+	ctx, span := tracer.Start(ctx, "transfer.GetTransfersByGroupId")
+	defer func() { tracing.End(span, err) }()
+
 	return s.store.GetTransfersByGroupId(ctx, groupId)
 }
+
+func (s *Service) GetTransfersByGroupIds(ctx context.Context, groupIds []int) (_ []Transfer, err error) {
+	ctx, span := tracer.Start(ctx, "transfer.GetTransfersByGroupIds")
+	defer func() { tracing.End(span, err) }()
+
+	transfers, err := s.store.GetTransfersByGroupIds(ctx, groupIds)
+	if err != nil {
+		return nil, fmt.Errorf("%w %w", ErrUnexpected, err)
+	}
+	return transfers, nil
+}
@@ -0,0 +1,12 @@
+CREATE TABLE outbox_event
+(
+    id            SERIAL PRIMARY KEY,
+    event_type    TEXT        NOT NULL,
+    payload       JSONB       NOT NULL,
+    created_at    TIMESTAMPTZ NOT NULL DEFAULT now(),
+    dispatched_at TIMESTAMPTZ,
+    attempts      INT         NOT NULL DEFAULT 0,
+    last_error    TEXT
+);
+
+CREATE INDEX outbox_event_pending_idx ON outbox_event (id) WHERE dispatched_at IS NULL;
\ No newline at end of file
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS recurring_expense;
+
+ALTER TABLE expense
+DROP COLUMN idempotency_key;
\ No newline at end of file
@@ -0,0 +1,19 @@
+ALTER TABLE expense
+ADD COLUMN idempotency_key TEXT UNIQUE;
+
+CREATE TABLE recurring_expense
+(
+    id                 SERIAL PRIMARY KEY,
+    amount_in_cents    INT  NOT NULL,
+    person_id          INT  NOT NULL REFERENCES person (id),
+    group_id           INT  NOT NULL REFERENCES "group" (id),
+    frequency          TEXT NOT NULL,
+    interval_count     INT  NOT NULL DEFAULT 1,
+    day_of_month       INT  NOT NULL DEFAULT 0,
+    start_date         DATE NOT NULL,
+    end_date           DATE,
+    occurrence_count   INT  NOT NULL DEFAULT 0,
+    next_occurrence_at DATE
+);
+
+CREATE INDEX recurring_expense_due_idx ON recurring_expense (next_occurrence_at) WHERE next_occurrence_at IS NOT NULL;
\ No newline at end of file
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS expense_item_consumer;
+DROP TABLE IF EXISTS expense_item;
+DROP TABLE IF EXISTS expense_itemization;
\ No newline at end of file
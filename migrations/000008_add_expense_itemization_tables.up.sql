@@ -0,0 +1,25 @@
+CREATE TABLE expense_itemization
+(
+    expense_id   INT PRIMARY KEY REFERENCES expense (id),
+    tax_in_cents INT  NOT NULL DEFAULT 0,
+    tip_in_cents INT  NOT NULL DEFAULT 0,
+    tax_rule     TEXT NOT NULL,
+    tip_rule     TEXT NOT NULL
+);
+
+CREATE TABLE expense_item
+(
+    id                  SERIAL PRIMARY KEY,
+    expense_id          INT  NOT NULL REFERENCES expense (id),
+    position            INT  NOT NULL,
+    description         TEXT NOT NULL,
+    unit_price_in_cents INT  NOT NULL,
+    quantity            INT  NOT NULL
+);
+
+CREATE TABLE expense_item_consumer
+(
+    item_id   INT NOT NULL REFERENCES expense_item (id),
+    person_id INT NOT NULL REFERENCES person (id),
+    PRIMARY KEY (item_id, person_id)
+);
\ No newline at end of file
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS expense_payer;
\ No newline at end of file
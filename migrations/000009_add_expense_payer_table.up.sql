@@ -0,0 +1,7 @@
+CREATE TABLE expense_payer
+(
+    expense_id      INT NOT NULL REFERENCES expense (id),
+    person_id       INT NOT NULL REFERENCES person (id),
+    amount_in_cents INT NOT NULL,
+    PRIMARY KEY (expense_id, person_id)
+);
\ No newline at end of file
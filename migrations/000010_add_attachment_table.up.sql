@@ -0,0 +1,16 @@
+-- expense_id has no foreign key: attachments of deleted expenses are removed asynchronously,
+-- after the expense.deleted event is dispatched
+CREATE TABLE attachment
+(
+    id            SERIAL PRIMARY KEY,
+    expense_id    INT         NOT NULL,
+    uploader_id   INT         NOT NULL REFERENCES person (id),
+    file_name     TEXT        NOT NULL,
+    content_type  TEXT        NOT NULL,
+    size_in_bytes BIGINT      NOT NULL,
+    blob_key      TEXT        NOT NULL UNIQUE,
+    thumbnail_key TEXT,
+    created_at    TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX attachment_expense_id_idx ON attachment (expense_id);
\ No newline at end of file
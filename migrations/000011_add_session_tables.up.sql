@@ -0,0 +1,18 @@
+CREATE TABLE session
+(
+    id         TEXT PRIMARY KEY,
+    person_id  INT         NOT NULL REFERENCES person (id),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    revoked_at TIMESTAMPTZ
+);
+
+CREATE INDEX session_person_id_idx ON session (person_id);
+
+CREATE TABLE refresh_token
+(
+    token_hash TEXT PRIMARY KEY,
+    session_id TEXT        NOT NULL REFERENCES session (id),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    expires_at TIMESTAMPTZ NOT NULL,
+    used_at    TIMESTAMPTZ
+);
\ No newline at end of file
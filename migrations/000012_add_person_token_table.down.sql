@@ -0,0 +1 @@
+DROP TABLE IF EXISTS person_token;
\ No newline at end of file
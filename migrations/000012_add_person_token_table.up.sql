@@ -0,0 +1,11 @@
+CREATE TABLE person_token
+(
+    token_hash TEXT PRIMARY KEY,
+    person_id  INT         NOT NULL REFERENCES person (id),
+    purpose    TEXT        NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    expires_at TIMESTAMPTZ NOT NULL,
+    used_at    TIMESTAMPTZ
+);
+
+CREATE INDEX person_token_person_id_purpose_idx ON person_token (person_id, purpose);
\ No newline at end of file
@@ -0,0 +1,2 @@
+ALTER TABLE person
+    DROP COLUMN IF EXISTS email_verified_at;
\ No newline at end of file
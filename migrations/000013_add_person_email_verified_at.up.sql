@@ -0,0 +1,2 @@
+ALTER TABLE person
+    ADD COLUMN email_verified_at TIMESTAMPTZ;
\ No newline at end of file
@@ -0,0 +1,2 @@
+ALTER TABLE person
+    DROP COLUMN IF EXISTS deleted_at;
\ No newline at end of file
@@ -0,0 +1,2 @@
+ALTER TABLE person
+    ADD COLUMN deleted_at TIMESTAMPTZ;
\ No newline at end of file
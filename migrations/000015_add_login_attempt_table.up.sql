@@ -0,0 +1,12 @@
+CREATE TABLE login_attempt
+(
+    id         SERIAL PRIMARY KEY,
+    email      TEXT        NOT NULL,
+    ip         TEXT        NOT NULL,
+    user_agent TEXT        NOT NULL DEFAULT '',
+    succeeded  BOOLEAN     NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX login_attempt_email_idx ON login_attempt (email, created_at);
+CREATE INDEX login_attempt_ip_idx ON login_attempt (ip, created_at);
\ No newline at end of file
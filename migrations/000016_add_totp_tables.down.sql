@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS totp_recovery_code;
+DROP TABLE IF EXISTS person_totp;
\ No newline at end of file
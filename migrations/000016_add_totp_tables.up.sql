@@ -0,0 +1,16 @@
+CREATE TABLE person_totp
+(
+    person_id      INT PRIMARY KEY REFERENCES person (id),
+    secret         TEXT   NOT NULL,
+    enabled_at     TIMESTAMPTZ,
+    last_used_step BIGINT NOT NULL DEFAULT 0
+);
+
+CREATE TABLE totp_recovery_code
+(
+    code_hash TEXT PRIMARY KEY,
+    person_id INT NOT NULL REFERENCES person (id),
+    used_at   TIMESTAMPTZ
+);
+
+CREATE INDEX totp_recovery_code_person_id_idx ON totp_recovery_code (person_id);
\ No newline at end of file
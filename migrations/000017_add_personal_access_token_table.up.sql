@@ -0,0 +1,15 @@
+CREATE TABLE personal_access_token
+(
+    id           SERIAL PRIMARY KEY,
+    person_id    INT         NOT NULL REFERENCES person (id),
+    name         TEXT        NOT NULL,
+    token_hash   TEXT        NOT NULL UNIQUE,
+    scopes       TEXT[]      NOT NULL,
+    group_ids    INT[]       NOT NULL DEFAULT '{}',
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT now(),
+    expires_at   TIMESTAMPTZ,
+    last_used_at TIMESTAMPTZ,
+    revoked_at   TIMESTAMPTZ
+);
+
+CREATE INDEX personal_access_token_person_id_idx ON personal_access_token (person_id);
\ No newline at end of file
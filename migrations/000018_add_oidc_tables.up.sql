@@ -0,0 +1,20 @@
+CREATE TABLE external_identity
+(
+    provider   TEXT        NOT NULL,
+    subject    TEXT        NOT NULL,
+    person_id  INT         NOT NULL REFERENCES person (id),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (provider, subject)
+);
+
+CREATE INDEX external_identity_person_id_idx ON external_identity (person_id);
+
+CREATE TABLE oidc_login_state
+(
+    state_hash    TEXT PRIMARY KEY,
+    provider      TEXT        NOT NULL,
+    code_verifier TEXT        NOT NULL,
+    nonce         TEXT        NOT NULL,
+    created_at    TIMESTAMPTZ NOT NULL DEFAULT now(),
+    expires_at    TIMESTAMPTZ NOT NULL
+);
\ No newline at end of file
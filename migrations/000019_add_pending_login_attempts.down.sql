@@ -0,0 +1,4 @@
+DELETE FROM login_attempt WHERE succeeded IS NULL;
+
+ALTER TABLE login_attempt
+ALTER COLUMN succeeded SET NOT NULL;
@@ -0,0 +1,3 @@
+-- a NULL outcome is an attempt still being verified, which counts as a failure meanwhile
+ALTER TABLE login_attempt
+ALTER COLUMN succeeded DROP NOT NULL;
@@ -0,0 +1,2 @@
+DROP TABLE outbox_delivery;
+ALTER TABLE outbox_event DROP COLUMN claimed_until;
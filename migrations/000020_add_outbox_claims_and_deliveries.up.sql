@@ -0,0 +1,11 @@
+-- a dispatcher claims the events it delivers until claimed_until, so that the other instances skip them
+ALTER TABLE outbox_event ADD COLUMN claimed_until TIMESTAMPTZ;
+
+-- the handlers a failed event was already delivered to: its retries only call the others
+CREATE TABLE outbox_delivery
+(
+    event_id     INT         NOT NULL REFERENCES outbox_event (id) ON DELETE CASCADE,
+    handler      TEXT        NOT NULL,
+    delivered_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (event_id, handler)
+);
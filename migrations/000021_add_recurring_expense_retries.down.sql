@@ -0,0 +1,4 @@
+ALTER TABLE recurring_expense
+    DROP COLUMN failure_count,
+    DROP COLUMN retry_at,
+    DROP COLUMN last_error;
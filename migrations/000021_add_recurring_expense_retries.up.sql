@@ -0,0 +1,6 @@
+-- a template whose occurrence cannot be created is retried with a backoff, not before retry_at, so that it does not
+-- hold back the ones behind it
+ALTER TABLE recurring_expense
+    ADD COLUMN failure_count INT NOT NULL DEFAULT 0,
+    ADD COLUMN retry_at      TIMESTAMPTZ,
+    ADD COLUMN last_error    TEXT;
@@ -0,0 +1,27 @@
+// Package migrations embeds the SQL migrations, so that the binary knows which schema version it expects
+package migrations
+
+import (
+	"embed"
+	"io/fs"
+	"strconv"
+	"strings"
+)
+
+//go:embed *.sql
+var FS embed.FS
+
+// LatestVersion - the version of the newest migration, the one the database must be at for this build
+func LatestVersion() uint {
+	entries, _ := fs.ReadDir(FS, ".")
+	var latest uint
+	for _, entry := range entries {
+		// golang-migrate names the files <version>_<title>.<up|down>.sql
+		prefix, _, _ := strings.Cut(entry.Name(), "_")
+		version, err := strconv.ParseUint(prefix, 10, 64)
+		if err == nil && uint(version) > latest {
+			latest = uint(version)
+		}
+	}
+	return latest
+}